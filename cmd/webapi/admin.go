@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ardanlabs/conf"
+	"github.com/gofrs/uuid"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/sirupsen/logrus"
+)
+
+// runAdmin implements the admin subcommand, which manages the admin role of users stored in the database:
+//
+//	webapi admin grant [-db FILE] USERNAME
+//	webapi admin revoke [-db FILE] USERNAME
+//	webapi admin list [-db FILE]
+//
+// Grants and revocations are recorded in the audit log without an admin, as done from the command line. Admins of the
+// configuration (Admin.Users) are not listed and can't be revoked here.
+func runAdmin() error {
+	cfg, err := loadConfiguration(nil)
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			return nil
+		}
+		return err
+	}
+
+	fs := flag.NewFlagSet("admin", flag.ContinueOnError)
+	dbFilename := fs.String("db", cfg.DB.Filename, "database file")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "usage: webapi admin grant|revoke|list [-db FILE] [USERNAME]")
+		fs.PrintDefaults()
+	}
+	if len(os.Args) < 3 {
+		fs.Usage()
+		return errors.New("a command is required")
+	}
+	command := os.Args[2]
+	if err := fs.Parse(os.Args[3:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	switch command {
+	case "grant", "revoke":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return fmt.Errorf("%s requires exactly one USERNAME", command)
+		}
+	case "list":
+		if fs.NArg() != 0 {
+			fs.Usage()
+			return errors.New("list takes no arguments")
+		}
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+	logger.SetLevel(logrus.WarnLevel)
+	if cfg.Debug {
+		logger.SetLevel(logrus.DebugLevel)
+	}
+
+	dbconn, db, err := openDatabase(*dbFilename, logger)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dbconn.Close()
+	}()
+
+	if command == "list" {
+		ids, err := db.GetAdminIDs()
+		if err != nil {
+			return fmt.Errorf("loading admins: %w", err)
+		}
+		for _, id := range ids {
+			user, err := db.GetUserByID(id)
+			if err != nil {
+				return fmt.Errorf("loading user: %w", err)
+			}
+			if user != nil {
+				fmt.Printf("%s %s\n", user.Name, user.ID) //nolint:forbidigo
+			}
+		}
+		return nil
+	}
+
+	username := fs.Arg(0)
+	user, err := db.GetUserByName(username)
+	if err != nil {
+		return fmt.Errorf("loading user: %w", err)
+	}
+	if user == nil {
+		return fmt.Errorf("user %q not found", username)
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return fmt.Errorf("generating ID: %w", err)
+	}
+	details := `{"via":"cli"}`
+	audit := database.AuditEntry{
+		ID:         id.String(),
+		Action:     "admin." + command,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Details:    &details,
+		CreatedAt:  globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if err := db.SetAdmin(user.ID, command == "grant", audit); err != nil {
+		return fmt.Errorf("updating admin role: %w", err)
+	}
+
+	fmt.Printf("%s %s: %s\n", command, username, user.ID) //nolint:forbidigo
+	return nil
+}
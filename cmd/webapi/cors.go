@@ -16,6 +16,8 @@ func applyCORSHandler(h http.Handler) http.Handler {
 			"Content-Type",
 		}),
 		handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS", "DELETE", "PUT"}),
+		// Lets the web UI read how long to wait after a 429 response, and the ID of failed requests
+		handlers.ExposedHeaders([]string{"Retry-After", "X-Request-Id"}),
 		// Do not modify the CORS origin and max age, they are used in the evaluation.
 		handlers.AllowedOrigins([]string{"*"}),
 		handlers.MaxAge(1),
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/conf"
+	"github.com/ozberk-sevinc/wasa-project/service/chatimport"
+	"github.com/sirupsen/logrus"
+)
+
+// senderFlags collects repeated -sender "Exported name=username" flags
+type senderFlags map[string]string
+
+func (s senderFlags) String() string {
+	pairs := make([]string, 0, len(s))
+	for name, username := range s {
+		pairs = append(pairs, name+"="+username)
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func (s senderFlags) Set(value string) error {
+	name, username, ok := strings.Cut(value, "=")
+	if !ok || name == "" || username == "" {
+		return errors.New(`expected "exported name=username"`)
+	}
+	s[name] = username
+	return nil
+}
+
+// runImport implements the import subcommand, which adds the messages of a chat export to an existing conversation:
+//
+//	webapi import -conversation ID -user USERNAME [-format whatsapp|json] [-date-order dmy|mdy] [-timezone ZONE]
+//	    [-sender "Exported name=username" ...] [-db FILE] FILE
+//
+// The database is the one of the web server configuration (environment variables and configuration file), unless -db
+// is given. The importing user must be a participant of the conversation, like with the HTTP endpoint.
+func runImport() error {
+	cfg, err := loadConfiguration(nil)
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			return nil
+		}
+		return err
+	}
+
+	senders := make(senderFlags)
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	conversationID := fs.String("conversation", "", "ID of the conversation to import into")
+	username := fs.String("user", "", "username of the participant running the import")
+	formatName := fs.String("format", "", "format of FILE: whatsapp or json (default: from the file extension)")
+	dateOrder := fs.String("date-order", "", "order of day and month in WhatsApp dates: dmy or mdy (default: guessed)")
+	timezone := fs.String("timezone", "UTC", "time zone of WhatsApp timestamps")
+	dbFilename := fs.String("db", cfg.DB.Filename, "database file")
+	fs.Var(senders, "sender", `map an exported sender to a participant, as "exported name=username" (repeatable)`)
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *conversationID == "" || *username == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("-conversation, -user and exactly one FILE are required")
+	}
+	fileName := fs.Arg(0)
+
+	if *formatName == "" {
+		*formatName = string(chatimport.FormatWhatsApp)
+		if strings.EqualFold(filepath.Ext(fileName), ".json") {
+			*formatName = string(chatimport.FormatJSON)
+		}
+	}
+	format, err := chatimport.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	order, err := chatimport.ParseDateOrder(*dateOrder)
+	if err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return fmt.Errorf("loading time zone: %w", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+	logger.SetLevel(logrus.WarnLevel)
+	if cfg.Debug {
+		logger.SetLevel(logrus.DebugLevel)
+	}
+
+	dbconn, db, err := openDatabase(*dbFilename, logger)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dbconn.Close()
+	}()
+
+	user, err := db.GetUserByName(*username)
+	if err != nil {
+		return fmt.Errorf("loading user: %w", err)
+	}
+	if user == nil {
+		return fmt.Errorf("user %q not found", *username)
+	}
+	conv, err := db.GetConversationByID(*conversationID)
+	if err != nil {
+		return fmt.Errorf("loading conversation: %w", err)
+	}
+	if conv == nil {
+		return fmt.Errorf("conversation %q not found", *conversationID)
+	}
+	isParticipant, err := db.IsParticipant(conv.ID, user.ID)
+	if err != nil {
+		return fmt.Errorf("checking participation: %w", err)
+	}
+	if !isParticipant {
+		return fmt.Errorf("%q is not a participant of the conversation", *username)
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	result, err := chatimport.Import(db, f, chatimport.Request{
+		ConversationID: conv.ID,
+		Options: chatimport.Options{
+			Format:    format,
+			DateOrder: order,
+			Location:  loc,
+		},
+		Senders:   senders,
+		KeepPhoto: chatimport.LocalPhotos(conv.ID, "./uploads"),
+	})
+	if err != nil {
+		return fmt.Errorf("importing %s: %w", fileName, err)
+	}
+
+	fmt.Printf("imported %d messages, skipped %d already imported\n", result.Imported, result.Skipped) //nolint:forbidigo
+	for _, s := range result.Senders {
+		kind := "participant"
+		if s.Placeholder {
+			kind = "placeholder"
+		}
+		fmt.Printf("  %s -> %s (%s)\n", s.Name, s.UserID, kind) //nolint:forbidigo
+	}
+	return nil
+}
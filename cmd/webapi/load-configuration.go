@@ -27,18 +27,83 @@ type WebAPIConfiguration struct {
 	DB    struct {
 		Filename string `conf:"default:./data/wasatext.db"`
 	}
+	Accounts struct {
+		// DeletionPolicy is what happens to the messages of deleted accounts: anonymize or delete
+		DeletionPolicy string `conf:"default:anonymize"`
+	}
+	LinkPreviews struct {
+		Enabled bool          `conf:"default:true"`
+		Timeout time.Duration `conf:"default:5s"`
+		// AllowedNetworks is a comma-separated list of non-public networks whose pages may be previewed, like
+		// 127.0.0.0/8 for a local test server. Other loopback and private addresses are always refused.
+		AllowedNetworks string
+	}
+	Push struct {
+		Enabled bool `conf:"default:true"`
+		// VAPIDKeyFile holds the key identifying this server to push services; it is created if missing. Changing
+		// the key invalidates every push subscription.
+		VAPIDKeyFile string `conf:"default:./data/vapid-key.pem"`
+		// Subject is a mailto: or https: URL where push services can contact the operator
+		Subject string `conf:"default:mailto:admin@wasatext.invalid"`
+		// AllowedNetworks is a comma-separated list of non-public networks push services may be in, like
+		// 127.0.0.0/8 for a local test push service
+		AllowedNetworks string
+	}
+	Mail struct {
+		// Host is the SMTP server sending the emails; emails (and so digests) are disabled when it is empty
+		Host     string
+		Port     int `conf:"default:587"`
+		Username string
+		Password string `conf:"noprint"`
+		From     string `conf:"default:WASAText <noreply@wasatext.invalid>"`
+	}
+	RateLimit struct {
+		Enabled bool `conf:"default:true"`
+		// Backend keeps the rate limits: memory, or database to share them between the replicas using the same
+		// database
+		Backend string `conf:"default:memory"`
+		// ProxyHeader is the header where a reverse proxy puts the address of the client, like X-Forwarded-For. Only
+		// set it when clients can't bypass the proxy, or they can choose their address.
+		ProxyHeader string
+		// Login, Message, Upload and Search are the limits per user and per client address of each kind of request,
+		// like "user=60/1m ip=300/1m" for 60 requests a minute per user and 300 per address. Limits left out are off.
+		Login   string `conf:"default:ip=20/10m"`
+		Message string `conf:"default:user=60/1m ip=300/1m"`
+		Upload  string `conf:"default:user=20/1m ip=60/1m"`
+		Search  string `conf:"default:user=60/1m ip=300/1m"`
+	}
+	Limits struct {
+		// The maximum lengths, in characters, of the texts users send
+		MessageText  int `conf:"default:4096"`
+		GroupName    int `conf:"default:100"`
+		PollQuestion int `conf:"default:300"`
+		PollOption   int `conf:"default:100"`
+	}
+	Admin struct {
+		// Users is a comma-separated list of the IDs of users who are server admins, in addition to the ones granted the role
+		// with the admin subcommand. They can't be suspended or banned through the API.
+		Users string
+	}
+	Digest struct {
+		// SecretFile holds the key signing unsubscribe links; it is created if missing
+		SecretFile string `conf:"default:./data/digest-secret"`
+		// PublicURL is the address of this API in emails, and WebUIURL the one of the web UI
+		PublicURL string `conf:"default:http://localhost:3000"`
+		WebUIURL  string `conf:"default:http://localhost:5173"`
+	}
 }
 
 // loadConfiguration creates a WebAPIConfiguration starting from flags, environment variables and configuration file.
 // It works by loading environment variables first, then update the config using command line flags, finally loading the
 // configuration file (specified in WebAPIConfiguration.Config.Path).
 // So, CLI parameters will override the environment, and configuration file will override everything.
-// Note that the configuration file can be specified only via CLI or environment variable.
-func loadConfiguration() (WebAPIConfiguration, error) {
+// Note that the configuration file can be specified only via CLI or environment variable. `args` are the command line
+// arguments, without the program name.
+func loadConfiguration(args []string) (WebAPIConfiguration, error) {
 	var cfg WebAPIConfiguration
 
 	// Try to load configuration from environment variables and command line switches
-	if err := conf.Parse(os.Args[1:], "CFG", &cfg); err != nil {
+	if err := conf.Parse(args, "CFG", &cfg); err != nil {
 		if errors.Is(err, conf.ErrHelpWanted) {
 			usage, err := conf.Usage("CFG", &cfg)
 			if err != nil {
@@ -7,6 +7,8 @@ Everything is served via the API web server, except debug variables (/debug/vars
 Usage:
 
 	webapi [flags]
+	webapi import [import flags] FILE
+	webapi admin grant|revoke|list [-db FILE] [USERNAME]
 
 Flags and configurations are handled automatically by the code in `load-configuration.go`.
 
@@ -18,6 +20,9 @@ Return values (exit codes):
 	> 0
 		The program ended due to an error
 
+The import subcommand adds the messages of a chat export to an existing conversation and exits; see `import.go`.
+The admin subcommand grants, revokes or lists the admin role of users and exits; see `admin.go`.
+
 Note that this program will update the schema of the database to the latest version available (embedded in the
 executable during the build).
 */
@@ -29,22 +34,40 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/ardanlabs/conf"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/ozberk-sevinc/wasa-project/service/api"
 	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/digest"
+	"github.com/ozberk-sevinc/wasa-project/service/linkpreview"
+	"github.com/ozberk-sevinc/wasa-project/service/mailer"
+	"github.com/ozberk-sevinc/wasa-project/service/ratelimit"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+	"github.com/ozberk-sevinc/wasa-project/service/webpush"
 	"github.com/sirupsen/logrus"
 )
 
 // main is the program entry point. The only purpose of this function is to call run() and set the exit code if there is
 // any error
 func main() {
-	if err := run(); err != nil {
+	command := run
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			command = runImport
+		case "admin":
+			command = runAdmin
+		}
+	}
+	if err := command(); err != nil {
 		_, _ = fmt.Fprintln(os.Stderr, "error: ", err)
 		os.Exit(1)
 	}
@@ -61,7 +84,7 @@ func main() {
 func run() error {
 	// Note: rand.Seed() removed - Go 1.20+ auto-seeds the global random source
 	// Load Configuration and defaults
-	cfg, err := loadConfiguration()
+	cfg, err := loadConfiguration(os.Args[1:])
 	if err != nil {
 		if errors.Is(err, conf.ErrHelpWanted) {
 			return nil
@@ -83,36 +106,15 @@ func run() error {
 	// Start Database
 	logger.Println("initializing database support")
 
-	// Ensure the directory for the database file exists
-	if dir := filepath.Dir(cfg.DB.Filename); dir != "" && dir != "." {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			logger.WithError(err).Error("error creating database directory")
-			return fmt.Errorf("creating database directory %s: %w", dir, err)
-		}
-	}
-
-	dbconn, err := sql.Open("sqlite3", cfg.DB.Filename)
+	dbconn, db, err := openDatabase(cfg.DB.Filename, logger)
 	if err != nil {
-		logger.WithError(err).Error("error opening SQLite DB")
-		return fmt.Errorf("opening SQLite: %w", err)
+		return err
 	}
 	defer func() {
 		logger.Debug("database stopping")
 		_ = dbconn.Close()
 	}()
 
-	// Configure connection pool for SQLite
-	// SQLite supports multiple concurrent readers, only writers are serialized
-	dbconn.SetMaxOpenConns(5)
-	dbconn.SetMaxIdleConns(2)
-	dbconn.SetConnMaxLifetime(0)
-
-	db, err := database.New(dbconn)
-	if err != nil {
-		logger.WithError(err).Error("error creating AppDatabase")
-		return fmt.Errorf("creating AppDatabase: %w", err)
-	}
-
 	// Start (main) API server
 	logger.Info("initializing API server")
 
@@ -125,10 +127,59 @@ func run() error {
 	// buffered channel so the goroutine can exit if we don't collect this error.
 	serverErrors := make(chan error, 1)
 
+	var linkPreviews *linkpreview.Fetcher
+	if cfg.LinkPreviews.Enabled {
+		linkPreviews, err = newLinkPreviewFetcher(cfg)
+		if err != nil {
+			logger.WithError(err).Error("error configuring link previews")
+			return err
+		}
+	}
+
+	var push *webpush.Sender
+	if cfg.Push.Enabled {
+		push, err = newPushSender(cfg)
+		if err != nil {
+			logger.WithError(err).Error("error configuring push notifications")
+			return err
+		}
+	}
+
+	var mail mailer.Mailer
+	var digestSecret []byte
+	if cfg.Mail.Host != "" {
+		mail, digestSecret, err = newDigestMailer(cfg)
+		if err != nil {
+			logger.WithError(err).Error("error configuring email digests")
+			return err
+		}
+	}
+
+	rateLimits, err := newRateLimits(cfg, db)
+	if err != nil {
+		logger.WithError(err).Error("error configuring rate limits")
+		return err
+	}
+
 	// Create the API router
 	apirouter, err := api.New(api.Config{
-		Logger:   logger,
-		Database: db,
+		Logger:                logger,
+		Database:              db,
+		AccountDeletionPolicy: cfg.Accounts.DeletionPolicy,
+		LinkPreviews:          linkPreviews,
+		Push:                  push,
+		Mailer:                mail,
+		DigestSecret:          digestSecret,
+		PublicURL:             cfg.Digest.PublicURL,
+		WebUIURL:              cfg.Digest.WebUIURL,
+		AdminUserIDs:          splitList(cfg.Admin.Users),
+		RateLimits:            rateLimits,
+		TextLimits: validation.Limits{
+			MessageText:  cfg.Limits.MessageText,
+			GroupName:    cfg.Limits.GroupName,
+			PollQuestion: cfg.Limits.PollQuestion,
+			PollOption:   cfg.Limits.PollOption,
+		},
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
@@ -170,23 +221,22 @@ func run() error {
 	case sig := <-shutdown:
 		logger.Infof("signal %v received, start shutdown", sig)
 
-		// Asking API server to shut down and load shed.
-		err := apirouter.Close()
-		if err != nil {
-			logger.WithError(err).Warning("graceful shutdown of apirouter error")
-		}
-
 		// Give outstanding requests a deadline for completion.
 		ctx, cancel := context.WithTimeout(context.Background(), cfg.Web.ShutdownTimeout)
 		defer cancel()
 
 		// Asking listener to shut down and load shed.
-		err = apiserver.Shutdown(ctx)
+		err := apiserver.Shutdown(ctx)
 		if err != nil {
 			logger.WithError(err).Warning("error during graceful shutdown of HTTP server")
 			err = apiserver.Close()
 		}
 
+		// Asking API server to shut down, once no request can start background work anymore.
+		if rterr := apirouter.Close(); rterr != nil {
+			logger.WithError(rterr).Warning("graceful shutdown of apirouter error")
+		}
+
 		// Log the status of this shutdown.
 		switch {
 		case sig == syscall.SIGQUIT:
@@ -198,3 +248,154 @@ func run() error {
 
 	return nil
 }
+
+// newLinkPreviewFetcher creates the link preview fetcher described by the configuration
+func newLinkPreviewFetcher(cfg WebAPIConfiguration) (*linkpreview.Fetcher, error) {
+	allowed, err := parseNetworks(cfg.LinkPreviews.AllowedNetworks)
+	if err != nil {
+		return nil, fmt.Errorf("parsing link preview allowed networks: %w", err)
+	}
+	return linkpreview.NewFetcher(linkpreview.Config{
+		Timeout:         cfg.LinkPreviews.Timeout,
+		AllowedNetworks: allowed,
+	}), nil
+}
+
+// newPushSender creates the Web Push sender described by the configuration, creating the VAPID key if needed
+func newPushSender(cfg WebAPIConfiguration) (*webpush.Sender, error) {
+	allowed, err := parseNetworks(cfg.Push.AllowedNetworks)
+	if err != nil {
+		return nil, fmt.Errorf("parsing push allowed networks: %w", err)
+	}
+	key, err := webpush.LoadOrCreateKey(cfg.Push.VAPIDKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading VAPID key: %w", err)
+	}
+	return webpush.NewSender(webpush.Config{
+		Key:             key,
+		Subject:         cfg.Push.Subject,
+		AllowedNetworks: allowed,
+	})
+}
+
+// newDigestMailer creates the mailer of the email digests and loads the key signing their unsubscribe links
+func newDigestMailer(cfg WebAPIConfiguration) (mailer.Mailer, []byte, error) {
+	m, err := mailer.NewSMTPMailer(mailer.SMTPConfig{
+		Host:     cfg.Mail.Host,
+		Port:     cfg.Mail.Port,
+		Username: cfg.Mail.Username,
+		Password: cfg.Mail.Password,
+		From:     cfg.Mail.From,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	secret, err := digest.LoadOrCreateSecret(cfg.Digest.SecretFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading digest secret: %w", err)
+	}
+	return m, secret, nil
+}
+
+// parseNetworks parses a comma-separated list of networks in CIDR notation
+func parseNetworks(list string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, prefix)
+	}
+	return networks, nil
+}
+
+// newRateLimits creates the rate limits described by the configuration
+func newRateLimits(cfg WebAPIConfiguration, db database.AppDatabase) (api.RateLimits, error) {
+	limits := api.RateLimits{ClientIPHeader: cfg.RateLimit.ProxyHeader}
+	if !cfg.RateLimit.Enabled {
+		return limits, nil
+	}
+	switch cfg.RateLimit.Backend {
+	case "memory":
+		limits.Store = ratelimit.NewMemoryStore()
+	case "database":
+		limits.Store = databaseRateLimitStore{db}
+	default:
+		return limits, errors.New("rate limit backend must be memory or database")
+	}
+	for _, rule := range []struct {
+		value string
+		dst   *ratelimit.Rule
+	}{
+		{cfg.RateLimit.Login, &limits.Login},
+		{cfg.RateLimit.Message, &limits.Message},
+		{cfg.RateLimit.Upload, &limits.Upload},
+		{cfg.RateLimit.Search, &limits.Search},
+	} {
+		r, err := ratelimit.ParseRule(rule.value)
+		if err != nil {
+			return limits, err
+		}
+		*rule.dst = r
+	}
+	return limits, nil
+}
+
+// databaseRateLimitStore keeps the rate limits in the database, shared by the servers using it
+type databaseRateLimitStore struct {
+	db database.AppDatabase
+}
+
+func (s databaseRateLimitStore) Take(key string, limit ratelimit.Limit, now time.Time) (time.Duration, error) {
+	return s.db.TakeRateLimitToken(key, limit.Burst, limit.Every, now)
+}
+
+func (s databaseRateLimitStore) Prune(now time.Time) error {
+	return s.db.PruneRateLimits(now)
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(list string) []string {
+	var items []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			items = append(items, s)
+		}
+	}
+	return items
+}
+
+// openDatabase opens the SQLite database and applies the schema. The returned *sql.DB must be closed by the caller.
+func openDatabase(filename string, logger *logrus.Logger) (*sql.DB, database.AppDatabase, error) {
+	// Ensure the directory for the database file exists
+	if dir := filepath.Dir(filename); dir != "" && dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			logger.WithError(err).Error("error creating database directory")
+			return nil, nil, fmt.Errorf("creating database directory %s: %w", dir, err)
+		}
+	}
+
+	dbconn, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		logger.WithError(err).Error("error opening SQLite DB")
+		return nil, nil, fmt.Errorf("opening SQLite: %w", err)
+	}
+
+	// Configure connection pool for SQLite
+	// SQLite supports multiple concurrent readers, only writers are serialized
+	dbconn.SetMaxOpenConns(5)
+	dbconn.SetMaxIdleConns(2)
+	dbconn.SetConnMaxLifetime(0)
+
+	db, err := database.New(dbconn)
+	if err != nil {
+		_ = dbconn.Close()
+		logger.WithError(err).Error("error creating AppDatabase")
+		return nil, nil, fmt.Errorf("creating AppDatabase: %w", err)
+	}
+	return dbconn, db, nil
+}
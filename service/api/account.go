@@ -0,0 +1,485 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/chatexport"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/sirupsen/logrus"
+)
+
+// accountExportDir is where account export archives are stored. Unlike uploads, it is not served directly.
+const accountExportDir = "./exports"
+
+// deletedUserDisplayName is the name shown for the messages of deleted accounts
+const deletedUserDisplayName = "Deleted user"
+
+// AccountExportResponse matches the AccountExport schema: the status of an account export
+type AccountExportResponse struct {
+	ID          string  `json:"id"`
+	Status      string  `json:"status"`
+	CreatedAt   string  `json:"createdAt"`
+	CompletedAt *string `json:"completedAt,omitempty"`
+	Size        int64   `json:"size,omitempty"`
+	DownloadURL *string `json:"downloadUrl,omitempty"`
+}
+
+func newAccountExportResponse(e database.AccountExport) AccountExportResponse {
+	response := AccountExportResponse{
+		ID:          e.ID,
+		Status:      e.Status,
+		CreatedAt:   e.CreatedAt,
+		CompletedAt: e.CompletedAt,
+		Size:        e.Size,
+	}
+	if e.Status == database.ExportReady {
+		url := "/me/export/" + e.ID + "/download"
+		response.DownloadURL = &url
+	}
+	return response
+}
+
+// accountDataMessage is a message in the messages.json file of an account export
+type accountDataMessage struct {
+	ConversationID string `json:"conversationId"`
+	chatexport.Message
+}
+
+// accountDataConversation is an entry of the conversations.json file of an account export
+type accountDataConversation struct {
+	ID           string            `json:"id"`
+	Type         string            `json:"type"`
+	Title        string            `json:"title"`
+	Participants []chatexport.User `json:"participants"`
+}
+
+// accountDataReaction is an entry of the reactions.json file of an account export
+type accountDataReaction struct {
+	MessageID string `json:"messageId"`
+	Emoji     string `json:"emoji"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// requestAccountExport handles POST /me/export
+// The archive is built in the background; the user gets an "account_export_ready" event when it is done. While an
+// export is pending, requesting another one returns it.
+func (rt *_router) requestAccountExport(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	pending, err := rt.db.GetPendingAccountExport(user.ID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting account export")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if pending != nil {
+		w.Header().Set("Location", "/me/export/"+pending.ID)
+		sendJSON(w, http.StatusAccepted, newAccountExportResponse(*pending))
+		return
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		sendInternalError(w, "Error generating ID")
+		return
+	}
+	export := database.AccountExport{
+		ID:        id.String(),
+		UserID:    user.ID,
+		Status:    database.ExportPending,
+		CreatedAt: globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if err := rt.db.CreateAccountExport(export); err != nil {
+		ctx.Logger.WithError(err).Error("error creating account export")
+		sendInternalError(w, "Error creating export")
+		return
+	}
+
+	started := rt.goBackground(func() {
+		rt.completeAccountExport(rt.baseLogger.WithField("export", export.ID), export, *user)
+	})
+	if !started {
+		// The server is shutting down: the export will never be built
+		completedAt := globaltime.Now().UTC().Format("2006-01-02T15:04:05Z")
+		export.Status = database.ExportFailed
+		export.CompletedAt = &completedAt
+		if err := rt.db.UpdateAccountExport(export); err != nil {
+			ctx.Logger.WithError(err).Error("error saving account export")
+		}
+	}
+
+	w.Header().Set("Location", "/me/export/"+export.ID)
+	sendJSON(w, http.StatusAccepted, newAccountExportResponse(export))
+}
+
+// getAccountExport handles GET /me/export/{exportId}
+func (rt *_router) getAccountExport(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	export, err := rt.db.GetAccountExport(ps.ByName("exportId"))
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting account export")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if export == nil || export.UserID != user.ID {
+		sendNotFound(w, "Export not found")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, newAccountExportResponse(*export))
+}
+
+// downloadAccountExport handles GET /me/export/{exportId}/download
+func (rt *_router) downloadAccountExport(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	export, err := rt.db.GetAccountExport(ps.ByName("exportId"))
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting account export")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if export == nil || export.UserID != user.ID {
+		sendNotFound(w, "Export not found")
+		return
+	}
+	if export.Status != database.ExportReady || export.FilePath == nil {
+		sendConflict(w, "Export is not ready")
+		return
+	}
+
+	f, err := os.Open(*export.FilePath)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("error opening account export")
+		sendInternalError(w, "Error reading export")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		ctx.Logger.WithError(err).Error("error reading account export")
+		sendInternalError(w, "Error reading export")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "account-"+user.Name+".zip"))
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// completeAccountExport builds the archive of an export and records the outcome
+func (rt *_router) completeAccountExport(logger logrus.FieldLogger, export database.AccountExport, user database.User) {
+	dir := filepath.Join(accountExportDir, user.ID)
+	filePath := filepath.Join(dir, export.ID+".zip")
+
+	size, err := rt.writeAccountArchive(dir, filePath, user)
+	completedAt := globaltime.Now().UTC().Format("2006-01-02T15:04:05Z")
+	export.CompletedAt = &completedAt
+	if err != nil {
+		logger.WithError(err).Error("error building account export")
+		export.Status = database.ExportFailed
+	} else {
+		export.Status = database.ExportReady
+		export.FilePath = &filePath
+		export.Size = size
+	}
+
+	// The account may have been deleted in the meantime
+	current, err := rt.db.GetAccountExport(export.ID)
+	if err != nil || current == nil {
+		_ = os.Remove(filePath)
+		return
+	}
+	if err := rt.db.UpdateAccountExport(export); err != nil {
+		logger.WithError(err).Error("error saving account export")
+		return
+	}
+
+	_ = rt.wsHub.SendToUser(user.ID, WebSocketMessage{
+		Type:    "account_export_ready",
+		Payload: newAccountExportResponse(export),
+	})
+}
+
+// writeAccountArchive writes the ZIP archive with everything stored about a user and returns its size. The archive
+// is written to a temporary file first, so that a partial archive is never served.
+func (rt *_router) writeAccountArchive(dir, filePath string, user database.User) (int64, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(dir, "export-*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	zw := zip.NewWriter(tmp)
+	if err := rt.writeAccountData(zw, user); err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Rename(tmp.Name(), filePath)
+}
+
+// writeAccountData adds the files of an account export to `zw`:
+// profile.json, conversations.json, messages.json, reactions.json and the uploaded photos under media/
+func (rt *_router) writeAccountData(zw *zip.Writer, user database.User) error {
+	var files []exportMedia
+
+	profile := map[string]interface{}{
+		"user":       UserResponse{ID: user.ID, Name: user.Name, DisplayName: user.DisplayName, PhotoURL: user.PhotoURL},
+		"exportedAt": globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if user.PhotoURL != nil {
+		if f, ok := localUpload(*user.PhotoURL); ok && fileExists(f.localPath) {
+			f.archivePath = "media/profile-" + f.archivePath
+			profile["media"] = f.archivePath
+			files = append(files, f)
+		}
+	}
+	if err := addArchiveJSON(zw, "profile.json", profile); err != nil {
+		return err
+	}
+
+	conversations, err := rt.db.GetConversationsByUser(user.ID)
+	if err != nil {
+		return fmt.Errorf("loading conversations: %w", err)
+	}
+	memberships := make([]accountDataConversation, 0, len(conversations))
+	for _, c := range conversations {
+		participants, err := rt.db.GetParticipants(c.ID)
+		if err != nil {
+			return fmt.Errorf("loading participants: %w", err)
+		}
+		entry := accountDataConversation{ID: c.ID, Type: c.Type, Title: c.Name, Participants: []chatexport.User{}}
+		for _, p := range participants {
+			entry.Participants = append(entry.Participants, exportUser(p))
+			if c.Type == "direct" && p.ID != user.ID {
+				entry.Title = p.Name
+			}
+		}
+		if entry.Title == "" {
+			entry.Title = selfConversationTitle
+		}
+		memberships = append(memberships, entry)
+	}
+	if err := addArchiveJSON(zw, "conversations.json", memberships); err != nil {
+		return err
+	}
+
+	sent, err := rt.db.GetMessagesBySender(user.ID)
+	if err != nil {
+		return fmt.Errorf("loading messages: %w", err)
+	}
+	messages := make([]accountDataMessage, 0, len(sent))
+	for _, m := range sent {
+		em := accountDataMessage{
+			ConversationID: m.ConversationID,
+			Message: chatexport.Message{
+				ID:               m.ID,
+				Sender:           exportUser(user),
+				CreatedAt:        m.CreatedAt,
+				ContentType:      m.ContentType,
+				Text:             m.Text,
+				PhotoURL:         m.PhotoURL,
+				ReplyToMessageID: m.RepliedToMessageID,
+				IsForwarded:      m.IsForwarded,
+			},
+		}
+		if m.ContentType == contentTypePoll {
+			em.Poll, err = rt.exportPoll(m.ID)
+			if err != nil {
+				return fmt.Errorf("loading poll: %w", err)
+			}
+		}
+		// Photos forwarded from someone else are not the user's uploads
+		if m.PhotoURL != nil && !m.IsForwarded {
+			if f, ok := localUpload(*m.PhotoURL); ok && fileExists(f.localPath) {
+				f.archivePath = "media/" + m.ID + "-" + path.Base(f.archivePath)
+				em.Media = &f.archivePath
+				files = append(files, f)
+			}
+		}
+		messages = append(messages, em)
+	}
+	if err := addArchiveJSON(zw, "messages.json", messages); err != nil {
+		return err
+	}
+
+	userReactions, err := rt.db.GetReactionsByUser(user.ID)
+	if err != nil {
+		return fmt.Errorf("loading reactions: %w", err)
+	}
+	reactions := make([]accountDataReaction, 0, len(userReactions))
+	for _, r := range userReactions {
+		reactions = append(reactions, accountDataReaction{MessageID: r.MessageID, Emoji: r.Emoji, CreatedAt: r.CreatedAt})
+	}
+	if err := addArchiveJSON(zw, "reactions.json", reactions); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if err := addArchiveFile(zw, f); err != nil {
+			return fmt.Errorf("adding %s: %w", f.localPath, err)
+		}
+	}
+	return nil
+}
+
+// addArchiveJSON adds a JSON document to an archive
+func addArchiveJSON(zw *zip.Writer, name string, v interface{}) error {
+	dst, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(dst)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// deleteMe handles DELETE /me
+// Messages are anonymized or deleted according to the server's account deletion policy. Participants of the affected
+// conversations get an "account_deleted" event listing the conversations that changed or were deleted.
+func (rt *_router) deleteMe(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	// Who has to be notified, collected before the memberships are gone
+	conversations, err := rt.db.GetConversationsByUser(user.ID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting conversations")
+		sendInternalError(w, "Database error")
+		return
+	}
+	notify := make(map[string][]string) // conversation ID -> other participants
+	for _, c := range conversations {
+		participants, err := rt.db.GetParticipants(c.ID)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("database error getting participants")
+			sendInternalError(w, "Database error")
+			return
+		}
+		for _, p := range participants {
+			if p.ID != user.ID {
+				notify[c.ID] = append(notify[c.ID], p.ID)
+			}
+		}
+	}
+
+	suffix, err := uuid.NewV4()
+	if err != nil {
+		sendInternalError(w, "Error generating ID")
+		return
+	}
+	displayName := deletedUserDisplayName
+	tombstone := database.User{
+		ID:          user.ID,
+		Name:        "deleted-" + suffix.String()[:8],
+		DisplayName: &displayName,
+	}
+	deletedAt := globaltime.Now().UTC().Format("2006-01-02T15:04:05Z")
+
+	deletion, err := rt.db.DeleteAccount(user.ID, rt.accountDeletionPolicy, tombstone, deletedAt)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("error deleting account")
+		sendInternalError(w, "Error deleting account")
+		return
+	}
+
+	rt.removeAccountFiles(ctx.Logger, user.ID, deletion)
+
+	deleted := make(map[string]bool)
+	for _, id := range deletion.DeletedConversationIDs {
+		deleted[id] = true
+	}
+	type accountDeletedPayload struct {
+		UserID                 string   `json:"userId"`
+		ConversationIDs        []string `json:"conversationIds"`
+		DeletedConversationIDs []string `json:"deletedConversationIds"`
+	}
+	payloads := make(map[string]*accountDeletedPayload)
+	for conversationID, recipients := range notify {
+		for _, recipient := range recipients {
+			payload, ok := payloads[recipient]
+			if !ok {
+				payload = &accountDeletedPayload{UserID: user.ID, ConversationIDs: []string{}, DeletedConversationIDs: []string{}}
+				payloads[recipient] = payload
+			}
+			if deleted[conversationID] {
+				payload.DeletedConversationIDs = append(payload.DeletedConversationIDs, conversationID)
+			} else {
+				payload.ConversationIDs = append(payload.ConversationIDs, conversationID)
+			}
+		}
+	}
+	for recipient, payload := range payloads {
+		rt.wsHub.BroadcastToUsers([]string{recipient}, WebSocketMessage{Type: "account_deleted", Payload: payload})
+	}
+
+	rt.wsHub.Unregister(user.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeAccountFiles deletes the files of a deleted account. Failures are only logged: the account is already gone.
+func (rt *_router) removeAccountFiles(logger logrus.FieldLogger, userID string, deletion *database.AccountDeletion) {
+	paths := []string{
+		filepath.Join("./uploads/users", userID),
+		filepath.Join(accountExportDir, userID),
+	}
+	for _, photoURL := range deletion.PhotoURLs {
+		if f, ok := localUpload(photoURL); ok {
+			paths = append(paths, f.localPath)
+		}
+	}
+	for _, id := range deletion.DeletedConversationIDs {
+		paths = append(paths, filepath.Join("./uploads/messages", id), filepath.Join("./uploads/groups", id))
+	}
+	paths = append(paths, deletion.ExportFiles...)
+
+	for _, p := range paths {
+		if err := os.RemoveAll(p); err != nil {
+			logger.WithError(err).WithField("path", p).Warn("error removing file of deleted account")
+		}
+	}
+}
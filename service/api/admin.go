@@ -0,0 +1,680 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+	"github.com/sirupsen/logrus"
+)
+
+// maxStatusReasonLength is the number of characters of the reason of a suspension or ban
+const maxStatusReasonLength = 500
+
+// Admin actions recorded in the audit log
+const (
+	auditUserSuspend   = "user.suspend"
+	auditUserBan       = "user.ban"
+	auditUserReinstate = "user.reinstate"
+	auditReportReview  = "report.review"
+	auditMessageDelete = "message.delete"
+	auditGroupDissolve = "group.dissolve"
+)
+
+// AdminUserResponse matches the AdminUser schema
+type AdminUserResponse struct {
+	UserResponse
+	IsAdmin        bool    `json:"isAdmin"`
+	Status         string  `json:"status"`
+	SuspendedUntil *string `json:"suspendedUntil,omitempty"`
+	StatusReason   *string `json:"statusReason,omitempty"`
+}
+
+// AdminUsersResponse matches the AdminUserPage schema: the response for GET /admin/users. NextCursor is set when there
+// are more pages.
+type AdminUsersResponse struct {
+	Users      []AdminUserResponse `json:"users"`
+	NextCursor *string             `json:"nextCursor,omitempty"`
+}
+
+// AccountStatusRequest matches the AccountStatusRequest schema: the body of PUT /admin/users/{userId}/status
+type AccountStatusRequest struct {
+	Status         string  `json:"status"`
+	SuspendedUntil *string `json:"suspendedUntil"`
+	Reason         *string `json:"reason"`
+}
+
+// AdminReportResponse matches the AdminReport schema
+type AdminReportResponse struct {
+	ID              string  `json:"id"`
+	Type            string  `json:"type"`
+	ReporterID      string  `json:"reporterId"`
+	UserID          string  `json:"userId"`
+	MessageID       *string `json:"messageId,omitempty"`
+	ConversationID  *string `json:"conversationId,omitempty"`
+	MessageText     *string `json:"messageText,omitempty"`
+	MessagePhotoURL *string `json:"messagePhotoUrl,omitempty"`
+	Reason          string  `json:"reason"`
+	Details         *string `json:"details,omitempty"`
+	Status          string  `json:"status"`
+	CreatedAt       string  `json:"createdAt"`
+	ReviewedBy      *string `json:"reviewedBy,omitempty"`
+	ReviewedAt      *string `json:"reviewedAt,omitempty"`
+}
+
+// AdminReportsResponse matches the AdminReportPage schema: the response for GET /admin/reports. NextCursor is set when
+// there are more pages.
+type AdminReportsResponse struct {
+	Reports    []AdminReportResponse `json:"reports"`
+	NextCursor *string               `json:"nextCursor,omitempty"`
+}
+
+// ReviewReportRequest matches the ReviewReportRequest schema: the body of PUT /admin/reports/{reportId}/status
+type ReviewReportRequest struct {
+	Status string `json:"status"`
+}
+
+// AuditEntryResponse matches the AuditEntry schema
+type AuditEntryResponse struct {
+	ID         string          `json:"id"`
+	AdminID    *string         `json:"adminId,omitempty"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"targetType"`
+	TargetID   string          `json:"targetId"`
+	Details    json.RawMessage `json:"details,omitempty"`
+	CreatedAt  string          `json:"createdAt"`
+}
+
+// AuditLogResponse matches the AuditLogPage schema: the response for GET /admin/audit-log. NextCursor is set when there
+// are more pages.
+type AuditLogResponse struct {
+	Entries    []AuditEntryResponse `json:"entries"`
+	NextCursor *string              `json:"nextCursor,omitempty"`
+}
+
+// AdminStatsResponse matches the AdminStats schema
+type AdminStatsResponse struct {
+	Users struct {
+		Total     int `json:"total"`
+		Admins    int `json:"admins"`
+		Suspended int `json:"suspended"`
+		Banned    int `json:"banned"`
+	} `json:"users"`
+	Conversations struct {
+		Direct int `json:"direct"`
+		Groups int `json:"groups"`
+	} `json:"conversations"`
+	Messages struct {
+		Total   int `json:"total"`
+		LastDay int `json:"lastDay"`
+	} `json:"messages"`
+	OpenReports int `json:"openReports"`
+	Storage     struct {
+		DatabaseBytes int64 `json:"databaseBytes"`
+		UploadsBytes  int64 `json:"uploadsBytes"`
+		ExportsBytes  int64 `json:"exportsBytes"`
+	} `json:"storage"`
+}
+
+// isAdmin reports whether a user is a server admin, from the configuration or granted in the database
+func (rt *_router) isAdmin(userID string) (bool, error) {
+	if rt.adminIDs[userID] {
+		return true, nil
+	}
+	return rt.db.IsAdmin(userID)
+}
+
+// adminWrap wraps a handler of the admin console: like authWrap, and the user must be a server admin
+func (rt *_router) adminWrap(fn httpRouterHandler) func(http.ResponseWriter, *http.Request, httprouter.Params) {
+	return rt.authWrap(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+		user := GetUserFromContext(r.Context())
+		if user == nil {
+			sendUnauthorized(w, "User not found in context")
+			return
+		}
+		admin, err := rt.isAdmin(user.ID)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("database error getting admin role")
+			sendInternalError(w, "Database error")
+			return
+		}
+		if !admin {
+			sendError(w, http.StatusForbidden, codeAdminRequired, "Admin access required")
+			return
+		}
+		fn(w, r, ps, ctx)
+	})
+}
+
+// newAuditEntry describes an action of `adminID` on a target for the audit log. `details` are the parameters of the
+// action, nil if there are none.
+func newAuditEntry(adminID, action, targetType, targetID string, details map[string]interface{}) (database.AuditEntry, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return database.AuditEntry{}, fmt.Errorf("generating ID: %w", err)
+	}
+	entry := database.AuditEntry{
+		ID:         id.String(),
+		AdminID:    &adminID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		CreatedAt:  globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if details != nil {
+		data, err := json.Marshal(details)
+		if err != nil {
+			return database.AuditEntry{}, fmt.Errorf("encoding audit details: %w", err)
+		}
+		s := string(data)
+		entry.Details = &s
+	}
+	return entry, nil
+}
+
+func (rt *_router) newAdminUserResponse(u database.AdminUser) AdminUserResponse {
+	return AdminUserResponse{
+		UserResponse: UserResponse{
+			ID:          u.User.ID,
+			Name:        u.User.Name,
+			DisplayName: u.User.DisplayName,
+			PhotoURL:    u.User.PhotoURL,
+		},
+		IsAdmin:        u.IsAdmin || rt.adminIDs[u.User.ID],
+		Status:         u.Account.Status,
+		SuspendedUntil: u.Account.SuspendedUntil,
+		StatusReason:   u.Account.Reason,
+	}
+}
+
+func newAdminReportResponse(r database.Report) AdminReportResponse {
+	return AdminReportResponse{
+		ID:              r.ID,
+		Type:            r.TargetType,
+		ReporterID:      r.ReporterID,
+		UserID:          r.UserID,
+		MessageID:       r.MessageID,
+		ConversationID:  r.ConversationID,
+		MessageText:     r.MessageText,
+		MessagePhotoURL: r.MessagePhotoURL,
+		Reason:          r.Reason,
+		Details:         r.Details,
+		Status:          r.Status,
+		CreatedAt:       r.CreatedAt,
+		ReviewedBy:      r.ReviewedBy,
+		ReviewedAt:      r.ReviewedAt,
+	}
+}
+
+// listAdminUsers handles GET /admin/users, ordered by username one page at a time (see parsePage)
+// ?q= searches usernames and display names, ?status= filters by account status
+func (rt *_router) listAdminUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	query := r.URL.Query()
+	status := query.Get("status")
+	switch status {
+	case "", database.AccountActive, database.AccountSuspended, database.AccountBanned:
+	default:
+		sendFieldError(w, "status", validation.CodeInvalidValue, "status must be active, suspended or banned")
+		return
+	}
+
+	limit, afterName, afterID, reqErr := parsePage(r)
+	if reqErr != nil {
+		sendRequestError(w, reqErr)
+		return
+	}
+
+	// One more than the page size tells whether there is a next page
+	users, err := rt.db.GetAdminUsers(query.Get("q"), status, afterName, afterID, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting users")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	response := AdminUsersResponse{Users: make([]AdminUserResponse, 0, len(users))}
+	if len(users) > limit {
+		users = users[:limit]
+		next := pageCursor(users[limit-1].User.Name, users[limit-1].User.ID)
+		response.NextCursor = &next
+	}
+	for _, u := range users {
+		response.Users = append(response.Users, rt.newAdminUserResponse(u))
+	}
+	sendJSON(w, http.StatusOK, response)
+}
+
+// getAdminUser handles GET /admin/users/{userId}
+func (rt *_router) getAdminUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	u, err := rt.db.GetAdminUser(ps.ByName("userId"))
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting user")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if u == nil {
+		sendNotFound(w, "User not found")
+		return
+	}
+	sendJSON(w, http.StatusOK, rt.newAdminUserResponse(*u))
+}
+
+// setAccountStatus handles PUT /admin/users/{userId}/status
+// Suspended and banned users are disconnected and can't log in or authenticate; suspensions with an end are lifted
+// automatically. Admins can't change their own status nor the one of other admins.
+func (rt *_router) setAccountStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	admin := GetUserFromContext(r.Context())
+	if admin == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	var req AccountStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendInvalidJSON(w)
+		return
+	}
+
+	status := database.AccountStatus{Status: req.Status}
+	var action string
+	switch req.Status {
+	case database.AccountActive:
+		action = auditUserReinstate
+	case database.AccountSuspended:
+		action = auditUserSuspend
+	case database.AccountBanned:
+		action = auditUserBan
+	default:
+		sendFieldError(w, "status", validation.CodeInvalidValue, "status must be active, suspended or banned")
+		return
+	}
+	if req.SuspendedUntil != nil {
+		if req.Status != database.AccountSuspended {
+			sendFieldError(w, "suspendedUntil", validation.CodeInvalidValue, "suspendedUntil is only allowed with status suspended")
+			return
+		}
+		until, err := time.Parse(time.RFC3339, *req.SuspendedUntil)
+		if err != nil {
+			sendFieldError(w, "suspendedUntil", validation.CodeInvalidFormat, "suspendedUntil must be an RFC 3339 date-time")
+			return
+		}
+		if !until.After(globaltime.Now()) {
+			sendFieldError(w, "suspendedUntil", validation.CodeInvalidValue, "suspendedUntil must be in the future")
+			return
+		}
+		s := until.UTC().Format("2006-01-02T15:04:05Z")
+		status.SuspendedUntil = &s
+	}
+	if req.Reason != nil && *req.Reason != "" && req.Status != database.AccountActive {
+		if utf8.RuneCountInString(*req.Reason) > maxStatusReasonLength {
+			sendFieldError(w, "reason", validation.CodeTooLong, "reason is too long")
+			return
+		}
+		status.Reason = req.Reason
+	}
+
+	target, err := rt.db.GetAdminUser(ps.ByName("userId"))
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting user")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if target == nil {
+		sendNotFound(w, "User not found")
+		return
+	}
+	if target.User.ID == admin.ID {
+		sendBadRequest(w, "You can't change the status of your own account")
+		return
+	}
+	if target.IsAdmin || rt.adminIDs[target.User.ID] {
+		sendForbidden(w, "Admins can't be suspended or banned")
+		return
+	}
+
+	audit, err := newAuditEntry(admin.ID, action, "user", target.User.ID, map[string]interface{}{
+		"previousStatus": target.Account.Status,
+		"suspendedUntil": status.SuspendedUntil,
+		"reason":         status.Reason,
+	})
+	if err != nil {
+		sendInternalError(w, "Error generating ID")
+		return
+	}
+	if err := rt.db.SetAccountStatus(target.User.ID, status, audit); err != nil {
+		ctx.Logger.WithError(err).Error("error setting account status")
+		sendInternalError(w, "Error setting account status")
+		return
+	}
+	ctx.Logger.WithFields(logrus.Fields{"userId": target.User.ID, "status": status.Status}).Info("account status changed")
+
+	if status.Status != database.AccountActive {
+		rt.wsHub.Unregister(target.User.ID)
+	}
+
+	target.Account = status
+	sendJSON(w, http.StatusOK, rt.newAdminUserResponse(*target))
+}
+
+// listAdminReports handles GET /admin/reports, the most recent first, one page at a time (see parsePage)
+// ?status= filters by status, ?userId= by reported user
+func (rt *_router) listAdminReports(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	query := r.URL.Query()
+	status := query.Get("status")
+	switch status {
+	case "", database.ReportOpen, database.ReportResolved, database.ReportDismissed:
+	default:
+		sendFieldError(w, "status", validation.CodeInvalidValue, "status must be open, resolved or dismissed")
+		return
+	}
+
+	limit, beforeCreatedAt, beforeID, reqErr := parsePage(r)
+	if reqErr != nil {
+		sendRequestError(w, reqErr)
+		return
+	}
+
+	reports, err := rt.db.GetReports(status, query.Get("userId"), beforeCreatedAt, beforeID, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting reports")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	response := AdminReportsResponse{Reports: make([]AdminReportResponse, 0, len(reports))}
+	if len(reports) > limit {
+		reports = reports[:limit]
+		next := pageCursor(reports[limit-1].CreatedAt, reports[limit-1].ID)
+		response.NextCursor = &next
+	}
+	for _, report := range reports {
+		response.Reports = append(response.Reports, newAdminReportResponse(report))
+	}
+	sendJSON(w, http.StatusOK, response)
+}
+
+// getAdminReport handles GET /admin/reports/{reportId}
+func (rt *_router) getAdminReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	report, err := rt.db.GetReport(ps.ByName("reportId"))
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting report")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if report == nil {
+		sendNotFound(w, "Report not found")
+		return
+	}
+	sendJSON(w, http.StatusOK, newAdminReportResponse(*report))
+}
+
+// reviewReport handles PUT /admin/reports/{reportId}/status
+func (rt *_router) reviewReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	admin := GetUserFromContext(r.Context())
+	if admin == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	var req ReviewReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendInvalidJSON(w)
+		return
+	}
+	switch req.Status {
+	case database.ReportOpen, database.ReportResolved, database.ReportDismissed:
+	default:
+		sendFieldError(w, "status", validation.CodeInvalidValue, "status must be open, resolved or dismissed")
+		return
+	}
+
+	report, err := rt.db.GetReport(ps.ByName("reportId"))
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting report")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if report == nil {
+		sendNotFound(w, "Report not found")
+		return
+	}
+
+	audit, err := newAuditEntry(admin.ID, auditReportReview, "report", report.ID, map[string]interface{}{
+		"previousStatus": report.Status,
+		"status":         req.Status,
+	})
+	if err != nil {
+		sendInternalError(w, "Error generating ID")
+		return
+	}
+	if err := rt.db.ReviewReport(report.ID, req.Status, audit); err != nil {
+		ctx.Logger.WithError(err).Error("error reviewing report")
+		sendInternalError(w, "Error reviewing report")
+		return
+	}
+
+	report.Status = req.Status
+	report.ReviewedBy = audit.AdminID
+	report.ReviewedAt = &audit.CreatedAt
+	sendJSON(w, http.StatusOK, newAdminReportResponse(*report))
+}
+
+// moderateMessage handles DELETE /admin/conversations/{conversationId}/messages/{messageId}
+// Admins can delete any message, in any conversation; participants get a "message_deleted" event with reason
+// "moderated".
+func (rt *_router) moderateMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	admin := GetUserFromContext(r.Context())
+	if admin == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	msg, err := rt.db.GetMessageByID(ps.ByName("messageId"))
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting message")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if msg == nil || msg.ConversationID != ps.ByName("conversationId") {
+		sendNotFound(w, "Message not found")
+		return
+	}
+
+	audit, err := newAuditEntry(admin.ID, auditMessageDelete, "message", msg.ID, map[string]interface{}{
+		"conversationId": msg.ConversationID,
+		"senderId":       msg.SenderID,
+	})
+	if err != nil {
+		sendInternalError(w, "Error generating ID")
+		return
+	}
+	if err := rt.db.ModerateMessage(msg.ID, audit); err != nil {
+		ctx.Logger.WithError(err).Error("error deleting message")
+		sendInternalError(w, "Error deleting message")
+		return
+	}
+	rt.broadcastMessageDeleted(ctx.Logger, msg.ConversationID, msg.ID, "moderated")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// dissolveGroup handles DELETE /admin/groups/{groupId}
+// The group is deleted with its messages and photos; its former members get a "group_dissolved" event.
+func (rt *_router) dissolveGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	admin := GetUserFromContext(r.Context())
+	if admin == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	groupID := ps.ByName("groupId")
+	conv, err := rt.db.GetConversationByID(groupID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting group")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if conv == nil || conv.Type != "group" {
+		sendNotFound(w, "Group not found")
+		return
+	}
+
+	// Who has to be notified, collected before the memberships are gone
+	members, err := rt.db.GetParticipants(groupID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting participants")
+		sendInternalError(w, "Database error")
+		return
+	}
+	var memberIDs []string
+	for _, m := range members {
+		memberIDs = append(memberIDs, m.ID)
+	}
+
+	audit, err := newAuditEntry(admin.ID, auditGroupDissolve, "conversation", groupID, map[string]interface{}{
+		"name":      conv.Name,
+		"memberIds": memberIDs,
+	})
+	if err != nil {
+		sendInternalError(w, "Error generating ID")
+		return
+	}
+	photoURLs, err := rt.db.DissolveGroup(groupID, audit)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("error dissolving group")
+		sendInternalError(w, "Error dissolving group")
+		return
+	}
+	ctx.Logger.WithField("groupId", groupID).Info("group dissolved")
+
+	paths := []string{filepath.Join("./uploads/messages", groupID), filepath.Join("./uploads/groups", groupID)}
+	for _, photoURL := range photoURLs {
+		if f, ok := localUpload(photoURL); ok {
+			paths = append(paths, f.localPath)
+		}
+	}
+	for _, p := range paths {
+		if err := os.RemoveAll(p); err != nil {
+			ctx.Logger.WithError(err).WithField("path", p).Warn("error removing file of dissolved group")
+		}
+	}
+
+	rt.wsHub.BroadcastToUsers(memberIDs, WebSocketMessage{
+		Type:    "group_dissolved",
+		Payload: map[string]interface{}{"groupId": groupID},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getAdminStats handles GET /admin/stats
+func (rt *_router) getAdminStats(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	lastDay := globaltime.Now().Add(-24 * time.Hour).UTC().Format("2006-01-02T15:04:05Z")
+	stats, err := rt.db.GetUsageStats(lastDay)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting usage stats")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	// Admins of the configuration count unless they were also granted the role in the database
+	admins := stats.Admins
+	for id := range rt.adminIDs {
+		granted, err := rt.db.IsAdmin(id)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("database error getting admin role")
+			sendInternalError(w, "Database error")
+			return
+		}
+		if !granted {
+			admins++
+		}
+	}
+
+	var response AdminStatsResponse
+	response.Users.Total = stats.Users
+	response.Users.Admins = admins
+	response.Users.Suspended = stats.SuspendedUsers
+	response.Users.Banned = stats.BannedUsers
+	response.Conversations.Direct = stats.DirectChats
+	response.Conversations.Groups = stats.Groups
+	response.Messages.Total = stats.Messages
+	response.Messages.LastDay = stats.RecentMessages
+	response.OpenReports = stats.OpenReports
+	response.Storage.DatabaseBytes = stats.DatabaseSizeBytes
+	response.Storage.UploadsBytes = dirSize(ctx.Logger, "./uploads")
+	response.Storage.ExportsBytes = dirSize(ctx.Logger, accountExportDir)
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// dirSize returns the total size of the files under `dir`, 0 if it does not exist
+func dirSize(logger logrus.FieldLogger, dir string) int64 {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		logger.WithError(err).WithField("dir", dir).Warn("error measuring storage")
+	}
+	return size
+}
+
+// getAuditLog handles GET /admin/audit-log, the most recent first, one page at a time (see parsePage)
+func (rt *_router) getAuditLog(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	limit, beforeCreatedAt, beforeID, reqErr := parsePage(r)
+	if reqErr != nil {
+		sendRequestError(w, reqErr)
+		return
+	}
+
+	entries, err := rt.db.GetAuditLog(beforeCreatedAt, beforeID, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting audit log")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	response := AuditLogResponse{Entries: make([]AuditEntryResponse, 0, len(entries))}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		next := pageCursor(entries[limit-1].CreatedAt, entries[limit-1].ID)
+		response.NextCursor = &next
+	}
+	for _, e := range entries {
+		entry := AuditEntryResponse{
+			ID:         e.ID,
+			AdminID:    e.AdminID,
+			Action:     e.Action,
+			TargetType: e.TargetType,
+			TargetID:   e.TargetID,
+			CreatedAt:  e.CreatedAt,
+		}
+		if e.Details != nil {
+			entry.Details = json.RawMessage(*e.Details)
+		}
+		response.Entries = append(response.Entries, entry)
+	}
+	sendJSON(w, http.StatusOK, response)
+}
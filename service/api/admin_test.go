@@ -0,0 +1,132 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+)
+
+// setStatus changes the account status of a user as an admin
+func setStatus(admin, c *apitest.Client, req api.AccountStatusRequest) api.AdminUserResponse {
+	var user api.AdminUserResponse
+	admin.Call(http.MethodPut, "/admin/users/"+c.ID+"/status", req, &user, http.StatusOK)
+	return user
+}
+
+// expectLockedOut checks that a user can't call the API, open the WebSocket nor log in again
+func expectLockedOut(c *apitest.Client, code string) {
+	c.Do(http.MethodGet, "/me", nil).ExpectError(http.StatusForbidden, code)
+	c.Do(http.MethodGet, "/ws?token="+c.ID, nil).ExpectError(http.StatusForbidden, code)
+	c.Do(http.MethodPost, "/session", map[string]string{"name": c.Name}).ExpectError(http.StatusForbidden, code)
+}
+
+// TestAccountStatus checks that suspended and banned users are disconnected and locked out, and that suspensions end
+// by themselves
+func TestAccountStatus(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	admin, alice, bob := s.Login("admin"), s.Login("alice"), s.Login("bob")
+	s.GrantAdmin(admin)
+	aliceEvents := alice.Connect()
+
+	until := s.Now().Add(2 * time.Hour).UTC().Format(time.RFC3339)
+	reason := "Spam"
+	suspended := setStatus(admin, alice, api.AccountStatusRequest{
+		Status: database.AccountSuspended, SuspendedUntil: &until, Reason: &reason,
+	})
+	if suspended.Status != database.AccountSuspended || suspended.SuspendedUntil == nil ||
+		*suspended.SuspendedUntil != until {
+		t.Errorf("alice is %s until %v, expected suspended until %s", suspended.Status, suspended.SuspendedUntil,
+			until)
+	}
+	aliceEvents.WaitClosed()
+	expectLockedOut(alice, "account-suspended")
+
+	s.Advance(2 * time.Hour)
+	alice.Call(http.MethodGet, "/me", nil, nil, http.StatusOK)
+	alice.Connect().Close()
+
+	setStatus(admin, bob, api.AccountStatusRequest{Status: database.AccountBanned})
+	expectLockedOut(bob, "account-banned")
+	s.Advance(365 * 24 * time.Hour)
+	bob.Do(http.MethodGet, "/me", nil).ExpectError(http.StatusForbidden, "account-banned")
+
+	setStatus(admin, bob, api.AccountStatusRequest{Status: database.AccountActive})
+	bob.Call(http.MethodGet, "/me", nil, nil, http.StatusOK)
+}
+
+// TestAdminAccess checks that only admins reach the admin console, and that they can't lock each other out
+func TestAdminAccess(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	admin, other, alice := s.Login("admin"), s.Login("other"), s.Login("alice")
+	s.GrantAdmin(admin)
+	s.GrantAdmin(other)
+
+	banned := api.AccountStatusRequest{Status: database.AccountBanned}
+	for _, path := range []string{"/admin/users", "/admin/reports", "/admin/stats", "/admin/audit-log"} {
+		alice.Do(http.MethodGet, path, nil).ExpectError(http.StatusForbidden, "admin-required")
+	}
+	alice.Do(http.MethodPut, "/admin/users/"+alice.ID+"/status", banned).
+		ExpectError(http.StatusForbidden, "admin-required")
+
+	admin.Do(http.MethodPut, "/admin/users/"+other.ID+"/status", banned).ExpectError(http.StatusForbidden, "forbidden")
+	admin.Do(http.MethodPut, "/admin/users/"+admin.ID+"/status", banned).
+		ExpectError(http.StatusBadRequest, "bad-request")
+	past := s.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	admin.Do(http.MethodPut, "/admin/users/"+alice.ID+"/status",
+		api.AccountStatusRequest{Status: database.AccountSuspended, SuspendedUntil: &past}).
+		ExpectError(http.StatusBadRequest, "validation-failed", "suspendedUntil:invalid-value")
+	alice.Call(http.MethodGet, "/me", nil, nil, http.StatusOK)
+}
+
+// TestAuditLog checks that the actions of admins are recorded, the most recent first, and that the log can't be
+// changed afterwards
+func TestAuditLog(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	admin, alice := s.Login("admin"), s.Login("alice")
+	s.GrantAdmin(admin)
+
+	reason := "Spam"
+	setStatus(admin, alice, api.AccountStatusRequest{Status: database.AccountSuspended, Reason: &reason})
+	setStatus(admin, alice, api.AccountStatusRequest{Status: database.AccountBanned})
+
+	var log api.AuditLogResponse
+	admin.Call(http.MethodGet, "/admin/audit-log", nil, &log, http.StatusOK)
+	if len(log.Entries) < 2 {
+		t.Fatalf("the audit log has %d entries, expected the suspension and the ban", len(log.Entries))
+	}
+	for i, action := range []string{"user.ban", "user.suspend"} {
+		e := log.Entries[i]
+		if e.Action != action || e.TargetType != "user" || e.TargetID != alice.ID || e.AdminID == nil ||
+			*e.AdminID != admin.ID {
+			t.Errorf("entry %d is %s of %s %s, expected %s of alice by the admin", i, e.Action, e.TargetType,
+				e.TargetID, action)
+		}
+	}
+	var details struct {
+		PreviousStatus string  `json:"previousStatus"`
+		Reason         *string `json:"reason"`
+	}
+	if err := json.Unmarshal(log.Entries[1].Details, &details); err != nil {
+		t.Fatal(err)
+	}
+	if details.PreviousStatus != database.AccountActive || details.Reason == nil || *details.Reason != reason {
+		t.Errorf("the suspension was recorded with %+v, expected the previous status and the reason", details)
+	}
+
+	// The log is append-only, even for whoever reaches the database
+	if _, err := s.SQL.Exec("UPDATE admin_audit_log SET action = 'user.reinstate'"); err == nil {
+		t.Errorf("the audit log was updated")
+	}
+	if _, err := s.SQL.Exec("DELETE FROM admin_audit_log"); err == nil {
+		t.Errorf("the audit log was deleted")
+	}
+	admin.Call(http.MethodGet, "/admin/audit-log", nil, &log, http.StatusOK)
+	if len(log.Entries) < 2 || log.Entries[0].Action != "user.ban" {
+		t.Errorf("the audit log changed after the refused statements")
+	}
+}
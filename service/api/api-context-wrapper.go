@@ -24,6 +24,7 @@ func (rt *_router) wrap(fn httpRouterHandler) func(http.ResponseWriter, *http.Re
 		var ctx = reqcontext.RequestContext{
 			ReqUUID: reqUUID,
 		}
+		w.Header().Set(requestIDHeader, reqUUID.String())
 
 		// Create a request-specific logger
 		ctx.Logger = rt.baseLogger.WithFields(logrus.Fields{
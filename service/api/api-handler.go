@@ -4,24 +4,42 @@ import (
 	"net/http"
 )
 
-// Handler returns an instance of httprouter.Router that handle APIs registered here
+// Handler returns an instance of httprouter.Router that handle APIs registered here. Logins, messages, uploads and
+// searches are rate limited (see rateLimited).
 func (rt *_router) Handler() http.Handler {
 	// ========================================
 	// SESSION (no auth required)
 	// ========================================
-	rt.router.POST("/session", rt.wrap(rt.doLogin))
+	rt.router.POST("/session", rt.wrap(rt.rateLimited(rateLimitLogin, rt.doLogin)))
 
 	// ========================================
 	// CURRENT USER /me (auth required)
 	// ========================================
 	rt.router.GET("/me", rt.authWrap(rt.getMe))
 	rt.router.PUT("/me/username", rt.authWrap(rt.setMyUserName))
-	rt.router.PUT("/me/photo", rt.authWrap(rt.setMyPhoto))
+	rt.router.PUT("/me/photo", rt.authWrap(rt.rateLimited(rateLimitUpload, rt.setMyPhoto)))
+	rt.router.PUT("/me/email", rt.authWrap(rt.setMyEmail))
+	rt.router.DELETE("/me", rt.authWrap(rt.deleteMe))
+	rt.router.POST("/me/export", rt.authWrap(rt.requestAccountExport))
+	rt.router.GET("/me/export/:exportId", rt.authWrap(rt.getAccountExport))
+	rt.router.GET("/me/export/:exportId/download", rt.authWrap(rt.downloadAccountExport))
+	rt.router.GET("/me/starred", rt.authWrap(rt.getStarredMessages))
+	rt.router.GET("/me/mentions", rt.authWrap(rt.getMentions))
+	rt.router.PUT("/me/pinned-conversations", rt.authWrap(rt.reorderPinnedConversations))
+	rt.router.GET("/me/preferences", rt.authWrap(rt.getMyPreferences))
+	rt.router.PUT("/me/preferences", rt.authWrap(rt.updateMyPreferences))
+	rt.router.GET("/me/push-subscriptions", rt.authWrap(rt.listPushSubscriptions))
+	rt.router.POST("/me/push-subscriptions", rt.authWrap(rt.createPushSubscription))
+	rt.router.DELETE("/me/push-subscriptions/:subscriptionId", rt.authWrap(rt.deletePushSubscription))
+	rt.router.GET("/me/blocks", rt.authWrap(rt.listBlocks))
+	rt.router.POST("/me/blocks/:userId", rt.authWrap(rt.blockUser))
+	rt.router.DELETE("/me/blocks/:userId", rt.authWrap(rt.unblockUser))
 
 	// ========================================
 	// USERS (auth required)
 	// ========================================
-	rt.router.GET("/users", rt.authWrap(rt.searchUsers))
+	rt.router.GET("/users", rt.authWrap(rt.rateLimited(rateLimitSearch, rt.searchUsers)))
+	rt.router.POST("/reports", rt.authWrap(rt.createReport))
 
 	// ========================================
 	// CONVERSATIONS (auth required)
@@ -29,12 +47,44 @@ func (rt *_router) Handler() http.Handler {
 	rt.router.POST("/conversations", rt.authWrap(rt.startConversation))
 	rt.router.GET("/conversations", rt.authWrap(rt.getMyConversations))
 	rt.router.GET("/conversations/:conversationId", rt.authWrap(rt.getConversation))
-	rt.router.POST("/conversations/:conversationId/messages", rt.authWrap(rt.sendMessage))
-	rt.router.POST("/conversations/:conversationId/photos", rt.authWrap(rt.uploadMessagePhoto))
+	rt.router.GET("/conversations/:conversationId/settings", rt.authWrap(rt.getConversationSettings))
+	rt.router.PUT("/conversations/:conversationId/settings", rt.authWrap(rt.updateConversationSettings))
+	rt.router.GET("/conversations/:conversationId/export", rt.authWrap(rt.exportConversation))
+	rt.router.POST("/conversations/:conversationId/import", rt.authWrap(rt.rateLimited(rateLimitUpload, rt.importConversation)))
+	rt.router.PUT("/conversations/:conversationId/archive", rt.authWrap(rt.archiveConversation))
+	rt.router.DELETE("/conversations/:conversationId/archive", rt.authWrap(rt.unarchiveConversation))
+	rt.router.PUT("/conversations/:conversationId/pin", rt.authWrap(rt.pinConversation))
+	rt.router.DELETE("/conversations/:conversationId/pin", rt.authWrap(rt.unpinConversation))
+	rt.router.PUT("/conversations/:conversationId/mute", rt.authWrap(rt.muteConversation))
+	rt.router.DELETE("/conversations/:conversationId/mute", rt.authWrap(rt.unmuteConversation))
+	rt.router.PUT("/conversations/:conversationId/unread", rt.authWrap(rt.markConversationUnread))
+	rt.router.DELETE("/conversations/:conversationId/unread", rt.authWrap(rt.markConversationRead))
+	rt.router.POST("/conversations/:conversationId/messages", rt.authWrap(rt.rateLimited(rateLimitMessage, rt.sendMessage)))
+	rt.router.POST("/conversations/:conversationId/photos", rt.authWrap(rt.rateLimited(rateLimitUpload, rt.uploadMessagePhoto)))
+	rt.router.POST("/conversations/:conversationId/scheduled-messages", rt.authWrap(rt.rateLimited(rateLimitMessage, rt.scheduleMessage)))
+	rt.router.GET("/conversations/:conversationId/scheduled-messages", rt.authWrap(rt.listScheduledMessages))
+	rt.router.PUT("/conversations/:conversationId/scheduled-messages/:scheduledMessageId", rt.authWrap(rt.updateScheduledMessage))
+	rt.router.DELETE("/conversations/:conversationId/scheduled-messages/:scheduledMessageId", rt.authWrap(rt.cancelScheduledMessage))
 	rt.router.DELETE("/conversations/:conversationId/messages/:messageId", rt.authWrap(rt.deleteMessage))
-	rt.router.POST("/conversations/:conversationId/messages/:messageId/forward", rt.authWrap(rt.forwardMessage))
-	rt.router.POST("/conversations/:conversationId/messages/:messageId/comments", rt.authWrap(rt.commentMessage))
+	rt.router.POST("/conversations/:conversationId/messages/:messageId/forward", rt.authWrap(rt.rateLimited(rateLimitMessage, rt.forwardMessage)))
+	rt.router.PUT("/conversations/:conversationId/messages/:messageId/pin", rt.authWrap(rt.pinMessage))
+	rt.router.DELETE("/conversations/:conversationId/messages/:messageId/pin", rt.authWrap(rt.unpinMessage))
+	rt.router.PUT("/conversations/:conversationId/messages/:messageId/star", rt.authWrap(rt.starMessage))
+	rt.router.DELETE("/conversations/:conversationId/messages/:messageId/star", rt.authWrap(rt.unstarMessage))
+	rt.router.POST("/conversations/:conversationId/messages/:messageId/comments", rt.authWrap(rt.rateLimited(rateLimitMessage, rt.commentMessage)))
 	rt.router.DELETE("/conversations/:conversationId/messages/:messageId/comments/:commentId", rt.authWrap(rt.uncommentMessage))
+	rt.router.GET("/conversations/:conversationId/messages/:messageId/reactions", rt.authWrap(rt.listReactions))
+	rt.router.GET("/conversations/:conversationId/messages/:messageId/thread", rt.authWrap(rt.getMessageThread))
+	rt.router.PUT("/conversations/:conversationId/messages/:messageId/poll/votes/:optionId", rt.authWrap(rt.votePoll))
+	rt.router.DELETE("/conversations/:conversationId/messages/:messageId/poll/votes/:optionId", rt.authWrap(rt.unvotePoll))
+
+	// ========================================
+	// SLASH COMMANDS (auth required)
+	// ========================================
+	rt.router.GET("/conversations/:conversationId/commands", rt.authWrap(rt.listCommands))
+	rt.router.PUT("/conversations/:conversationId/commands/:commandName", rt.authWrap(rt.registerCommand))
+	rt.router.DELETE("/conversations/:conversationId/commands/:commandName", rt.authWrap(rt.unregisterCommand))
+	rt.router.POST("/conversations/:conversationId/command-invocations/:invocationId/reply", rt.authWrap(rt.replyToCommand))
 
 	// ========================================
 	// GROUPS (auth required)
@@ -44,13 +94,30 @@ func (rt *_router) Handler() http.Handler {
 	rt.router.POST("/groups/:groupId/members", rt.authWrap(rt.addToGroup))
 	rt.router.DELETE("/groups/:groupId/members/me", rt.authWrap(rt.leaveGroup))
 	rt.router.PUT("/groups/:groupId/name", rt.authWrap(rt.setGroupName))
-	rt.router.PUT("/groups/:groupId/photo", rt.authWrap(rt.setGroupPhoto))
+	rt.router.PUT("/groups/:groupId/photo", rt.authWrap(rt.rateLimited(rateLimitUpload, rt.setGroupPhoto)))
+
+	// ========================================
+	// ADMIN (admin role required)
+	// ========================================
+	rt.router.GET("/admin/users", rt.adminWrap(rt.listAdminUsers))
+	rt.router.GET("/admin/users/:userId", rt.adminWrap(rt.getAdminUser))
+	rt.router.PUT("/admin/users/:userId/status", rt.adminWrap(rt.setAccountStatus))
+	rt.router.GET("/admin/reports", rt.adminWrap(rt.listAdminReports))
+	rt.router.GET("/admin/reports/:reportId", rt.adminWrap(rt.getAdminReport))
+	rt.router.PUT("/admin/reports/:reportId/status", rt.adminWrap(rt.reviewReport))
+	rt.router.DELETE("/admin/conversations/:conversationId/messages/:messageId", rt.adminWrap(rt.moderateMessage))
+	rt.router.DELETE("/admin/groups/:groupId", rt.adminWrap(rt.dissolveGroup))
+	rt.router.GET("/admin/stats", rt.adminWrap(rt.getAdminStats))
+	rt.router.GET("/admin/audit-log", rt.adminWrap(rt.getAuditLog))
 
 	// ========================================
 	// SPECIAL ROUTES
 	// ========================================
 	rt.router.GET("/liveness", rt.getLiveness)
 	rt.router.GET("/ws", rt.wrap(rt.handleWebSocket))
+	rt.router.GET("/push/vapid-public-key", rt.wrap(rt.getVAPIDPublicKey))
+	rt.router.GET("/digest/unsubscribe", rt.wrap(rt.unsubscribeDigest))
+	rt.router.POST("/digest/unsubscribe", rt.wrap(rt.unsubscribeDigest))
 
 	// Serve uploaded files
 	rt.router.ServeFiles("/uploads/*filepath", http.Dir("./uploads"))
@@ -37,11 +37,20 @@ See the `main.go` file inside the `cmd/webapi` for a full usage example.
 package api
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/julienschmidt/httprouter"
 	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/linkpreview"
+	"github.com/ozberk-sevinc/wasa-project/service/mailer"
+	"github.com/ozberk-sevinc/wasa-project/service/ratelimit"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+	"github.com/ozberk-sevinc/wasa-project/service/webpush"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"strings"
+	"sync"
 )
 
 // Config is used to provide dependencies and configuration to the New function.
@@ -51,6 +60,38 @@ type Config struct {
 
 	// Database is the instance of database.AppDatabase where data are saved
 	Database database.AppDatabase
+
+	// AccountDeletionPolicy is what happens to the messages of users deleting their account: anonymize (the default)
+	// or delete. See database.AppDatabase.DeleteAccount.
+	AccountDeletionPolicy string
+
+	// LinkPreviews fetches the previews of the links in text messages. Link previews are disabled when it is nil.
+	LinkPreviews *linkpreview.Fetcher
+
+	// Push sends Web Push notifications to offline users. Push notifications are disabled when it is nil.
+	Push *webpush.Sender
+
+	// Mailer sends the email digests of unread messages. Digests are disabled when it is nil.
+	Mailer mailer.Mailer
+
+	// DigestSecret signs the unsubscribe links of the digests. It is required with Mailer.
+	DigestSecret []byte
+
+	// PublicURL is the address of this API in links sent by email, like https://api.example.com, and WebUIURL the
+	// address of the web UI. They are required with Mailer.
+	PublicURL string
+	WebUIURL  string
+
+	// AdminUserIDs are the users who are server admins in addition to those granted the role in the database. They
+	// can't be suspended, banned or demoted through the API.
+	AdminUserIDs []string
+
+	// RateLimits throttles logins, messages, uploads and searches. Rate limiting is disabled when its Store is nil.
+	RateLimits RateLimits
+
+	// TextLimits are the maximum lengths of messages, group names and polls; limits not set are the defaults of
+	// validation.DefaultLimits
+	TextLimits validation.Limits
 }
 
 // Router is the package API interface representing an API handler builder
@@ -71,6 +112,27 @@ func New(cfg Config) (Router, error) {
 	if cfg.Database == nil {
 		return nil, errors.New("database is required")
 	}
+	switch cfg.AccountDeletionPolicy {
+	case "":
+		cfg.AccountDeletionPolicy = database.DeletionPolicyAnonymize
+	case database.DeletionPolicyAnonymize, database.DeletionPolicyRemove:
+	default:
+		return nil, errors.New("account deletion policy must be anonymize or delete")
+	}
+
+	if cfg.Mailer != nil {
+		if len(cfg.DigestSecret) == 0 {
+			return nil, errors.New("digest secret is required to send digests")
+		}
+		if cfg.PublicURL == "" || cfg.WebUIURL == "" {
+			return nil, errors.New("public URL and web UI URL are required to send digests")
+		}
+	}
+
+	// Exports interrupted by a restart are never completed
+	if err := cfg.Database.FailPendingAccountExports(); err != nil {
+		return nil, fmt.Errorf("resetting account exports: %w", err)
+	}
 
 	// Create a new router where we will register HTTP endpoints. The server will pass requests to this router to be
 	// handled.
@@ -86,12 +148,65 @@ func New(cfg Config) (Router, error) {
 	}
 	wsHub := NewWebSocketHub(logger)
 
-	return &_router{
-		router:     router,
-		baseLogger: cfg.Logger,
-		db:         cfg.Database,
-		wsHub:      wsHub,
-	}, nil
+	var rateLimiter *ratelimit.Limiter
+	if cfg.RateLimits.Store != nil {
+		var err error
+		if rateLimiter, err = ratelimit.NewLimiter(cfg.RateLimits.Store); err != nil {
+			return nil, fmt.Errorf("creating rate limiter: %w", err)
+		}
+	}
+
+	adminIDs := make(map[string]bool, len(cfg.AdminUserIDs))
+	for _, id := range cfg.AdminUserIDs {
+		adminIDs[id] = true
+	}
+
+	rt := &_router{
+		router:                router,
+		baseLogger:            cfg.Logger,
+		db:                    cfg.Database,
+		wsHub:                 wsHub,
+		commandInvocations:    newCommandInvocationStore(),
+		accountDeletionPolicy: cfg.AccountDeletionPolicy,
+		stopWorkers:           make(chan struct{}),
+		schedulerWake:         make(chan struct{}, 1),
+		linkPreviews:          cfg.LinkPreviews,
+		linkPreviewPending:    make(map[string][]pendingLinkPreview),
+		push:                  cfg.Push,
+		mailer:                cfg.Mailer,
+		digestSecret:          cfg.DigestSecret,
+		publicURL:             strings.TrimRight(cfg.PublicURL, "/"),
+		webUIURL:              strings.TrimRight(cfg.WebUIURL, "/"),
+		adminIDs:              adminIDs,
+		rateLimiter:           rateLimiter,
+		rateLimitRules: map[string]ratelimit.Rule{
+			rateLimitLogin:   cfg.RateLimits.Login,
+			rateLimitMessage: cfg.RateLimits.Message,
+			rateLimitUpload:  cfg.RateLimits.Upload,
+			rateLimitSearch:  cfg.RateLimits.Search,
+		},
+		clientIPHeader: cfg.RateLimits.ClientIPHeader,
+		textLimits:     cfg.TextLimits.WithDefaults(),
+	}
+
+	rt.background.Add(2)
+	go func() {
+		defer rt.background.Done()
+		rt.runExpiryWorker(rt.stopWorkers)
+	}()
+	go func() {
+		defer rt.background.Done()
+		rt.runScheduler(rt.stopWorkers)
+	}()
+	if rt.mailer != nil {
+		rt.background.Add(1)
+		go func() {
+			defer rt.background.Done()
+			rt.runDigestWorker(rt.stopWorkers)
+		}()
+	}
+
+	return rt, nil
 }
 
 type _router struct {
@@ -104,4 +219,61 @@ type _router struct {
 	db database.AppDatabase
 
 	wsHub *WebSocketHub
+
+	// commandInvocations holds the bot command invocations waiting for a reply
+	commandInvocations *commandInvocationStore
+
+	accountDeletionPolicy string
+
+	// background tracks the workers and the goroutines building account exports, which Close waits for
+	background sync.WaitGroup
+
+	// closed is set by Close; backgroundMu guards it, so that no background work starts once Close waits
+	closed       bool
+	backgroundMu sync.Mutex
+
+	// stopWorkers is closed by Close to stop the expiry worker, the scheduler and the digest worker
+	stopWorkers chan struct{}
+
+	// schedulerWake tells the scheduler that the schedule changed
+	schedulerWake chan struct{}
+
+	// schedulerMu is held while scheduled messages are sent, edited or cancelled
+	schedulerMu sync.Mutex
+
+	linkPreviews *linkpreview.Fetcher
+
+	// linkPreviewPending lists the messages waiting for each link preview being fetched
+	linkPreviewPending map[string][]pendingLinkPreview
+	linkPreviewMu      sync.Mutex
+
+	push *webpush.Sender
+
+	mailer       mailer.Mailer
+	digestSecret []byte
+	publicURL    string
+	webUIURL     string
+
+	// adminIDs are the admins from the configuration
+	adminIDs map[string]bool
+
+	// rateLimiter checks the rate limits of rateLimitRules; nil when rate limiting is disabled
+	rateLimiter    *ratelimit.Limiter
+	rateLimitRules map[string]ratelimit.Rule
+	clientIPHeader string
+
+	textLimits validation.Limits
+}
+
+// backgroundContext returns a context for the work of a background goroutine, cancelled on Close
+func (rt *_router) backgroundContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-rt.stopWorkers:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
 }
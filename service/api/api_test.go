@@ -0,0 +1,112 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+)
+
+// quietPeriod is how long a test waits to check that an event is not sent
+const quietPeriod = 200 * time.Millisecond
+
+// TestLogin checks that logging in creates a user once, and that the identifier authenticates them
+func TestLogin(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice := s.Login("alice")
+	if again := s.Login("alice"); again.ID != alice.ID {
+		t.Errorf("logging in again gave the identifier %s, expected %s", again.ID, alice.ID)
+	}
+	if bob := s.Login("bob"); bob.ID == alice.ID {
+		t.Errorf("alice and bob have the same identifier %s", bob.ID)
+	}
+
+	var me api.MeResponse
+	alice.Call(http.MethodGet, "/me", nil, &me, http.StatusOK)
+	if me.ID != alice.ID || me.Name != "alice" {
+		t.Errorf("GET /me returned %s (%s), expected alice (%s)", me.Name, me.ID, alice.ID)
+	}
+	if me.IsAdmin || me.UnreadCount != 0 {
+		t.Errorf("a new user is admin (%t) or has unread messages (%d)", me.IsAdmin, me.UnreadCount)
+	}
+
+	// The identifier opens the WebSocket too
+	alice.Connect().Close()
+}
+
+// TestLoginErrors checks that invalid logins and unauthenticated requests are rejected
+func TestLoginErrors(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	anonymous := s.Anonymous()
+	anonymous.Do(http.MethodPost, "/session", map[string]string{"name": "al"}).
+		ExpectError(http.StatusBadRequest, "validation-failed", "name:invalid-format")
+	anonymous.Do(http.MethodPost, "/session", "alice").ExpectError(http.StatusBadRequest, "invalid-json")
+	anonymous.Do(http.MethodGet, "/me", nil).ExpectError(http.StatusUnauthorized, "unauthorized")
+	if resp := anonymous.Do(http.MethodGet, "/ws?token=", nil); resp.Status != http.StatusUnauthorized {
+		t.Errorf("opening the WebSocket without an identifier: status %d, expected 401", resp.Status)
+	}
+}
+
+// ============================================================================
+// HELPERS
+// ============================================================================
+
+// textMessage is the body of a request sending a text message
+func textMessage(text string) map[string]string {
+	return map[string]string{"contentType": "text", "text": text}
+}
+
+// text returns the text of a message, or "" if it has none
+func text(m api.MessageResponse) string {
+	if m.Text == nil {
+		return ""
+	}
+	return *m.Text
+}
+
+// timestamp formats a time as the server does
+func timestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// startConversation starts the direct conversation of two users, and returns its identifier
+func startConversation(from, to *apitest.Client) string {
+	var conv api.ConversationResponse
+	from.Call(http.MethodPost, "/conversations", map[string]string{"userId": to.ID}, &conv, http.StatusCreated)
+	return conv.ID
+}
+
+// getMessage returns a message of a conversation, as a participant sees it when reading the conversation
+func getMessage(t *testing.T, c *apitest.Client, conversationID, messageID string) api.MessageResponse {
+	t.Helper()
+	var conv api.ConversationResponse
+	c.Call(http.MethodGet, "/conversations/"+conversationID, nil, &conv, http.StatusOK)
+	for _, m := range conv.Messages {
+		if m.ID == messageID {
+			return m
+		}
+	}
+	t.Fatalf("%s doesn't see the message %s", c.Name, messageID)
+	return api.MessageResponse{}
+}
+
+// expectReactions checks the number of reactions to a message
+func expectReactions(t *testing.T, c *apitest.Client, messagePath string, want int) {
+	t.Helper()
+	var list api.ReactionListResponse
+	c.Call(http.MethodGet, messagePath+"/reactions", nil, &list, http.StatusOK)
+	if len(list.Reactions) != want {
+		t.Errorf("the message has %d reactions, expected %d", len(list.Reactions), want)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
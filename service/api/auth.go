@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
 	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
 	"github.com/sirupsen/logrus"
 )
 
@@ -43,6 +45,7 @@ func (rt *_router) authWrap(fn httpRouterHandler) func(http.ResponseWriter, *htt
 				"remote-ip": r.RemoteAddr,
 			}),
 		}
+		w.Header().Set(requestIDHeader, reqUUID.String())
 
 		// Get Authorization header
 		authHeader := r.Header.Get("Authorization")
@@ -69,6 +72,20 @@ func (rt *_router) authWrap(fn httpRouterHandler) func(http.ResponseWriter, *htt
 			sendUnauthorized(w, "Invalid identifier")
 			return
 		}
+		inactive, err := rt.db.IsInactiveUser(user.ID)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("database error looking up user")
+			sendInternalError(w, "Database error")
+			return
+		}
+		if inactive {
+			sendUnauthorized(w, "Invalid identifier")
+			return
+		}
+		if err := rt.checkAccountStatus(user.ID); err != nil {
+			sendResolveError(w, ctx.Logger, err)
+			return
+		}
 
 		// Add user to request context
 		reqCtx := context.WithValue(r.Context(), userContextKey, user)
@@ -77,3 +94,36 @@ func (rt *_router) authWrap(fn httpRouterHandler) func(http.ResponseWriter, *htt
 		fn(w, r.WithContext(reqCtx), ps, ctx)
 	}
 }
+
+// checkAccountStatus rejects users whose account is suspended or banned. Suspensions end by themselves once their end
+// has passed. Errors caused by the account status are returned as *requestError.
+func (rt *_router) checkAccountStatus(userID string) error {
+	status, err := rt.db.GetAccountStatus(userID)
+	if err != nil {
+		return fmt.Errorf("getting account status: %w", err)
+	}
+
+	var code errorCode
+	var message string
+	switch status.Status {
+	case database.AccountSuspended:
+		now := globaltime.Now().UTC().Format("2006-01-02T15:04:05Z")
+		if status.SuspendedUntil != nil && *status.SuspendedUntil <= now {
+			return nil
+		}
+		code = codeAccountSuspended
+		message = "Your account is suspended"
+		if status.SuspendedUntil != nil {
+			message += " until " + *status.SuspendedUntil
+		}
+	case database.AccountBanned:
+		code = codeAccountBanned
+		message = "Your account is banned"
+	default:
+		return nil
+	}
+	if status.Reason != nil {
+		message += ": " + *status.Reason
+	}
+	return newRequestError(http.StatusForbidden, code, message)
+}
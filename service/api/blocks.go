@@ -0,0 +1,214 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/sirupsen/logrus"
+)
+
+// BlockResponse matches the Block schema
+type BlockResponse struct {
+	User      UserResponse `json:"user"`
+	BlockedAt string       `json:"blockedAt"`
+}
+
+// blockUser handles POST /me/blocks/{userId}
+// Blocked users can't message the current user in direct conversations or add them to groups, don't see their
+// profile photo, and their activity is no longer delivered to the current user. Blocking a blocked user does nothing.
+func (rt *_router) blockUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	blockedID := ps.ByName("userId")
+	if blockedID == user.ID {
+		sendBadRequest(w, "You can't block yourself")
+		return
+	}
+	blocked, err := rt.db.GetUserByID(blockedID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting user")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if blocked == nil {
+		sendNotFound(w, "User not found")
+		return
+	}
+
+	err = rt.db.BlockUser(database.Block{
+		BlockerID: user.ID,
+		BlockedID: blocked.ID,
+		CreatedAt: globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("error blocking user")
+		sendInternalError(w, "Error blocking user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unblockUser handles DELETE /me/blocks/{userId}
+func (rt *_router) unblockUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	blockedID := ps.ByName("userId")
+	blocked, err := rt.db.IsBlocked(user.ID, blockedID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting block")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if !blocked {
+		sendNotFound(w, "User is not blocked")
+		return
+	}
+
+	if err := rt.db.UnblockUser(user.ID, blockedID); err != nil {
+		ctx.Logger.WithError(err).Error("error unblocking user")
+		sendInternalError(w, "Error unblocking user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listBlocks handles GET /me/blocks, the most recently blocked first
+func (rt *_router) listBlocks(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	blocks, err := rt.db.GetBlocks(user.ID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting blocks")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	var userIDs []string
+	for _, b := range blocks {
+		userIDs = append(userIDs, b.BlockedID)
+	}
+	users, err := rt.db.GetUsersByIDs(userIDs)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting users")
+		sendInternalError(w, "Database error")
+		return
+	}
+	userMap := make(map[string]database.User)
+	for _, u := range users {
+		userMap[u.ID] = u
+	}
+
+	response := make([]BlockResponse, 0, len(blocks))
+	for _, b := range blocks {
+		u, ok := userMap[b.BlockedID]
+		if !ok {
+			continue
+		}
+		response = append(response, BlockResponse{
+			User: UserResponse{
+				ID:          u.ID,
+				Name:        u.Name,
+				DisplayName: u.DisplayName,
+				PhotoURL:    u.PhotoURL,
+			},
+			BlockedAt: b.CreatedAt,
+		})
+	}
+	sendJSON(w, http.StatusOK, response)
+}
+
+// blockedBy returns the users who blocked `viewerID`. Their profile photos are hidden from the viewer.
+func (rt *_router) blockedBy(logger logrus.FieldLogger, viewerID string) map[string]bool {
+	blockerIDs, err := rt.db.GetBlockerIDs(viewerID)
+	if err != nil {
+		logger.WithError(err).Warn("error getting blockers")
+	}
+	blockers := make(map[string]bool, len(blockerIDs))
+	for _, id := range blockerIDs {
+		blockers[id] = true
+	}
+	return blockers
+}
+
+// visiblePhoto returns the profile photo of `userID`, unless they blocked the viewer (see blockedBy)
+func visiblePhoto(blockers map[string]bool, userID string, photoURL *string) *string {
+	if blockers[userID] {
+		return nil
+	}
+	return photoURL
+}
+
+// withoutBlockersOf removes from `userIDs` the users who blocked `actorID`, so that they don't receive the events of
+// their activity
+func (rt *_router) withoutBlockersOf(logger logrus.FieldLogger, actorID string, userIDs []string) []string {
+	blockers := rt.blockedBy(logger, actorID)
+	if len(blockers) == 0 {
+		return userIDs
+	}
+	filtered := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if !blockers[id] {
+			filtered = append(filtered, id)
+		}
+	}
+	return filtered
+}
+
+// checkDirectMessage rejects a message from `senderID` in a direct conversation where either participant blocked
+// the other. Errors caused by the block are returned as *requestError.
+func (rt *_router) checkDirectMessage(senderID string, conv *database.Conversation) error {
+	if conv.Type != "direct" {
+		return nil
+	}
+	participants, err := rt.db.GetParticipants(conv.ID)
+	if err != nil {
+		return fmt.Errorf("getting participants: %w", err)
+	}
+	for _, p := range participants {
+		if p.ID == senderID {
+			continue
+		}
+		if blocked, err := rt.db.IsBlocked(p.ID, senderID); err != nil {
+			return fmt.Errorf("checking block: %w", err)
+		} else if blocked {
+			return newRequestError(http.StatusForbidden, codeBlocked, "You can't send messages to this user")
+		}
+		if blocked, err := rt.db.IsBlocked(senderID, p.ID); err != nil {
+			return fmt.Errorf("checking block: %w", err)
+		} else if blocked {
+			return newRequestError(http.StatusForbidden, codeBlocked, "Unblock this user to send them messages")
+		}
+	}
+	return nil
+}
+
+// checkCanAdd rejects adding `userID` to a group by `actorID` when the user blocked the actor. Errors caused by the
+// block are returned as *requestError.
+func (rt *_router) checkCanAdd(actorID, userID string) error {
+	blocked, err := rt.db.IsBlocked(userID, actorID)
+	if err != nil {
+		return fmt.Errorf("checking block: %w", err)
+	}
+	if blocked {
+		return newRequestError(http.StatusForbidden, codeBlocked, "You can't add this user to groups")
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package api_test
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+	"github.com/ozberk-sevinc/wasa-project/service/linkpreview"
+)
+
+// TestBlockedUserEvents checks that the members of a group who blocked a user don't get the events of what that user
+// does: the preview of their links, and their pins
+func TestBlockedUserEvents(t *testing.T) {
+	site, _ := startSite(t)
+	s := apitest.Start(t, apitest.Options{
+		Configure: func(cfg *api.Config) error {
+			cfg.LinkPreviews = linkpreview.NewFetcher(linkpreview.Config{
+				AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+			})
+			return nil
+		},
+	})
+	alice, bob, carol := s.Login("alice"), s.Login("bob"), s.Login("carol")
+	var group api.GroupResponse
+	create := map[string]interface{}{"name": "Crag", "memberIds": []string{bob.ID, carol.ID}}
+	alice.Call(http.MethodPost, "/groups", create, &group, http.StatusCreated)
+	bob.Call(http.MethodPost, "/me/blocks/"+alice.ID, nil, nil, http.StatusNoContent)
+	bobEvents, carolEvents := bob.Connect(), carol.Connect()
+	c := "/conversations/" + group.ID
+
+	var link api.MessageResponse
+	alice.Call(http.MethodPost, c+"/messages", textMessage(site.URL+"/article"), &link, http.StatusCreated)
+	carolEvents.WaitWith("message_updated", "messageId", link.ID)
+	bobEvents.ExpectNone("message_updated", quietPeriod)
+
+	alice.Call(http.MethodPut, c+"/messages/"+link.ID+"/pin", nil, nil, http.StatusOK)
+	carolEvents.Wait("message_pinned")
+	alice.Call(http.MethodDelete, c+"/messages/"+link.ID+"/pin", nil, nil, http.StatusNoContent)
+	carolEvents.Wait("message_unpinned")
+	bobEvents.ExpectNone("message_pinned", quietPeriod)
+	bobEvents.ExpectNone("message_unpinned", quietPeriod)
+
+	// A pin of a message of alice shows it: bob doesn't get it either, whoever pins it
+	carol.Call(http.MethodPut, c+"/messages/"+link.ID+"/pin", nil, nil, http.StatusOK)
+	carolEvents.Wait("message_pinned")
+	bobEvents.ExpectNone("message_pinned", quietPeriod)
+
+	// The events of the others still reach bob
+	var own api.MessageResponse
+	carol.Call(http.MethodPost, c+"/messages", textMessage("Mine"), &own, http.StatusCreated)
+	carol.Call(http.MethodPut, c+"/messages/"+own.ID+"/pin", nil, nil, http.StatusOK)
+	bobEvents.Wait("message_pinned")
+}
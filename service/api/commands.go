@@ -0,0 +1,623 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+	"github.com/sirupsen/logrus"
+)
+
+// commandInvocationTTL is how long a bot can answer to a command invocation
+const commandInvocationTTL = 15 * time.Minute
+
+// maxCommandHintLength is the maximum length of the description and usage of a command, in characters
+const maxCommandHintLength = 200
+
+// Usage of the built-in commands, shown in autocomplete and when a command is invoked with wrong arguments
+const (
+	meCommandUsage    = "/me <action>"
+	shrugCommandUsage = "/shrug [message]"
+	pollCommandUsage  = "/poll <question> | <option> | <option> [| ...]"
+)
+
+// commandNamePattern is the set of valid command names, both built-in and registered by bots
+var commandNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// ============================================================================
+// COMMAND TYPES
+// ============================================================================
+
+// commandInvocation is a parsed slash command and the context it was invoked in
+type commandInvocation struct {
+	Name             string
+	Args             string
+	Caller           *database.User
+	ConversationID   string
+	ReplyToMessageID *string
+	Logger           logrus.FieldLogger
+}
+
+// commandReply is the answer of a command handler. Ephemeral replies are shown only to the caller, the others are
+// posted in the conversation as a message from the caller.
+type commandReply struct {
+	Text      string
+	Ephemeral bool
+	Poll      *database.Poll
+}
+
+// commandHandler runs a built-in command
+type commandHandler func(rt *_router, inv commandInvocation) (*commandReply, error)
+
+// builtinCommand describes a command implemented by the server itself
+type builtinCommand struct {
+	Description string
+	Usage       string
+	Handler     commandHandler
+}
+
+// builtinCommands are available in every conversation. Bots can't register commands with the same names.
+var builtinCommands = map[string]builtinCommand{
+	"me": {
+		Description: "Send an action message, like \"* alice waves\"",
+		Usage:       meCommandUsage,
+		Handler:     runMeCommand,
+	},
+	"shrug": {
+		Description: "Append ¯\\_(ツ)_/¯ to your message",
+		Usage:       shrugCommandUsage,
+		Handler:     runShrugCommand,
+	},
+	"poll": {
+		Description: "Start a poll",
+		Usage:       pollCommandUsage,
+		Handler:     runPollCommand,
+	},
+}
+
+// parseSlashCommand splits a message like "/name some args" into the command name and its arguments. It returns false
+// if the text is not shaped like a command.
+func parseSlashCommand(text string) (string, string, bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+	name, args, _ := strings.Cut(text[1:], " ")
+	name = strings.ToLower(name)
+	if !commandNamePattern.MatchString(name) {
+		return "", "", false
+	}
+	return name, strings.TrimSpace(args), true
+}
+
+// ============================================================================
+// BUILT-IN COMMANDS
+// ============================================================================
+
+func runMeCommand(rt *_router, inv commandInvocation) (*commandReply, error) {
+	if inv.Args == "" {
+		return &commandReply{Text: "Usage: " + meCommandUsage, Ephemeral: true}, nil
+	}
+	return &commandReply{Text: fmt.Sprintf("* %s %s", inv.Caller.Name, inv.Args)}, nil
+}
+
+func runShrugCommand(rt *_router, inv commandInvocation) (*commandReply, error) {
+	return &commandReply{Text: strings.TrimSpace(inv.Args + ` ¯\_(ツ)_/¯`)}, nil
+}
+
+func runPollCommand(rt *_router, inv commandInvocation) (*commandReply, error) {
+	var parts []string
+	for _, p := range strings.Split(inv.Args, "|") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) < 3 {
+		return &commandReply{Text: "Usage: " + pollCommandUsage, Ephemeral: true}, nil
+	}
+
+	poll, err := newPoll(&PollRequest{Question: parts[0], Options: parts[1:]}, rt.textLimits)
+	if err != nil {
+		if reqErr, ok := asRequestError(err); ok {
+			return &commandReply{Text: reqErr.message, Ephemeral: true}, nil
+		}
+		return nil, err
+	}
+	return &commandReply{Text: poll.Question, Poll: poll}, nil
+}
+
+// ============================================================================
+// DISPATCH
+// ============================================================================
+
+// runSlashCommand dispatches a command to its built-in handler or to the bot that registered it in the conversation.
+// It returns false if no such command exists, in which case the text should be sent as a regular message.
+func (rt *_router) runSlashCommand(inv commandInvocation) (*messageSubmission, bool, error) {
+	if builtin, ok := builtinCommands[inv.Name]; ok {
+		reply, err := builtin.Handler(rt, inv)
+		if err != nil {
+			return nil, true, fmt.Errorf("running /%s: %w", inv.Name, err)
+		}
+		submission, err := rt.applyCommandReply(inv, reply)
+		return submission, true, err
+	}
+
+	botCommand, err := rt.db.GetConversationCommand(inv.ConversationID, inv.Name)
+	if err != nil {
+		return nil, true, fmt.Errorf("looking up command: %w", err)
+	}
+	if botCommand == nil {
+		return nil, false, nil
+	}
+
+	invocationID, _ := uuid.NewV4()
+	result := &CommandResultResponse{Command: inv.Name}
+
+	if !rt.wsHub.IsConnected(botCommand.BotUserID) {
+		ephemeral := rt.sendEphemeral(inv.Caller.ID, inv.ConversationID, inv.Name, "The bot handling /"+inv.Name+" is not available right now")
+		result.Ephemeral = &ephemeral
+		return &messageSubmission{Command: result}, true, nil
+	}
+
+	rt.commandInvocations.add(invocationID.String(), pendingInvocation{
+		Invocation: inv,
+		BotUserID:  botCommand.BotUserID,
+		ExpiresAt:  globaltime.Now().Add(commandInvocationTTL),
+	})
+
+	_ = rt.wsHub.SendToUser(botCommand.BotUserID, WebSocketMessage{
+		Type: "command_invoked",
+		Payload: map[string]interface{}{
+			"invocationId":     invocationID.String(),
+			"conversationId":   inv.ConversationID,
+			"command":          inv.Name,
+			"args":             inv.Args,
+			"replyToMessageId": inv.ReplyToMessageID,
+			"caller": UserResponse{
+				ID:          inv.Caller.ID,
+				Name:        inv.Caller.Name,
+				DisplayName: inv.Caller.DisplayName,
+				PhotoURL:    inv.Caller.PhotoURL,
+			},
+		},
+	})
+
+	invocationIDString := invocationID.String()
+	result.InvocationID = &invocationIDString
+	return &messageSubmission{Command: result}, true, nil
+}
+
+// applyCommandReply posts a public reply as a message from the caller, or pushes an ephemeral one to the caller only
+func (rt *_router) applyCommandReply(inv commandInvocation, reply *commandReply) (*messageSubmission, error) {
+	if reply == nil {
+		return &messageSubmission{Command: &CommandResultResponse{Command: inv.Name}}, nil
+	}
+
+	if reply.Ephemeral {
+		ephemeral := rt.sendEphemeral(inv.Caller.ID, inv.ConversationID, inv.Name, reply.Text)
+		return &messageSubmission{Command: &CommandResultResponse{Command: inv.Name, Ephemeral: &ephemeral}}, nil
+	}
+
+	contentType := "text"
+	if reply.Poll != nil {
+		contentType = contentTypePoll
+	}
+
+	msgID, _ := uuid.NewV4()
+	text := reply.Text
+	messageResponse, err := rt.deliverMessage(inv.Logger, inv.Caller, database.Message{
+		ID:                 msgID.String(),
+		ConversationID:     inv.ConversationID,
+		SenderID:           inv.Caller.ID,
+		CreatedAt:          globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		ContentType:        contentType,
+		Text:               &text,
+		RepliedToMessageID: inv.ReplyToMessageID,
+		Status:             database.StatusSent,
+	}, reply.Poll)
+	if err != nil {
+		return nil, err
+	}
+	return &messageSubmission{Message: &messageResponse}, nil
+}
+
+// sendEphemeral pushes a message that is not stored to a single user, over their WebSocket connection
+func (rt *_router) sendEphemeral(userID, conversationID, command, text string) EphemeralMessageResponse {
+	id, _ := uuid.NewV4()
+	ephemeral := EphemeralMessageResponse{
+		ID:             id.String(),
+		ConversationID: conversationID,
+		Command:        command,
+		Text:           text,
+		CreatedAt:      globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	_ = rt.wsHub.SendToUser(userID, WebSocketMessage{
+		Type:    "ephemeral_message",
+		Payload: ephemeral,
+	})
+	return ephemeral
+}
+
+// ============================================================================
+// PENDING BOT INVOCATIONS
+// ============================================================================
+
+// pendingInvocation is a bot command invocation waiting for the bot to reply
+type pendingInvocation struct {
+	Invocation commandInvocation
+	BotUserID  string
+	ExpiresAt  time.Time
+}
+
+// commandInvocationStore keeps bot command invocations in memory until they expire
+type commandInvocationStore struct {
+	mu      sync.Mutex
+	pending map[string]pendingInvocation
+}
+
+func newCommandInvocationStore() *commandInvocationStore {
+	return &commandInvocationStore{
+		pending: make(map[string]pendingInvocation),
+	}
+}
+
+func (s *commandInvocationStore) add(id string, inv pendingInvocation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop expired invocations while we hold the lock
+	now := globaltime.Now()
+	for k, v := range s.pending {
+		if now.After(v.ExpiresAt) {
+			delete(s.pending, k)
+		}
+	}
+	s.pending[id] = inv
+}
+
+func (s *commandInvocationStore) get(id string) (pendingInvocation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, ok := s.pending[id]
+	if !ok || globaltime.Now().After(inv.ExpiresAt) {
+		return pendingInvocation{}, false
+	}
+	return inv, true
+}
+
+// ============================================================================
+// COMMAND REQUEST / RESPONSE TYPES
+// ============================================================================
+
+// CommandResponse matches the Command schema
+type CommandResponse struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Usage       string        `json:"usage"`
+	Builtin     bool          `json:"builtin"`
+	Bot         *UserResponse `json:"bot,omitempty"`
+}
+
+// CommandListResponse matches the CommandList schema: the response for GET /conversations/{id}/commands
+type CommandListResponse struct {
+	Commands []CommandResponse `json:"commands"`
+}
+
+// RegisterCommandRequest matches the RegisterCommandRequest schema: the request body for PUT
+// /conversations/{id}/commands/{commandName}
+type RegisterCommandRequest struct {
+	Description string `json:"description"`
+	Usage       string `json:"usage"`
+}
+
+// CommandReplyRequest matches the CommandReplyRequest schema: the request body for POST
+// /conversations/{id}/command-invocations/{invocationId}/reply
+type CommandReplyRequest struct {
+	Text      string `json:"text"`
+	Ephemeral bool   `json:"ephemeral"`
+}
+
+// EphemeralMessageResponse matches the EphemeralMessage schema. Ephemeral messages are never stored.
+type EphemeralMessageResponse struct {
+	ID             string `json:"id"`
+	ConversationID string `json:"conversationId"`
+	Command        string `json:"command"`
+	Text           string `json:"text"`
+	CreatedAt      string `json:"createdAt"`
+}
+
+// CommandResultResponse matches the CommandResult schema, returned when a command did not post a public message
+type CommandResultResponse struct {
+	Command      string                    `json:"command"`
+	Ephemeral    *EphemeralMessageResponse `json:"ephemeral,omitempty"`
+	InvocationID *string                   `json:"invocationId,omitempty"`
+}
+
+// ============================================================================
+// COMMAND ENDPOINTS
+// ============================================================================
+
+// listCommands handles GET /conversations/{conversationId}/commands - autocomplete for slash commands
+func (rt *_router) listCommands(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+	prefix := strings.ToLower(strings.TrimPrefix(r.URL.Query().Get("prefix"), "/"))
+
+	if _, err := rt.resolveConversation(user.ID, conversationID); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	commands := []CommandResponse{}
+	for name, c := range builtinCommands {
+		if strings.HasPrefix(name, prefix) {
+			commands = append(commands, CommandResponse{
+				Name:        name,
+				Description: c.Description,
+				Usage:       c.Usage,
+				Builtin:     true,
+			})
+		}
+	}
+
+	botCommands, err := rt.db.GetConversationCommands(conversationID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting commands")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	var botIDs []string
+	for _, c := range botCommands {
+		botIDs = append(botIDs, c.BotUserID)
+	}
+	bots, err := rt.db.GetUsersByIDs(botIDs)
+	if err != nil {
+		ctx.Logger.WithError(err).Warn("error fetching bots in batch")
+		bots = []database.User{}
+	}
+	botMap := make(map[string]database.User)
+	for _, b := range bots {
+		botMap[b.ID] = b
+	}
+
+	for _, c := range botCommands {
+		if !strings.HasPrefix(c.Name, prefix) {
+			continue
+		}
+		bot := botMap[c.BotUserID]
+		commands = append(commands, CommandResponse{
+			Name:        c.Name,
+			Description: c.Description,
+			Usage:       c.Usage,
+			Bot: &UserResponse{
+				ID:          bot.ID,
+				Name:        bot.Name,
+				DisplayName: bot.DisplayName,
+				PhotoURL:    bot.PhotoURL,
+			},
+		})
+	}
+
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+
+	sendJSON(w, http.StatusOK, CommandListResponse{Commands: commands})
+}
+
+// registerCommand handles PUT /conversations/{conversationId}/commands/{commandName}
+// The caller registers the command as a bot: invocations are delivered to its WebSocket as "command_invoked" events
+func (rt *_router) registerCommand(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+	name := ps.ByName("commandName")
+
+	if _, err := rt.resolveConversation(user.ID, conversationID); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	var req RegisterCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendInvalidJSON(w)
+		return
+	}
+
+	if !commandNamePattern.MatchString(name) {
+		sendFieldError(w, "name", validation.CodeInvalidFormat, "Command names must be 1-32 lowercase letters, digits or underscores")
+		return
+	}
+	// The description and usage are optional, and shown on a single line
+	for _, hint := range []struct {
+		field string
+		value *string
+	}{{"description", &req.Description}, {"usage", &req.Usage}} {
+		if strings.TrimSpace(*hint.value) == "" {
+			*hint.value = ""
+			continue
+		}
+		text, err := validation.Line(hint.field, *hint.value, maxCommandHintLength)
+		if err != nil {
+			sendResolveError(w, ctx.Logger, newFieldError(err))
+			return
+		}
+		*hint.value = text
+	}
+	if _, ok := builtinCommands[name]; ok {
+		sendConflict(w, "This is a built-in command")
+		return
+	}
+
+	existing, err := rt.db.GetConversationCommand(conversationID, name)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if existing != nil && existing.BotUserID != user.ID {
+		sendConflict(w, "Another bot already registered this command")
+		return
+	}
+
+	if err := rt.db.UpsertConversationCommand(database.ConversationCommand{
+		ConversationID: conversationID,
+		Name:           name,
+		BotUserID:      user.ID,
+		Description:    req.Description,
+		Usage:          req.Usage,
+		CreatedAt:      globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}); err != nil {
+		ctx.Logger.WithError(err).Error("error registering command")
+		sendInternalError(w, "Error registering command")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, CommandResponse{
+		Name:        name,
+		Description: req.Description,
+		Usage:       req.Usage,
+		Bot: &UserResponse{
+			ID:          user.ID,
+			Name:        user.Name,
+			DisplayName: user.DisplayName,
+			PhotoURL:    user.PhotoURL,
+		},
+	})
+}
+
+// unregisterCommand handles DELETE /conversations/{conversationId}/commands/{commandName}
+func (rt *_router) unregisterCommand(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+	name := ps.ByName("commandName")
+
+	if _, err := rt.resolveConversation(user.ID, conversationID); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	existing, err := rt.db.GetConversationCommand(conversationID, name)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if existing == nil {
+		sendNotFound(w, "Command not found")
+		return
+	}
+	if existing.BotUserID != user.ID {
+		sendForbidden(w, "You can only remove your own commands")
+		return
+	}
+
+	if err := rt.db.DeleteConversationCommand(conversationID, name); err != nil {
+		ctx.Logger.WithError(err).Error("error removing command")
+		sendInternalError(w, "Error removing command")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// replyToCommand handles POST /conversations/{conversationId}/command-invocations/{invocationId}/reply
+// Only the bot that received the invocation can reply, either publicly or to the caller only
+func (rt *_router) replyToCommand(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+
+	pending, ok := rt.commandInvocations.get(ps.ByName("invocationId"))
+	if !ok || pending.BotUserID != user.ID || pending.Invocation.ConversationID != conversationID {
+		sendNotFound(w, "Invocation not found or expired")
+		return
+	}
+
+	var req CommandReplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendInvalidJSON(w)
+		return
+	}
+	if req.Text == "" {
+		sendFieldError(w, "text", validation.CodeRequired, "text is required")
+		return
+	}
+
+	// Replies are checked like the messages users send
+	inv := pending.Invocation
+	if req.Ephemeral {
+		text, err := validation.Paragraph("text", req.Text, rt.textLimits.MessageText)
+		if err != nil {
+			sendResolveError(w, ctx.Logger, newFieldError(err))
+			return
+		}
+		sendJSON(w, http.StatusOK, rt.sendEphemeral(inv.Caller.ID, conversationID, inv.Name, text))
+		return
+	}
+
+	// Public replies are regular messages from the bot, so the bot must still be in the conversation. They are not
+	// parsed for commands, so bots can't trigger each other.
+	conv, err := rt.resolveConversation(user.ID, conversationID)
+	if err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+	if err := rt.checkDirectMessage(user.ID, conv); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+	reply := SendMessageRequest{ContentType: "text", Text: &req.Text}
+	if _, err := rt.prepareMessage(conversationID, &reply); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	msgID, _ := uuid.NewV4()
+	messageResponse, err := rt.deliverMessage(ctx.Logger, user, database.Message{
+		ID:             msgID.String(),
+		ConversationID: conversationID,
+		SenderID:       user.ID,
+		CreatedAt:      globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		ContentType:    reply.ContentType,
+		Text:           reply.Text,
+		Status:         database.StatusSent,
+	}, nil)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("error sending command reply")
+		sendInternalError(w, "Error creating message")
+		return
+	}
+
+	sendJSON(w, http.StatusCreated, messageResponse)
+}
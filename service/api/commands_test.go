@@ -0,0 +1,87 @@
+package api_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+)
+
+// invokeBot registers `bot` for /deploy in a conversation, has `caller` invoke it, and returns the path of the reply
+func invokeBot(caller, bot *apitest.Client, botEvents *apitest.Socket, conversationID string) string {
+	c := "/conversations/" + conversationID
+	register := api.RegisterCommandRequest{Description: "Deploy the current build", Usage: "/deploy <environment>"}
+	bot.Call(http.MethodPut, c+"/commands/deploy", register, nil, http.StatusOK)
+	caller.Call(http.MethodPost, c+"/messages", textMessage("/deploy staging"), nil, http.StatusAccepted)
+	var invocation struct {
+		InvocationID string `json:"invocationId"`
+	}
+	botEvents.Wait("command_invoked").Decode(&invocation)
+	return c + "/command-invocations/" + invocation.InvocationID + "/reply"
+}
+
+// TestCommandReply checks that the replies of bots are checked and delivered like the messages users send
+func TestCommandReply(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	timer := 3600
+	alice.Call(http.MethodPut, "/conversations/"+conv+"/settings",
+		api.UpdateConversationSettingsRequest{DisappearingTimer: &timer}, nil, http.StatusOK)
+	reply := invokeBot(alice, bob, bob.Connect(), conv)
+
+	var public api.MessageResponse
+	bob.Call(http.MethodPost, reply, api.CommandReplyRequest{Text: "Cafe\u0301 deployed"}, &public,
+		http.StatusCreated)
+	if text(public) != "Caf\u00E9 deployed" {
+		t.Errorf("the public reply is %+q, expected it normalised", text(public))
+	}
+	if public.ExpiresAfter != timer {
+		t.Errorf("the public reply expires after %d seconds, expected the %d of the conversation",
+			public.ExpiresAfter, timer)
+	}
+
+	var ephemeral api.EphemeralMessageResponse
+	bob.Call(http.MethodPost, reply, api.CommandReplyRequest{Text: "Cafe\u0301", Ephemeral: true}, &ephemeral,
+		http.StatusOK)
+	if ephemeral.Text != "Caf\u00E9" {
+		t.Errorf("the ephemeral reply is %+q, expected it normalised", ephemeral.Text)
+	}
+
+	long := strings.Repeat("a", validation.DefaultLimits.MessageText+1)
+	bob.Do(http.MethodPost, reply, api.CommandReplyRequest{Text: long}).
+		ExpectError(http.StatusBadRequest, "validation-failed", "text:too-long")
+	bob.Do(http.MethodPost, reply, api.CommandReplyRequest{Text: "a\u202Eb", Ephemeral: true}).
+		ExpectError(http.StatusBadRequest, "validation-failed", "text:control-character")
+	bob.Do(http.MethodPost, reply, api.CommandReplyRequest{Text: ""}).
+		ExpectError(http.StatusBadRequest, "validation-failed", "text:required")
+
+	// Bots blocked by the caller can't reply publicly in their direct conversation
+	alice.Call(http.MethodPost, "/me/blocks/"+bob.ID, nil, nil, http.StatusNoContent)
+	bob.Do(http.MethodPost, reply, api.CommandReplyRequest{Text: "Done"}).
+		ExpectError(http.StatusForbidden, "blocked")
+}
+
+// TestRegisterCommand checks that the description and usage of a command are single lines, limited in characters
+func TestRegisterCommand(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	c := "/conversations/" + startConversation(alice, bob) + "/commands/deploy"
+
+	var command api.CommandResponse
+	longest := strings.Repeat("\u00E9", 200)
+	register := api.RegisterCommandRequest{Description: longest, Usage: "/deploy e\u0301"}
+	bob.Call(http.MethodPut, c, register, &command, http.StatusOK)
+	if command.Description != longest || command.Usage != "/deploy \u00E9" {
+		t.Errorf("registered %+q with the usage %+q, expected them normalised", command.Description, command.Usage)
+	}
+	bob.Call(http.MethodPut, c, api.RegisterCommandRequest{}, &command, http.StatusOK)
+
+	bob.Do(http.MethodPut, c, api.RegisterCommandRequest{Description: longest + "\u00E9"}).
+		ExpectError(http.StatusBadRequest, "validation-failed", "description:too-long")
+	bob.Do(http.MethodPut, c, api.RegisterCommandRequest{Usage: "/deploy\n<environment>"}).
+		ExpectError(http.StatusBadRequest, "validation-failed", "usage:control-character")
+}
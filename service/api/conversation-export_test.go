@@ -0,0 +1,119 @@
+package api_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+	"github.com/ozberk-sevinc/wasa-project/service/chatexport"
+)
+
+// TestConversationExport checks that a conversation is exported with its messages, reactions and photos, in every
+// format, and with the photos bundled in a ZIP archive
+func TestConversationExport(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob, carol := s.Login("alice"), s.Login("bob"), s.Login("carol")
+	conv := startConversation(alice, bob)
+	c := "/conversations/" + conv
+
+	var hello, photo, reply api.MessageResponse
+	alice.Call(http.MethodPost, c+"/messages", textMessage("Hello <b>bob</b>"), &hello, http.StatusCreated)
+	var uploaded struct {
+		PhotoURL string `json:"photoUrl"`
+	}
+	alice.Upload(http.MethodPost, c+"/photos", "photo", "beach.png", apitest.Photo(), nil, &uploaded, http.StatusOK)
+	alice.Call(http.MethodPost, c+"/messages", map[string]string{"contentType": "photo", "photoUrl": uploaded.PhotoURL},
+		&photo, http.StatusCreated)
+	bob.Call(http.MethodPost, c+"/messages/"+hello.ID+"/comments", map[string]string{"emoji": "\U0001F44D"}, nil,
+		http.StatusCreated)
+	bob.Call(http.MethodPost, c+"/messages", map[string]string{
+		"contentType": "text", "text": "Nice", "replyToMessageId": photo.ID,
+	}, &reply, http.StatusCreated)
+
+	resp := alice.Do(http.MethodGet, c+"/export", nil)
+	if resp.Status != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" ||
+		!strings.Contains(resp.Header.Get("Content-Disposition"), `filename="conversation-`+conv+`.json"`) {
+		t.Fatalf("exporting: status %d, %s, %s", resp.Status, resp.Header.Get("Content-Type"),
+			resp.Header.Get("Content-Disposition"))
+	}
+	var doc chatexport.Document
+	resp.Decode(&doc)
+	if doc.Conversation.ID != conv || doc.Conversation.Title != "bob" || len(doc.Conversation.Participants) != 2 ||
+		doc.Conversation.ExportedBy.ID != alice.ID {
+		t.Errorf("exported %s %q with %d participants by %s, expected the conversation with bob by alice",
+			doc.Conversation.ID, doc.Conversation.Title, len(doc.Conversation.Participants),
+			doc.Conversation.ExportedBy.Name)
+	}
+	if len(doc.Messages) != 3 {
+		t.Fatalf("exported %d messages, expected 3", len(doc.Messages))
+	}
+	first, second, third := doc.Messages[0], doc.Messages[1], doc.Messages[2]
+	if first.ID != hello.ID || len(first.Reactions) != 1 || first.Reactions[0].User.ID != bob.ID {
+		t.Errorf("the first message is %s with %d reactions, expected %s with bob's", first.ID,
+			len(first.Reactions), hello.ID)
+	}
+	if second.PhotoURL == nil || *second.PhotoURL != uploaded.PhotoURL || second.Media != nil {
+		t.Errorf("the photo is exported as %v, expected the URL %s", second.PhotoURL, uploaded.PhotoURL)
+	}
+	if third.Sender.ID != bob.ID || third.ReplyToMessageID == nil || *third.ReplyToMessageID != photo.ID {
+		t.Errorf("the reply is exported from %s replying to %v, expected bob replying to %s", third.Sender.Name,
+			third.ReplyToMessageID, photo.ID)
+	}
+
+	txt := alice.Do(http.MethodGet, c+"/export?format=txt", nil)
+	if txt.Status != http.StatusOK || !strings.Contains(string(txt.Body), "alice: Hello <b>bob</b>\n") ||
+		!strings.Contains(string(txt.Body), "reactions: \U0001F44D bob") {
+		t.Errorf("the text export is:\n%s", txt.Body)
+	}
+	html := alice.Do(http.MethodGet, c+"/export?format=html&media=link", nil)
+	if html.Status != http.StatusOK || !strings.HasPrefix(html.Header.Get("Content-Type"), "text/html") ||
+		!strings.Contains(string(html.Body), "Hello &lt;b&gt;bob&lt;/b&gt;") ||
+		strings.Contains(string(html.Body), "<b>bob</b>") {
+		t.Errorf("the HTML export is not escaped:\n%s", html.Body)
+	}
+
+	// With media=zip, the photos travel with the document
+	archive := alice.Do(http.MethodGet, c+"/export?media=zip", nil)
+	if archive.Status != http.StatusOK || archive.Header.Get("Content-Type") != "application/zip" {
+		t.Fatalf("exporting the archive: status %d, %s", archive.Status, archive.Header.Get("Content-Type"))
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive.Body), int64(len(archive.Body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		_ = r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = data
+	}
+	var bundled chatexport.Document
+	if err := json.Unmarshal(files["conversation.json"], &bundled); err != nil {
+		t.Fatalf("the archive has no conversation.json: %v", err)
+	}
+	if len(bundled.Messages) != 3 || bundled.Messages[1].Media == nil || bundled.Messages[1].PhotoURL != nil {
+		t.Fatalf("the archived document doesn't reference the bundled photo")
+	}
+	if media := files[*bundled.Messages[1].Media]; !bytes.Equal(media, apitest.Photo()) {
+		t.Errorf("the archive has %d bytes at %s, expected the photo", len(media), *bundled.Messages[1].Media)
+	}
+
+	alice.Do(http.MethodGet, c+"/export?format=pdf", nil).
+		ExpectError(http.StatusBadRequest, "validation-failed", "format:invalid-value")
+	alice.Do(http.MethodGet, c+"/export?media=inline", nil).
+		ExpectError(http.StatusBadRequest, "validation-failed", "media:invalid-value")
+	carol.Do(http.MethodGet, c+"/export", nil).ExpectError(http.StatusNotFound, "not-found")
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+)
+
+// ConversationSettingsResponse matches the ConversationSettings schema
+type ConversationSettingsResponse struct {
+	SingleReaction    bool   `json:"singleReaction"`
+	DisappearingTimer int    `json:"disappearingTimer"`
+	DisappearingFrom  string `json:"disappearingFrom"`
+}
+
+// UpdateConversationSettingsRequest matches the UpdateConversationSettingsRequest schema: the request body for PUT
+// /conversations/{id}/settings. Omitted fields are left unchanged.
+type UpdateConversationSettingsRequest struct {
+	SingleReaction    *bool   `json:"singleReaction,omitempty"`
+	DisappearingTimer *int    `json:"disappearingTimer,omitempty"`
+	DisappearingFrom  *string `json:"disappearingFrom,omitempty"`
+}
+
+func newConversationSettingsResponse(s database.ConversationSettings) ConversationSettingsResponse {
+	return ConversationSettingsResponse{
+		SingleReaction:    s.SingleReaction,
+		DisappearingTimer: s.DisappearingTimer,
+		DisappearingFrom:  s.DisappearingFrom,
+	}
+}
+
+// getConversationSettings handles GET /conversations/{conversationId}/settings
+func (rt *_router) getConversationSettings(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+
+	if _, err := rt.resolveConversation(user.ID, conversationID); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	settings, err := rt.db.GetConversationSettings(conversationID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting settings")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if settings == nil {
+		sendNotFound(w, "Conversation not found")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, newConversationSettingsResponse(*settings))
+}
+
+// updateConversationSettings handles PUT /conversations/{conversationId}/settings
+// Any participant may change the settings; the others are notified with a "settings_updated" event. Changes to
+// disappearing messages are also posted in the chat as a system message. They apply to new messages only.
+func (rt *_router) updateConversationSettings(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+
+	var req UpdateConversationSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendInvalidJSON(w)
+		return
+	}
+	if req.DisappearingTimer != nil {
+		if _, ok := disappearingTimers[*req.DisappearingTimer]; !ok {
+			sendFieldError(w, "disappearingTimer", validation.CodeInvalidValue, "disappearingTimer must be 0, 3600, 86400, 604800 or 7776000")
+			return
+		}
+	}
+	if req.DisappearingFrom != nil && *req.DisappearingFrom != database.DisappearFromSent && *req.DisappearingFrom != database.DisappearFromRead {
+		sendFieldError(w, "disappearingFrom", validation.CodeInvalidValue, "disappearingFrom must be 'sent' or 'read'")
+		return
+	}
+
+	if _, err := rt.resolveConversation(user.ID, conversationID); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	settings, err := rt.db.GetConversationSettings(conversationID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting settings")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if settings == nil {
+		sendNotFound(w, "Conversation not found")
+		return
+	}
+
+	previous := *settings
+	if req.SingleReaction != nil {
+		settings.SingleReaction = *req.SingleReaction
+	}
+	if req.DisappearingTimer != nil {
+		settings.DisappearingTimer = *req.DisappearingTimer
+	}
+	if req.DisappearingFrom != nil {
+		settings.DisappearingFrom = *req.DisappearingFrom
+	}
+
+	if err := rt.db.UpdateConversationSettings(*settings); err != nil {
+		ctx.Logger.WithError(err).Error("error updating settings")
+		sendInternalError(w, "Error updating settings")
+		return
+	}
+
+	response := newConversationSettingsResponse(*settings)
+
+	// The start of the timer only matters while disappearing messages are on
+	if settings.DisappearingTimer != previous.DisappearingTimer ||
+		(settings.DisappearingTimer != 0 && settings.DisappearingFrom != previous.DisappearingFrom) {
+		if err := rt.postSystemMessage(ctx.Logger, user, conversationID, disappearingDescription(user, *settings)); err != nil {
+			ctx.Logger.WithError(err).Warn("error posting disappearing messages change")
+		}
+	}
+
+	participants, err := rt.db.GetParticipants(conversationID)
+	if err == nil {
+		var participantIDs []string
+		for _, p := range participants {
+			participantIDs = append(participantIDs, p.ID)
+		}
+		rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
+			Type: "settings_updated",
+			Payload: map[string]interface{}{
+				"conversationId": conversationID,
+				"settings":       response,
+				"updatedBy":      user.ID,
+			},
+		})
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,379 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+	"github.com/sirupsen/logrus"
+)
+
+// maxPinnedConversations is the number of conversations a user can pin to the top of their list
+const maxPinnedConversations = 5
+
+// ConversationStateResponse matches the ConversationState schema. The state of a conversation is private to each
+// participant. MutedUntil is left out when the conversation is not muted or is muted forever.
+type ConversationStateResponse struct {
+	Archived     bool    `json:"archived"`
+	Pinned       bool    `json:"pinned"`
+	Muted        bool    `json:"muted"`
+	MutedUntil   *string `json:"mutedUntil,omitempty"`
+	MarkedUnread bool    `json:"markedUnread"`
+}
+
+// MuteConversationRequest matches the MuteConversationRequest schema: the body of PUT
+// /conversations/{conversationId}/mute. Without Until the conversation is muted until it is unmuted.
+type MuteConversationRequest struct {
+	Until *string `json:"until"`
+}
+
+// ReorderPinnedConversationsRequest matches the ReorderPinnedConversationsRequest schema: the body of PUT
+// /me/pinned-conversations
+type ReorderPinnedConversationsRequest struct {
+	ConversationIDs []string `json:"conversationIds"`
+}
+
+// PreferencesResponse matches the Preferences schema
+type PreferencesResponse struct {
+	UnarchiveOnMessage bool   `json:"unarchiveOnMessage"`
+	PushNotifications  bool   `json:"pushNotifications"`
+	PushPreviews       bool   `json:"pushPreviews"`
+	DigestFrequency    string `json:"digestFrequency"`
+}
+
+// PreferencesRequest matches the Preferences schema: the body of PUT /me/preferences; missing fields are left unchanged
+type PreferencesRequest struct {
+	UnarchiveOnMessage *bool   `json:"unarchiveOnMessage"`
+	PushNotifications  *bool   `json:"pushNotifications"`
+	PushPreviews       *bool   `json:"pushPreviews"`
+	DigestFrequency    *string `json:"digestFrequency"`
+}
+
+func newPreferencesResponse(p database.UserPreferences) PreferencesResponse {
+	return PreferencesResponse{
+		UnarchiveOnMessage: p.UnarchiveOnMessage,
+		PushNotifications:  p.PushNotifications,
+		PushPreviews:       p.PushPreviews,
+		DigestFrequency:    p.DigestFrequency,
+	}
+}
+
+func newConversationStateResponse(s database.ConversationState) ConversationStateResponse {
+	response := ConversationStateResponse{
+		Archived:     s.Archived,
+		Pinned:       s.PinPosition != nil,
+		MarkedUnread: s.MarkedUnread,
+	}
+	now := globaltime.Now().UTC().Format("2006-01-02T15:04:05Z")
+	if s.MutedUntil != nil && *s.MutedUntil > now {
+		response.Muted = true
+		if *s.MutedUntil != database.MutedForever {
+			response.MutedUntil = s.MutedUntil
+		}
+	}
+	return response
+}
+
+// sortConversationSummaries orders the conversations of a user: by default the pinned conversations come first, in
+// the order the user chose, followed by the others with the most recent message first. With sort=recent pins are
+// ignored. GetConversationSummariesByUser already returns the most recent conversations first.
+func sortConversationSummaries(summaries []database.ConversationSummary, order string) {
+	if order == "recent" {
+		return
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		a, b := summaries[i].State.PinPosition, summaries[j].State.PinPosition
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return *a > *b
+	})
+}
+
+// notifyConversationState sends the new state of a conversation to the other sessions of its user
+func (rt *_router) notifyConversationState(logger logrus.FieldLogger, conversationID, userID string) {
+	state, err := rt.db.GetConversationState(conversationID, userID)
+	if err != nil || state == nil {
+		if err != nil {
+			logger.WithError(err).Warn("error getting conversation state for notification")
+		}
+		return
+	}
+	_ = rt.wsHub.SendToUser(userID, WebSocketMessage{
+		Type: "conversation_state_updated",
+		Payload: map[string]interface{}{
+			"conversationId": conversationID,
+			"state":          newConversationStateResponse(*state),
+		},
+	})
+}
+
+// changeConversationState applies `change` to the state of a conversation for the current user, then responds with
+// the new state. `change` may return a requestError.
+func (rt *_router) changeConversationState(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, change func(*database.ConversationState) error) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+	if _, err := rt.resolveConversation(user.ID, conversationID); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	state, err := rt.db.GetConversationState(conversationID, user.ID)
+	if err != nil || state == nil {
+		if err == nil {
+			err = fmt.Errorf("no state for participant %s", user.ID)
+		}
+		ctx.Logger.WithError(err).Error("database error getting conversation state")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	if err := change(state); err != nil {
+		if reqErr, ok := asRequestError(err); ok {
+			sendRequestError(w, reqErr)
+			return
+		}
+		ctx.Logger.WithError(err).Error("error updating conversation state")
+		sendInternalError(w, "Error updating conversation state")
+		return
+	}
+
+	rt.notifyConversationState(ctx.Logger, conversationID, user.ID)
+	// Archiving and muting change the total unread counts
+	rt.notifyUnreadChanged(ctx.Logger, conversationID, []string{user.ID})
+
+	state, err = rt.db.GetConversationState(conversationID, user.ID)
+	if err != nil || state == nil {
+		ctx.Logger.WithError(err).Error("database error getting conversation state")
+		sendInternalError(w, "Database error")
+		return
+	}
+	sendJSON(w, http.StatusOK, newConversationStateResponse(*state))
+}
+
+// archiveConversation handles PUT /conversations/{conversationId}/archive
+// Archived conversations are not pinned
+func (rt *_router) archiveConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changeConversationState(w, r, ps, ctx, func(s *database.ConversationState) error {
+		s.Archived = true
+		s.PinPosition = nil
+		return rt.db.UpdateConversationState(*s)
+	})
+}
+
+// unarchiveConversation handles DELETE /conversations/{conversationId}/archive
+func (rt *_router) unarchiveConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changeConversationState(w, r, ps, ctx, func(s *database.ConversationState) error {
+		s.Archived = false
+		return rt.db.UpdateConversationState(*s)
+	})
+}
+
+// pinConversation handles PUT /conversations/{conversationId}/pin
+// The conversation goes to the top of the list and out of the archive
+func (rt *_router) pinConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changeConversationState(w, r, ps, ctx, func(s *database.ConversationState) error {
+		ok, err := rt.db.PinConversation(s.ConversationID, s.UserID, maxPinnedConversations)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return newRequestError(http.StatusConflict, codePinLimitReached, fmt.Sprintf("At most %d conversations can be pinned", maxPinnedConversations))
+		}
+		return nil
+	})
+}
+
+// unpinConversation handles DELETE /conversations/{conversationId}/pin
+func (rt *_router) unpinConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changeConversationState(w, r, ps, ctx, func(s *database.ConversationState) error {
+		s.PinPosition = nil
+		return rt.db.UpdateConversationState(*s)
+	})
+}
+
+// muteConversation handles PUT /conversations/{conversationId}/mute
+func (rt *_router) muteConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// The body is optional
+	var req MuteConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		sendInvalidJSON(w)
+		return
+	}
+
+	mutedUntil := database.MutedForever
+	if req.Until != nil {
+		until, err := time.Parse(time.RFC3339, *req.Until)
+		if err != nil {
+			sendFieldError(w, "until", validation.CodeInvalidFormat, "until must be an RFC 3339 date-time")
+			return
+		}
+		if !until.After(globaltime.Now()) {
+			sendFieldError(w, "until", validation.CodeInvalidValue, "until must be in the future")
+			return
+		}
+		mutedUntil = until.UTC().Format("2006-01-02T15:04:05Z")
+	}
+
+	rt.changeConversationState(w, r, ps, ctx, func(s *database.ConversationState) error {
+		s.MutedUntil = &mutedUntil
+		return rt.db.UpdateConversationState(*s)
+	})
+}
+
+// unmuteConversation handles DELETE /conversations/{conversationId}/mute
+func (rt *_router) unmuteConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changeConversationState(w, r, ps, ctx, func(s *database.ConversationState) error {
+		s.MutedUntil = nil
+		return rt.db.UpdateConversationState(*s)
+	})
+}
+
+// markConversationUnread handles PUT /conversations/{conversationId}/unread
+// The mark is cleared when the user opens the conversation or sends a message in it
+func (rt *_router) markConversationUnread(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changeConversationState(w, r, ps, ctx, func(s *database.ConversationState) error {
+		s.MarkedUnread = true
+		return rt.db.UpdateConversationState(*s)
+	})
+}
+
+// markConversationRead handles DELETE /conversations/{conversationId}/unread
+func (rt *_router) markConversationRead(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changeConversationState(w, r, ps, ctx, func(s *database.ConversationState) error {
+		s.MarkedUnread = false
+		return rt.db.UpdateConversationState(*s)
+	})
+}
+
+// reorderPinnedConversations handles PUT /me/pinned-conversations
+// The body lists every pinned conversation, from the top of the list
+func (rt *_router) reorderPinnedConversations(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	var req ReorderPinnedConversationsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendInvalidJSON(w)
+		return
+	}
+
+	pinned, err := rt.db.GetPinnedConversationIDs(user.ID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting pinned conversations")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	remaining := make(map[string]bool)
+	for _, id := range pinned {
+		remaining[id] = true
+	}
+	for _, id := range req.ConversationIDs {
+		if !remaining[id] {
+			sendFieldError(w, "conversationIds", validation.CodeInvalidValue, "conversationIds must list each pinned conversation once")
+			return
+		}
+		delete(remaining, id)
+	}
+	if len(remaining) > 0 {
+		sendFieldError(w, "conversationIds", validation.CodeInvalidValue, "conversationIds must list each pinned conversation once")
+		return
+	}
+
+	if err := rt.db.ReorderPinnedConversations(user.ID, req.ConversationIDs); err != nil {
+		ctx.Logger.WithError(err).Error("error reordering pinned conversations")
+		sendInternalError(w, "Error reordering pinned conversations")
+		return
+	}
+
+	_ = rt.wsHub.SendToUser(user.ID, WebSocketMessage{
+		Type: "pinned_conversations_reordered",
+		Payload: map[string]interface{}{
+			"conversationIds": req.ConversationIDs,
+		},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getMyPreferences handles GET /me/preferences
+func (rt *_router) getMyPreferences(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	prefs, err := rt.db.GetUserPreferences(user.ID)
+	if err != nil || prefs == nil {
+		ctx.Logger.WithError(err).Error("database error getting preferences")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, newPreferencesResponse(*prefs))
+}
+
+// updateMyPreferences handles PUT /me/preferences
+func (rt *_router) updateMyPreferences(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	var req PreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendInvalidJSON(w)
+		return
+	}
+
+	prefs, err := rt.db.GetUserPreferences(user.ID)
+	if err != nil || prefs == nil {
+		ctx.Logger.WithError(err).Error("database error getting preferences")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if req.UnarchiveOnMessage != nil {
+		prefs.UnarchiveOnMessage = *req.UnarchiveOnMessage
+	}
+	if req.PushNotifications != nil {
+		prefs.PushNotifications = *req.PushNotifications
+	}
+	if req.PushPreviews != nil {
+		prefs.PushPreviews = *req.PushPreviews
+	}
+	if req.DigestFrequency != nil {
+		if !validDigestFrequency(*req.DigestFrequency) {
+			sendFieldError(w, "digestFrequency", validation.CodeInvalidValue, "digestFrequency must be hourly, daily or never")
+			return
+		}
+		prefs.DigestFrequency = *req.DigestFrequency
+	}
+
+	if err := rt.db.UpdateUserPreferences(*prefs); err != nil {
+		ctx.Logger.WithError(err).Error("error updating preferences")
+		sendInternalError(w, "Error updating preferences")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, newPreferencesResponse(*prefs))
+}
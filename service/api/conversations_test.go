@@ -0,0 +1,83 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+)
+
+// TestDirectConversation checks that a direct conversation is created once, announced to the other user, and listed
+// for both
+func TestDirectConversation(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	bobEvents := bob.Connect()
+
+	var conv api.ConversationResponse
+	alice.Call(http.MethodPost, "/conversations", map[string]string{"userId": bob.ID}, &conv, http.StatusCreated)
+	if conv.Type != "direct" || len(conv.Participants) != 2 {
+		t.Errorf("created a %s conversation with %d participants", conv.Type, len(conv.Participants))
+	}
+	bobEvents.WaitWith("new_conversation", "id", conv.ID)
+
+	// Starting it again, from either side, returns the same conversation
+	var again api.ConversationResponse
+	alice.Call(http.MethodPost, "/conversations", map[string]string{"userId": bob.ID}, &again, http.StatusOK)
+	bob.Call(http.MethodPost, "/conversations", map[string]string{"userId": alice.ID}, &again, http.StatusOK)
+	if again.ID != conv.ID {
+		t.Errorf("starting the conversation again returned %s, expected %s", again.ID, conv.ID)
+	}
+
+	for _, c := range []*apitest.Client{alice, bob} {
+		var list []api.ConversationSummaryResponse
+		c.Call(http.MethodGet, "/conversations", nil, &list, http.StatusOK)
+		if len(list) != 1 || list[0].ID != conv.ID {
+			t.Errorf("%s has %d conversations, expected only %s", c.Name, len(list), conv.ID)
+		}
+	}
+
+	alice.Do(http.MethodPost, "/conversations", map[string]string{"userId": "unknown"}).
+		ExpectError(http.StatusNotFound, "not-found")
+}
+
+// TestGroupConversation checks that members added to a group are told, that renames reach the members, and that
+// members who left don't get the messages anymore
+func TestGroupConversation(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob, carol := s.Login("alice"), s.Login("bob"), s.Login("carol")
+	bobEvents, carolEvents := bob.Connect(), carol.Connect()
+
+	var group api.GroupResponse
+	create := map[string]interface{}{"name": "Climbing", "memberIds": []string{bob.ID}}
+	alice.Call(http.MethodPost, "/groups", create, &group, http.StatusCreated)
+	if group.CreatedBy != alice.ID || len(group.Members) != 2 {
+		t.Errorf("created a group by %s with %d members, expected alice and bob", group.CreatedBy, len(group.Members))
+	}
+	bobEvents.WaitWith("new_conversation", "id", group.ID)
+
+	g := "/groups/" + group.ID
+	alice.Call(http.MethodPost, g+"/members", map[string]string{"userId": carol.ID}, &group, http.StatusOK)
+	if len(group.Members) != 3 {
+		t.Errorf("the group has %d members after adding carol, expected 3", len(group.Members))
+	}
+	carolEvents.WaitWith("new_conversation", "id", group.ID)
+
+	alice.Call(http.MethodPut, g+"/name", map[string]string{"name": "Bouldering"}, nil, http.StatusOK)
+	bobEvents.WaitWith("group_updated", "name", "Bouldering")
+
+	// Group messages reach every member, the sender included
+	var hello api.MessageResponse
+	carol.Call(http.MethodPost, "/conversations/"+group.ID+"/messages", textMessage("Hello!"), &hello, http.StatusCreated)
+	for _, events := range []*apitest.Socket{bobEvents, carolEvents} {
+		events.WaitWith("new_message", "id", hello.ID)
+	}
+
+	carol.Call(http.MethodDelete, g+"/members/me", nil, nil, http.StatusNoContent)
+	var bye api.MessageResponse
+	alice.Call(http.MethodPost, "/conversations/"+group.ID+"/messages", textMessage("Bye carol"), &bye, http.StatusCreated)
+	bobEvents.WaitWith("new_message", "id", bye.ID)
+	carolEvents.ExpectNone("new_message", quietPeriod)
+	carol.Do(http.MethodGet, "/conversations/"+group.ID, nil).ExpectError(http.StatusNotFound, "not-found")
+}
@@ -0,0 +1,338 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/digest"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/ozberk-sevinc/wasa-project/service/mailer"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// digestInterval is how often the digest worker looks for due digests
+	digestInterval = time.Minute
+
+	// digestBatchSize is the number of digests sent per run of the worker; the others wait for the next run
+	digestBatchSize = 50
+
+	// digestMessageLimit bounds the messages summarized in one digest
+	digestMessageLimit = 500
+
+	// digestLatestMessages is the number of messages shown for each conversation of a digest
+	digestLatestMessages = 3
+
+	// digestMaxMentions is the number of mentions listed in a digest
+	digestMaxMentions = 10
+
+	// digestSendTimeout bounds the sending of one digest
+	digestSendTimeout = 30 * time.Second
+
+	// maxEmailLength is the longest email address allowed by RFC 5321
+	maxEmailLength = 254
+)
+
+// digestPeriods is the time between two digests, by frequency
+var digestPeriods = map[string]time.Duration{
+	database.DigestHourly: time.Hour,
+	database.DigestDaily:  24 * time.Hour,
+}
+
+// EmailRequest matches the Email schema: the body of PUT /me/email; a null email removes the address
+type EmailRequest struct {
+	Email *string `json:"email"`
+}
+
+// EmailResponse matches the Email schema
+type EmailResponse struct {
+	Email *string `json:"email"`
+}
+
+// validDigestFrequency reports whether `f` is a frequency users can choose
+func validDigestFrequency(f string) bool {
+	return f == database.DigestHourly || f == database.DigestDaily || f == database.DigestNever
+}
+
+// setMyEmail handles PUT /me/email
+// The address is where email digests are sent. It is not verified, and only the user can see it.
+func (rt *_router) setMyEmail(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	var req EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendInvalidJSON(w)
+		return
+	}
+	if req.Email != nil {
+		email := strings.TrimSpace(*req.Email)
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email || len(email) > maxEmailLength {
+			sendFieldError(w, "email", validation.CodeInvalidFormat, "Invalid email address")
+			return
+		}
+		req.Email = &email
+	}
+
+	if err := rt.db.SetUserEmail(user.ID, req.Email); err != nil {
+		ctx.Logger.WithError(err).Error("error setting email")
+		sendInternalError(w, "Error setting email")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, EmailResponse{Email: req.Email})
+}
+
+// unsubscribeDigest handles GET and POST /digest/unsubscribe?token=
+// It turns off the digests of the user of the token, found in the link at the bottom of every digest. GET shows a
+// confirmation page for the link; POST is the one-click unsubscribe of mail clients (RFC 8058).
+func (rt *_router) unsubscribeDigest(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	if rt.mailer == nil {
+		sendNotFound(w, "Email digests are disabled")
+		return
+	}
+	userID, ok := digest.VerifyUnsubscribeToken(rt.digestSecret, r.URL.Query().Get("token"))
+	if !ok {
+		sendBadRequest(w, "Invalid unsubscribe token")
+		return
+	}
+
+	prefs, err := rt.db.GetUserPreferences(userID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting preferences")
+		sendInternalError(w, "Database error")
+		return
+	}
+	// Deleted accounts have nothing left to unsubscribe from
+	if prefs != nil && prefs.DigestFrequency != database.DigestNever {
+		prefs.DigestFrequency = database.DigestNever
+		if err := rt.db.UpdateUserPreferences(*prefs); err != nil {
+			ctx.Logger.WithError(err).Error("error updating preferences")
+			sendInternalError(w, "Error updating preferences")
+			return
+		}
+	}
+
+	if r.Method == http.MethodPost {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(digest.UnsubscribedPage))
+}
+
+// runDigestWorker sends the due email digests every digestInterval, until `stop` is closed
+func (rt *_router) runDigestWorker(stop <-chan struct{}) {
+	ticker := time.NewTicker(digestInterval)
+	defer ticker.Stop()
+	for {
+		rt.sendDueDigests()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendDueDigests sends a batch of the digests that are due
+func (rt *_router) sendDueDigests() {
+	logger := rt.baseLogger.WithField("worker", "digest")
+	now := globaltime.Now().UTC()
+	format := func(t time.Time) string { return t.Format("2006-01-02T15:04:05Z") }
+
+	recipients, err := rt.db.GetDueDigests(
+		format(now.Add(-digestPeriods[database.DigestHourly])),
+		format(now.Add(-digestPeriods[database.DigestDaily])),
+		digestBatchSize,
+	)
+	if err != nil {
+		logger.WithError(err).Error("error getting due digests")
+		return
+	}
+
+	ctx, cancel := rt.backgroundContext()
+	defer cancel()
+	for _, recipient := range recipients {
+		if ctx.Err() != nil {
+			return
+		}
+		rt.sendDigest(ctx, logger.WithField("userId", recipient.UserID), recipient, format(now))
+	}
+}
+
+// sendDigest sends the digest of the messages a user received since their previous digest and has not read yet.
+// Each message is digested once: the next digest starts at `now`, or after the last message of this one when there
+// were more than digestMessageLimit. When sending fails, the same messages are tried again one period later, if they
+// are still unread.
+func (rt *_router) sendDigest(ctx context.Context, logger logrus.FieldLogger, recipient database.DigestRecipient, now string) {
+	// Digests that were just turned on start now, rather than with the whole backlog
+	if recipient.Since == nil {
+		if err := rt.db.SetDigestProgress(recipient.UserID, now, now); err != nil {
+			logger.WithError(err).Error("error starting digests")
+		}
+		return
+	}
+
+	d, next, err := rt.buildDigest(logger, recipient, *recipient.Since, now)
+	if err != nil {
+		logger.WithError(err).Error("error building digest")
+		return
+	}
+	if d != nil {
+		err = rt.mailDigest(ctx, recipient, *d)
+		if err != nil {
+			logger.WithError(err).Warn("error sending digest")
+			if err := rt.db.SetDigestProgress(recipient.UserID, *recipient.Since, now); err != nil {
+				logger.WithError(err).Error("error recording digest progress")
+			}
+			return
+		}
+		logger.WithField("conversations", len(d.Conversations)).Debug("digest sent")
+	}
+
+	if err := rt.db.SetDigestProgress(recipient.UserID, next, now); err != nil {
+		logger.WithError(err).Error("error recording digest progress")
+	}
+}
+
+// buildDigest returns the digest of a user for the messages sent in [since, until), or nil if there is nothing new,
+// and where the next digest starts: `until`, or the time of the first message left out when there are more than
+// digestMessageLimit
+func (rt *_router) buildDigest(logger logrus.FieldLogger, recipient database.DigestRecipient, since, until string) (*digest.Digest, string, error) {
+	unread, err := rt.db.GetDigestMessages(recipient.UserID, since, until, digestMessageLimit+1)
+	if err != nil {
+		return nil, since, err
+	}
+	next := until
+	if len(unread) > digestMessageLimit {
+		// Times are in seconds: the messages of the second of the first one left out are left out with it
+		next = unread[digestMessageLimit].CreatedAt
+		included := unread[:digestMessageLimit]
+		for len(included) > 0 && included[len(included)-1].CreatedAt == next {
+			included = included[:len(included)-1]
+		}
+		if len(included) > 0 {
+			unread = included
+		} else {
+			// More messages than the limit in a single second: the rest of that second is dropped
+			unread = unread[:digestMessageLimit]
+			next = until
+			if at, err := time.Parse(time.RFC3339, unread[0].CreatedAt); err == nil {
+				next = at.Add(time.Second).UTC().Format("2006-01-02T15:04:05Z")
+			}
+		}
+	}
+	if len(unread) == 0 {
+		return nil, next, nil
+	}
+	user, err := rt.db.GetUserByID(recipient.UserID)
+	if err != nil || user == nil {
+		return nil, next, err
+	}
+
+	messages := make([]database.Message, 0, len(unread))
+	for _, m := range unread {
+		messages = append(messages, m.Message)
+	}
+	responses, conversations, err := rt.messageResponsesWithConversations(logger, recipient.UserID, messages)
+	if err != nil {
+		return nil, since, err
+	}
+
+	d := digest.Digest{
+		Recipient:      user.Name,
+		Frequency:      recipient.Frequency,
+		AppURL:         rt.webUIURL,
+		UnsubscribeURL: rt.publicURL + "/digest/unsubscribe?token=" + url.QueryEscape(digest.UnsubscribeToken(rt.digestSecret, user.ID)),
+	}
+	if user.DisplayName != nil && *user.DisplayName != "" {
+		d.Recipient = *user.DisplayName
+	}
+
+	byConversation := make(map[string]*digest.Conversation)
+	var order []string
+	for _, m := range unread {
+		response, ok := responses[m.ID]
+		if !ok {
+			continue
+		}
+		conv := conversations[m.ConversationID]
+		line := digest.Line{
+			Sender:       response.Sender.Name,
+			Conversation: conv.Title,
+			Text:         pushBody(response),
+			At:           response.CreatedAt,
+		}
+		if response.Sender.DisplayName != nil && *response.Sender.DisplayName != "" {
+			line.Sender = *response.Sender.DisplayName
+		}
+
+		c, ok := byConversation[m.ConversationID]
+		if !ok {
+			c = &digest.Conversation{Title: conv.Title, URL: rt.webUIURL + "/chat/" + url.PathEscape(conv.ID)}
+			byConversation[m.ConversationID] = c
+			order = append(order, m.ConversationID)
+		}
+		c.Unread++
+		c.Latest = append(c.Latest, line)
+		if len(c.Latest) > digestLatestMessages {
+			c.Latest = c.Latest[1:]
+		}
+		if m.Mentioned {
+			c.Mentions++
+			d.Mentions = append(d.Mentions, line)
+		}
+	}
+	if len(order) == 0 {
+		return nil, next, nil
+	}
+	if len(d.Mentions) > digestMaxMentions {
+		d.Mentions = d.Mentions[len(d.Mentions)-digestMaxMentions:]
+	}
+
+	// The conversation with the most recent message comes first
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := byConversation[order[i]].Latest, byConversation[order[j]].Latest
+		return a[len(a)-1].At > b[len(b)-1].At
+	})
+	for _, id := range order {
+		d.Conversations = append(d.Conversations, *byConversation[id])
+	}
+	return &d, next, nil
+}
+
+// mailDigest renders a digest and sends it to its recipient
+func (rt *_router) mailDigest(ctx context.Context, recipient database.DigestRecipient, d digest.Digest) error {
+	text, html, err := digest.Render(d)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, digestSendTimeout)
+	defer cancel()
+	return rt.mailer.Send(ctx, mailer.Message{
+		To:      recipient.Email,
+		Subject: digest.Subject(d),
+		Text:    text,
+		HTML:    html,
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + d.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+}
@@ -0,0 +1,123 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/mailer"
+)
+
+// startDigests starts a server mailing its digests to an SMTP sink, and turns on the hourly digests of `name`
+func startDigests(t *testing.T, name string) (*apitest.Server, *apitest.SMTPSink, *apitest.Client) {
+	t.Helper()
+	sink := apitest.StartSMTPSink(t)
+	s := apitest.Start(t, apitest.Options{
+		Configure: func(cfg *api.Config) error {
+			m, err := mailer.NewSMTPMailer(mailer.SMTPConfig{
+				Host: sink.Host,
+				Port: sink.Port,
+				From: "WASAText <noreply@example.com>",
+			})
+			cfg.Mailer = m
+			cfg.DigestSecret = []byte("digest")
+			cfg.PublicURL = "http://localhost:3000"
+			cfg.WebUIURL = "http://localhost:8080"
+			return err
+		},
+	})
+	c := s.Login(name)
+	c.Call(http.MethodPut, "/me/email", map[string]string{"email": name + "@example.com"}, nil, http.StatusOK)
+	c.Call(http.MethodPut, "/me/preferences", map[string]string{"digestFrequency": "hourly"}, nil, http.StatusOK)
+
+	// The first run starts the digests, without the messages sent before
+	api.SendDueDigests(s.Router)
+	sink.ExpectNone(quietPeriod)
+	return s, sink, c
+}
+
+// TestDigestMailed checks that the unread messages of an hour are mailed once, through SMTP
+func TestDigestMailed(t *testing.T) {
+	s, sink, bob := startDigests(t, "bob")
+	alice := s.Login("alice")
+	conv := startConversation(alice, bob)
+	alice.Call(http.MethodPost, "/conversations/"+conv+"/messages", textMessage("Are you coming @bob?"), nil,
+		http.StatusCreated)
+
+	// Not due before an hour
+	api.SendDueDigests(s.Router)
+	sink.ExpectNone(quietPeriod)
+
+	s.Advance(time.Hour)
+	api.SendDueDigests(s.Router)
+	m := sink.Wait()
+	if len(m.To) != 1 || m.To[0] != "bob@example.com" || m.From != "noreply@example.com" {
+		t.Errorf("the digest was mailed from %s to %v", m.From, m.To)
+	}
+	if m.Subject != "1 unread message, 1 mention on WASAText" {
+		t.Errorf("the digest is titled %q", m.Subject)
+	}
+	if !strings.Contains(m.Text, "alice: Are you coming @bob?") || !strings.Contains(m.HTML, "Are you coming @bob?") {
+		t.Errorf("the digest doesn't show the message:\n%s", m.Text)
+	}
+	if !strings.HasPrefix(m.Header.Get("List-Unsubscribe"), "<http://localhost:3000/digest/unsubscribe?token=") {
+		t.Errorf("the digest has the List-Unsubscribe header %q", m.Header.Get("List-Unsubscribe"))
+	}
+
+	// The message was digested: the next digest has nothing to say
+	s.Advance(time.Hour)
+	api.SendDueDigests(s.Router)
+	sink.ExpectNone(quietPeriod)
+}
+
+// TestDigestMessageLimit checks that the messages beyond the limit of a digest go in the next one, rather than being
+// skipped
+func TestDigestMessageLimit(t *testing.T) {
+	const limit, extra = 500, 20
+	s, sink, bob := startDigests(t, "bob")
+	alice := s.Login("alice")
+	conv := startConversation(alice, bob)
+
+	// Sent one per second, faster than the API allows
+	start := s.Now()
+	for i := range limit + extra {
+		id, err := uuid.NewV4()
+		if err != nil {
+			t.Fatal(err)
+		}
+		text := fmt.Sprintf("Message %d", i)
+		err = s.DB.CreateMessage(database.Message{
+			ID:             id.String(),
+			ConversationID: conv,
+			SenderID:       alice.ID,
+			CreatedAt:      start.Add(time.Duration(i) * time.Second).UTC().Format("2006-01-02T15:04:05Z"),
+			ContentType:    "text",
+			Text:           &text,
+			Status:         "sent",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.Advance(time.Hour)
+	api.SendDueDigests(s.Router)
+	if m := sink.Wait(); m.Subject != fmt.Sprintf("%d unread messages on WASAText", limit) {
+		t.Errorf("the first digest is titled %q, expected it to have %d messages", m.Subject, limit)
+	}
+	s.Advance(time.Hour)
+	api.SendDueDigests(s.Router)
+	m := sink.Wait()
+	if m.Subject != fmt.Sprintf("%d unread messages on WASAText", extra) {
+		t.Errorf("the second digest is titled %q, expected it to have the last %d messages", m.Subject, extra)
+	}
+	if want := fmt.Sprintf("alice: Message %d", limit+extra-1); !strings.Contains(m.Text, want) {
+		t.Errorf("the second digest doesn't show the last message:\n%s", m.Text)
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/sirupsen/logrus"
+)
+
+const contentTypeSystem = "system"
+
+// expiryInterval is how often the expiry worker looks for disappearing messages to delete
+const expiryInterval = time.Minute
+
+// disappearingTimers are the allowed lifetimes of disappearing messages, in seconds, with their description. 0 turns
+// disappearing messages off.
+var disappearingTimers = map[int]string{
+	0:       "off",
+	3600:    "1 hour",
+	86400:   "1 day",
+	604800:  "7 days",
+	7776000: "90 days",
+}
+
+// applyDisappearing sets the timer of a new message from the settings of its conversation. Messages disappearing
+// after being sent get their deletion time immediately; the others once read by everyone (see expireMessages).
+func (rt *_router) applyDisappearing(msg *database.Message) error {
+	if msg.ContentType == contentTypeSystem {
+		return nil
+	}
+	settings, err := rt.db.GetConversationSettings(msg.ConversationID)
+	if err != nil {
+		return fmt.Errorf("getting conversation settings: %w", err)
+	}
+	if settings == nil || settings.DisappearingTimer == 0 {
+		return nil
+	}
+
+	msg.ExpiresAfter = settings.DisappearingTimer
+	msg.ExpireOnRead = settings.DisappearingFrom == database.DisappearFromRead
+	if !msg.ExpireOnRead {
+		sentAt, err := time.Parse(time.RFC3339, msg.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("parsing message time: %w", err)
+		}
+		expiresAt := sentAt.Add(time.Duration(msg.ExpiresAfter) * time.Second).UTC().Format("2006-01-02T15:04:05Z")
+		msg.ExpiresAt = &expiresAt
+	}
+	return nil
+}
+
+// isExpired reports whether a disappearing message is past its deletion time but not deleted yet by the worker
+func isExpired(m database.Message, now string) bool {
+	return m.ExpiresAt != nil && *m.ExpiresAt <= now
+}
+
+// postSystemMessage posts an event in a conversation, like a change of its settings. System messages are shown in
+// the chat like the others, with `actor` as the sender; they never disappear.
+func (rt *_router) postSystemMessage(logger logrus.FieldLogger, actor *database.User, conversationID, text string) error {
+	msgID, _ := uuid.NewV4()
+	msg := database.Message{
+		ID:             msgID.String(),
+		ConversationID: conversationID,
+		SenderID:       actor.ID,
+		CreatedAt:      globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		ContentType:    contentTypeSystem,
+		Text:           &text,
+		Status:         database.StatusSent,
+	}
+	_, err := rt.deliverMessage(logger, actor, msg, nil)
+	return err
+}
+
+// disappearingDescription describes the disappearing messages settings for a system message
+func disappearingDescription(actor *database.User, s database.ConversationSettings) string {
+	name := actor.Name
+	if actor.DisplayName != nil && *actor.DisplayName != "" {
+		name = *actor.DisplayName
+	}
+	if s.DisappearingTimer == 0 {
+		return name + " turned off disappearing messages"
+	}
+	when := "after they are sent"
+	if s.DisappearingFrom == database.DisappearFromRead {
+		when = "after they are read"
+	}
+	return fmt.Sprintf("%s set messages to disappear %s %s", name, disappearingTimers[s.DisappearingTimer], when)
+}
+
+// broadcastMessageDeleted notifies the participants of a conversation that a message is gone. `reason` is "deleted"
+// when the sender deleted it, "expired" for disappearing messages.
+func (rt *_router) broadcastMessageDeleted(logger logrus.FieldLogger, conversationID, messageID, reason string) {
+	participants, err := rt.db.GetParticipants(conversationID)
+	if err != nil {
+		logger.WithError(err).Warn("error getting participants for broadcast")
+		return
+	}
+	var participantIDs []string
+	for _, p := range participants {
+		participantIDs = append(participantIDs, p.ID)
+	}
+	rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
+		Type: "message_deleted",
+		Payload: map[string]interface{}{
+			"conversationId": conversationID,
+			"messageId":      messageID,
+			"reason":         reason,
+		},
+	})
+	rt.notifyUnreadChanged(logger, conversationID, participantIDs)
+}
+
+// runExpiryWorker deletes expired messages every expiryInterval, until `stop` is closed
+func (rt *_router) runExpiryWorker(stop <-chan struct{}) {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+	for {
+		rt.expireMessages()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireMessages starts the timers of the messages now read by everyone, then deletes the expired messages with
+// their photos and notifies the participants
+func (rt *_router) expireMessages() {
+	logger := rt.baseLogger.WithField("worker", "expiry")
+	now := globaltime.Now().UTC().Format("2006-01-02T15:04:05Z")
+
+	if err := rt.db.StartReadExpiryTimers(now); err != nil {
+		logger.WithError(err).Error("error starting read expiry timers")
+	}
+
+	expired, unusedPhotos, err := rt.db.DeleteExpiredMessages(now)
+	if err != nil {
+		logger.WithError(err).Error("error deleting expired messages")
+		return
+	}
+	for _, photoURL := range unusedPhotos {
+		if f, ok := localUpload(photoURL); ok {
+			if err := os.Remove(f.localPath); err != nil && !os.IsNotExist(err) {
+				logger.WithError(err).WithField("file", f.localPath).Warn("error removing expired photo")
+			}
+		}
+	}
+	for _, m := range expired {
+		rt.broadcastMessageDeleted(logger, m.ConversationID, m.ID, "expired")
+	}
+	if len(expired) > 0 {
+		logger.WithField("messages", len(expired)).Debug("expired messages deleted")
+	}
+}
@@ -0,0 +1,216 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+)
+
+// setDisappearing changes the disappearing messages settings of a conversation
+func setDisappearing(c *apitest.Client, conversationID string, timer int, from string) {
+	req := api.UpdateConversationSettingsRequest{DisappearingTimer: &timer}
+	if from != "" {
+		req.DisappearingFrom = &from
+	}
+	c.Call(http.MethodPut, "/conversations/"+conversationID+"/settings", req, nil, http.StatusOK)
+}
+
+// listsMessage reports whether a participant sees a message when reading the conversation
+func listsMessage(c *apitest.Client, conversationID, messageID string) bool {
+	var conv api.ConversationResponse
+	c.Call(http.MethodGet, "/conversations/"+conversationID, nil, &conv, http.StatusOK)
+	for _, m := range conv.Messages {
+		if m.ID == messageID {
+			return true
+		}
+	}
+	return false
+}
+
+// TestDisappearingAfterSent checks that messages disappear when their timer runs out after they are sent: hidden at
+// once, deleted by the expiry worker and announced, while the system message of the change stays
+func TestDisappearingAfterSent(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	bobEvents := bob.Connect()
+
+	setDisappearing(alice, conv, 3600, "")
+	var notice api.MessageResponse
+	bobEvents.Wait("new_message").Decode(&notice)
+	if notice.ContentType != "system" || text(notice) != "alice set messages to disappear 1 hour after they are sent" {
+		t.Errorf("the change was posted as the %s message %q", notice.ContentType, text(notice))
+	}
+	if notice.ExpiresAfter != 0 || notice.ExpiresAt != nil {
+		t.Errorf("the system message expires after %d seconds, expected it to stay", notice.ExpiresAfter)
+	}
+
+	var msg api.MessageResponse
+	alice.Call(http.MethodPost, "/conversations/"+conv+"/messages", textMessage("The code is 4921"), &msg,
+		http.StatusCreated)
+	sentAt, err := time.Parse(time.RFC3339, msg.CreatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ExpiresAfter != 3600 || msg.ExpiresAt == nil || *msg.ExpiresAt != timestamp(sentAt.Add(time.Hour)) {
+		t.Fatalf("the message expires after %d seconds at %v, expected an hour after %s", msg.ExpiresAfter,
+			msg.ExpiresAt, msg.CreatedAt)
+	}
+
+	// The message is deleted when its time comes, not a second before
+	s.Advance(sentAt.Add(time.Hour).Sub(s.Now()) - time.Second)
+	api.ExpireMessages(s.Router)
+	bobEvents.ExpectNone("message_deleted", quietPeriod)
+	s.Advance(time.Second)
+	api.ExpireMessages(s.Router)
+	var deleted struct {
+		ConversationID string `json:"conversationId"`
+		Reason         string `json:"reason"`
+	}
+	bobEvents.WaitWith("message_deleted", "messageId", msg.ID).Decode(&deleted)
+	if deleted.ConversationID != conv || deleted.Reason != "expired" {
+		t.Errorf("message_deleted announced %s for %q, expected %s as expired", deleted.ConversationID,
+			deleted.Reason, conv)
+	}
+	if listsMessage(bob, conv, msg.ID) {
+		t.Errorf("bob still sees the expired message")
+	}
+
+	// Expired messages are hidden before the worker deletes them
+	var late api.MessageResponse
+	alice.Call(http.MethodPost, "/conversations/"+conv+"/messages", textMessage("Gone soon"), &late,
+		http.StatusCreated)
+	s.Advance(time.Hour)
+	if listsMessage(bob, conv, late.ID) {
+		t.Errorf("bob sees the expired message before the worker ran")
+	}
+
+	// System messages never disappear
+	s.Advance(90 * 24 * time.Hour)
+	api.ExpireMessages(s.Router)
+	if !listsMessage(bob, conv, notice.ID) {
+		t.Errorf("the system message of the change disappeared")
+	}
+}
+
+// TestDisappearingAfterRead checks that the timer of messages disappearing after being read starts once every
+// recipient has read them
+func TestDisappearingAfterRead(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob, carol := s.Login("alice"), s.Login("bob"), s.Login("carol")
+	var group api.GroupResponse
+	create := map[string]interface{}{"name": "Crag", "memberIds": []string{bob.ID, carol.ID}}
+	alice.Call(http.MethodPost, "/groups", create, &group, http.StatusCreated)
+	aliceEvents := alice.Connect()
+
+	setDisappearing(alice, group.ID, 86400, "read")
+	var notice api.MessageResponse
+	aliceEvents.Wait("new_message").Decode(&notice)
+	if text(notice) != "alice set messages to disappear 1 day after they are read" {
+		t.Errorf("the change was posted as %q", text(notice))
+	}
+
+	var msg api.MessageResponse
+	alice.Call(http.MethodPost, "/conversations/"+group.ID+"/messages", textMessage("Meet at 8"), &msg,
+		http.StatusCreated)
+	if msg.ExpiresAfter != 86400 || msg.ExpiresAt != nil {
+		t.Fatalf("the message expires after %d seconds at %v, expected a day once read", msg.ExpiresAfter,
+			msg.ExpiresAt)
+	}
+
+	// Unread messages stay, even long after they are sent, until all the recipients read them
+	s.Advance(7 * 24 * time.Hour)
+	getMessage(t, bob, group.ID, msg.ID)
+	api.ExpireMessages(s.Router)
+	if read := getMessage(t, alice, group.ID, msg.ID); read.ExpiresAt != nil {
+		t.Errorf("the timer started at %s while carol has not read the message", *read.ExpiresAt)
+	}
+
+	getMessage(t, carol, group.ID, msg.ID)
+	startedAt := s.Now()
+	api.ExpireMessages(s.Router)
+	read := getMessage(t, alice, group.ID, msg.ID)
+	if read.ExpiresAt == nil || *read.ExpiresAt != timestamp(startedAt.Add(24*time.Hour)) {
+		t.Fatalf("the message expires at %v once read, expected a day after %s", read.ExpiresAt,
+			timestamp(startedAt))
+	}
+
+	s.Advance(24 * time.Hour)
+	api.ExpireMessages(s.Router)
+	aliceEvents.WaitWith("message_deleted", "messageId", msg.ID)
+}
+
+// TestDisappearingSettings checks the values of the settings, and that changes apply to new messages only
+func TestDisappearingSettings(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	c := "/conversations/" + conv
+	bobEvents := bob.Connect()
+
+	for _, timer := range []int{60, -1, 3601} {
+		alice.Do(http.MethodPut, c+"/settings", api.UpdateConversationSettingsRequest{DisappearingTimer: &timer}).
+			ExpectError(http.StatusBadRequest, "validation-failed", "disappearingTimer:invalid-value")
+	}
+	from := "opened"
+	alice.Do(http.MethodPut, c+"/settings", api.UpdateConversationSettingsRequest{DisappearingFrom: &from}).
+		ExpectError(http.StatusBadRequest, "validation-failed", "disappearingFrom:invalid-value")
+
+	var before api.MessageResponse
+	alice.Call(http.MethodPost, c+"/messages", textMessage("Before"), &before, http.StatusCreated)
+	bobEvents.WaitWith("new_message", "id", before.ID)
+
+	// Every timer is accepted, and described in the chat
+	for _, change := range []struct {
+		timer       int
+		description string
+	}{{604800, "7 days"}, {7776000, "90 days"}} {
+		setDisappearing(alice, conv, change.timer, "sent")
+		var notice api.MessageResponse
+		bobEvents.WaitFor("new_message", func(ev apitest.Event) bool {
+			ev.Decode(&notice)
+			return notice.ContentType == "system"
+		})
+		want := "alice set messages to disappear " + change.description + " after they are sent"
+		if text(notice) != want {
+			t.Errorf("the change was posted as %q, expected %q", text(notice), want)
+		}
+	}
+
+	// Setting the same values again posts nothing
+	setDisappearing(alice, conv, 7776000, "sent")
+	bobEvents.ExpectNone("new_message", quietPeriod)
+
+	var during api.MessageResponse
+	alice.Call(http.MethodPost, c+"/messages", textMessage("During"), &during, http.StatusCreated)
+	setDisappearing(bob, conv, 0, "")
+	var notice api.MessageResponse
+	bobEvents.WaitFor("new_message", func(ev apitest.Event) bool {
+		ev.Decode(&notice)
+		return notice.ContentType == "system"
+	})
+	if text(notice) != "bob turned off disappearing messages" {
+		t.Errorf("turning disappearing messages off was posted as %q", text(notice))
+	}
+	var after api.MessageResponse
+	alice.Call(http.MethodPost, c+"/messages", textMessage("After"), &after, http.StatusCreated)
+
+	// The messages keep the timer they were sent with
+	if m := getMessage(t, bob, conv, before.ID); m.ExpiresAfter != 0 || m.ExpiresAt != nil {
+		t.Errorf("the message sent before got a timer of %d seconds", m.ExpiresAfter)
+	}
+	if m := getMessage(t, bob, conv, during.ID); m.ExpiresAfter != 7776000 || m.ExpiresAt == nil {
+		t.Errorf("the message sent with a timer expires after %d seconds", m.ExpiresAfter)
+	}
+	if after.ExpiresAfter != 0 || after.ExpiresAt != nil {
+		t.Errorf("the message sent after turning off expires after %d seconds", after.ExpiresAfter)
+	}
+
+	s.Advance(90 * 24 * time.Hour)
+	api.ExpireMessages(s.Router)
+	bobEvents.WaitWith("message_deleted", "messageId", during.ID)
+	bobEvents.ExpectNone("message_deleted", quietPeriod)
+}
@@ -0,0 +1,61 @@
+package api
+
+// errorCode is the machine-readable code of an ErrorResponse. Clients match the codes, so they are never renamed or
+// reused for something else; every code is listed in errorCodes and documented in the Error schema of api.yaml, which
+// TestErrorCodesMatchSpec checks.
+type errorCode string
+
+// Codes of the errors of every status
+const (
+	codeBadRequest       errorCode = "bad-request"
+	codeUnauthorized     errorCode = "unauthorized"
+	codeForbidden        errorCode = "forbidden"
+	codeNotFound         errorCode = "not-found"
+	codeConflict         errorCode = "conflict"
+	codeTooManyRequests  errorCode = "too-many-requests"
+	codeInternalError    errorCode = "internal-error"
+	codeInvalidJSON      errorCode = "invalid-json"
+	codeValidationFailed errorCode = "validation-failed"
+)
+
+// Codes of specific errors, which clients may handle on their own
+const (
+	codeUsernameTaken    errorCode = "username-taken"
+	codeUsernameReserved errorCode = "username-reserved"
+	codeAccountSuspended errorCode = "account-suspended"
+	codeAccountBanned    errorCode = "account-banned"
+	codeAdminRequired    errorCode = "admin-required"
+	codeBlocked          errorCode = "blocked"
+	codePollClosed       errorCode = "poll-closed"
+	codePinLimitReached  errorCode = "pin-limit-reached"
+)
+
+// errorCodes is the catalogue of the codes handlers may send
+var errorCodes = []errorCode{
+	codeBadRequest,
+	codeUnauthorized,
+	codeForbidden,
+	codeNotFound,
+	codeConflict,
+	codeTooManyRequests,
+	codeInternalError,
+	codeInvalidJSON,
+	codeValidationFailed,
+	codeUsernameTaken,
+	codeUsernameReserved,
+	codeAccountSuspended,
+	codeAccountBanned,
+	codeAdminRequired,
+	codeBlocked,
+	codePollClosed,
+	codePinLimitReached,
+}
+
+// ErrorCodes returns the codes of the errors the API sends, for checking them against the API specification
+func ErrorCodes() []string {
+	codes := make([]string, len(errorCodes))
+	for i, code := range errorCodes {
+		codes[i] = string(code)
+	}
+	return codes
+}
@@ -0,0 +1,218 @@
+package api_test
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apispec"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+)
+
+// specFile is the OpenAPI specification of the API, relative to the package
+const specFile = "../../doc/api.yaml"
+
+// fieldCodeArguments are the functions of the api package taking the code of a field error, with the position of the
+// code among their arguments
+var fieldCodeArguments = map[string]int{"sendFieldError": 2, "newInvalidFieldError": 1}
+
+// TestErrorCodesMatchSpec checks that the codes of the catalogue of the api package (errorCodes) are the ones of the
+// Error schema, and the codes of the validation package the ones of the ErrorDetail schema. The handlers must only
+// send codes of the catalogue: every constant error code in the package, named or not, must be in it, no error code
+// may be made from a string at run time, and field errors must not be given string literals as codes.
+func TestErrorCodesMatchSpec(t *testing.T) {
+	spec := loadSpec(t)
+	compareCodes(t, "Error", api.ErrorCodes(), schemaEnum(t, spec, "Error", "code"))
+	compareCodes(t, "ErrorDetail", validation.Codes(), schemaEnum(t, spec, "ErrorDetail", "code"))
+
+	for _, p := range checkSources(t, ".") {
+		t.Error(p)
+	}
+}
+
+// TestValidationCodesListed checks that every Code constant of the validation package is in validation.Codes, so
+// that the ErrorDetail schema is compared with all of them
+func TestValidationCodesListed(t *testing.T) {
+	fset := token.NewFileSet()
+	files := parseDir(t, fset, "../validation")
+	conf := types.Config{Importer: noImporter{}, Error: func(error) {}}
+	pkg, _ := conf.Check("validation", fset, files, nil)
+
+	listed := make(map[string]bool)
+	for _, code := range validation.Codes() {
+		listed[code] = true
+	}
+	for _, name := range pkg.Scope().Names() {
+		c, ok := pkg.Scope().Lookup(name).(*types.Const)
+		if !ok || !strings.HasPrefix(name, "Code") || c.Val().Kind() != constant.String {
+			continue
+		}
+		if !listed[constant.StringVal(c.Val())] {
+			t.Errorf("%s: %s is not listed in validation.Codes", fset.Position(c.Pos()), name)
+		}
+	}
+}
+
+// loadSpec loads the specification of the API
+func loadSpec(t *testing.T) *apispec.Spec {
+	t.Helper()
+	spec, err := apispec.Load(specFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+// schemaEnum returns the enum of a property of a schema of the specification
+func schemaEnum(t *testing.T, spec *apispec.Spec, schema, property string) []string {
+	t.Helper()
+	var enum []string
+	if s := spec.Schema(schema); s != nil && s.Properties[property] != nil {
+		for _, v := range s.Properties[property].Enum {
+			enum = append(enum, fmt.Sprint(v))
+		}
+	}
+	if len(enum) == 0 {
+		t.Fatalf("the specification has no enum for %s.%s", schema, property)
+	}
+	return enum
+}
+
+// compareCodes reports the codes the server has and the specification doesn't, and the other way round
+func compareCodes(t *testing.T, schema string, server, spec []string) {
+	t.Helper()
+	for _, code := range difference(server, spec) {
+		t.Errorf("%s code %q is sent by the server but not documented", schema, code)
+	}
+	for _, code := range difference(spec, server) {
+		t.Errorf("%s code %q is documented but not in the server catalogue", schema, code)
+	}
+}
+
+// difference returns the elements of a that are not in b, sorted
+func difference(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+	var diff []string
+	for _, s := range a {
+		if !in[s] {
+			diff = append(diff, s)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// checkSources type-checks the api package and reports the constant error codes that are not in the catalogue, and
+// the codes made from strings at run time. Imported packages are not loaded: the codes are defined in the package.
+func checkSources(t *testing.T, dir string) []string {
+	t.Helper()
+	fset := token.NewFileSet()
+	files := parseDir(t, fset, dir)
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	conf := types.Config{Importer: noImporter{}, Error: func(error) {}}
+	pkg, _ := conf.Check("api", fset, files, info)
+	codeType, ok := pkg.Scope().Lookup("errorCode").(*types.TypeName)
+	if !ok {
+		t.Fatal("the api package has no errorCode type")
+	}
+
+	known := make(map[string]bool)
+	for _, code := range api.ErrorCodes() {
+		known[code] = true
+	}
+	// Problems by position; the files are in the file set in order, so positions sort by file then line
+	found := make(map[token.Pos]string)
+	for expr, tv := range info.Types {
+		if !types.Identical(tv.Type, codeType.Type()) || tv.IsType() {
+			continue
+		}
+		switch {
+		case tv.Value != nil && tv.Value.Kind() == constant.String:
+			if code := constant.StringVal(tv.Value); !known[code] {
+				found[expr.Pos()] = fmt.Sprintf("error code %q is not listed in errorCodes", code)
+			}
+		case isConversion(expr, info):
+			found[expr.Pos()] = "error code converted at run time, use an errorCode constant"
+		}
+	}
+
+	// Field codes are strings, so only literals are caught
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			fn, ok := call.Fun.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if i, ok := fieldCodeArguments[fn.Name]; ok && i < len(call.Args) {
+				if _, ok := call.Args[i].(*ast.BasicLit); ok {
+					found[call.Args[i].Pos()] = "field error code literal, use a validation.Code constant"
+				}
+			}
+			return true
+		})
+	}
+
+	positions := make([]token.Pos, 0, len(found))
+	for pos := range found {
+		positions = append(positions, pos)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+	problems := make([]string, len(positions))
+	for i, pos := range positions {
+		problems[i] = fmt.Sprintf("%s: %s", fset.Position(pos), found[pos])
+	}
+	return problems
+}
+
+// parseDir parses the Go files of a package, leaving out the tests
+func parseDir(t *testing.T, fset *token.FileSet, dir string) []*ast.File {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []*ast.File
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil {
+			t.Fatalf("parsing %s: %v", dir, err)
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no Go files in %s", dir)
+	}
+	return files
+}
+
+// isConversion reports whether an expression converts a value to another type, like errorCode(s)
+func isConversion(expr ast.Expr, info *types.Info) bool {
+	call, ok := expr.(*ast.CallExpr)
+	return ok && len(call.Args) == 1 && info.Types[call.Fun].IsType()
+}
+
+// noImporter fails to import every package, so that a package is checked on its own: the expressions using imported
+// packages are not typed, the others are
+type noImporter struct{}
+
+func (noImporter) Import(path string) (*types.Package, error) {
+	return nil, fmt.Errorf("%s not loaded", path)
+}
@@ -0,0 +1,421 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apispec"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/ozberk-sevinc/wasa-project/service/mailer"
+	"github.com/ozberk-sevinc/wasa-project/service/webpush"
+)
+
+// TestExchangesMatchSpec runs the server on a temporary database and plays a scenario exercising every operation of
+// the specification, WebSocket included. Every request, response and WebSocket event of the scenario is checked
+// against the specification, and every operation must be exercised: a new endpoint needs a step in the scenario.
+func TestExchangesMatchSpec(t *testing.T) {
+	spec := loadSpec(t)
+	h := &harness{
+		t:         t,
+		spec:      spec,
+		exercised: make(map[*apispec.Operation]bool),
+		seen:      make(map[string]bool),
+	}
+	h.server = apitest.Start(t, apitest.Options{
+		Configure: configure,
+		Wrap: func(next http.Handler) http.Handler {
+			return spec.Handler(next, h.record)
+		},
+		OnEvent: h.checkEvent,
+	})
+	h.scenario()
+
+	for _, op := range spec.Operations() {
+		if !h.exercised[op] {
+			h.problem(fmt.Sprintf("operation %s (%s) is not exercised by the scenario", op, op.ID))
+		}
+	}
+	for _, p := range h.problems {
+		t.Error(p)
+	}
+}
+
+// harness checks every exchange of the scenario with the server against the specification
+type harness struct {
+	t      *testing.T
+	spec   *apispec.Spec
+	server *apitest.Server
+
+	mu        sync.Mutex
+	exercised map[*apispec.Operation]bool
+	problems  []string
+	seen      map[string]bool
+}
+
+// configure enables push notifications and emails, so that their endpoints work
+func configure(cfg *api.Config) error {
+	key, err := webpush.LoadOrCreateKey("vapid.pem")
+	if err != nil {
+		return fmt.Errorf("creating the VAPID key: %w", err)
+	}
+	cfg.Push, err = webpush.NewSender(webpush.Config{Key: key, Subject: "mailto:test@example.com"})
+	if err != nil {
+		return fmt.Errorf("creating the push sender: %w", err)
+	}
+	cfg.Mailer = discardMailer{}
+	cfg.DigestSecret = []byte("exchanges")
+	cfg.PublicURL = "http://localhost:3000"
+	cfg.WebUIURL = "http://localhost:8080"
+	return nil
+}
+
+// record is called by the specification handler with every exchange. Requests the specification rejects are fine
+// when the server rejects them too: the scenario sends some on purpose.
+func (h *harness) record(ex apispec.Exchange) {
+	h.t.Logf("%s %s -> %d", ex.Request.Method, ex.Request.URL.Path, ex.Status)
+	h.mu.Lock()
+	if ex.Operation != nil {
+		h.exercised[ex.Operation] = true
+	}
+	h.mu.Unlock()
+
+	problems := ex.ResponseProblems
+	if ex.Operation == nil || ex.Status < 400 || ex.Status >= 500 {
+		problems = append(ex.RequestProblems, problems...)
+	}
+	for _, p := range problems {
+		h.problem(fmt.Sprintf("%s %s -> %d: %v", ex.Request.Method, ex.Request.URL.Path, ex.Status, p))
+	}
+}
+
+// checkEvent checks every WebSocket event received against the WebSocketEvent schema
+func (h *harness) checkEvent(data []byte) {
+	var ev apitest.Event
+	if err := json.Unmarshal(data, &ev); err != nil {
+		h.problem(fmt.Sprintf("WebSocket event: %v", err))
+		return
+	}
+	for _, p := range h.spec.ValidateJSON(h.spec.Schema("WebSocketEvent"), data, "WebSocket event "+ev.Type) {
+		h.problem(p.Error())
+	}
+}
+
+// problem records a problem, once
+func (h *harness) problem(p string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.seen[p] {
+		h.seen[p] = true
+		h.problems = append(h.problems, p)
+	}
+}
+
+// discardMailer accepts every email without sending it
+type discardMailer struct{}
+
+func (discardMailer) Send(context.Context, mailer.Message) error {
+	return nil
+}
+
+// ============================================================================
+// SCENARIO
+// ============================================================================
+
+// ids are the identifiers of the resources the scenario created
+type ids struct {
+	ID string `json:"id"`
+}
+
+// scenario exercises every operation of the specification, in the order a client would use them
+func (h *harness) scenario() {
+	alice, bob := h.server.Login("alice"), h.server.Login("bob")
+	carol, dave := h.server.Login("carol"), h.server.Login("dave")
+	h.server.GrantAdmin(alice)
+
+	steps := []func(*fixture){
+		profileSteps,
+		conversationSteps,
+		messageSteps,
+		groupSteps,
+		commandSteps,
+		transferSteps,
+		moderationSteps,
+		errorSteps,
+	}
+	f := &fixture{
+		t:           h.t,
+		anonymous:   h.server.Anonymous(),
+		alice:       alice,
+		bob:         bob,
+		carol:       carol,
+		dave:        dave,
+		aliceEvents: alice.Connect(),
+		bobEvents:   bob.Connect(),
+	}
+	for _, step := range steps {
+		step(f)
+	}
+}
+
+// fixture is what the steps of the scenario share
+type fixture struct {
+	t                       *testing.T
+	anonymous               *apitest.Client
+	alice, bob, carol, dave *apitest.Client
+	aliceEvents, bobEvents  *apitest.Socket
+
+	direct  string // conversation of alice and bob
+	group   string // group of alice, bob and carol
+	message string // a text message of alice in the direct conversation
+}
+
+func profileSteps(f *fixture) {
+	f.anonymous.Call(http.MethodGet, "/liveness", nil, nil, http.StatusOK)
+	f.alice.Call(http.MethodGet, "/me", nil, nil, http.StatusOK)
+	f.dave.Call(http.MethodPut, "/me/username", map[string]string{"name": "david"}, nil, http.StatusOK)
+	f.dave.Name = "david"
+	f.alice.Upload(http.MethodPut, "/me/photo", "photo", "me.png", apitest.Photo(), nil, nil, http.StatusOK)
+	f.alice.Call(http.MethodPut, "/me/email", map[string]string{"email": "alice@example.com"}, nil, http.StatusOK)
+	f.alice.Call(http.MethodGet, "/me/preferences", nil, nil, http.StatusOK)
+	prefs := map[string]interface{}{
+		"unarchiveOnMessage": true,
+		"pushNotifications":  true,
+		"pushPreviews":       false,
+		"digestFrequency":    "daily",
+	}
+	f.alice.Call(http.MethodPut, "/me/preferences", prefs, nil, http.StatusOK)
+	f.anonymous.Call(http.MethodGet, "/push/vapid-public-key", nil, nil, http.StatusOK)
+	subscription := map[string]interface{}{
+		"endpoint": "https://push.example.com/send/exchanges",
+		"keys": map[string]string{
+			"p256dh": "BNcRdreALRFXTkOOUHK1EtK2wtaz5Ry4YfYCA_0QTpQtUbVlUls0VJXg7A8u-Ts1XbjhazAkj7I99e8QcYP7DkM",
+			"auth":   "tBHItJI5svbpez7KI4CCXg",
+		},
+	}
+	var sub ids
+	f.alice.Call(http.MethodPost, "/me/push-subscriptions", subscription, &sub, http.StatusCreated)
+	f.alice.Call(http.MethodGet, "/me/push-subscriptions", nil, nil, http.StatusOK)
+	// Deleted at once, so that no notification is sent
+	f.alice.Call(http.MethodDelete, "/me/push-subscriptions/"+sub.ID, nil, nil, http.StatusNoContent)
+	f.alice.Call(http.MethodGet, "/users?q=bo", nil, nil, http.StatusOK)
+	f.alice.Call(http.MethodPost, "/me/blocks/"+f.dave.ID, nil, nil, http.StatusNoContent)
+	f.alice.Call(http.MethodGet, "/me/blocks", nil, nil, http.StatusOK)
+	f.alice.Call(http.MethodDelete, "/me/blocks/"+f.dave.ID, nil, nil, http.StatusNoContent)
+}
+
+func conversationSteps(f *fixture) {
+	var conv ids
+	f.alice.Call(http.MethodPost, "/conversations", map[string]string{"userId": f.bob.ID}, &conv, http.StatusCreated)
+	f.direct = conv.ID
+	f.bobEvents.Wait("new_conversation")
+	c := "/conversations/" + f.direct
+	f.alice.Call(http.MethodGet, "/conversations?sort=recent", nil, nil, http.StatusOK)
+	f.alice.Call(http.MethodGet, c, nil, nil, http.StatusOK)
+	f.alice.Call(http.MethodGet, c+"/settings", nil, nil, http.StatusOK)
+	settings := map[string]interface{}{"singleReaction": false, "disappearingTimer": 0}
+	f.alice.Call(http.MethodPut, c+"/settings", settings, nil, http.StatusOK)
+	for _, state := range []string{"archive", "pin", "unread"} {
+		f.alice.Call(http.MethodPut, c+"/"+state, nil, nil, http.StatusOK)
+	}
+	f.alice.Call(http.MethodGet, "/conversations?archived=true", nil, nil, http.StatusOK)
+	reorder := map[string][]string{"conversationIds": {f.direct}}
+	f.alice.Call(http.MethodPut, "/me/pinned-conversations", reorder, nil, http.StatusNoContent)
+	mute := map[string]string{"until": globaltime.Now().Add(time.Hour).UTC().Format(time.RFC3339)}
+	f.alice.Call(http.MethodPut, c+"/mute", mute, nil, http.StatusOK)
+	for _, state := range []string{"archive", "pin", "unread", "mute"} {
+		f.alice.Call(http.MethodDelete, c+"/"+state, nil, nil, http.StatusOK)
+	}
+}
+
+func messageSteps(f *fixture) {
+	c := "/conversations/" + f.direct
+	var msg struct {
+		ID string `json:"id"`
+	}
+	text := map[string]string{"contentType": "text", "text": "Hello @bob, see https://example.com"}
+	f.alice.Call(http.MethodPost, c+"/messages", text, &msg, http.StatusCreated)
+	f.message = msg.ID
+	f.bobEvents.Wait("new_message")
+	m := c + "/messages/" + f.message
+
+	var uploaded struct {
+		PhotoURL string `json:"photoUrl"`
+	}
+	f.alice.Upload(http.MethodPost, c+"/photos", "photo", "photo.png", apitest.Photo(), nil, &uploaded, http.StatusOK)
+	photoMessage := map[string]string{"contentType": "photo", "photoUrl": uploaded.PhotoURL}
+	f.alice.Call(http.MethodPost, c+"/messages", photoMessage, nil, http.StatusCreated)
+
+	var poll struct {
+		ID   string `json:"id"`
+		Poll struct {
+			Options []ids `json:"options"`
+		} `json:"poll"`
+	}
+	pollMessage := map[string]interface{}{
+		"contentType": "poll",
+		"poll":        map[string]interface{}{"question": "Lunch?", "options": []string{"Pizza", "Sushi"}},
+	}
+	f.alice.Call(http.MethodPost, c+"/messages", pollMessage, &poll, http.StatusCreated)
+	vote := c + "/messages/" + poll.ID + "/poll/votes/" + poll.Poll.Options[0].ID
+	f.bob.Call(http.MethodPut, vote, nil, nil, http.StatusOK)
+	f.aliceEvents.Wait("poll_updated")
+	f.bob.Call(http.MethodDelete, vote, nil, nil, http.StatusOK)
+
+	var reply ids
+	replyMessage := map[string]string{"contentType": "text", "text": "Hi!", "replyToMessageId": f.message}
+	f.bob.Call(http.MethodPost, c+"/messages", replyMessage, &reply, http.StatusCreated)
+	f.alice.Call(http.MethodGet, m+"/thread", nil, nil, http.StatusOK)
+	f.bob.Call(http.MethodDelete, c+"/messages/"+reply.ID, nil, nil, http.StatusNoContent)
+	f.aliceEvents.Wait("message_deleted")
+
+	// Reading the conversation marks the messages as read
+	f.bob.Call(http.MethodGet, c+"?limit=10", nil, nil, http.StatusOK)
+	f.aliceEvents.Wait("messages_read")
+
+	var reaction ids
+	f.bob.Call(http.MethodPost, m+"/comments", map[string]string{"emoji": "👍"}, &reaction, http.StatusCreated)
+	f.aliceEvents.Wait("reaction_added")
+	f.alice.Call(http.MethodGet, m+"/reactions?emoji=👍", nil, nil, http.StatusOK)
+	f.bob.Call(http.MethodDelete, m+"/comments/"+reaction.ID, nil, nil, http.StatusNoContent)
+
+	f.alice.Call(http.MethodPut, m+"/pin", nil, nil, http.StatusOK)
+	f.alice.Call(http.MethodDelete, m+"/pin", nil, nil, http.StatusNoContent)
+	f.bob.Call(http.MethodPut, m+"/star", nil, nil, http.StatusNoContent)
+	f.bob.Call(http.MethodGet, "/me/starred?limit=10", nil, nil, http.StatusOK)
+	f.bob.Call(http.MethodDelete, m+"/star", nil, nil, http.StatusNoContent)
+	f.bob.Call(http.MethodGet, "/me/mentions", nil, nil, http.StatusOK)
+
+	var scheduled ids
+	later := map[string]string{
+		"contentType": "text",
+		"text":        "Later",
+		"sendAt":      globaltime.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	}
+	f.alice.Call(http.MethodPost, c+"/scheduled-messages", later, &scheduled, http.StatusCreated)
+	f.alice.Call(http.MethodGet, c+"/scheduled-messages", nil, nil, http.StatusOK)
+	s := c + "/scheduled-messages/" + scheduled.ID
+	later["text"] = "Even later"
+	later["sendAt"] = globaltime.Now().Add(2 * time.Hour).UTC().Format(time.RFC3339)
+	f.alice.Call(http.MethodPut, s, later, nil, http.StatusOK)
+	f.alice.Call(http.MethodDelete, s, nil, nil, http.StatusNoContent)
+}
+
+func groupSteps(f *fixture) {
+	var group ids
+	create := map[string]interface{}{"name": "Climbing", "memberIds": []string{f.bob.ID}}
+	f.alice.Call(http.MethodPost, "/groups", create, &group, http.StatusCreated)
+	f.group = group.ID
+	g := "/groups/" + f.group
+	f.alice.Call(http.MethodGet, g, nil, nil, http.StatusOK)
+	f.alice.Call(http.MethodPost, g+"/members", map[string]string{"userId": f.carol.ID}, nil, http.StatusOK)
+	f.alice.Call(http.MethodPut, g+"/name", map[string]string{"name": "Bouldering"}, nil, http.StatusOK)
+	f.bobEvents.Wait("group_updated")
+	f.alice.Upload(http.MethodPut, g+"/photo", "photo", "group.png", apitest.Photo(), nil, nil, http.StatusOK)
+
+	mention := map[string]string{"contentType": "text", "text": "@carol are you coming?"}
+	f.bob.Call(http.MethodPost, "/conversations/"+f.group+"/messages", mention, nil, http.StatusCreated)
+	f.carol.Call(http.MethodGet, "/me/mentions?limit=5", nil, nil, http.StatusOK)
+
+	forward := map[string]string{"targetConversationId": f.group}
+	m := "/conversations/" + f.direct + "/messages/" + f.message
+	f.alice.Call(http.MethodPost, m+"/forward", forward, nil, http.StatusCreated)
+	f.carol.Call(http.MethodDelete, g+"/members/me", nil, nil, http.StatusNoContent)
+}
+
+func commandSteps(f *fixture) {
+	c := "/conversations/" + f.group
+	register := map[string]string{"description": "Deploy the current build", "usage": "/deploy <environment>"}
+	f.bob.Call(http.MethodPut, c+"/commands/deploy", register, nil, http.StatusOK)
+	f.alice.Call(http.MethodGet, c+"/commands?prefix=de", nil, nil, http.StatusOK)
+	invoke := map[string]string{"contentType": "text", "text": "/deploy staging"}
+	f.alice.Call(http.MethodPost, c+"/messages", invoke, nil, http.StatusAccepted)
+	var invocation struct {
+		InvocationID string `json:"invocationId"`
+	}
+	f.bobEvents.Wait("command_invoked").Decode(&invocation)
+	reply := map[string]interface{}{"text": "Deploying to staging...", "ephemeral": false}
+	path := c + "/command-invocations/" + invocation.InvocationID + "/reply"
+	f.bob.Call(http.MethodPost, path, reply, nil, http.StatusCreated)
+	f.bob.Call(http.MethodDelete, c+"/commands/deploy", nil, nil, http.StatusNoContent)
+}
+
+func transferSteps(f *fixture) {
+	c := "/conversations/" + f.direct
+	for _, query := range []string{"format=json", "format=html", "format=txt", "format=json&media=zip"} {
+		f.alice.Call(http.MethodGet, c+"/export?"+query, nil, nil, http.StatusOK)
+	}
+
+	chat := "2024-03-01, 09:30 - alice: Imported hello\n2024-03-01, 09:31 - bob: Imported reply\n"
+	fields := map[string]string{"format": "whatsapp", "timezone": "Europe/Rome"}
+	f.alice.Upload(http.MethodPost, c+"/import", "file", "chat.txt", []byte(chat), fields, nil, http.StatusOK)
+
+	var export struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	f.bob.Call(http.MethodPost, "/me/export", nil, &export, http.StatusAccepted)
+	for deadline := time.Now().Add(apitest.EventTimeout); export.Status == "pending"; {
+		if time.Now().After(deadline) {
+			f.t.Fatal("the account export is still pending")
+		}
+		time.Sleep(50 * time.Millisecond)
+		f.bob.Call(http.MethodGet, "/me/export/"+export.ID, nil, &export, http.StatusOK)
+	}
+	f.bob.Call(http.MethodGet, "/me/export/"+export.ID+"/download", nil, nil, http.StatusOK)
+}
+
+func moderationSteps(f *fixture) {
+	var report ids
+	reportMessage := map[string]string{
+		"type":           "message",
+		"conversationId": f.direct,
+		"messageId":      f.message,
+		"reason":         "spam",
+	}
+	f.bob.Call(http.MethodPost, "/reports", reportMessage, &report, http.StatusCreated)
+	f.alice.Call(http.MethodGet, "/admin/reports?status=open", nil, nil, http.StatusOK)
+	f.alice.Call(http.MethodGet, "/admin/reports/"+report.ID, nil, nil, http.StatusOK)
+	review := map[string]string{"status": "resolved"}
+	f.alice.Call(http.MethodPut, "/admin/reports/"+report.ID+"/status", review, nil, http.StatusOK)
+	moderate := "/admin/conversations/" + f.direct + "/messages/" + f.message
+	f.alice.Call(http.MethodDelete, moderate, nil, nil, http.StatusNoContent)
+	f.bobEvents.Wait("message_deleted")
+
+	f.alice.Call(http.MethodGet, "/admin/users?limit=10", nil, nil, http.StatusOK)
+	f.alice.Call(http.MethodGet, "/admin/users/"+f.dave.ID, nil, nil, http.StatusOK)
+	status := "/admin/users/" + f.dave.ID + "/status"
+	suspend := map[string]string{
+		"status":         "suspended",
+		"suspendedUntil": globaltime.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339),
+		"reason":         "Spam",
+	}
+	f.alice.Call(http.MethodPut, status, suspend, nil, http.StatusOK)
+	f.dave.Call(http.MethodGet, "/me", nil, nil, http.StatusForbidden)
+	f.alice.Call(http.MethodPut, status, map[string]string{"status": "active"}, nil, http.StatusOK)
+	f.alice.Call(http.MethodGet, "/admin/stats", nil, nil, http.StatusOK)
+	f.alice.Call(http.MethodGet, "/admin/audit-log?limit=20", nil, nil, http.StatusOK)
+	f.alice.Call(http.MethodDelete, "/admin/groups/"+f.group, nil, nil, http.StatusNoContent)
+	f.bobEvents.Wait("group_dissolved")
+	f.dave.Call(http.MethodDelete, "/me", nil, nil, http.StatusNoContent)
+}
+
+// errorSteps exercises documented errors
+func errorSteps(f *fixture) {
+	f.anonymous.Call(http.MethodGet, "/me", nil, nil, http.StatusUnauthorized)
+	f.bob.Call(http.MethodPut, "/me/username", map[string]string{"name": "alice"}, nil, http.StatusConflict)
+	f.anonymous.Call(http.MethodPost, "/session", map[string]string{"name": "a"}, nil, http.StatusBadRequest)
+	empty := map[string]string{"contentType": "text", "text": ""}
+	f.alice.Call(http.MethodPost, "/conversations/"+f.direct+"/messages", empty, nil, http.StatusBadRequest)
+	f.alice.Call(http.MethodGet, "/conversations/unknown", nil, nil, http.StatusNotFound)
+	f.bob.Call(http.MethodGet, "/admin/stats", nil, nil, http.StatusForbidden)
+	f.anonymous.Call(http.MethodGet, "/digest/unsubscribe?token=not.valid", nil, nil, http.StatusBadRequest)
+	f.anonymous.Call(http.MethodPost, "/digest/unsubscribe?token=not.valid", nil, nil, http.StatusBadRequest)
+	f.anonymous.Call(http.MethodGet, "/ws?token=unknown", nil, nil, http.StatusUnauthorized)
+}
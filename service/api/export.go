@@ -0,0 +1,287 @@
+package api
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/chatexport"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+	"github.com/sirupsen/logrus"
+)
+
+// exportPageSize is the number of messages loaded from the database at a time while exporting
+const exportPageSize = 500
+
+// exportMedia is a photo bundled in an export archive
+type exportMedia struct {
+	archivePath string
+	localPath   string
+}
+
+// exportConversation handles GET /conversations/{conversationId}/export
+// ?format= is json (default), html or txt. With ?media=zip, the document is sent in a ZIP archive together with the
+// photos uploaded to the conversation; otherwise photos are referenced by URL.
+func (rt *_router) exportConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+
+	formatName := r.URL.Query().Get("format")
+	if formatName == "" {
+		formatName = string(chatexport.FormatJSON)
+	}
+	format, err := chatexport.ParseFormat(formatName)
+	if err != nil {
+		sendFieldError(w, "format", validation.CodeInvalidValue, "format must be 'json', 'html' or 'txt'")
+		return
+	}
+
+	media := r.URL.Query().Get("media")
+	if media != "" && media != "link" && media != "zip" {
+		sendFieldError(w, "media", validation.CodeInvalidValue, "media must be 'link' or 'zip'")
+		return
+	}
+	bundle := media == "zip"
+
+	conv, err := rt.resolveConversation(user.ID, conversationID)
+	if err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	participants, err := rt.db.GetParticipants(conversationID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting participants")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	header := chatexport.Conversation{
+		ID:         conv.ID,
+		Type:       conv.Type,
+		Title:      conv.Name,
+		ExportedAt: globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		ExportedBy: exportUser(*user),
+	}
+	users := make(map[string]chatexport.User)
+	for _, p := range participants {
+		users[p.ID] = exportUser(p)
+		header.Participants = append(header.Participants, exportUser(p))
+		if conv.Type == "direct" && p.ID != user.ID {
+			header.Title = p.Name
+		}
+	}
+	if header.Title == "" {
+		header.Title = selfConversationTitle
+	}
+
+	// From here on the response is streamed: errors can only be logged
+	fileName := "conversation-" + conv.ID
+	if bundle {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName+".zip"))
+		w.WriteHeader(http.StatusOK)
+
+		zw := zip.NewWriter(w)
+		doc, err := zw.Create("conversation." + format.Extension())
+		if err != nil {
+			ctx.Logger.WithError(err).Error("error creating export archive")
+			return
+		}
+		files, err := rt.writeExport(ctx.Logger, chatexport.NewWriter(format, doc), header, users, true)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("error writing export")
+			return
+		}
+		for _, f := range files {
+			if err := addArchiveFile(zw, f); err != nil {
+				ctx.Logger.WithError(err).WithField("file", f.localPath).Warn("error adding media to export")
+			}
+		}
+		if err := zw.Close(); err != nil {
+			ctx.Logger.WithError(err).Error("error completing export archive")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName+"."+format.Extension()))
+	w.WriteHeader(http.StatusOK)
+	if _, err := rt.writeExport(ctx.Logger, chatexport.NewWriter(format, w), header, users, false); err != nil {
+		ctx.Logger.WithError(err).Error("error writing export")
+	}
+}
+
+// writeExport writes the whole history of a conversation, loading it from the database one page at a time. `users`
+// caches the senders already seen. With `bundle`, local photos are referenced by their path in the archive and
+// returned so that the caller can add them.
+func (rt *_router) writeExport(logger logrus.FieldLogger, ew chatexport.Writer, header chatexport.Conversation, users map[string]chatexport.User, bundle bool) ([]exportMedia, error) {
+	if err := ew.WriteHeader(header); err != nil {
+		return nil, err
+	}
+
+	var files []exportMedia
+	afterCreatedAt, afterID := "", ""
+	for {
+		page, err := rt.db.GetMessagesByConversationAfter(header.ID, afterCreatedAt, afterID, exportPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("loading messages: %w", err)
+		}
+
+		messageIDs := make([]string, 0, len(page))
+		var missing []string
+		for _, m := range page {
+			messageIDs = append(messageIDs, m.ID)
+			if _, ok := users[m.SenderID]; !ok {
+				missing = append(missing, m.SenderID)
+			}
+		}
+
+		reactions, err := rt.db.GetReactionsByMessageIDs(messageIDs)
+		if err != nil {
+			return nil, fmt.Errorf("loading reactions: %w", err)
+		}
+		reactionsByMessage := make(map[string][]database.Reaction)
+		for _, r := range reactions {
+			reactionsByMessage[r.MessageID] = append(reactionsByMessage[r.MessageID], r)
+			if _, ok := users[r.UserID]; !ok {
+				missing = append(missing, r.UserID)
+			}
+		}
+
+		// Former participants are not in the header
+		if len(missing) > 0 {
+			found, err := rt.db.GetUsersByIDs(missing)
+			if err != nil {
+				return nil, fmt.Errorf("loading users: %w", err)
+			}
+			for _, u := range found {
+				users[u.ID] = exportUser(u)
+			}
+		}
+
+		for _, m := range page {
+			em := chatexport.Message{
+				ID:               m.ID,
+				Sender:           users[m.SenderID],
+				CreatedAt:        m.CreatedAt,
+				ContentType:      m.ContentType,
+				Text:             m.Text,
+				PhotoURL:         m.PhotoURL,
+				ReplyToMessageID: m.RepliedToMessageID,
+				IsForwarded:      m.IsForwarded,
+			}
+			for _, r := range reactionsByMessage[m.ID] {
+				em.Reactions = append(em.Reactions, chatexport.Reaction{
+					Emoji:     r.Emoji,
+					User:      users[r.UserID],
+					CreatedAt: r.CreatedAt,
+				})
+			}
+			if m.ContentType == contentTypePoll {
+				em.Poll, err = rt.exportPoll(m.ID)
+				if err != nil {
+					return nil, fmt.Errorf("loading poll: %w", err)
+				}
+			}
+			if bundle && m.PhotoURL != nil {
+				if f, ok := localUpload(*m.PhotoURL); ok && fileExists(f.localPath) {
+					f.archivePath = "media/" + m.ID + "-" + path.Base(f.archivePath)
+					em.Media = &f.archivePath
+					em.PhotoURL = nil
+					files = append(files, f)
+				}
+			}
+
+			if err := ew.WriteMessage(em); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(page) < exportPageSize {
+			break
+		}
+		last := page[len(page)-1]
+		afterCreatedAt, afterID = last.CreatedAt, last.ID
+	}
+
+	if err := ew.Close(); err != nil {
+		return nil, err
+	}
+	logger.WithField("media", len(files)).Debug("conversation exported")
+	return files, nil
+}
+
+// exportPoll loads a poll with its final results
+func (rt *_router) exportPoll(messageID string) (*chatexport.Poll, error) {
+	poll, err := rt.db.GetPoll(messageID)
+	if err != nil || poll == nil {
+		return nil, err
+	}
+	votes, err := rt.db.GetPollVotes(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, v := range votes {
+		counts[v.OptionID]++
+	}
+	ep := &chatexport.Poll{Question: poll.Question, MultipleChoice: poll.MultipleChoice}
+	for _, o := range poll.Options {
+		ep.Options = append(ep.Options, chatexport.PollOption{Text: o.Text, Votes: counts[o.ID]})
+	}
+	return ep, nil
+}
+
+func exportUser(u database.User) chatexport.User {
+	return chatexport.User{ID: u.ID, Name: u.Name, DisplayName: u.DisplayName}
+}
+
+// localUpload maps a photo URL served from /uploads to the file on disk. External URLs are not bundled.
+func localUpload(photoURL string) (exportMedia, bool) {
+	rest, ok := strings.CutPrefix(photoURL, "/uploads/")
+	if !ok {
+		return exportMedia{}, false
+	}
+	clean := path.Clean("/" + rest)
+	return exportMedia{
+		archivePath: path.Base(clean),
+		localPath:   filepath.Join("./uploads", filepath.FromSlash(clean)),
+	}, true
+}
+
+func fileExists(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// addArchiveFile copies a media file into the export archive
+func addArchiveFile(zw *zip.Writer, f exportMedia) error {
+	src, err := os.Open(f.localPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := zw.Create(f.archivePath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
@@ -0,0 +1,18 @@
+package api
+
+// SendDueMessages sends the scheduled messages that are due, as the scheduler does when its timer fires, so that the
+// tests don't wait for it
+func SendDueMessages(r Router) {
+	rt := r.(*_router)
+	rt.sendDueMessages(rt.baseLogger)
+}
+
+// SendDueDigests sends the email digests that are due, as the digest worker does every digestInterval
+func SendDueDigests(r Router) {
+	r.(*_router).sendDueDigests()
+}
+
+// ExpireMessages deletes the disappearing messages that expired, as the expiry worker does every expiryInterval
+func ExpireMessages(r Router) {
+	r.(*_router).expireMessages()
+}
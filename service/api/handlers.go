@@ -11,6 +11,7 @@ import (
 	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
 	"github.com/ozberk-sevinc/wasa-project/service/database"
 	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
 )
 
 // ============================================================================
@@ -20,6 +21,7 @@ import (
 const (
 	selfConversationTitle = "Message Yourself"
 	contentTypePhoto      = "photo"
+	contentTypePoll       = "poll"
 )
 
 // ============================================================================
@@ -34,27 +36,36 @@ type UserResponse struct {
 	PhotoURL    *string `json:"photoUrl,omitempty"`
 }
 
-// LoginRequest is the request body for POST /session
+// MeResponse matches the Me schema: the current user with their unread badge
+type MeResponse struct {
+	UserResponse
+	Email              *string `json:"email,omitempty"`
+	UnreadCount        int     `json:"unreadCount"`
+	UnreadMentionCount int     `json:"unreadMentionCount"`
+	IsAdmin            bool    `json:"isAdmin"`
+}
+
+// LoginRequest matches the LoginRequest schema: the request body for POST /session
 type LoginRequest struct {
 	Name string `json:"name"`
 }
 
-// LoginResponse is the response for POST /session
+// LoginResponse matches the LoginResponse schema: the response for POST /session
 type LoginResponse struct {
 	Identifier string `json:"identifier"`
 }
 
-// SetUsernameRequest is the request body for PUT /me/username
+// SetUsernameRequest matches the SetMyUserNameRequest schema: the request body for PUT /me/username
 type SetUsernameRequest struct {
 	Name string `json:"name"`
 }
 
-// SearchUsersResponse is the response for GET /users
+// SearchUsersResponse matches the SearchUsersResponse schema: the response for GET /users
 type SearchUsersResponse struct {
 	Users []UserResponse `json:"users"`
 }
 
-// CreateConversationRequest is the request body for POST /conversations
+// CreateConversationRequest matches the ConversationPrototype schema: the request body for POST /conversations
 type CreateConversationRequest struct {
 	UserID string `json:"userId"`
 }
@@ -72,6 +83,9 @@ type ConversationSummaryResponse struct {
 	LastMessageAt      *string `json:"lastMessageAt,omitempty"`
 	LastMessageSnippet *string `json:"lastMessageSnippet,omitempty"`
 	LastMessageIsPhoto bool    `json:"lastMessageIsPhoto"`
+	UnreadCount        int     `json:"unreadCount"`
+	UnreadMentionCount int     `json:"unreadMentionCount"`
+	ConversationStateResponse
 }
 
 // ReactionResponse matches the Reaction schema
@@ -84,27 +98,39 @@ type ReactionResponse struct {
 
 // MessageResponse matches the Message schema
 type MessageResponse struct {
-	ID                 string             `json:"id"`
-	ConversationID     string             `json:"conversationId"`
-	Sender             UserResponse       `json:"sender"`
-	CreatedAt          string             `json:"createdAt"`
-	ContentType        string             `json:"contentType"`
-	Text               *string            `json:"text,omitempty"`
-	PhotoURL           *string            `json:"photoUrl,omitempty"`
-	RepliedToMessageID *string            `json:"repliedToMessageId,omitempty"`
-	Status             string             `json:"status"`
-	Reactions          []ReactionResponse `json:"reactions"`
-	IsForwarded        bool               `json:"isForwarded"`
+	ID                 string                    `json:"id"`
+	ConversationID     string                    `json:"conversationId"`
+	Sender             UserResponse              `json:"sender"`
+	CreatedAt          string                    `json:"createdAt"`
+	ContentType        string                    `json:"contentType"`
+	Text               *string                   `json:"text,omitempty"`
+	PhotoURL           *string                   `json:"photoUrl,omitempty"`
+	RepliedToMessageID *string                   `json:"repliedToMessageId,omitempty"`
+	ReplyTo            *ReplyPreviewResponse     `json:"replyTo,omitempty"`
+	ReplyCount         int                       `json:"replyCount"`
+	Status             string                    `json:"status"`
+	Reactions          []ReactionResponse        `json:"reactions"`
+	ReactionSummary    []ReactionSummaryResponse `json:"reactionSummary"`
+	IsForwarded        bool                      `json:"isForwarded"`
+	IsImported         bool                      `json:"isImported"`
+	ExpiresAfter       int                       `json:"expiresAfter,omitempty"`
+	ExpiresAt          *string                   `json:"expiresAt,omitempty"`
+	Starred            bool                      `json:"starred"`
+	Poll               *PollResponse             `json:"poll,omitempty"`
+	Mentions           []MentionResponse         `json:"mentions,omitempty"`
+	LinkPreview        *LinkPreviewResponse      `json:"linkPreview,omitempty"`
 }
 
 // ConversationResponse matches the Conversation schema (full details)
 type ConversationResponse struct {
-	ID           string            `json:"id"`
-	Type         string            `json:"type"`
-	Title        string            `json:"title"`
-	PhotoURL     *string           `json:"photoUrl,omitempty"`
-	Participants []UserResponse    `json:"participants"`
-	Messages     []MessageResponse `json:"messages"`
+	ID             string                        `json:"id"`
+	Type           string                        `json:"type"`
+	Title          string                        `json:"title"`
+	PhotoURL       *string                       `json:"photoUrl,omitempty"`
+	Participants   []UserResponse                `json:"participants"`
+	Messages       []MessageResponse             `json:"messages"`
+	Settings       *ConversationSettingsResponse `json:"settings,omitempty"`
+	PinnedMessages []PinnedMessageResponse       `json:"pinnedMessages,omitempty"`
 }
 
 // GroupResponse matches the Group schema
@@ -120,36 +146,41 @@ type GroupResponse struct {
 // REQUEST TYPES
 // ============================================================================
 
-// SendMessageRequest is the request body for POST /conversations/{id}/messages
+// SendMessageRequest matches the SendMessageRequest schema: the request body for POST /conversations/{id}/messages
 type SendMessageRequest struct {
-	ContentType      string  `json:"contentType"`
-	Text             *string `json:"text,omitempty"`
-	PhotoURL         *string `json:"photoUrl,omitempty"`
-	ReplyToMessageID *string `json:"replyToMessageId,omitempty"`
+	ContentType      string       `json:"contentType"`
+	Text             *string      `json:"text,omitempty"`
+	PhotoURL         *string      `json:"photoUrl,omitempty"`
+	ReplyToMessageID *string      `json:"replyToMessageId,omitempty"`
+	Poll             *PollRequest `json:"poll,omitempty"`
+
+	// messageID, when set, is the ID of the new message. The scheduler uses the ID of the scheduled message, so that
+	// a delivery interrupted by a restart is not repeated.
+	messageID string
 }
 
-// CommentMessageRequest is the request body for POST .../comments (reactions)
+// CommentMessageRequest matches the CommentMessageRequest schema: the request body for POST .../comments (reactions)
 type CommentMessageRequest struct {
 	Emoji string `json:"emoji"`
 }
 
-// ForwardMessageRequest is the request body for POST .../forward
+// ForwardMessageRequest matches the ForwardMessageRequest schema: the request body for POST .../forward
 type ForwardMessageRequest struct {
 	TargetConversationID string `json:"targetConversationId"`
 }
 
-// CreateGroupRequest is the request body for POST /groups
+// CreateGroupRequest matches the GroupPrototype schema: the request body for POST /groups
 type CreateGroupRequest struct {
 	Name      string   `json:"name"`
 	MemberIDs []string `json:"memberIds,omitempty"`
 }
 
-// AddToGroupRequest is the request body for POST /groups/{id}/members
+// AddToGroupRequest matches the AddToGroupRequest schema: the request body for POST /groups/{id}/members
 type AddToGroupRequest struct {
 	UserID string `json:"userId"`
 }
 
-// SetGroupNameRequest is the request body for PUT /groups/{id}/name
+// SetGroupNameRequest matches the SetGroupNameRequest schema: the request body for PUT /groups/{id}/name
 type SetGroupNameRequest struct {
 	Name string `json:"name"`
 }
@@ -164,13 +195,13 @@ type SetGroupNameRequest struct {
 func (rt *_router) doLogin(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendBadRequest(w, "Invalid JSON")
+		sendInvalidJSON(w)
 		return
 	}
 
 	// Validate username length (3-16 characters)
 	if len(req.Name) < 3 || len(req.Name) > 16 {
-		sendBadRequest(w, "Username must be between 3 and 16 characters")
+		sendFieldError(w, "name", validation.CodeInvalidFormat, "Username must be between 3 and 16 characters")
 		return
 	}
 
@@ -185,6 +216,23 @@ func (rt *_router) doLogin(w http.ResponseWriter, r *http.Request, ps httprouter
 	var userID string
 
 	if user != nil {
+		// Placeholders stand for senders of imported conversations and deleted accounts keep their messages, nobody
+		// may log in as them
+		inactive, err := rt.db.IsInactiveUser(user.ID)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("database error")
+			sendInternalError(w, "Database error")
+			return
+		}
+		if inactive {
+			sendError(w, http.StatusForbidden, codeUsernameReserved, "This username is reserved")
+			return
+		}
+		if err := rt.checkAccountStatus(user.ID); err != nil {
+			sendResolveError(w, ctx.Logger, err)
+			return
+		}
+
 		// User exists, return existing ID
 		userID = user.ID
 	} else {
@@ -220,11 +268,36 @@ func (rt *_router) getMe(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		return
 	}
 
-	sendJSON(w, http.StatusOK, UserResponse{
-		ID:          user.ID,
-		Name:        user.Name,
-		DisplayName: user.DisplayName,
-		PhotoURL:    user.PhotoURL,
+	unread, err := rt.db.GetTotalUnreadCounts(user.ID, globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error counting unread messages")
+		sendInternalError(w, "Database error")
+		return
+	}
+	email, err := rt.db.GetUserEmail(user.ID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting email")
+		sendInternalError(w, "Database error")
+		return
+	}
+	isAdmin, err := rt.isAdmin(user.ID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting admin role")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, MeResponse{
+		UserResponse: UserResponse{
+			ID:          user.ID,
+			Name:        user.Name,
+			DisplayName: user.DisplayName,
+			PhotoURL:    user.PhotoURL,
+		},
+		Email:              email,
+		UnreadCount:        unread.Messages,
+		UnreadMentionCount: unread.Mentions,
+		IsAdmin:            isAdmin,
 	})
 }
 
@@ -238,13 +311,13 @@ func (rt *_router) setMyUserName(w http.ResponseWriter, r *http.Request, ps http
 
 	var req SetUsernameRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendBadRequest(w, "Invalid JSON")
+		sendInvalidJSON(w)
 		return
 	}
 
 	// Validate username length
 	if len(req.Name) < 3 || len(req.Name) > 16 {
-		sendBadRequest(w, "Username must be between 3 and 16 characters")
+		sendFieldError(w, "name", validation.CodeInvalidFormat, "Username must be between 3 and 16 characters")
 		return
 	}
 
@@ -256,7 +329,7 @@ func (rt *_router) setMyUserName(w http.ResponseWriter, r *http.Request, ps http
 		return
 	}
 	if existing != nil && existing.ID != user.ID {
-		sendConflict(w, "Username is already taken")
+		sendError(w, http.StatusConflict, codeUsernameTaken, "Username is already taken")
 		return
 	}
 
@@ -351,6 +424,13 @@ func (rt *_router) searchUsers(w http.ResponseWriter, r *http.Request, ps httpro
 		users = []UserResponse{}
 	}
 
+	if user := GetUserFromContext(r.Context()); user != nil {
+		blockers := rt.blockedBy(ctx.Logger, user.ID)
+		for i := range users {
+			users[i].PhotoURL = visiblePhoto(blockers, users[i].ID, users[i].PhotoURL)
+		}
+	}
+
 	sendJSON(w, http.StatusOK, SearchUsersResponse{
 		Users: users,
 	})
@@ -371,12 +451,12 @@ func (rt *_router) startConversation(w http.ResponseWriter, r *http.Request, ps
 
 	var req CreateConversationRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendBadRequest(w, "Invalid JSON")
+		sendInvalidJSON(w)
 		return
 	}
 
 	if req.UserID == "" {
-		sendBadRequest(w, "userId is required")
+		sendFieldError(w, "userId", validation.CodeRequired, "userId is required")
 		return
 	}
 
@@ -410,6 +490,9 @@ func (rt *_router) startConversation(w http.ResponseWriter, r *http.Request, ps
 		return
 	}
 
+	// Users who blocked the current user can't be reached through a new conversation, and their photo is hidden
+	blockers := rt.blockedBy(ctx.Logger, user.ID)
+
 	if existingConv != nil {
 		// Return existing conversation
 		participants, _ := rt.db.GetParticipants(existingConv.ID)
@@ -419,7 +502,7 @@ func (rt *_router) startConversation(w http.ResponseWriter, r *http.Request, ps
 				ID:          p.ID,
 				Name:        p.Name,
 				DisplayName: p.DisplayName,
-				PhotoURL:    p.PhotoURL,
+				PhotoURL:    visiblePhoto(blockers, p.ID, p.PhotoURL),
 			})
 		}
 
@@ -433,13 +516,18 @@ func (rt *_router) startConversation(w http.ResponseWriter, r *http.Request, ps
 			ID:           existingConv.ID,
 			Type:         existingConv.Type,
 			Title:        existingTitle,
-			PhotoURL:     targetUser.PhotoURL,
+			PhotoURL:     visiblePhoto(blockers, targetUser.ID, targetUser.PhotoURL),
 			Participants: participantResponses,
 			Messages:     []MessageResponse{},
 		})
 		return
 	}
 
+	if blockers[targetUser.ID] {
+		sendError(w, http.StatusForbidden, codeBlocked, "You can't start a conversation with this user")
+		return
+	}
+
 	// Create new direct conversation
 	convID, _ := uuid.NewV4()
 
@@ -502,6 +590,7 @@ func (rt *_router) startConversation(w http.ResponseWriter, r *http.Request, ps
 
 // getMyConversations handles GET /conversations - list user's conversations
 // Also marks messages from others as "received" (one checkmark)
+// ?archived=true lists the archived conversations instead of the others; ?sort=recent ignores pins
 func (rt *_router) getMyConversations(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	user := GetUserFromContext(r.Context())
 	if user == nil {
@@ -509,6 +598,22 @@ func (rt *_router) getMyConversations(w http.ResponseWriter, r *http.Request, ps
 		return
 	}
 
+	query := r.URL.Query()
+	archived := false
+	switch query.Get("archived") {
+	case "", "false":
+	case "true":
+		archived = true
+	default:
+		sendFieldError(w, "archived", validation.CodeInvalidValue, "archived must be true or false")
+		return
+	}
+	order := query.Get("sort")
+	if order != "" && order != "pinned" && order != "recent" {
+		sendFieldError(w, "sort", validation.CodeInvalidValue, "sort must be pinned or recent")
+		return
+	}
+
 	// Update status of messages from others to "received" for all user's conversations
 	_ = rt.db.MarkMessagesAsReceived(user.ID)
 
@@ -519,8 +624,15 @@ func (rt *_router) getMyConversations(w http.ResponseWriter, r *http.Request, ps
 		return
 	}
 
+	sortConversationSummaries(summaries, order)
+	blockers := rt.blockedBy(ctx.Logger, user.ID)
+
 	var response []ConversationSummaryResponse
 	for _, s := range summaries {
+		if s.State.Archived != archived {
+			continue
+		}
+
 		// For direct conversations, get the other participant's name and photo as title/photo
 		title := s.Title
 		photoURL := s.PhotoURL
@@ -529,7 +641,7 @@ func (rt *_router) getMyConversations(w http.ResponseWriter, r *http.Request, ps
 			for _, p := range participants {
 				if p.ID != user.ID {
 					title = p.Name
-					photoURL = p.PhotoURL
+					photoURL = visiblePhoto(blockers, p.ID, p.PhotoURL)
 					break
 				}
 			}
@@ -543,6 +655,10 @@ func (rt *_router) getMyConversations(w http.ResponseWriter, r *http.Request, ps
 			LastMessageAt:      s.LastMessageAt,
 			LastMessageSnippet: s.LastMessageSnippet,
 			LastMessageIsPhoto: s.LastMessageIsPhoto,
+			UnreadCount:        s.Unread.Messages,
+			UnreadMentionCount: s.Unread.Mentions,
+
+			ConversationStateResponse: newConversationStateResponse(s.State),
 		})
 	}
 
@@ -564,20 +680,14 @@ func (rt *_router) getConversation(w http.ResponseWriter, r *http.Request, ps ht
 
 	conversationID := ps.ByName("conversationId")
 
-	// Check if user is participant
-	isParticipant, err := rt.db.IsParticipant(conversationID, user.ID)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("database error")
-		sendInternalError(w, "Database error")
-		return
-	}
-	if !isParticipant {
-		sendNotFound(w, "Conversation not found or you are not a participant")
+	if _, err := rt.resolveConversation(user.ID, conversationID); err != nil {
+		sendResolveError(w, ctx.Logger, err)
 		return
 	}
 
 	// Mark messages from others as "read" (two checkmarks) since user is viewing the conversation
 	_ = rt.db.MarkMessagesAsRead(conversationID, user.ID)
+	rt.notifyUnreadChanged(ctx.Logger, conversationID, []string{user.ID})
 
 	// Notify message senders that their messages have been read
 	// For groups, only notify when ALL members have read the message
@@ -602,7 +712,7 @@ func (rt *_router) getConversation(w http.ResponseWriter, r *http.Request, ps ht
 					senderIDs = append(senderIDs, p.ID)
 				}
 			}
-			rt.wsHub.BroadcastToUsers(senderIDs, WebSocketMessage{
+			rt.wsHub.BroadcastToUsers(rt.withoutBlockersOf(ctx.Logger, user.ID, senderIDs), WebSocketMessage{
 				Type: "messages_read",
 				Payload: map[string]interface{}{
 					"conversationId":      conversationID,
@@ -627,13 +737,14 @@ func (rt *_router) getConversation(w http.ResponseWriter, r *http.Request, ps ht
 		return
 	}
 
+	blockers := rt.blockedBy(ctx.Logger, user.ID)
 	var participantResponses []UserResponse
 	for _, p := range participants {
 		participantResponses = append(participantResponses, UserResponse{
 			ID:          p.ID,
 			Name:        p.Name,
 			DisplayName: p.DisplayName,
-			PhotoURL:    p.PhotoURL,
+			PhotoURL:    visiblePhoto(blockers, p.ID, p.PhotoURL),
 		})
 	}
 
@@ -645,103 +756,20 @@ func (rt *_router) getConversation(w http.ResponseWriter, r *http.Request, ps ht
 		return
 	}
 
-	// Optimize: Collect all unique user IDs from messages
-	userIDSet := make(map[string]bool)
-	for _, p := range participants {
-		userIDSet[p.ID] = true
-	}
-	for _, m := range messages {
-		userIDSet[m.SenderID] = true
-	}
+	messageResponses := rt.buildMessageResponses(ctx.Logger, user.ID, conversationID, messages)
 
-	// Optimize: Fetch all reactions for this conversation at once
-	allReactions, err := rt.db.GetReactionsByConversation(conversationID)
+	var settingsResponse *ConversationSettingsResponse
+	settings, err := rt.db.GetConversationSettings(conversationID)
 	if err != nil {
-		ctx.Logger.WithError(err).Warn("error fetching reactions")
-		allReactions = []database.Reaction{}
-	}
-
-	// Group reactions by message ID
-	reactionsByMessage := make(map[string][]database.Reaction)
-	for _, r := range allReactions {
-		reactionsByMessage[r.MessageID] = append(reactionsByMessage[r.MessageID], r)
-		userIDSet[r.UserID] = true
+		ctx.Logger.WithError(err).Warn("error getting conversation settings")
+	} else if settings != nil {
+		sr := newConversationSettingsResponse(*settings)
+		settingsResponse = &sr
 	}
 
-	// Optimize: Fetch all users at once
-	var userIDs []string
-	for id := range userIDSet {
-		userIDs = append(userIDs, id)
-	}
-	users, err := rt.db.GetUsersByIDs(userIDs)
+	pinnedMessages, err := rt.pinnedMessageResponses(conversationID)
 	if err != nil {
-		ctx.Logger.WithError(err).Warn("error fetching users in batch")
-		users = []database.User{}
-	}
-
-	// Create user map for O(1) lookups
-	userMap := make(map[string]database.User)
-	for _, u := range users {
-		userMap[u.ID] = u
-	}
-
-	var messageResponses []MessageResponse
-	for _, m := range messages {
-		// Get sender from map
-		sender := userMap[m.SenderID]
-		senderResponse := UserResponse{
-			ID:          sender.ID,
-			Name:        sender.Name,
-			DisplayName: sender.DisplayName,
-			PhotoURL:    sender.PhotoURL,
-		}
-
-		// Get reactions from map
-		reactions := reactionsByMessage[m.ID]
-		var reactionResponses []ReactionResponse
-		for _, reaction := range reactions {
-			reactUser := userMap[reaction.UserID]
-			reactUserResponse := UserResponse{
-				ID:          reactUser.ID,
-				Name:        reactUser.Name,
-				DisplayName: reactUser.DisplayName,
-				PhotoURL:    reactUser.PhotoURL,
-			}
-			reactionResponses = append(reactionResponses, ReactionResponse{
-				ID:        reaction.ID,
-				Emoji:     reaction.Emoji,
-				User:      reactUserResponse,
-				CreatedAt: reaction.CreatedAt,
-			})
-		}
-		if reactionResponses == nil {
-			reactionResponses = []ReactionResponse{}
-		}
-
-		// Calculate dynamic status based on read receipts
-		messageStatus, err := rt.db.GetMessageStatus(m.ID)
-		if err != nil {
-			ctx.Logger.WithError(err).Warn("error calculating message status, using stored status")
-			messageStatus = m.Status
-		}
-
-		messageResponses = append(messageResponses, MessageResponse{
-			ID:                 m.ID,
-			ConversationID:     m.ConversationID,
-			Sender:             senderResponse,
-			CreatedAt:          m.CreatedAt,
-			ContentType:        m.ContentType,
-			Text:               m.Text,
-			PhotoURL:           m.PhotoURL,
-			RepliedToMessageID: m.RepliedToMessageID,
-			Status:             messageStatus,
-			Reactions:          reactionResponses,
-			IsForwarded:        m.IsForwarded,
-		})
-	}
-
-	if messageResponses == nil {
-		messageResponses = []MessageResponse{}
+		ctx.Logger.WithError(err).Warn("error getting pinned messages")
 	}
 
 	// Determine title and photoURL for direct conversations
@@ -751,23 +779,26 @@ func (rt *_router) getConversation(w http.ResponseWriter, r *http.Request, ps ht
 		for _, p := range participants {
 			if p.ID != user.ID {
 				title = p.Name
-				photoURL = p.PhotoURL
+				photoURL = visiblePhoto(blockers, p.ID, p.PhotoURL)
 				break
 			}
 		}
 	}
 
 	sendJSON(w, http.StatusOK, ConversationResponse{
-		ID:           conv.ID,
-		Type:         conv.Type,
-		Title:        title,
-		PhotoURL:     photoURL,
-		Participants: participantResponses,
-		Messages:     messageResponses,
+		ID:             conv.ID,
+		Type:           conv.Type,
+		Title:          title,
+		PhotoURL:       photoURL,
+		Participants:   participantResponses,
+		Messages:       messageResponses,
+		Settings:       settingsResponse,
+		PinnedMessages: pinnedMessages,
 	})
 }
 
 // sendMessage handles POST /conversations/{conversationId}/messages - send a message
+// Text starting with "/" is dispatched to the matching slash command, if any
 func (rt *_router) sendMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	user := GetUserFromContext(r.Context())
 	if user == nil {
@@ -777,140 +808,29 @@ func (rt *_router) sendMessage(w http.ResponseWriter, r *http.Request, ps httpro
 
 	conversationID := ps.ByName("conversationId")
 
-	// Check if user is participant
-	isParticipant, err := rt.db.IsParticipant(conversationID, user.ID)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("database error")
-		sendInternalError(w, "Database error")
-		return
-	}
-	if !isParticipant {
-		sendNotFound(w, "Conversation not found or you are not a participant")
-		return
-	}
-
 	var req SendMessageRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendBadRequest(w, "Invalid JSON")
+		sendInvalidJSON(w)
 		return
 	}
 
-	// Validate content type
-	validTypes := map[string]bool{"text": true, contentTypePhoto: true}
-	if !validTypes[req.ContentType] {
-		sendBadRequest(w, "contentType must be 'text' or 'photo'")
+	submission, err := rt.submitMessage(ctx.Logger, user, conversationID, req)
+	if reqErr, ok := asRequestError(err); ok {
+		sendRequestError(w, reqErr)
 		return
-	}
-
-	// Validate content - text and photo can co-exist
-	if req.ContentType == "text" && (req.Text == nil || *req.Text == "") && (req.PhotoURL == nil || *req.PhotoURL == "") {
-		sendBadRequest(w, "text or photoUrl is required for text messages")
-		return
-	}
-	if req.ContentType == contentTypePhoto && (req.PhotoURL == nil || *req.PhotoURL == "") {
-		sendBadRequest(w, "photoUrl is required for photo messages")
-		return
-	}
-
-	// Generate message ID and timestamp
-	msgID, _ := uuid.NewV4()
-	createdAt := globaltime.Now().UTC().Format("2006-01-02T15:04:05Z")
-
-	msg := database.Message{
-		ID:                 msgID.String(),
-		ConversationID:     conversationID,
-		SenderID:           user.ID,
-		CreatedAt:          createdAt,
-		ContentType:        req.ContentType,
-		Text:               req.Text,
-		PhotoURL:           req.PhotoURL,
-		RepliedToMessageID: req.ReplyToMessageID,
-		Status:             database.StatusSent,
-		IsForwarded:        false,
-	}
-
-	if err := rt.db.CreateMessage(msg); err != nil {
-		ctx.Logger.WithError(err).Error("error creating message")
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("error sending message")
 		sendInternalError(w, "Error creating message")
 		return
 	}
 
-	// Sending a message implies the sender has read all previous messages in this conversation
-	_ = rt.db.MarkMessagesAsRead(conversationID, user.ID)
-
-	messageResponse := MessageResponse{
-		ID:             msg.ID,
-		ConversationID: msg.ConversationID,
-		Sender: UserResponse{
-			ID:          user.ID,
-			Name:        user.Name,
-			DisplayName: user.DisplayName,
-			PhotoURL:    user.PhotoURL,
-		},
-		CreatedAt:          msg.CreatedAt,
-		ContentType:        msg.ContentType,
-		Text:               msg.Text,
-		PhotoURL:           msg.PhotoURL,
-		RepliedToMessageID: msg.RepliedToMessageID,
-		Status:             msg.Status,
-		Reactions:          []ReactionResponse{},
-		IsForwarded:        msg.IsForwarded,
-	}
-
-	// Broadcast new message to all conversation participants via WebSocket
-	participants, err := rt.db.GetParticipants(conversationID)
-	if err == nil && len(participants) > 0 {
-		var participantIDs []string
-		for _, p := range participants {
-			participantIDs = append(participantIDs, p.ID)
-		}
-		// Broadcast new message for ChatView
-		rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
-			Type:    "new_message",
-			Payload: messageResponse,
-		})
-		// Broadcast conversation update for ConversationsView (so list updates with new snippet)
-		rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
-			Type: "conversation_updated",
-			Payload: map[string]interface{}{
-				"conversationId":     conversationID,
-				"lastMessageSnippet": msg.Text,
-				"lastMessageIsPhoto": msg.ContentType == contentTypePhoto,
-				"lastMessageAt":      msg.CreatedAt,
-			},
-		})
-
-		// Notify other participants that the sender has read their messages
-		// (sending a reply means they've read everything)
-		messages, readErr := rt.db.GetMessagesByConversation(conversationID)
-		if readErr == nil {
-			var fullyReadMessageIDs []string
-			for _, m := range messages {
-				status, sErr := rt.db.GetMessageStatus(m.ID)
-				if sErr == nil && status == database.StatusRead {
-					fullyReadMessageIDs = append(fullyReadMessageIDs, m.ID)
-				}
-			}
-			if len(fullyReadMessageIDs) > 0 {
-				var otherIDs []string
-				for _, p := range participants {
-					if p.ID != user.ID {
-						otherIDs = append(otherIDs, p.ID)
-					}
-				}
-				rt.wsHub.BroadcastToUsers(otherIDs, WebSocketMessage{
-					Type: "messages_read",
-					Payload: map[string]interface{}{
-						"conversationId":      conversationID,
-						"readByUserId":        user.ID,
-						"fullyReadMessageIds": fullyReadMessageIDs,
-					},
-				})
-			}
-		}
+	if submission.Command != nil {
+		// The command was handled without posting a public message
+		sendJSON(w, http.StatusAccepted, submission.Command)
+		return
 	}
 
-	sendJSON(w, http.StatusCreated, messageResponse)
+	sendJSON(w, http.StatusCreated, submission.Message)
 }
 
 // ============================================================================
@@ -928,14 +848,9 @@ func (rt *_router) deleteMessage(w http.ResponseWriter, r *http.Request, ps http
 	messageID := ps.ByName("messageId")
 
 	// Get the message
-	msg, err := rt.db.GetMessageByID(messageID)
+	_, msg, err := rt.resolveMessage(user.ID, ps.ByName("conversationId"), messageID)
 	if err != nil {
-		ctx.Logger.WithError(err).Error("database error")
-		sendInternalError(w, "Database error")
-		return
-	}
-	if msg == nil {
-		sendNotFound(w, "Message not found")
+		sendResolveError(w, ctx.Logger, err)
 		return
 	}
 
@@ -950,6 +865,7 @@ func (rt *_router) deleteMessage(w http.ResponseWriter, r *http.Request, ps http
 		sendInternalError(w, "Error deleting message")
 		return
 	}
+	rt.broadcastMessageDeleted(ctx.Logger, msg.ConversationID, messageID, "deleted")
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -966,26 +882,33 @@ func (rt *_router) forwardMessage(w http.ResponseWriter, r *http.Request, ps htt
 
 	var req ForwardMessageRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendBadRequest(w, "Invalid JSON")
+		sendInvalidJSON(w)
 		return
 	}
 
-	// Get original message
-	origMsg, err := rt.db.GetMessageByID(messageID)
-	if err != nil || origMsg == nil {
-		sendNotFound(w, "Original message not found")
+	// Get original message, which must be readable by the user
+	_, origMsg, err := rt.resolveMessage(user.ID, ps.ByName("conversationId"), messageID)
+	if err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+	if origMsg.ContentType == contentTypeSystem {
+		sendBadRequest(w, "System messages can't be forwarded")
 		return
 	}
 
 	// Check if user is participant of target conversation
-	isParticipant, err := rt.db.IsParticipant(req.TargetConversationID, user.ID)
+	targetConv, err := rt.resolveConversation(user.ID, req.TargetConversationID)
 	if err != nil {
-		ctx.Logger.WithError(err).Error("database error")
-		sendInternalError(w, "Database error")
+		if _, ok := asRequestError(err); ok {
+			sendNotFound(w, "Target conversation not found or you are not a participant")
+			return
+		}
+		sendResolveError(w, ctx.Logger, err)
 		return
 	}
-	if !isParticipant {
-		sendNotFound(w, "Target conversation not found or you are not a participant")
+	if err := rt.checkDirectMessage(user.ID, targetConv); err != nil {
+		sendResolveError(w, ctx.Logger, err)
 		return
 	}
 
@@ -1005,52 +928,32 @@ func (rt *_router) forwardMessage(w http.ResponseWriter, r *http.Request, ps htt
 		IsForwarded:    true,
 	}
 
-	if err := rt.db.CreateMessage(newMsg); err != nil {
-		ctx.Logger.WithError(err).Error("error creating forwarded message")
-		sendInternalError(w, "Error forwarding message")
-		return
+	// Forwarded polls start over with the same question and options and no votes
+	var poll *database.Poll
+	if origMsg.ContentType == contentTypePoll {
+		poll, err = rt.db.GetPoll(origMsg.ID)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("database error getting poll")
+			sendInternalError(w, "Database error")
+			return
+		}
 	}
-
-	messageResponse := MessageResponse{
-		ID:             newMsg.ID,
-		ConversationID: newMsg.ConversationID,
-		Sender: UserResponse{
-			ID:          user.ID,
-			Name:        user.Name,
-			DisplayName: user.DisplayName,
-			PhotoURL:    user.PhotoURL,
-		},
-		CreatedAt:   newMsg.CreatedAt,
-		ContentType: newMsg.ContentType,
-		Text:        newMsg.Text,
-		PhotoURL:    newMsg.PhotoURL,
-		Status:      newMsg.Status,
-		Reactions:   []ReactionResponse{},
-		IsForwarded: newMsg.IsForwarded,
-	}
-
-	// Broadcast forwarded message to all participants in target conversation via WebSocket
-	participants, err := rt.db.GetParticipants(req.TargetConversationID)
-	if err == nil && len(participants) > 0 {
-		var participantIDs []string
-		for _, p := range participants {
-			participantIDs = append(participantIDs, p.ID)
+	if poll != nil {
+		for i := range poll.Options {
+			optionID, _ := uuid.NewV4()
+			poll.Options[i].ID = optionID.String()
 		}
-		// Broadcast new message for ChatView
-		rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
-			Type:    "new_message",
-			Payload: messageResponse,
-		})
-		// Broadcast conversation update for ConversationsView
-		rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
-			Type: "conversation_updated",
-			Payload: map[string]interface{}{
-				"conversationId":     req.TargetConversationID,
-				"lastMessageSnippet": newMsg.Text,
-				"lastMessageIsPhoto": newMsg.ContentType == contentTypePhoto,
-				"lastMessageAt":      newMsg.CreatedAt,
-			},
-		})
+	}
+
+	// The forward is delivered like any new message: mentions, link previews, unarchiving, unread counts and pushes
+	messageResponse, err := rt.deliverMessage(ctx.Logger, user, newMsg, poll)
+	if reqErr, ok := asRequestError(err); ok {
+		sendRequestError(w, reqErr)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("error forwarding message")
+		sendInternalError(w, "Error forwarding message")
+		return
 	}
 
 	sendJSON(w, http.StatusCreated, messageResponse)
@@ -1066,21 +969,29 @@ func (rt *_router) commentMessage(w http.ResponseWriter, r *http.Request, ps htt
 
 	messageID := ps.ByName("messageId")
 
-	// Check message exists
-	msg, err := rt.db.GetMessageByID(messageID)
-	if err != nil || msg == nil {
-		sendNotFound(w, "Message not found")
+	// Check message exists in a conversation of the user
+	_, msg, err := rt.resolveMessage(user.ID, ps.ByName("conversationId"), messageID)
+	if err != nil {
+		sendResolveError(w, ctx.Logger, err)
 		return
 	}
 
 	var req CommentMessageRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendBadRequest(w, "Invalid JSON")
+		sendInvalidJSON(w)
+		return
+	}
+
+	req.Emoji, err = validation.Grapheme("emoji", req.Emoji)
+	if err != nil {
+		sendResolveError(w, ctx.Logger, newFieldError(err))
 		return
 	}
 
-	if req.Emoji == "" {
-		sendBadRequest(w, "emoji is required")
+	settings, err := rt.db.GetConversationSettings(msg.ConversationID)
+	if err != nil || settings == nil {
+		ctx.Logger.WithError(err).Error("error getting conversation settings")
+		sendInternalError(w, "Database error")
 		return
 	}
 
@@ -1095,7 +1006,10 @@ func (rt *_router) commentMessage(w http.ResponseWriter, r *http.Request, ps htt
 		CreatedAt: createdAt,
 	}
 
-	if err := rt.db.CreateReaction(reaction); err != nil {
+	// Reacting again with the same emoji returns the existing reaction; in single-reaction conversations the
+	// user's other reactions are replaced
+	reaction, created, replaced, err := rt.db.CreateReaction(reaction, settings.SingleReaction)
+	if err != nil {
 		ctx.Logger.WithError(err).Error("error creating reaction")
 		sendInternalError(w, "Error creating reaction")
 		return
@@ -1113,24 +1027,48 @@ func (rt *_router) commentMessage(w http.ResponseWriter, r *http.Request, ps htt
 		CreatedAt: reaction.CreatedAt,
 	}
 
+	// The reaction was already stored, by an earlier or a concurrent request, and announced
+	if !created && len(replaced) == 0 {
+		sendJSON(w, http.StatusOK, reactionResponse)
+		return
+	}
+
 	// Broadcast reaction to all conversation participants via WebSocket
-	conversationID := ps.ByName("conversationId")
+	conversationID := msg.ConversationID
 	participants, err := rt.db.GetParticipants(conversationID)
 	if err == nil {
 		var participantIDs []string
 		for _, p := range participants {
 			participantIDs = append(participantIDs, p.ID)
 		}
-		rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
-			Type: "reaction_added",
-			Payload: map[string]interface{}{
-				"conversationId": conversationID,
-				"messageId":      messageID,
-				"reaction":       reactionResponse,
-			},
-		})
+		participantIDs = rt.withoutBlockersOf(ctx.Logger, user.ID, participantIDs)
+		for _, e := range replaced {
+			rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
+				Type: "reaction_removed",
+				Payload: map[string]interface{}{
+					"conversationId": conversationID,
+					"messageId":      messageID,
+					"reactionId":     e.ID,
+					"userId":         user.ID,
+				},
+			})
+		}
+		if created {
+			rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
+				Type: "reaction_added",
+				Payload: map[string]interface{}{
+					"conversationId": conversationID,
+					"messageId":      messageID,
+					"reaction":       reactionResponse,
+				},
+			})
+		}
 	}
 
+	if !created {
+		sendJSON(w, http.StatusOK, reactionResponse)
+		return
+	}
 	sendJSON(w, http.StatusCreated, reactionResponse)
 }
 
@@ -1144,14 +1082,20 @@ func (rt *_router) uncommentMessage(w http.ResponseWriter, r *http.Request, ps h
 
 	commentID := ps.ByName("commentId")
 
-	// Get the reaction
+	_, msg, err := rt.resolveMessage(user.ID, ps.ByName("conversationId"), ps.ByName("messageId"))
+	if err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	// Get the reaction, which must be attached to the message in the URL
 	reaction, err := rt.db.GetReactionByID(commentID)
 	if err != nil {
 		ctx.Logger.WithError(err).Error("database error")
 		sendInternalError(w, "Database error")
 		return
 	}
-	if reaction == nil {
+	if reaction == nil || reaction.MessageID != msg.ID {
 		sendNotFound(w, "Reaction not found")
 		return
 	}
@@ -1169,14 +1113,14 @@ func (rt *_router) uncommentMessage(w http.ResponseWriter, r *http.Request, ps h
 	}
 
 	// Broadcast reaction removal to all conversation participants via WebSocket
-	conversationID := ps.ByName("conversationId")
+	conversationID := msg.ConversationID
 	participants, err := rt.db.GetParticipants(conversationID)
 	if err == nil {
 		var participantIDs []string
 		for _, p := range participants {
 			participantIDs = append(participantIDs, p.ID)
 		}
-		rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
+		rt.wsHub.BroadcastToUsers(rt.withoutBlockersOf(ctx.Logger, user.ID, participantIDs), WebSocketMessage{
 			Type: "reaction_removed",
 			Payload: map[string]interface{}{
 				"conversationId": conversationID,
@@ -1204,14 +1148,24 @@ func (rt *_router) createGroup(w http.ResponseWriter, r *http.Request, ps httpro
 
 	var req CreateGroupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendBadRequest(w, "Invalid JSON")
+		sendInvalidJSON(w)
 		return
 	}
 
-	if req.Name == "" {
-		sendBadRequest(w, "name is required")
+	name, err := validation.Line("name", req.Name, rt.textLimits.GroupName)
+	if err != nil {
+		sendResolveError(w, ctx.Logger, newFieldError(err))
 		return
 	}
+	req.Name = name
+
+	// Users who blocked the creator can't be added
+	for _, memberID := range req.MemberIDs {
+		if err := rt.checkCanAdd(user.ID, memberID); err != nil {
+			sendResolveError(w, ctx.Logger, err)
+			return
+		}
+	}
 
 	groupID, _ := uuid.NewV4()
 
@@ -1301,13 +1255,14 @@ func (rt *_router) getGroup(w http.ResponseWriter, r *http.Request, ps httproute
 	}
 
 	members, _ := rt.db.GetParticipants(groupID)
+	blockers := rt.blockedBy(ctx.Logger, user.ID)
 	var memberResponses []UserResponse
 	for _, m := range members {
 		memberResponses = append(memberResponses, UserResponse{
 			ID:          m.ID,
 			Name:        m.Name,
 			DisplayName: m.DisplayName,
-			PhotoURL:    m.PhotoURL,
+			PhotoURL:    visiblePhoto(blockers, m.ID, m.PhotoURL),
 		})
 	}
 
@@ -1350,7 +1305,7 @@ func (rt *_router) addToGroup(w http.ResponseWriter, r *http.Request, ps httprou
 
 	var req AddToGroupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendBadRequest(w, "Invalid JSON")
+		sendInvalidJSON(w)
 		return
 	}
 
@@ -1360,6 +1315,10 @@ func (rt *_router) addToGroup(w http.ResponseWriter, r *http.Request, ps httprou
 		sendNotFound(w, "User to add not found")
 		return
 	}
+	if err := rt.checkCanAdd(user.ID, userToAdd.ID); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
 
 	if err := rt.db.AddParticipant(groupID, req.UserID); err != nil {
 		ctx.Logger.WithError(err).Error("error adding user to group")
@@ -1413,6 +1372,7 @@ func (rt *_router) addToGroup(w http.ResponseWriter, r *http.Request, ps httprou
 			Messages:     []MessageResponse{},
 		},
 	})
+	rt.notifyUnreadChanged(ctx.Logger, groupID, []string{req.UserID})
 
 	sendJSON(w, http.StatusOK, GroupResponse{
 		ID:        conv.ID,
@@ -1450,6 +1410,7 @@ func (rt *_router) leaveGroup(w http.ResponseWriter, r *http.Request, ps httprou
 		sendInternalError(w, "Error leaving group")
 		return
 	}
+	rt.notifyUnreadChanged(ctx.Logger, groupID, []string{user.ID})
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -1478,7 +1439,12 @@ func (rt *_router) setGroupName(w http.ResponseWriter, r *http.Request, ps httpr
 
 	var req SetGroupNameRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendBadRequest(w, "Invalid JSON")
+		sendInvalidJSON(w)
+		return
+	}
+	req.Name, err = validation.Line("name", req.Name, rt.textLimits.GroupName)
+	if err != nil {
+		sendResolveError(w, ctx.Logger, newFieldError(err))
 		return
 	}
 
@@ -1543,15 +1509,8 @@ func (rt *_router) uploadMessagePhoto(w http.ResponseWriter, r *http.Request, ps
 
 	conversationID := ps.ByName("conversationId")
 
-	// Check if user is participant
-	isParticipant, err := rt.db.IsParticipant(conversationID, user.ID)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("database error")
-		sendInternalError(w, "Database error")
-		return
-	}
-	if !isParticipant {
-		sendNotFound(w, "Conversation not found or you are not a participant")
+	if _, err := rt.resolveConversation(user.ID, conversationID); err != nil {
+		sendResolveError(w, ctx.Logger, err)
 		return
 	}
 
@@ -1563,7 +1522,7 @@ func (rt *_router) uploadMessagePhoto(w http.ResponseWriter, r *http.Request, ps
 
 	file, header, err := r.FormFile("photo")
 	if err != nil {
-		sendBadRequest(w, "photo file is required")
+		sendFieldError(w, "photo", validation.CodeRequired, "photo file is required")
 		return
 	}
 	defer file.Close()
@@ -1618,7 +1577,7 @@ func (rt *_router) setMyPhoto(w http.ResponseWriter, r *http.Request, ps httprou
 
 	file, header, err := r.FormFile("photo")
 	if err != nil {
-		sendBadRequest(w, "photo file is required")
+		sendFieldError(w, "photo", validation.CodeRequired, "photo file is required")
 		return
 	}
 	defer file.Close()
@@ -1720,7 +1679,7 @@ func (rt *_router) setGroupPhoto(w http.ResponseWriter, r *http.Request, ps http
 
 	file, header, err := r.FormFile("photo")
 	if err != nil {
-		sendBadRequest(w, "photo file is required")
+		sendFieldError(w, "photo", validation.CodeRequired, "photo file is required")
 		return
 	}
 	defer file.Close()
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/chatimport"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+)
+
+// maxImportSize is the largest document accepted by the import endpoint
+const maxImportSize = 32 << 20
+
+// ImportedSenderResponse matches the ImportedSender schema: the user the messages of an exported sender were attributed
+// to
+type ImportedSenderResponse struct {
+	Name        string       `json:"name"`
+	User        UserResponse `json:"user"`
+	Placeholder bool         `json:"placeholder"`
+}
+
+// ImportResultResponse matches the ImportResult schema, summarizing an import
+type ImportResultResponse struct {
+	Format   string                   `json:"format"`
+	Imported int                      `json:"imported"`
+	Skipped  int                      `json:"skipped"`
+	Senders  []ImportedSenderResponse `json:"senders"`
+}
+
+// importConversation handles POST /conversations/{conversationId}/import
+// The multipart form carries the exported document in "file" and the options "format" (whatsapp or json, guessed from
+// the file name if missing), "dateOrder" (dmy or mdy, for WhatsApp), "timezone" (IANA name of the time zone of
+// WhatsApp timestamps) and "senders" (a JSON object mapping exported names to usernames of participants).
+func (rt *_router) importConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+
+	if _, err := rt.resolveConversation(user.ID, conversationID); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize+1<<20)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		sendBadRequest(w, "Invalid multipart form or file too large")
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		sendFieldError(w, "file", validation.CodeRequired, "file is required")
+		return
+	}
+	defer file.Close()
+
+	req, reqErr := newImportRequest(conversationID, r, header.Filename)
+	if reqErr != nil {
+		sendRequestError(w, reqErr)
+		return
+	}
+
+	result, err := chatimport.Import(rt.db, file, req)
+	var inputErr *chatimport.InputError
+	if errors.As(err, &inputErr) {
+		sendBadRequest(w, inputErr.Error())
+		return
+	}
+	if err != nil {
+		ctx.Logger.WithError(err).Error("error importing conversation")
+		sendInternalError(w, "Error importing conversation")
+		return
+	}
+
+	response, err := rt.newImportResultResponse(req.Options.Format, result)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting imported senders")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	if result.Imported > 0 {
+		participants, err := rt.db.GetParticipants(conversationID)
+		if err == nil {
+			var participantIDs []string
+			for _, p := range participants {
+				participantIDs = append(participantIDs, p.ID)
+			}
+			rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
+				Type: "messages_imported",
+				Payload: map[string]interface{}{
+					"conversationId": conversationID,
+					"imported":       result.Imported,
+					"importedBy":     user.ID,
+				},
+			})
+		}
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// newImportRequest reads the import options from a parsed multipart form
+func newImportRequest(conversationID string, r *http.Request, fileName string) (chatimport.Request, *requestError) {
+	req := chatimport.Request{
+		ConversationID: conversationID,
+		KeepPhoto:      chatimport.LocalPhotos(conversationID, "./uploads"),
+	}
+
+	formatName := r.FormValue("format")
+	if formatName == "" {
+		formatName = string(chatimport.FormatWhatsApp)
+		if strings.EqualFold(path.Ext(fileName), ".json") {
+			formatName = string(chatimport.FormatJSON)
+		}
+	}
+	format, err := chatimport.ParseFormat(formatName)
+	if err != nil {
+		return req, newInvalidFieldError("format", validation.CodeInvalidValue, "format must be 'whatsapp' or 'json'")
+	}
+	req.Options.Format = format
+
+	order, err := chatimport.ParseDateOrder(r.FormValue("dateOrder"))
+	if err != nil {
+		return req, newInvalidFieldError("dateOrder", validation.CodeInvalidValue, "dateOrder must be 'dmy' or 'mdy'")
+	}
+	req.Options.DateOrder = order
+
+	if tz := r.FormValue("timezone"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return req, newInvalidFieldError("timezone", validation.CodeInvalidValue, "Unknown timezone")
+		}
+		req.Options.Location = loc
+	}
+
+	if senders := r.FormValue("senders"); senders != "" {
+		if err := json.Unmarshal([]byte(senders), &req.Senders); err != nil {
+			return req, newInvalidFieldError("senders", validation.CodeInvalidFormat, "senders must be a JSON object mapping names to usernames")
+		}
+	}
+
+	return req, nil
+}
+
+func (rt *_router) newImportResultResponse(format chatimport.Format, result *chatimport.Result) (ImportResultResponse, error) {
+	response := ImportResultResponse{
+		Format:   string(format),
+		Imported: result.Imported,
+		Skipped:  result.Skipped,
+		Senders:  []ImportedSenderResponse{},
+	}
+
+	ids := make([]string, 0, len(result.Senders))
+	for _, s := range result.Senders {
+		ids = append(ids, s.UserID)
+	}
+	users, err := rt.db.GetUsersByIDs(ids)
+	if err != nil {
+		return response, err
+	}
+	userMap := make(map[string]database.User)
+	for _, u := range users {
+		userMap[u.ID] = u
+	}
+
+	for _, s := range result.Senders {
+		u := userMap[s.UserID]
+		response.Senders = append(response.Senders, ImportedSenderResponse{
+			Name: s.Name,
+			User: UserResponse{
+				ID:          u.ID,
+				Name:        u.Name,
+				DisplayName: u.DisplayName,
+				PhotoURL:    u.PhotoURL,
+			},
+			Placeholder: s.Placeholder,
+		})
+	}
+	return response, nil
+}
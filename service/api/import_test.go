@@ -0,0 +1,131 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+)
+
+// whatsAppChat is a chat exported by WhatsApp on iOS
+const whatsAppChat = `[31/12/2023, 23:59:59] Alice: Happy new year
+[01/01/2024, 00:00:05] Bobby: You too
+with a second line
+[01/01/2024, 00:01:00] Mallory: Hi all
+`
+
+// TestImportWhatsApp checks that a WhatsApp chat is imported with its timestamps and senders, and that importing it
+// again adds nothing
+func TestImportWhatsApp(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	c := "/conversations/" + conv
+	bobEvents := bob.Connect()
+
+	options := map[string]string{"timezone": "Europe/Rome", "senders": `{"Bobby": "bob"}`}
+	var result api.ImportResultResponse
+	alice.Upload(http.MethodPost, c+"/import", "file", "chat.txt", []byte(whatsAppChat), options, &result,
+		http.StatusOK)
+	if result.Format != "whatsapp" || result.Imported != 3 || result.Skipped != 0 {
+		t.Errorf("imported %d messages and skipped %d as %s, expected 3 WhatsApp messages", result.Imported,
+			result.Skipped, result.Format)
+	}
+	senders := map[string]api.ImportedSenderResponse{}
+	for _, sender := range result.Senders {
+		senders[sender.Name] = sender
+	}
+	if senders["Alice"].User.ID != alice.ID || senders["Bobby"].User.ID != bob.ID || senders["Alice"].Placeholder {
+		t.Errorf("the senders were attributed as %+v, expected Alice to alice and Bobby to bob", result.Senders)
+	}
+	if mallory := senders["Mallory"]; !mallory.Placeholder || mallory.User.ID == "" {
+		t.Errorf("Mallory was attributed to %+v, expected a placeholder", mallory)
+	}
+	var imported struct {
+		Imported   int    `json:"imported"`
+		ImportedBy string `json:"importedBy"`
+	}
+	bobEvents.WaitWith("messages_imported", "conversationId", conv).Decode(&imported)
+	if imported.Imported != 3 || imported.ImportedBy != alice.ID {
+		t.Errorf("messages_imported announced %d messages by %s, expected 3 by alice", imported.Imported,
+			imported.ImportedBy)
+	}
+
+	var history api.ConversationResponse
+	bob.Call(http.MethodGet, c, nil, &history, http.StatusOK)
+	if len(history.Messages) != 3 {
+		t.Fatalf("the conversation has %d messages, expected the 3 imported", len(history.Messages))
+	}
+	first, second := history.Messages[0], history.Messages[1]
+	if first.Sender.ID != alice.ID || first.CreatedAt != "2023-12-31T22:59:59Z" {
+		t.Errorf("the first message is from %s at %s, expected alice at 22:59:59 UTC", first.Sender.Name,
+			first.CreatedAt)
+	}
+	if second.Sender.ID != bob.ID || text(second) != "You too\nwith a second line" {
+		t.Errorf("the second message is %q from %s, expected both lines from bob", text(second), second.Sender.Name)
+	}
+
+	// Importing the same chat again is harmless
+	alice.Upload(http.MethodPost, c+"/import", "file", "chat.txt", []byte(whatsAppChat), options, &result,
+		http.StatusOK)
+	if result.Imported != 0 || result.Skipped != 3 {
+		t.Errorf("importing again added %d messages and skipped %d, expected all skipped", result.Imported,
+			result.Skipped)
+	}
+	bobEvents.ExpectNone("messages_imported", quietPeriod)
+	bob.Call(http.MethodGet, c, nil, &history, http.StatusOK)
+	if len(history.Messages) != 3 {
+		t.Errorf("the conversation has %d messages after importing again, expected 3", len(history.Messages))
+	}
+}
+
+// TestImportExport checks that a conversation exported as JSON can be imported into another one, guessing the format
+// from the file name
+func TestImportExport(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	alice.Call(http.MethodPost, "/conversations/"+conv+"/messages", textMessage("Hello"), nil, http.StatusCreated)
+	bob.Call(http.MethodPost, "/conversations/"+conv+"/messages", textMessage("Hi"), nil, http.StatusCreated)
+	export := alice.Do(http.MethodGet, "/conversations/"+conv+"/export", nil)
+	if export.Status != http.StatusOK {
+		t.Fatalf("exporting: status %d", export.Status)
+	}
+
+	var group api.GroupResponse
+	create := map[string]interface{}{"name": "Archive", "memberIds": []string{bob.ID}}
+	alice.Call(http.MethodPost, "/groups", create, &group, http.StatusCreated)
+	var result api.ImportResultResponse
+	alice.Upload(http.MethodPost, "/conversations/"+group.ID+"/import", "file", "conversation.json", export.Body, nil,
+		&result, http.StatusOK)
+	if result.Format != "json" || result.Imported != 2 {
+		t.Errorf("imported %d messages as %s, expected the 2 of the JSON export", result.Imported, result.Format)
+	}
+	for _, sender := range result.Senders {
+		if sender.Placeholder {
+			t.Errorf("%s was attributed to a placeholder, expected the participant", sender.Name)
+		}
+	}
+}
+
+// TestImportErrors checks that imports with a missing file, invalid options or into someone else's conversation are
+// rejected
+func TestImportErrors(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob, carol := s.Login("alice"), s.Login("bob"), s.Login("carol")
+	c := "/conversations/" + startConversation(alice, bob) + "/import"
+	chat := []byte(whatsAppChat)
+
+	alice.DoUpload(http.MethodPost, c, "document", "chat.txt", chat, nil).
+		ExpectError(http.StatusBadRequest, "validation-failed", "file:required")
+	alice.DoUpload(http.MethodPost, c, "file", "chat.txt", chat, map[string]string{"format": "telegram"}).
+		ExpectError(http.StatusBadRequest, "validation-failed", "format:invalid-value")
+	alice.DoUpload(http.MethodPost, c, "file", "chat.txt", chat, map[string]string{"timezone": "Mars/Olympus"}).
+		ExpectError(http.StatusBadRequest, "validation-failed", "timezone:invalid-value")
+	alice.DoUpload(http.MethodPost, c, "file", "chat.txt", chat, map[string]string{"senders": `{"Bobby": "carol"}`}).
+		ExpectError(http.StatusBadRequest, "bad-request")
+	alice.DoUpload(http.MethodPost, c, "file", "chat.txt", []byte("not a chat"), nil).
+		ExpectError(http.StatusBadRequest, "bad-request")
+	carol.DoUpload(http.MethodPost, c, "file", "chat.txt", chat, nil).ExpectError(http.StatusNotFound, "not-found")
+}
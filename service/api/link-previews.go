@@ -0,0 +1,223 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// linkPreviewTTL is how long a preview stays in the cache before the page is fetched again
+	linkPreviewTTL = 7 * 24 * time.Hour
+	// failedLinkPreviewTTL is how long to wait before trying again a page that could not be previewed
+	failedLinkPreviewTTL = time.Hour
+
+	linkPreviewDir = "./uploads/previews"
+)
+
+// linkPattern matches the http and https URLs in the text of a message
+var linkPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// linkPreviewImageExtensions are the extensions of the preview images we keep, by content type
+var linkPreviewImageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// LinkPreviewResponse matches the LinkPreview schema
+type LinkPreviewResponse struct {
+	URL         string  `json:"url"`
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	SiteName    *string `json:"siteName,omitempty"`
+	ImageURL    *string `json:"imageUrl,omitempty"`
+}
+
+// pendingLinkPreview is a message waiting for the preview of its link
+type pendingLinkPreview struct {
+	messageID      string
+	conversationID string
+	senderID       string // participants who blocked the sender are not sent the preview
+}
+
+// firstLink returns the first URL in `text`, without the punctuation that usually follows a link in a sentence
+func firstLink(text string) string {
+	link := linkPattern.FindString(text)
+	return strings.TrimRight(link, ".,;:!?)]}'")
+}
+
+func newLinkPreviewResponse(p *database.LinkPreview) *LinkPreviewResponse {
+	if p == nil || p.Status != database.LinkPreviewOK {
+		return nil
+	}
+	url := p.URL
+	if p.PageURL != nil {
+		url = *p.PageURL
+	}
+	return &LinkPreviewResponse{
+		URL:         url,
+		Title:       p.Title,
+		Description: p.Description,
+		SiteName:    p.SiteName,
+		ImageURL:    p.ImageURL,
+	}
+}
+
+// isFresh tells whether a cached preview can be used instead of fetching the page again
+func isFresh(p database.LinkPreview, now time.Time) bool {
+	fetchedAt, err := time.Parse(time.RFC3339, p.FetchedAt)
+	if err != nil {
+		return false
+	}
+	ttl := linkPreviewTTL
+	if p.Status == database.LinkPreviewFailed {
+		ttl = failedLinkPreviewTTL
+	}
+	return now.Sub(fetchedAt) < ttl
+}
+
+// attachLinkPreview links a new text message to the preview of the first URL in its text. It returns the preview if
+// it is in the cache; otherwise the page is fetched in the background and the participants receive a
+// "message_updated" event when the preview is ready.
+func (rt *_router) attachLinkPreview(logger logrus.FieldLogger, msg database.Message) *LinkPreviewResponse {
+	if rt.linkPreviews == nil || msg.ContentType != "text" || msg.Text == nil {
+		return nil
+	}
+	link := firstLink(*msg.Text)
+	if link == "" {
+		return nil
+	}
+
+	if err := rt.db.SetMessageLinkPreview(msg.ID, msg.ConversationID, link); err != nil {
+		logger.WithError(err).Warn("error linking message to its preview")
+		return nil
+	}
+
+	cached, err := rt.db.GetLinkPreview(link)
+	if err != nil {
+		logger.WithError(err).Warn("error getting link preview")
+		return nil
+	}
+	if cached != nil && isFresh(*cached, globaltime.Now()) {
+		return newLinkPreviewResponse(cached)
+	}
+
+	// Messages sent while the page is being fetched wait for the same fetch
+	rt.linkPreviewMu.Lock()
+	defer rt.linkPreviewMu.Unlock()
+	pending, fetching := rt.linkPreviewPending[link]
+	rt.linkPreviewPending[link] = append(pending, pendingLinkPreview{messageID: msg.ID, conversationID: msg.ConversationID, senderID: msg.SenderID})
+	if !fetching && !rt.goBackground(func() { rt.resolveLinkPreview(link) }) {
+		// The server is shutting down: the preview will not be fetched
+		delete(rt.linkPreviewPending, link)
+	}
+	return nil
+}
+
+// resolveLinkPreview fetches the preview of `link`, saves it in the cache and sends it to the conversations of the
+// messages waiting for it
+func (rt *_router) resolveLinkPreview(link string) {
+	logger := rt.baseLogger.WithField("url", link)
+
+	ctx, cancel := rt.backgroundContext()
+	defer cancel()
+
+	p := database.LinkPreview{
+		URL:       link,
+		Status:    database.LinkPreviewFailed,
+		FetchedAt: globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	preview, err := rt.linkPreviews.Fetch(ctx, link)
+	if err != nil {
+		logger.WithError(err).Info("link preview failed")
+	} else if preview.Title != "" {
+		p.Status = database.LinkPreviewOK
+		p.PageURL = optionalString(preview.URL)
+		p.Title = optionalString(preview.Title)
+		p.Description = optionalString(preview.Description)
+		p.SiteName = optionalString(preview.SiteName)
+		if preview.ImageURL != "" {
+			p.ImageURL = rt.storeLinkPreviewImage(ctx, logger, preview.ImageURL)
+		}
+	}
+
+	if err := rt.db.SaveLinkPreview(p); err != nil {
+		logger.WithError(err).Error("error saving link preview")
+	}
+
+	rt.linkPreviewMu.Lock()
+	pending := rt.linkPreviewPending[link]
+	delete(rt.linkPreviewPending, link)
+	rt.linkPreviewMu.Unlock()
+
+	response := newLinkPreviewResponse(&p)
+	if response == nil {
+		return
+	}
+	for _, m := range pending {
+		participants, err := rt.db.GetParticipants(m.conversationID)
+		if err != nil {
+			logger.WithError(err).Warn("error getting participants for broadcast")
+			continue
+		}
+		var participantIDs []string
+		for _, u := range participants {
+			participantIDs = append(participantIDs, u.ID)
+		}
+		participantIDs = rt.withoutBlockersOf(logger, m.senderID, participantIDs)
+		rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
+			Type: "message_updated",
+			Payload: map[string]interface{}{
+				"conversationId": m.conversationID,
+				"messageId":      m.messageID,
+				"linkPreview":    response,
+			},
+		})
+	}
+}
+
+// storeLinkPreviewImage downloads a preview image and keeps a copy in the uploads, so that clients don't load it
+// from the linked site. The copy is named after the image URL, so that pages sharing an image share the copy.
+func (rt *_router) storeLinkPreviewImage(ctx context.Context, logger logrus.FieldLogger, imageURL string) *string {
+	image, err := rt.linkPreviews.FetchImage(ctx, imageURL)
+	if err != nil {
+		logger.WithError(err).Info("link preview image not downloaded")
+		return nil
+	}
+	ext, ok := linkPreviewImageExtensions[image.ContentType]
+	if !ok {
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(imageURL))
+	fileName := hex.EncodeToString(sum[:16]) + ext
+	if err := os.MkdirAll(linkPreviewDir, 0755); err != nil {
+		logger.WithError(err).Error("error creating link preview directory")
+		return nil
+	}
+	if err := os.WriteFile(filepath.Join(linkPreviewDir, fileName), image.Data, 0644); err != nil {
+		logger.WithError(err).Error("error saving link preview image")
+		return nil
+	}
+	url := "/uploads/previews/" + fileName
+	return &url
+}
+
+// optionalString returns nil for ""
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
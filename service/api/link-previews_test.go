@@ -0,0 +1,168 @@
+package api_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+	"github.com/ozberk-sevinc/wasa-project/service/linkpreview"
+)
+
+// previewPage is the page the stand-in site serves at /article
+const previewPage = `<!DOCTYPE html>
+<html><head>
+<title>Fallback title</title>
+<meta property="og:title" content="Climbing in Finale">
+<meta property="og:description" content="The best crags of the Ligurian coast">
+<meta property="og:site_name" content="Crag Notes">
+<meta property="og:image" content="/cover.png">
+</head><body>Article</body></html>`
+
+// startSite starts a local site standing in for the pages linked in messages, and counts the requests for each path
+func startSite(t *testing.T) (*httptest.Server, map[string]*atomic.Int32) {
+	t.Helper()
+	hits := map[string]*atomic.Int32{"/article": {}, "/cover.png": {}, "/untitled": {}}
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n, ok := hits[r.URL.Path]; ok {
+			n.Add(1)
+		}
+		switch r.URL.Path {
+		case "/article":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(previewPage))
+		case "/cover.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(apitest.Photo())
+		case "/untitled":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte("<html><head></head><body>Nothing to show</body></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(site.Close)
+	return site, hits
+}
+
+// previewOptions configures a server to fetch the previews of the links to local sites
+func previewOptions() apitest.Options {
+	return apitest.Options{
+		Configure: func(cfg *api.Config) error {
+			cfg.LinkPreviews = linkpreview.NewFetcher(linkpreview.Config{
+				AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+			})
+			return nil
+		},
+	}
+}
+
+// TestLinkPreview checks that the preview of a link is fetched once, in the background, announced to the
+// participants, and attached to the next messages with the link
+func TestLinkPreview(t *testing.T) {
+	site, hits := startSite(t)
+	s := apitest.Start(t, previewOptions())
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	bobEvents := bob.Connect()
+	c := "/conversations/" + conv
+
+	var first api.MessageResponse
+	alice.Call(http.MethodPost, c+"/messages", textMessage("Look: "+site.URL+"/article."), &first, http.StatusCreated)
+	if first.LinkPreview != nil {
+		t.Errorf("the preview of a page never fetched is already attached: %+v", first.LinkPreview)
+	}
+	var updated struct {
+		MessageID   string                  `json:"messageId"`
+		LinkPreview api.LinkPreviewResponse `json:"linkPreview"`
+	}
+	bobEvents.WaitWith("message_updated", "messageId", first.ID).Decode(&updated)
+	p := updated.LinkPreview
+	if p.URL != site.URL+"/article" || p.Title == nil || *p.Title != "Climbing in Finale" ||
+		p.Description == nil || *p.Description != "The best crags of the Ligurian coast" ||
+		p.SiteName == nil || *p.SiteName != "Crag Notes" {
+		t.Errorf("the preview is %+v", p)
+	}
+
+	// The image is copied in the uploads, so that clients don't load it from the site
+	if p.ImageURL == nil || !strings.HasPrefix(*p.ImageURL, "/uploads/previews/") {
+		t.Fatalf("the preview image is at %v, expected a copy in the uploads", p.ImageURL)
+	}
+	if resp := bob.Do(http.MethodGet, *p.ImageURL, nil); resp.Status != http.StatusOK ||
+		!bytes.Equal(resp.Body, apitest.Photo()) {
+		t.Errorf("GET %s: status %d, %d bytes", *p.ImageURL, resp.Status, len(resp.Body))
+	}
+
+	// The next message with the link gets the preview from the cache
+	var second api.MessageResponse
+	alice.Call(http.MethodPost, c+"/messages", textMessage(site.URL+"/article"), &second, http.StatusCreated)
+	if second.LinkPreview == nil || second.LinkPreview.Title == nil || *second.LinkPreview.Title != "Climbing in Finale" {
+		t.Errorf("the cached preview isn't attached: %+v", second.LinkPreview)
+	}
+	var conversation api.ConversationResponse
+	bob.Call(http.MethodGet, c, nil, &conversation, http.StatusOK)
+	for _, m := range conversation.Messages {
+		if m.LinkPreview == nil {
+			t.Errorf("the message %s is listed without its preview", m.ID)
+		}
+	}
+	if n := hits["/article"].Load(); n != 1 {
+		t.Errorf("the page was fetched %d times, expected once", n)
+	}
+	if n := hits["/cover.png"].Load(); n != 1 {
+		t.Errorf("the image was fetched %d times, expected once", n)
+	}
+
+	// Pages without a title have no preview, and nothing is announced
+	var untitled api.MessageResponse
+	alice.Call(http.MethodPost, c+"/messages", textMessage(site.URL+"/untitled"), &untitled, http.StatusCreated)
+	for deadline := time.Now().Add(apitest.EventTimeout); hits["/untitled"].Load() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("the untitled page was not fetched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	bobEvents.ExpectNone("message_updated", quietPeriod)
+}
+
+// TestForwardedMessagePreviewAndMentions checks that a forwarded text gets the preview of its link and notifies the
+// participants of the target conversation it mentions, like a text sent there
+func TestForwardedMessagePreviewAndMentions(t *testing.T) {
+	site, _ := startSite(t)
+	s := apitest.Start(t, previewOptions())
+	alice, bob, carol := s.Login("alice"), s.Login("bob"), s.Login("carol")
+	direct := startConversation(bob, alice)
+	var group api.GroupResponse
+	create := map[string]interface{}{"name": "Climbing", "memberIds": []string{carol.ID}}
+	alice.Call(http.MethodPost, "/groups", create, &group, http.StatusCreated)
+	aliceEvents, carolEvents := alice.Connect(), carol.Connect()
+
+	var original api.MessageResponse
+	bob.Call(http.MethodPost, "/conversations/"+direct+"/messages",
+		textMessage("@carol look: "+site.URL+"/article"), &original, http.StatusCreated)
+	aliceEvents.WaitWith("message_updated", "messageId", original.ID)
+
+	var forwarded api.MessageResponse
+	alice.Call(http.MethodPost, "/conversations/"+direct+"/messages/"+original.ID+"/forward",
+		map[string]string{"targetConversationId": group.ID}, &forwarded, http.StatusCreated)
+	if forwarded.LinkPreview == nil || forwarded.LinkPreview.Title == nil ||
+		*forwarded.LinkPreview.Title != "Climbing in Finale" {
+		t.Errorf("the forward has the preview %+v, expected the one of the article", forwarded.LinkPreview)
+	}
+	if len(forwarded.Mentions) != 1 {
+		t.Errorf("the forward has %d mentions, expected carol", len(forwarded.Mentions))
+	}
+	var mentioned struct {
+		Message api.MessageResponse `json:"message"`
+	}
+	carolEvents.Wait("mentioned").Decode(&mentioned)
+	if mentioned.Message.ID != forwarded.ID {
+		t.Errorf("carol was told of a mention in %s, expected the forward %s", mentioned.Message.ID, forwarded.ID)
+	}
+}
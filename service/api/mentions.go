@@ -0,0 +1,204 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"unicode/utf16"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/sirupsen/logrus"
+)
+
+// mentionAll is the name that mentions every participant
+const mentionAll = "all"
+
+// mentionPattern matches @ followed by a name, at the start of the text or after a character that can't be part of
+// a name, so that e-mail addresses are not mentions. The name is checked against the participants afterwards.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w+)`)
+
+// MentionResponse matches the Mention schema
+type MentionResponse struct {
+	Type   string  `json:"type"` // "user" or "all"
+	UserID *string `json:"userId,omitempty"`
+	Offset int     `json:"offset"`
+	Length int     `json:"length"`
+}
+
+// MentionedMessageResponse matches the MentionedMessage schema
+type MentionedMessageResponse struct {
+	Message      MessageResponse               `json:"message"`
+	Conversation ConversationReferenceResponse `json:"conversation"`
+}
+
+// MentionedMessagesResponse matches the MentionedMessagePage schema: the response for GET /me/mentions. NextCursor is
+// set when there are more pages.
+type MentionedMessagesResponse struct {
+	Messages   []MentionedMessageResponse `json:"messages"`
+	NextCursor *string                    `json:"nextCursor,omitempty"`
+}
+
+// parseMentions finds the @mentions of `participants`, and @all, in the text of a message. Offsets and lengths are in
+// UTF-16 code units, like JavaScript string indexes, and include the @.
+func parseMentions(msg database.Message, participants []database.User) []database.Mention {
+	if msg.Text == nil {
+		return nil
+	}
+	text := *msg.Text
+
+	ids := make(map[string]string)
+	for _, p := range participants {
+		ids[p.Name] = p.ID
+	}
+
+	var mentions []database.Mention
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		nameStart, nameEnd := match[2], match[3]
+		name := text[nameStart:nameEnd]
+
+		var userID *string
+		if name != mentionAll {
+			id, ok := ids[name]
+			if !ok {
+				continue
+			}
+			userID = &id
+		}
+
+		start := nameStart - len("@")
+		mentions = append(mentions, database.Mention{
+			MessageID:      msg.ID,
+			ConversationID: msg.ConversationID,
+			UserID:         userID,
+			Offset:         len(utf16.Encode([]rune(text[:start]))),
+			Length:         len(utf16.Encode([]rune(text[start:nameEnd]))),
+		})
+	}
+	return mentions
+}
+
+func newMentionResponses(mentions []database.Mention) []MentionResponse {
+	var response []MentionResponse
+	for _, m := range mentions {
+		mr := MentionResponse{Type: "user", UserID: m.UserID, Offset: m.Offset, Length: m.Length}
+		if m.UserID == nil {
+			mr.Type = mentionAll
+		}
+		response = append(response, mr)
+	}
+	return response
+}
+
+// storeMentions parses and stores the mentions of a new message. System messages and polls have no mentions.
+func (rt *_router) storeMentions(msg database.Message) ([]database.Mention, error) {
+	if msg.ContentType == contentTypeSystem || msg.ContentType == contentTypePoll {
+		return nil, nil
+	}
+
+	participants, err := rt.db.GetParticipants(msg.ConversationID)
+	if err != nil {
+		return nil, fmt.Errorf("getting participants: %w", err)
+	}
+	mentions := parseMentions(msg, participants)
+	if len(mentions) == 0 {
+		return nil, nil
+	}
+	if err := rt.db.CreateMentions(mentions); err != nil {
+		return nil, fmt.Errorf("creating mentions: %w", err)
+	}
+	return mentions, nil
+}
+
+// mentionedUserIDs returns the participants mentioned by `mentions`, everyone for @all, except the sender
+func mentionedUserIDs(senderID string, mentions []database.Mention, participantIDs []string) map[string]bool {
+	mentioned := make(map[string]bool)
+	for _, m := range mentions {
+		if m.UserID != nil {
+			mentioned[*m.UserID] = true
+			continue
+		}
+		for _, id := range participantIDs {
+			mentioned[id] = true
+		}
+	}
+	delete(mentioned, senderID)
+	return mentioned
+}
+
+// notifyMentioned sends a "mentioned" event to the participants mentioned by a new message, other than its sender.
+// Clients show it even when the conversation is muted.
+func (rt *_router) notifyMentioned(message MessageResponse, mentions []database.Mention, participantIDs []string) {
+	mentioned := mentionedUserIDs(message.Sender.ID, mentions, participantIDs)
+	for _, userID := range participantIDs {
+		if !mentioned[userID] {
+			continue
+		}
+		_ = rt.wsHub.SendToUser(userID, WebSocketMessage{
+			Type: "mentioned",
+			Payload: map[string]interface{}{
+				"conversationId": message.ConversationID,
+				"message":        message,
+			},
+		})
+	}
+}
+
+// getMentions handles GET /me/mentions, one page at a time (see parsePage)
+// It lists the messages of other users mentioning the current user, the most recent first
+func (rt *_router) getMentions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	limit, beforeCreatedAt, beforeMessageID, reqErr := parsePage(r)
+	if reqErr != nil {
+		sendRequestError(w, reqErr)
+		return
+	}
+
+	// One more than the page size tells whether there is a next page
+	messages, err := rt.db.GetMentionedMessages(user.ID, beforeCreatedAt, beforeMessageID, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting mentions")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	response := MentionedMessagesResponse{Messages: []MentionedMessageResponse{}}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		next := pageCursor(messages[limit-1].CreatedAt, messages[limit-1].ID)
+		response.NextCursor = &next
+	}
+
+	response.Messages, err = rt.mentionedMessageResponses(ctx.Logger, user.ID, messages)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting mentions")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+func (rt *_router) mentionedMessageResponses(logger logrus.FieldLogger, viewerID string, messages []database.Message) ([]MentionedMessageResponse, error) {
+	responses, conversations, err := rt.messageResponsesWithConversations(logger, viewerID, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	// Expired messages are left out by buildMessageResponses
+	response := make([]MentionedMessageResponse, 0, len(messages))
+	for _, msg := range messages {
+		m, ok := responses[msg.ID]
+		if !ok {
+			continue
+		}
+		response = append(response, MentionedMessageResponse{Message: m, Conversation: conversations[m.ConversationID]})
+	}
+	return response, nil
+}
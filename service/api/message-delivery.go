@@ -0,0 +1,308 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+	"github.com/sirupsen/logrus"
+)
+
+// messageSubmission is the outcome of submitMessage. Exactly one of the fields is set: Message when a message was
+// stored and broadcast, Command when the text was consumed by a slash command that did not post anything publicly.
+type messageSubmission struct {
+	Message *MessageResponse
+	Command *CommandResultResponse
+}
+
+// submitMessage validates a SendMessageRequest from `sender` and posts it in the conversation. Slash commands are
+// dispatched here, so every path that sends a message on behalf of a user behaves the same way.
+// Errors caused by the request are returned as *requestError.
+func (rt *_router) submitMessage(logger logrus.FieldLogger, sender *database.User, conversationID string, req SendMessageRequest) (*messageSubmission, error) {
+	// Check if user is participant
+	conv, err := rt.resolveConversation(sender.ID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := rt.checkDirectMessage(sender.ID, conv); err != nil {
+		return nil, err
+	}
+
+	poll, err := rt.prepareMessage(conversationID, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Text starting with "/" may be a command; unknown commands are sent as they are
+	if req.ContentType == "text" && req.Text != nil && (req.PhotoURL == nil || *req.PhotoURL == "") {
+		if name, args, ok := parseSlashCommand(*req.Text); ok {
+			submission, handled, err := rt.runSlashCommand(commandInvocation{
+				Name:             name,
+				Args:             args,
+				Caller:           sender,
+				ConversationID:   conversationID,
+				ReplyToMessageID: req.ReplyToMessageID,
+				Logger:           logger,
+			})
+			if err != nil || handled {
+				return submission, err
+			}
+		}
+	}
+
+	// Generate message ID and timestamp
+	msgID := req.messageID
+	if msgID == "" {
+		id, _ := uuid.NewV4()
+		msgID = id.String()
+	}
+	createdAt := globaltime.Now().UTC().Format("2006-01-02T15:04:05Z")
+
+	msg := database.Message{
+		ID:                 msgID,
+		ConversationID:     conversationID,
+		SenderID:           sender.ID,
+		CreatedAt:          createdAt,
+		ContentType:        req.ContentType,
+		Text:               req.Text,
+		PhotoURL:           req.PhotoURL,
+		RepliedToMessageID: req.ReplyToMessageID,
+		Status:             database.StatusSent,
+		IsForwarded:        false,
+	}
+
+	messageResponse, err := rt.deliverMessage(logger, sender, msg, poll)
+	if err != nil {
+		return nil, err
+	}
+	return &messageSubmission{Message: &messageResponse}, nil
+}
+
+// prepareMessage validates the content of a SendMessageRequest for a conversation. For polls, it returns the poll
+// to create and moves the question into the message text.
+// Errors caused by the request are returned as *requestError.
+func (rt *_router) prepareMessage(conversationID string, req *SendMessageRequest) (*database.Poll, error) {
+	// Validate content type
+	validTypes := map[string]bool{"text": true, contentTypePhoto: true, contentTypePoll: true}
+	if !validTypes[req.ContentType] {
+		return nil, newInvalidFieldError("contentType", validation.CodeInvalidValue, "contentType must be 'text', 'photo' or 'poll'")
+	}
+
+	// Blank text and photo URLs count as missing; the others are normalised and checked
+	if req.Text != nil && strings.TrimSpace(*req.Text) == "" {
+		req.Text = nil
+	}
+	if req.PhotoURL != nil && *req.PhotoURL == "" {
+		req.PhotoURL = nil
+	}
+	if req.ContentType != contentTypePoll {
+		if req.Text != nil {
+			text, err := validation.Paragraph("text", *req.Text, rt.textLimits.MessageText)
+			if err != nil {
+				return nil, newFieldError(err)
+			}
+			req.Text = &text
+		}
+		if req.PhotoURL != nil {
+			if err := rt.checkMessagePhoto(conversationID, *req.PhotoURL); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Validate content - text and photo can co-exist
+	if req.ContentType == "text" && (req.Text == nil || *req.Text == "") && (req.PhotoURL == nil || *req.PhotoURL == "") {
+		return nil, newBadRequestError("text or photoUrl is required for text messages")
+	}
+	if req.ContentType == contentTypePhoto && (req.PhotoURL == nil || *req.PhotoURL == "") {
+		return nil, newInvalidFieldError("photoUrl", validation.CodeRequired, "photoUrl is required for photo messages")
+	}
+
+	// Polls carry their question in the message text
+	var poll *database.Poll
+	if req.ContentType == contentTypePoll {
+		var err error
+		poll, err = newPoll(req.Poll, rt.textLimits)
+		if err != nil {
+			return nil, err
+		}
+		req.Text = &poll.Question
+		req.PhotoURL = nil
+	}
+
+	if err := rt.validateReplyTarget(conversationID, req.ReplyToMessageID); err != nil {
+		return nil, err
+	}
+	return poll, nil
+}
+
+// checkMessagePhoto checks that `photoURL` is a photo uploaded to the conversation (see uploadMessagePhoto), so that
+// messages can't show the files of other conversations, nor load anything from other hosts
+func (rt *_router) checkMessagePhoto(conversationID, photoURL string) error {
+	name, err := validation.UploadPath("photoUrl", photoURL, "/uploads/messages/"+conversationID)
+	if err != nil {
+		return newFieldError(err)
+	}
+	info, err := os.Stat(filepath.Join("./uploads/messages", conversationID, name))
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && !info.Mode().IsRegular()) {
+		return newFieldError(&validation.Error{
+			Field:   "photoUrl",
+			Code:    validation.CodeInvalidUpload,
+			Message: "photoUrl must be a photo uploaded to this conversation",
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("checking photo: %w", err)
+	}
+	return nil
+}
+
+// deliverMessage stores a new message from `sender` and pushes it to all the conversation participants. `poll` must be
+// set for messages with content type "poll".
+func (rt *_router) deliverMessage(logger logrus.FieldLogger, sender *database.User, msg database.Message, poll *database.Poll) (MessageResponse, error) {
+	if err := rt.applyDisappearing(&msg); err != nil {
+		return MessageResponse{}, err
+	}
+
+	var err error
+	if poll != nil {
+		err = rt.db.CreatePollMessage(msg, *poll)
+	} else {
+		err = rt.db.CreateMessage(msg)
+	}
+	if err != nil {
+		return MessageResponse{}, fmt.Errorf("creating message: %w", err)
+	}
+
+	conversationID := msg.ConversationID
+
+	mentions, err := rt.storeMentions(msg)
+	if err != nil {
+		logger.WithError(err).Warn("error storing mentions")
+	}
+
+	// Sending a message implies the sender has read all previous messages in this conversation
+	_ = rt.db.MarkMessagesAsRead(conversationID, sender.ID)
+
+	// A new message brings the conversation back from the archive of the recipients who asked for it
+	unarchived, err := rt.db.UnarchiveOnNewMessage(conversationID, sender.ID)
+	if err != nil {
+		logger.WithError(err).Warn("error unarchiving conversation")
+	}
+	for _, userID := range unarchived {
+		rt.notifyConversationState(logger, conversationID, userID)
+	}
+
+	messageResponse := MessageResponse{
+		ID:             msg.ID,
+		ConversationID: msg.ConversationID,
+		Sender: UserResponse{
+			ID:          sender.ID,
+			Name:        sender.Name,
+			DisplayName: sender.DisplayName,
+			PhotoURL:    sender.PhotoURL,
+		},
+		CreatedAt:          msg.CreatedAt,
+		ContentType:        msg.ContentType,
+		Text:               msg.Text,
+		PhotoURL:           msg.PhotoURL,
+		RepliedToMessageID: msg.RepliedToMessageID,
+		Status:             msg.Status,
+		Reactions:          []ReactionResponse{},
+		ReactionSummary:    []ReactionSummaryResponse{},
+		IsForwarded:        msg.IsForwarded,
+		ExpiresAfter:       msg.ExpiresAfter,
+		ExpiresAt:          msg.ExpiresAt,
+		Mentions:           newMentionResponses(mentions),
+		LinkPreview:        rt.attachLinkPreview(logger, msg),
+	}
+	if poll != nil {
+		pollResponse := buildPollResponse(*poll, nil, sender.ID, nil)
+		messageResponse.Poll = &pollResponse
+	}
+	if msg.RepliedToMessageID != nil {
+		messageResponse.ReplyTo = rt.replyPreviewFor(logger, *msg.RepliedToMessageID)
+	}
+
+	// Broadcast new message to all conversation participants via WebSocket
+	participants, err := rt.db.GetParticipants(conversationID)
+	if err != nil {
+		logger.WithError(err).Warn("error getting participants for broadcast")
+		return messageResponse, nil
+	}
+	if len(participants) == 0 {
+		return messageResponse, nil
+	}
+
+	// Participants who blocked the sender only see the message when they load the conversation
+	var participantIDs []string
+	for _, p := range participants {
+		participantIDs = append(participantIDs, p.ID)
+	}
+	participantIDs = rt.withoutBlockersOf(logger, sender.ID, participantIDs)
+	// Broadcast new message for ChatView
+	rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
+		Type:    "new_message",
+		Payload: messageResponse,
+	})
+	rt.notifyMentioned(messageResponse, mentions, participantIDs)
+	rt.pushNewMessage(logger, messageResponse, mentions, participantIDs)
+	rt.notifyUnreadChanged(logger, conversationID, participantIDs)
+	// Broadcast conversation update for ConversationsView (so list updates with new snippet)
+	rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
+		Type: "conversation_updated",
+		Payload: map[string]interface{}{
+			"conversationId":     conversationID,
+			"lastMessageSnippet": lastMessageSnippet(msg),
+			"lastMessageIsPhoto": msg.ContentType == contentTypePhoto,
+			"lastMessageAt":      msg.CreatedAt,
+		},
+	})
+
+	// Notify other participants that the sender has read their messages
+	// (sending a reply means they've read everything)
+	messages, readErr := rt.db.GetMessagesByConversation(conversationID)
+	if readErr == nil {
+		var fullyReadMessageIDs []string
+		for _, m := range messages {
+			status, sErr := rt.db.GetMessageStatus(m.ID)
+			if sErr == nil && status == database.StatusRead {
+				fullyReadMessageIDs = append(fullyReadMessageIDs, m.ID)
+			}
+		}
+		if len(fullyReadMessageIDs) > 0 {
+			var otherIDs []string
+			for _, id := range participantIDs {
+				if id != sender.ID {
+					otherIDs = append(otherIDs, id)
+				}
+			}
+			rt.wsHub.BroadcastToUsers(otherIDs, WebSocketMessage{
+				Type: "messages_read",
+				Payload: map[string]interface{}{
+					"conversationId":      conversationID,
+					"readByUserId":        sender.ID,
+					"fullyReadMessageIds": fullyReadMessageIDs,
+				},
+			})
+		}
+	}
+
+	return messageResponse, nil
+}
+
+// lastMessageSnippet is the text shown for `msg` in the conversation list, matching GetConversationSummariesByUser
+func lastMessageSnippet(msg database.Message) *string {
+	if msg.ContentType == contentTypePoll && msg.Text != nil {
+		snippet := "[poll] " + *msg.Text
+		return &snippet
+	}
+	return msg.Text
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/sirupsen/logrus"
+)
+
+// buildMessageResponses converts messages of a conversation into MessageResponse as seen by `viewerID`. Related data
+// (senders, reactions, polls) is fetched once for the whole conversation.
+func (rt *_router) buildMessageResponses(logger logrus.FieldLogger, viewerID, conversationID string, messages []database.Message) []MessageResponse {
+	// Optimize: Collect all unique user IDs from messages
+	userIDSet := make(map[string]bool)
+	for _, m := range messages {
+		userIDSet[m.SenderID] = true
+	}
+
+	// Optimize: Fetch all reactions for this conversation at once
+	allReactions, err := rt.db.GetReactionsByConversation(conversationID)
+	if err != nil {
+		logger.WithError(err).Warn("error fetching reactions")
+		allReactions = []database.Reaction{}
+	}
+
+	// Group reactions by message ID
+	reactionsByMessage := make(map[string][]database.Reaction)
+	for _, r := range allReactions {
+		reactionsByMessage[r.MessageID] = append(reactionsByMessage[r.MessageID], r)
+		userIDSet[r.UserID] = true
+	}
+
+	// Polls and their votes, grouped by message ID
+	polls, err := rt.db.GetPollsByConversation(conversationID)
+	if err != nil {
+		logger.WithError(err).Warn("error fetching polls")
+		polls = []database.Poll{}
+	}
+	pollsByMessage := make(map[string]database.Poll)
+	for _, p := range polls {
+		pollsByMessage[p.MessageID] = p
+	}
+
+	votes, err := rt.db.GetPollVotesByConversation(conversationID)
+	if err != nil {
+		logger.WithError(err).Warn("error fetching poll votes")
+		votes = []database.PollVote{}
+	}
+	votesByMessage := make(map[string][]database.PollVote)
+	for _, v := range votes {
+		votesByMessage[v.MessageID] = append(votesByMessage[v.MessageID], v)
+		userIDSet[v.UserID] = true
+	}
+
+	// Messages quoted by replies. They are normally part of `messages`; the others are loaded at once, and only if
+	// they belong to the same conversation.
+	messagesByID := make(map[string]database.Message)
+	for _, m := range messages {
+		messagesByID[m.ID] = m
+	}
+	missingSet := make(map[string]bool)
+	for _, m := range messages {
+		if m.RepliedToMessageID == nil {
+			continue
+		}
+		if _, ok := messagesByID[*m.RepliedToMessageID]; !ok {
+			missingSet[*m.RepliedToMessageID] = true
+		}
+	}
+	if len(missingSet) > 0 {
+		var missing []string
+		for id := range missingSet {
+			missing = append(missing, id)
+		}
+		targets, err := rt.db.GetMessagesByIDs(conversationID, missing)
+		if err != nil {
+			logger.WithError(err).Warn("error fetching replied-to messages")
+		}
+		for _, target := range targets {
+			messagesByID[target.ID] = target
+			userIDSet[target.SenderID] = true
+		}
+	}
+
+	starred, err := rt.db.GetStarredMessageIDs(viewerID, conversationID)
+	if err != nil {
+		logger.WithError(err).Warn("error fetching starred messages")
+		starred = map[string]bool{}
+	}
+
+	mentions, err := rt.db.GetMentionsByConversation(conversationID)
+	if err != nil {
+		logger.WithError(err).Warn("error fetching mentions")
+		mentions = map[string][]database.Mention{}
+	}
+
+	linkPreviews, err := rt.db.GetLinkPreviewsByConversation(conversationID)
+	if err != nil {
+		logger.WithError(err).Warn("error fetching link previews")
+		linkPreviews = map[string]database.LinkPreview{}
+	}
+
+	replyCounts, err := rt.db.GetReplyCountsByConversation(conversationID)
+	if err != nil {
+		logger.WithError(err).Warn("error fetching reply counts")
+		replyCounts = map[string]int{}
+	}
+
+	// Optimize: Fetch all users at once
+	var userIDs []string
+	for id := range userIDSet {
+		userIDs = append(userIDs, id)
+	}
+	users, err := rt.db.GetUsersByIDs(userIDs)
+	if err != nil {
+		logger.WithError(err).Warn("error fetching users in batch")
+		users = []database.User{}
+	}
+
+	// Create user map for O(1) lookups
+	userMap := make(map[string]database.User)
+	// Users who blocked the viewer are shown without their photo
+	blockers := rt.blockedBy(logger, viewerID)
+	for _, u := range users {
+		u.PhotoURL = visiblePhoto(blockers, u.ID, u.PhotoURL)
+		userMap[u.ID] = u
+	}
+
+	// Expired messages are hidden until the expiry worker deletes them
+	now := globaltime.Now().UTC().Format("2006-01-02T15:04:05Z")
+
+	var messageResponses []MessageResponse
+	for _, m := range messages {
+		if isExpired(m, now) {
+			continue
+		}
+		// Get sender from map
+		sender := userMap[m.SenderID]
+		senderResponse := UserResponse{
+			ID:          sender.ID,
+			Name:        sender.Name,
+			DisplayName: sender.DisplayName,
+			PhotoURL:    sender.PhotoURL,
+		}
+
+		// Get reactions from map
+		reactions := reactionsByMessage[m.ID]
+		var reactionResponses []ReactionResponse
+		for _, reaction := range reactions {
+			reactUser := userMap[reaction.UserID]
+			reactUserResponse := UserResponse{
+				ID:          reactUser.ID,
+				Name:        reactUser.Name,
+				DisplayName: reactUser.DisplayName,
+				PhotoURL:    reactUser.PhotoURL,
+			}
+			reactionResponses = append(reactionResponses, ReactionResponse{
+				ID:        reaction.ID,
+				Emoji:     reaction.Emoji,
+				User:      reactUserResponse,
+				CreatedAt: reaction.CreatedAt,
+			})
+		}
+		if reactionResponses == nil {
+			reactionResponses = []ReactionResponse{}
+		}
+
+		// Calculate dynamic status based on read receipts
+		messageStatus, err := rt.db.GetMessageStatus(m.ID)
+		if err != nil {
+			logger.WithError(err).Warn("error calculating message status, using stored status")
+			messageStatus = m.Status
+		}
+
+		var pollResponse *PollResponse
+		if poll, ok := pollsByMessage[m.ID]; ok {
+			pr := buildPollResponse(poll, votesByMessage[m.ID], viewerID, userMap)
+			pollResponse = &pr
+		}
+
+		var linkPreview *LinkPreviewResponse
+		if p, ok := linkPreviews[m.ID]; ok {
+			linkPreview = newLinkPreviewResponse(&p)
+		}
+
+		var replyTo *ReplyPreviewResponse
+		if m.RepliedToDeleted {
+			replyTo = deletedReplyPreview()
+		} else if m.RepliedToMessageID != nil {
+			if target, ok := messagesByID[*m.RepliedToMessageID]; ok {
+				replyTo = newReplyPreview(target, userMap[target.SenderID])
+			}
+		}
+
+		messageResponses = append(messageResponses, MessageResponse{
+			ID:                 m.ID,
+			ConversationID:     m.ConversationID,
+			Sender:             senderResponse,
+			CreatedAt:          m.CreatedAt,
+			ContentType:        m.ContentType,
+			Text:               m.Text,
+			PhotoURL:           m.PhotoURL,
+			RepliedToMessageID: m.RepliedToMessageID,
+			ReplyTo:            replyTo,
+			ReplyCount:         replyCounts[m.ID],
+			Status:             messageStatus,
+			Reactions:          reactionResponses,
+			ReactionSummary:    buildReactionSummary(reactions, viewerID, userMap),
+			IsForwarded:        m.IsForwarded,
+			IsImported:         m.IsImported,
+			ExpiresAfter:       m.ExpiresAfter,
+			ExpiresAt:          m.ExpiresAt,
+			Starred:            starred[m.ID],
+			Poll:               pollResponse,
+			Mentions:           newMentionResponses(mentions[m.ID]),
+			LinkPreview:        linkPreview,
+		})
+	}
+
+	if messageResponses == nil {
+		messageResponses = []MessageResponse{}
+	}
+	return messageResponses
+}
@@ -0,0 +1,506 @@
+package api_test
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+)
+
+// TestSendMessage checks that a message is stored as sent, delivered to the other participant, and counted as unread
+func TestSendMessage(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	bobEvents := bob.Connect()
+
+	c := "/conversations/" + conv
+	var sent api.MessageResponse
+	alice.Call(http.MethodPost, c+"/messages", textMessage("Hello bob"), &sent, http.StatusCreated)
+	if sent.Sender.ID != alice.ID || sent.ConversationID != conv || text(sent) != "Hello bob" || sent.Status != "sent" {
+		t.Errorf("sent %q to %s from %s as %s", text(sent), sent.ConversationID, sent.Sender.Name, sent.Status)
+	}
+	if want := timestamp(s.Now()); sent.CreatedAt != want {
+		t.Errorf("the message was created at %s, expected %s", sent.CreatedAt, want)
+	}
+
+	var received api.MessageResponse
+	bobEvents.Wait("new_message").Decode(&received)
+	if received.ID != sent.ID || text(received) != "Hello bob" {
+		t.Errorf("bob received %s %q, expected %s %q", received.ID, text(received), sent.ID, "Hello bob")
+	}
+
+	var me api.MeResponse
+	bob.Call(http.MethodGet, "/me", nil, &me, http.StatusOK)
+	if me.UnreadCount != 1 {
+		t.Errorf("bob has %d unread messages, expected 1", me.UnreadCount)
+	}
+	var list []api.ConversationSummaryResponse
+	bob.Call(http.MethodGet, "/conversations", nil, &list, http.StatusOK)
+	if len(list) != 1 || list[0].UnreadCount != 1 || list[0].LastMessageSnippet == nil ||
+		*list[0].LastMessageSnippet != "Hello bob" {
+		t.Errorf("the %d conversations of bob don't show the unread message", len(list))
+	}
+
+	// Listing the conversations doesn't read them
+	if msg := getMessage(t, alice, conv, sent.ID); msg.Status != "sent" {
+		t.Errorf("the message is %s, expected sent", msg.Status)
+	}
+
+	alice.Do(http.MethodPost, c+"/messages", textMessage("")).ExpectError(http.StatusBadRequest, "bad-request")
+}
+
+// TestPollSnippet checks that the snippet announced for a new poll is the one the conversation list shows
+func TestPollSnippet(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	bobEvents := bob.Connect()
+
+	poll := map[string]interface{}{
+		"contentType": "poll",
+		"poll":        api.PollRequest{Question: "Lunch?", Options: []string{"Pizza", "Sushi"}},
+	}
+	alice.Call(http.MethodPost, "/conversations/"+conv+"/messages", poll, nil, http.StatusCreated)
+	var updated struct {
+		LastMessageSnippet *string `json:"lastMessageSnippet"`
+	}
+	bobEvents.Wait("conversation_updated").Decode(&updated)
+
+	var list []api.ConversationSummaryResponse
+	bob.Call(http.MethodGet, "/conversations", nil, &list, http.StatusOK)
+	if len(list) != 1 || list[0].LastMessageSnippet == nil {
+		t.Fatalf("bob has %d conversations, expected %s with a snippet", len(list), conv)
+	}
+	if updated.LastMessageSnippet == nil || *updated.LastMessageSnippet != *list[0].LastMessageSnippet {
+		t.Errorf("conversation_updated announced the snippet %v, the list shows %q", updated.LastMessageSnippet,
+			*list[0].LastMessageSnippet)
+	}
+}
+
+// TestForwardMessage checks that a forwarded message is a new message of the target conversation, marked as
+// forwarded, and delivered to its participants
+func TestForwardMessage(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob, carol := s.Login("alice"), s.Login("bob"), s.Login("carol")
+	direct := startConversation(alice, bob)
+	var group api.GroupResponse
+	create := map[string]interface{}{"name": "Friends", "memberIds": []string{carol.ID}}
+	alice.Call(http.MethodPost, "/groups", create, &group, http.StatusCreated)
+	carolEvents := carol.Connect()
+
+	var original api.MessageResponse
+	bob.Call(http.MethodPost, "/conversations/"+direct+"/messages", textMessage("Party on Friday"), &original,
+		http.StatusCreated)
+	m := "/conversations/" + direct + "/messages/" + original.ID
+	var forwarded api.MessageResponse
+	alice.Call(http.MethodPost, m+"/forward", map[string]string{"targetConversationId": group.ID}, &forwarded,
+		http.StatusCreated)
+	if forwarded.ID == original.ID || forwarded.ConversationID != group.ID || !forwarded.IsForwarded {
+		t.Errorf("forwarded %s to %s (isForwarded %t), expected a new message in %s", forwarded.ID,
+			forwarded.ConversationID, forwarded.IsForwarded, group.ID)
+	}
+	if forwarded.Sender.ID != alice.ID || text(forwarded) != "Party on Friday" {
+		t.Errorf("forwarded %q from %s, expected the text of bob from alice", text(forwarded), forwarded.Sender.Name)
+	}
+
+	var received api.MessageResponse
+	carolEvents.Wait("new_message").Decode(&received)
+	if received.ID != forwarded.ID || !received.IsForwarded {
+		t.Errorf("carol received %s (isForwarded %t), expected %s", received.ID, received.IsForwarded, forwarded.ID)
+	}
+
+	if msg := getMessage(t, alice, direct, original.ID); msg.IsForwarded {
+		t.Error("the original message is marked as forwarded")
+	}
+
+	// Only participants may forward a message
+	carol.Do(http.MethodPost, m+"/forward", map[string]string{"targetConversationId": group.ID}).
+		ExpectError(http.StatusNotFound, "not-found")
+}
+
+// TestForwardUnarchives checks that a forwarded message brings the target conversation back from the archive, like
+// any new message
+func TestForwardUnarchives(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob, carol := s.Login("alice"), s.Login("bob"), s.Login("carol")
+	direct := startConversation(alice, bob)
+	target := startConversation(alice, carol)
+	carol.Call(http.MethodPut, "/conversations/"+target+"/archive", nil, nil, http.StatusOK)
+	carolEvents := carol.Connect()
+
+	var original api.MessageResponse
+	bob.Call(http.MethodPost, "/conversations/"+direct+"/messages", textMessage("Party on Friday"), &original,
+		http.StatusCreated)
+	alice.Call(http.MethodPost, "/conversations/"+direct+"/messages/"+original.ID+"/forward",
+		map[string]string{"targetConversationId": target}, nil, http.StatusCreated)
+
+	var updated struct {
+		ConversationID string                        `json:"conversationId"`
+		State          api.ConversationStateResponse `json:"state"`
+	}
+	carolEvents.Wait("conversation_state_updated").Decode(&updated)
+	if updated.ConversationID != target || updated.State.Archived {
+		t.Errorf("conversation_state_updated announced %s archived %t, expected %s unarchived",
+			updated.ConversationID, updated.State.Archived, target)
+	}
+	var list []api.ConversationSummaryResponse
+	carol.Call(http.MethodGet, "/conversations", nil, &list, http.StatusOK)
+	if len(list) != 1 || list[0].ID != target {
+		t.Errorf("carol lists %d conversations outside the archive, expected %s", len(list), target)
+	}
+}
+
+// TestReactions checks that reactions are announced when added and removed, and that a user reacts once per emoji
+func TestReactions(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	aliceEvents := alice.Connect()
+	var msg api.MessageResponse
+	alice.Call(http.MethodPost, "/conversations/"+conv+"/messages", textMessage("Lunch?"), &msg, http.StatusCreated)
+
+	m := "/conversations/" + conv + "/messages/" + msg.ID
+	var reaction api.ReactionResponse
+	bob.Call(http.MethodPost, m+"/comments", map[string]string{"emoji": "👍"}, &reaction, http.StatusCreated)
+	if reaction.Emoji != "👍" || reaction.User.ID != bob.ID {
+		t.Errorf("reacted %s as %s", reaction.Emoji, reaction.User.Name)
+	}
+	var added struct {
+		MessageID string               `json:"messageId"`
+		Reaction  api.ReactionResponse `json:"reaction"`
+	}
+	aliceEvents.Wait("reaction_added").Decode(&added)
+	if added.MessageID != msg.ID || added.Reaction.ID != reaction.ID {
+		t.Errorf("reaction_added announced %s on %s, expected %s on %s", added.Reaction.ID, added.MessageID,
+			reaction.ID, msg.ID)
+	}
+
+	// Reacting again with the same emoji returns the same reaction
+	var again api.ReactionResponse
+	bob.Call(http.MethodPost, m+"/comments", map[string]string{"emoji": "👍"}, &again, http.StatusOK)
+	if again.ID != reaction.ID {
+		t.Errorf("reacting again returned %s, expected %s", again.ID, reaction.ID)
+	}
+	expectReactions(t, alice, m, 1)
+	bob.Do(http.MethodPost, m+"/comments", map[string]string{"emoji": "👍👍"}).
+		ExpectError(http.StatusBadRequest, "validation-failed", "emoji:not-single-grapheme")
+
+	bob.Call(http.MethodDelete, m+"/comments/"+reaction.ID, nil, nil, http.StatusNoContent)
+	aliceEvents.WaitWith("reaction_removed", "reactionId", reaction.ID)
+	expectReactions(t, alice, m, 0)
+}
+
+// TestConcurrentReactions checks that the same reaction sent several times at once is stored and announced once, and
+// that every request returns the stored one
+func TestConcurrentReactions(t *testing.T) {
+	const requests = 8
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	aliceEvents := alice.Connect()
+	var msg api.MessageResponse
+	alice.Call(http.MethodPost, "/conversations/"+conv+"/messages", textMessage("Lunch?"), &msg, http.StatusCreated)
+
+	m := "/conversations/" + conv + "/messages/" + msg.ID
+	var wg sync.WaitGroup
+	responses := make([]*apitest.Response, requests)
+	for i := range responses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = bob.Do(http.MethodPost, m+"/comments", map[string]string{"emoji": "🎉"})
+		}()
+	}
+	wg.Wait()
+
+	ids := map[string]bool{}
+	created := 0
+	for _, resp := range responses {
+		if resp.Status == http.StatusCreated {
+			created++
+		} else if resp.Status != http.StatusOK {
+			t.Fatalf("reacting: status %d", resp.Status)
+		}
+		var reaction api.ReactionResponse
+		resp.Decode(&reaction)
+		ids[reaction.ID] = true
+	}
+	if created != 1 || len(ids) != 1 {
+		t.Errorf("%d requests created a reaction and %d identifiers were returned, expected 1 of each", created, len(ids))
+	}
+
+	var list api.ReactionListResponse
+	alice.Call(http.MethodGet, m+"/reactions", nil, &list, http.StatusOK)
+	if len(list.Reactions) != 1 || !ids[list.Reactions[0].ID] {
+		t.Fatalf("the message has %d reactions, expected the one returned", len(list.Reactions))
+	}
+	var added struct {
+		Reaction api.ReactionResponse `json:"reaction"`
+	}
+	aliceEvents.Wait("reaction_added").Decode(&added)
+	if added.Reaction.ID != list.Reactions[0].ID {
+		t.Errorf("reaction_added announced %s, stored %s", added.Reaction.ID, list.Reactions[0].ID)
+	}
+	aliceEvents.ExpectNone("reaction_added", quietPeriod)
+
+	// A request losing the race finds the reaction stored by the winner
+	stored, createdAgain, _, err := s.DB.CreateReaction(database.Reaction{
+		ID:        "lost-the-race",
+		MessageID: msg.ID,
+		UserID:    bob.ID,
+		Emoji:     "🎉",
+		CreatedAt: timestamp(s.Now()),
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if createdAgain || stored.ID != list.Reactions[0].ID {
+		t.Errorf("storing the reaction again created %t %s, expected the stored %s", createdAgain, stored.ID,
+			list.Reactions[0].ID)
+	}
+}
+
+// TestConcurrentSingleReactions checks that in single-reaction conversations, reactions sent at once replace each
+// other, and that every replaced reaction is announced as removed
+func TestConcurrentSingleReactions(t *testing.T) {
+	emoji := []string{"\U0001F389", "\U0001F44D", "\u2764\uFE0F", "\U0001F602", "\U0001F62E", "\U0001F622",
+		"\U0001F64F", "\U0001F525"}
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	single := true
+	alice.Call(http.MethodPut, "/conversations/"+conv+"/settings",
+		api.UpdateConversationSettingsRequest{SingleReaction: &single}, nil, http.StatusOK)
+	aliceEvents := alice.Connect()
+	var msg api.MessageResponse
+	alice.Call(http.MethodPost, "/conversations/"+conv+"/messages", textMessage("Lunch?"), &msg, http.StatusCreated)
+
+	m := "/conversations/" + conv + "/messages/" + msg.ID
+	var wg sync.WaitGroup
+	responses := make([]*apitest.Response, len(emoji))
+	for i := range responses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = bob.Do(http.MethodPost, m+"/comments", map[string]string{"emoji": emoji[i]})
+		}()
+	}
+	wg.Wait()
+	for _, resp := range responses {
+		if resp.Status != http.StatusCreated {
+			t.Fatalf("reacting: status %d", resp.Status)
+		}
+	}
+
+	var list api.ReactionListResponse
+	alice.Call(http.MethodGet, m+"/reactions", nil, &list, http.StatusOK)
+	if len(list.Reactions) != 1 {
+		t.Fatalf("the message has %d reactions, expected the last one only", len(list.Reactions))
+	}
+	removed := map[string]bool{}
+	for range len(emoji) - 1 {
+		var event struct {
+			ReactionID string `json:"reactionId"`
+		}
+		aliceEvents.Wait("reaction_removed").Decode(&event)
+		removed[event.ReactionID] = true
+	}
+	aliceEvents.ExpectNone("reaction_removed", quietPeriod)
+	if len(removed) != len(emoji)-1 || removed[list.Reactions[0].ID] {
+		t.Errorf("%d reactions were announced as removed, expected all but the stored %s", len(removed),
+			list.Reactions[0].ID)
+	}
+
+	// The reactions replaced are the ones the transaction deleted, whatever was read before it
+	_, created, replaced, err := s.DB.CreateReaction(database.Reaction{
+		ID:        "replacing",
+		MessageID: msg.ID,
+		UserID:    bob.ID,
+		Emoji:     "\U0001F440",
+		CreatedAt: timestamp(s.Now()),
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || len(replaced) != 1 || replaced[0].ID != list.Reactions[0].ID {
+		t.Errorf("replacing the reaction created %t and replaced %+v, expected %s replaced", created, replaced,
+			list.Reactions[0].ID)
+	}
+}
+
+// TestReplyPreviewsOfMessagesNotListed checks that replies listed without the messages they quote, like starred
+// replies, still show what they quote
+func TestReplyPreviewsOfMessagesNotListed(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	c := "/conversations/" + conv
+
+	type quote struct{ id, text string }
+	quoted := map[string]quote{}
+	for _, question := range []string{"Lunch?", "Where?"} {
+		var msg, reply api.MessageResponse
+		alice.Call(http.MethodPost, c+"/messages", textMessage(question), &msg, http.StatusCreated)
+		answer := map[string]string{"contentType": "text", "text": "Re: " + question, "replyToMessageId": msg.ID}
+		bob.Call(http.MethodPost, c+"/messages", answer, &reply, http.StatusCreated)
+		alice.Call(http.MethodPut, c+"/messages/"+reply.ID+"/star", nil, nil, http.StatusNoContent)
+		quoted[reply.ID] = quote{msg.ID, question}
+	}
+
+	var starred api.StarredMessagesResponse
+	alice.Call(http.MethodGet, "/me/starred", nil, &starred, http.StatusOK)
+	if len(starred.Messages) != len(quoted) {
+		t.Fatalf("alice has %d starred messages, expected %d", len(starred.Messages), len(quoted))
+	}
+	for _, st := range starred.Messages {
+		m, want := st.Message, quoted[st.Message.ID]
+		if m.ReplyTo == nil || m.ReplyTo.ID != want.id || m.ReplyTo.Snippet == nil || *m.ReplyTo.Snippet != want.text {
+			t.Errorf("the starred reply %q quotes %+v, expected %q (%s)", text(m), m.ReplyTo, want.text, want.id)
+		}
+	}
+}
+
+// TestReadReceipts checks that reading a conversation marks the messages of the others as read, and tells their
+// senders
+func TestReadReceipts(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	aliceEvents := alice.Connect()
+
+	var ids []string
+	for _, text := range []string{"Are you there?", "Hello?"} {
+		var msg api.MessageResponse
+		alice.Call(http.MethodPost, "/conversations/"+conv+"/messages", textMessage(text), &msg, http.StatusCreated)
+		ids = append(ids, msg.ID)
+	}
+
+	bob.Call(http.MethodGet, "/conversations/"+conv, nil, nil, http.StatusOK)
+	var read struct {
+		ConversationID      string   `json:"conversationId"`
+		ReadByUserID        string   `json:"readByUserId"`
+		FullyReadMessageIDs []string `json:"fullyReadMessageIds"`
+	}
+	aliceEvents.Wait("messages_read").Decode(&read)
+	if read.ConversationID != conv || read.ReadByUserID != bob.ID {
+		t.Errorf("messages_read announced %s reading %s, expected bob reading %s", read.ReadByUserID,
+			read.ConversationID, conv)
+	}
+	for _, id := range ids {
+		if !contains(read.FullyReadMessageIDs, id) {
+			t.Errorf("messages_read doesn't list %s: %v", id, read.FullyReadMessageIDs)
+		}
+		if msg := getMessage(t, alice, conv, id); msg.Status != "read" {
+			t.Errorf("the message %s is %s, expected read", id, msg.Status)
+		}
+	}
+
+	var me api.MeResponse
+	bob.Call(http.MethodGet, "/me", nil, &me, http.StatusOK)
+	if me.UnreadCount != 0 {
+		t.Errorf("bob still has %d unread messages", me.UnreadCount)
+	}
+}
+
+// TestPhotoUpload checks that an uploaded photo is served, can be sent in its conversation only, and reaches the
+// other participant
+func TestPhotoUpload(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob, carol := s.Login("alice"), s.Login("bob"), s.Login("carol")
+	conv := startConversation(alice, bob)
+	bobEvents := bob.Connect()
+
+	c := "/conversations/" + conv
+	var uploaded struct {
+		PhotoURL string `json:"photoUrl"`
+	}
+	alice.Upload(http.MethodPost, c+"/photos", "photo", "beach.png", apitest.Photo(), nil, &uploaded, http.StatusOK)
+	if !strings.HasPrefix(uploaded.PhotoURL, "/uploads/messages/"+conv+"/") {
+		t.Fatalf("the photo was uploaded to %s", uploaded.PhotoURL)
+	}
+	if resp := bob.Do(http.MethodGet, uploaded.PhotoURL, nil); resp.Status != http.StatusOK ||
+		!bytes.Equal(resp.Body, apitest.Photo()) {
+		t.Errorf("GET %s: status %d, %d bytes", uploaded.PhotoURL, resp.Status, len(resp.Body))
+	}
+
+	photoMessage := map[string]string{"contentType": "photo", "photoUrl": uploaded.PhotoURL}
+	var sent api.MessageResponse
+	alice.Call(http.MethodPost, c+"/messages", photoMessage, &sent, http.StatusCreated)
+	if sent.ContentType != "photo" || sent.PhotoURL == nil || *sent.PhotoURL != uploaded.PhotoURL {
+		t.Errorf("sent a %s message, expected the photo %s", sent.ContentType, uploaded.PhotoURL)
+	}
+	bobEvents.WaitWith("new_message", "photoUrl", uploaded.PhotoURL)
+	var list []api.ConversationSummaryResponse
+	bob.Call(http.MethodGet, "/conversations", nil, &list, http.StatusOK)
+	if len(list) != 1 || !list[0].LastMessageIsPhoto {
+		t.Errorf("the %d conversations of bob don't show the photo as last message", len(list))
+	}
+
+	// The photos of a conversation can't be sent in another one
+	other := startConversation(alice, carol)
+	alice.Do(http.MethodPost, "/conversations/"+other+"/messages", photoMessage).
+		ExpectError(http.StatusBadRequest, "validation-failed", "photoUrl:invalid-upload")
+	alice.Upload(http.MethodPost, c+"/photos", "file", "beach.png", apitest.Photo(), nil, nil, http.StatusBadRequest)
+}
+
+// TestMessageOfAnotherConversation checks that a message can only be reacted to, deleted or forwarded through its own
+// conversation, by its participants, and that reactions are only announced to that conversation
+func TestMessageOfAnotherConversation(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob, carol := s.Login("alice"), s.Login("bob"), s.Login("carol")
+	withBob, withCarol := startConversation(alice, bob), startConversation(alice, carol)
+	bobEvents, carolEvents := bob.Connect(), carol.Connect()
+
+	// A message of alice and carol, which bob can't see
+	var msg api.MessageResponse
+	carol.Call(http.MethodPost, "/conversations/"+withCarol+"/messages", textMessage("Just us"), &msg, http.StatusCreated)
+	var reaction api.ReactionResponse
+	carol.Call(http.MethodPost, "/conversations/"+withCarol+"/messages/"+msg.ID+"/comments",
+		map[string]string{"emoji": "🤫"}, &reaction, http.StatusCreated)
+	carolEvents.WaitWith("reaction_added", "messageId", msg.ID)
+
+	paths := []struct {
+		name   string
+		caller *apitest.Client
+		path   string
+	}{
+		// alice is a participant of both conversations, but the message isn't in the first
+		{"wrong conversation", alice, "/conversations/" + withBob + "/messages/" + msg.ID},
+		{"wrong conversation, other participant", bob, "/conversations/" + withBob + "/messages/" + msg.ID},
+		{"not a participant", bob, "/conversations/" + withCarol + "/messages/" + msg.ID},
+	}
+	for _, p := range paths {
+		t.Run(p.name, func(t *testing.T) {
+			p.caller.Do(http.MethodPost, p.path+"/comments", map[string]string{"emoji": "👀"}).
+				ExpectError(http.StatusNotFound, "not-found")
+			p.caller.Do(http.MethodDelete, p.path+"/comments/"+reaction.ID, nil).
+				ExpectError(http.StatusNotFound, "not-found")
+			p.caller.Do(http.MethodDelete, p.path, nil).ExpectError(http.StatusNotFound, "not-found")
+			p.caller.Do(http.MethodPost, p.path+"/forward", map[string]string{"targetConversationId": withBob}).
+				ExpectError(http.StatusNotFound, "not-found")
+		})
+	}
+
+	// Nothing changed, and nothing was announced to bob
+	m := "/conversations/" + withCarol + "/messages/" + msg.ID
+	if got := getMessage(t, carol, withCarol, msg.ID); text(got) != "Just us" {
+		t.Errorf("the message is now %q", text(got))
+	}
+	expectReactions(t, carol, m, 1)
+	var conv api.ConversationResponse
+	bob.Call(http.MethodGet, "/conversations/"+withBob, nil, &conv, http.StatusOK)
+	if len(conv.Messages) != 0 {
+		t.Errorf("the conversation of alice and bob has %d messages, expected none", len(conv.Messages))
+	}
+
+	// A reaction in the conversation of the message only reaches its participants
+	alice.Call(http.MethodPost, m+"/comments", map[string]string{"emoji": "👍"}, nil, http.StatusCreated)
+	carolEvents.WaitWith("reaction_added", "messageId", msg.ID)
+	bobEvents.ExpectNone("reaction_added", quietPeriod)
+}
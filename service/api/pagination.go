@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// pageCursor encodes the position after the item with time `at` and ID `id` in a list ordered by time then ID
+func pageCursor(at, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(at + "|" + id))
+}
+
+// parsePage reads the ?limit= and ?cursor= parameters of a paginated list. limit is the page size (default 50, at
+// most 100); cursor is the nextCursor of the previous page, made by pageCursor. `at` and `id` are empty for the first
+// page.
+func parsePage(r *http.Request) (limit int, at, id string, reqErr *requestError) {
+	limit = defaultPageSize
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageSize {
+			return 0, "", "", newInvalidFieldError("limit", validation.CodeInvalidValue, "limit must be between 1 and 100")
+		}
+		limit = n
+	}
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return 0, "", "", newInvalidFieldError("cursor", validation.CodeInvalidFormat, "Invalid cursor")
+		}
+		var ok bool
+		at, id, ok = strings.Cut(string(data), "|")
+		if !ok || at == "" || id == "" {
+			return 0, "", "", newInvalidFieldError("cursor", validation.CodeInvalidFormat, "Invalid cursor")
+		}
+	}
+	return limit, at, id, nil
+}
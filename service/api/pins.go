@@ -0,0 +1,210 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+)
+
+// maxPinnedMessages is the number of messages that can be pinned in a conversation at the same time
+const maxPinnedMessages = 10
+
+// PinnedMessageResponse matches the PinnedMessage schema
+type PinnedMessageResponse struct {
+	Message  *ReplyPreviewResponse `json:"message"`
+	PinnedBy UserResponse          `json:"pinnedBy"`
+	PinnedAt string                `json:"pinnedAt"`
+}
+
+// pinnedMessageResponses returns the pinned messages of a conversation, the most recently pinned first
+func (rt *_router) pinnedMessageResponses(conversationID string) ([]PinnedMessageResponse, error) {
+	pins, err := rt.db.GetPinnedMessages(conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("getting pinned messages: %w", err)
+	}
+
+	messages := make(map[string]database.Message)
+	var userIDs []string
+	for _, p := range pins {
+		msg, err := rt.db.GetMessageByID(p.MessageID)
+		if err != nil {
+			return nil, fmt.Errorf("getting pinned message: %w", err)
+		}
+		if msg == nil {
+			continue
+		}
+		messages[p.MessageID] = *msg
+		userIDs = append(userIDs, msg.SenderID, p.PinnedBy)
+	}
+
+	users, err := rt.db.GetUsersByIDs(userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("getting users: %w", err)
+	}
+	userMap := make(map[string]database.User)
+	for _, u := range users {
+		userMap[u.ID] = u
+	}
+
+	now := globaltime.Now().UTC().Format("2006-01-02T15:04:05Z")
+	response := make([]PinnedMessageResponse, 0, len(messages))
+	for _, p := range pins {
+		msg, ok := messages[p.MessageID]
+		if !ok || isExpired(msg, now) {
+			continue
+		}
+		response = append(response, newPinnedMessageResponse(p, msg, userMap))
+	}
+	return response, nil
+}
+
+func newPinnedMessageResponse(pin database.PinnedMessage, msg database.Message, users map[string]database.User) PinnedMessageResponse {
+	pinnedBy := users[pin.PinnedBy]
+	return PinnedMessageResponse{
+		Message: newReplyPreview(msg, users[msg.SenderID]),
+		PinnedBy: UserResponse{
+			ID:          pinnedBy.ID,
+			Name:        pinnedBy.Name,
+			DisplayName: pinnedBy.DisplayName,
+			PhotoURL:    pinnedBy.PhotoURL,
+		},
+		PinnedAt: pin.PinnedAt,
+	}
+}
+
+// pinMessage handles PUT /conversations/{conversationId}/messages/{messageId}/pin
+// Conversations have no roles, so any participant may pin and unpin messages. Pinning a pinned message keeps the
+// original pin.
+func (rt *_router) pinMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	_, msg, err := rt.resolveMessage(user.ID, ps.ByName("conversationId"), ps.ByName("messageId"))
+	if err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+	if msg.ContentType == contentTypeSystem {
+		sendBadRequest(w, "System messages can't be pinned")
+		return
+	}
+
+	pin, err := rt.db.GetPinnedMessage(msg.ID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting pin")
+		sendInternalError(w, "Database error")
+		return
+	}
+	isNew := pin == nil
+	if isNew {
+		pin = &database.PinnedMessage{
+			MessageID:      msg.ID,
+			ConversationID: msg.ConversationID,
+			PinnedBy:       user.ID,
+			PinnedAt:       globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		}
+		ok, err := rt.db.PinMessage(*pin, maxPinnedMessages)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("error pinning message")
+			sendInternalError(w, "Error pinning message")
+			return
+		}
+		if !ok {
+			sendError(w, http.StatusConflict, codePinLimitReached, fmt.Sprintf("At most %d messages can be pinned in a conversation", maxPinnedMessages))
+			return
+		}
+	}
+
+	users, err := rt.db.GetUsersByIDs([]string{msg.SenderID, pin.PinnedBy})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting users")
+		sendInternalError(w, "Database error")
+		return
+	}
+	userMap := make(map[string]database.User)
+	for _, u := range users {
+		userMap[u.ID] = u
+	}
+	response := newPinnedMessageResponse(*pin, *msg, userMap)
+
+	if isNew {
+		participants, err := rt.db.GetParticipants(msg.ConversationID)
+		if err == nil {
+			var participantIDs []string
+			for _, p := range participants {
+				participantIDs = append(participantIDs, p.ID)
+			}
+			// Participants who blocked the pinner are left out, and so are those who blocked the sender of the message the
+			// pin shows, as for the message itself
+			participantIDs = rt.withoutBlockersOf(ctx.Logger, user.ID, participantIDs)
+			participantIDs = rt.withoutBlockersOf(ctx.Logger, msg.SenderID, participantIDs)
+			rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
+				Type: "message_pinned",
+				Payload: map[string]interface{}{
+					"conversationId": msg.ConversationID,
+					"pin":            response,
+				},
+			})
+		}
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// unpinMessage handles DELETE /conversations/{conversationId}/messages/{messageId}/pin
+func (rt *_router) unpinMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	_, msg, err := rt.resolveMessage(user.ID, ps.ByName("conversationId"), ps.ByName("messageId"))
+	if err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	pin, err := rt.db.GetPinnedMessage(msg.ID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting pin")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if pin == nil {
+		sendNotFound(w, "Message is not pinned")
+		return
+	}
+
+	if err := rt.db.UnpinMessage(msg.ID); err != nil {
+		ctx.Logger.WithError(err).Error("error unpinning message")
+		sendInternalError(w, "Error unpinning message")
+		return
+	}
+
+	participants, err := rt.db.GetParticipants(msg.ConversationID)
+	if err == nil {
+		var participantIDs []string
+		for _, p := range participants {
+			participantIDs = append(participantIDs, p.ID)
+		}
+		participantIDs = rt.withoutBlockersOf(ctx.Logger, user.ID, participantIDs)
+		rt.wsHub.BroadcastToUsers(participantIDs, WebSocketMessage{
+			Type: "message_unpinned",
+			Payload: map[string]interface{}{
+				"conversationId": msg.ConversationID,
+				"messageId":      msg.ID,
+				"unpinnedBy":     user.ID,
+			},
+		})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,97 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+)
+
+// TestPinnedMessages checks that any member of a group can pin and unpin messages, up to the limit, that pins are
+// listed with the conversation and announced
+func TestPinnedMessages(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob, carol, dave := s.Login("alice"), s.Login("bob"), s.Login("carol"), s.Login("dave")
+	var group api.GroupResponse
+	create := map[string]interface{}{"name": "Crag", "memberIds": []string{bob.ID, carol.ID}}
+	alice.Call(http.MethodPost, "/groups", create, &group, http.StatusCreated)
+	c := "/conversations/" + group.ID
+	bobEvents, carolEvents := bob.Connect(), carol.Connect()
+
+	messages := make([]api.MessageResponse, 11)
+	for i := range messages {
+		alice.Call(http.MethodPost, c+"/messages", textMessage(fmt.Sprintf("Note %d", i)), &messages[i],
+			http.StatusCreated)
+	}
+	pin := func(by *apitest.Client, msg api.MessageResponse) *apitest.Response {
+		return by.Do(http.MethodPut, c+"/messages/"+msg.ID+"/pin", nil)
+	}
+
+	// Members who didn't create the group pin as well
+	var pinned api.PinnedMessageResponse
+	pin(bob, messages[0]).Expect(http.StatusOK, &pinned)
+	if pinned.Message == nil || pinned.Message.ID != messages[0].ID || pinned.PinnedBy.ID != bob.ID ||
+		pinned.PinnedAt != timestamp(s.Now()) {
+		t.Errorf("pinned %+v by %s at %s, expected %s by bob now", pinned.Message, pinned.PinnedBy.Name,
+			pinned.PinnedAt, messages[0].ID)
+	}
+	var announced struct {
+		ConversationID string                    `json:"conversationId"`
+		Pin            api.PinnedMessageResponse `json:"pin"`
+	}
+	carolEvents.Wait("message_pinned").Decode(&announced)
+	if announced.ConversationID != group.ID || announced.Pin.Message == nil ||
+		announced.Pin.Message.ID != messages[0].ID {
+		t.Errorf("message_pinned announced %+v in %s, expected %s", announced.Pin.Message, announced.ConversationID,
+			messages[0].ID)
+	}
+
+	// Pinning again keeps the original pin
+	pin(alice, messages[0]).Expect(http.StatusOK, &pinned)
+	if pinned.PinnedBy.ID != bob.ID {
+		t.Errorf("pinning again recorded %s as the pinner, expected bob", pinned.PinnedBy.Name)
+	}
+	carolEvents.ExpectNone("message_pinned", quietPeriod)
+
+	for _, msg := range messages[1:10] {
+		pin(alice, msg).Expect(http.StatusOK, nil)
+	}
+	pin(alice, messages[10]).ExpectError(http.StatusConflict, "pin-limit-reached")
+
+	var conv api.ConversationResponse
+	bob.Call(http.MethodGet, c, nil, &conv, http.StatusOK)
+	if len(conv.PinnedMessages) != 10 || conv.PinnedMessages[0].Message.ID != messages[9].ID ||
+		conv.PinnedMessages[9].Message.ID != messages[0].ID {
+		t.Fatalf("the conversation lists %d pinned messages, expected 10, the most recently pinned first",
+			len(conv.PinnedMessages))
+	}
+
+	carol.Call(http.MethodDelete, c+"/messages/"+messages[0].ID+"/pin", nil, nil, http.StatusNoContent)
+	var unpinned struct {
+		UnpinnedBy string `json:"unpinnedBy"`
+	}
+	bobEvents.WaitWith("message_unpinned", "messageId", messages[0].ID).Decode(&unpinned)
+	if unpinned.UnpinnedBy != carol.ID {
+		t.Errorf("message_unpinned announced %s as the unpinner, expected carol", unpinned.UnpinnedBy)
+	}
+	pin(alice, messages[10]).Expect(http.StatusOK, nil)
+
+	carol.Do(http.MethodDelete, c+"/messages/"+messages[0].ID+"/pin", nil).ExpectError(http.StatusNotFound, "not-found")
+	pin(dave, messages[1]).ExpectError(http.StatusNotFound, "not-found")
+}
+
+// TestPinSystemMessage checks that the messages posted by the server can't be pinned
+func TestPinSystemMessage(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	bobEvents := bob.Connect()
+
+	setDisappearing(alice, conv, 3600, "")
+	var notice api.MessageResponse
+	bobEvents.Wait("new_message").Decode(&notice)
+	bob.Do(http.MethodPut, "/conversations/"+conv+"/messages/"+notice.ID+"/pin", nil).
+		ExpectError(http.StatusBadRequest, "bad-request")
+}
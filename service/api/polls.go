@@ -0,0 +1,313 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+	"github.com/sirupsen/logrus"
+)
+
+// Poll limits; the lengths of the question and options are in validation.Limits
+const (
+	minPollOptions = 2
+	maxPollOptions = 12
+)
+
+// ============================================================================
+// POLL REQUEST / RESPONSE TYPES
+// ============================================================================
+
+// PollRequest matches the PollRequest schema: the poll part of a SendMessageRequest with contentType "poll"
+type PollRequest struct {
+	Question       string   `json:"question"`
+	Options        []string `json:"options"`
+	MultipleChoice bool     `json:"multipleChoice"`
+	Anonymous      bool     `json:"anonymous"`
+	ClosesAt       *string  `json:"closesAt,omitempty"`
+}
+
+// PollOptionResponse matches the PollOption schema
+type PollOptionResponse struct {
+	ID        string         `json:"id"`
+	Text      string         `json:"text"`
+	VoteCount int            `json:"voteCount"`
+	VotedByMe bool           `json:"votedByMe"`
+	Voters    []UserResponse `json:"voters,omitempty"`
+}
+
+// PollResponse matches the Poll schema. Voters are listed only for polls that are not anonymous.
+type PollResponse struct {
+	Question       string               `json:"question"`
+	Options        []PollOptionResponse `json:"options"`
+	MultipleChoice bool                 `json:"multipleChoice"`
+	Anonymous      bool                 `json:"anonymous"`
+	ClosesAt       *string              `json:"closesAt,omitempty"`
+	Closed         bool                 `json:"closed"`
+	TotalVoters    int                  `json:"totalVoters"`
+}
+
+// ============================================================================
+// POLL HELPERS
+// ============================================================================
+
+// newPoll validates a PollRequest and turns it into a database.Poll, generating the option IDs
+func newPoll(req *PollRequest, limits validation.Limits) (*database.Poll, error) {
+	if req == nil {
+		return nil, newInvalidFieldError("poll", validation.CodeRequired, "poll is required for poll messages")
+	}
+
+	question, err := validation.Paragraph("poll.question", req.Question, limits.PollQuestion)
+	if err != nil {
+		return nil, newFieldError(err)
+	}
+	if len(req.Options) < minPollOptions || len(req.Options) > maxPollOptions {
+		return nil, newInvalidFieldError("poll.options", validation.CodeInvalidValue, "polls must have between 2 and 12 options")
+	}
+
+	poll := &database.Poll{
+		Question:       question,
+		MultipleChoice: req.MultipleChoice,
+		Anonymous:      req.Anonymous,
+	}
+
+	seen := make(map[string]bool)
+	for i, text := range req.Options {
+		text, err := validation.Line(fmt.Sprintf("poll.options[%d]", i), text, limits.PollOption)
+		if err != nil {
+			return nil, newFieldError(err)
+		}
+		if seen[text] {
+			return nil, newInvalidFieldError("poll.options", validation.CodeInvalidValue, "poll options must be unique")
+		}
+		seen[text] = true
+
+		optionID, _ := uuid.NewV4()
+		poll.Options = append(poll.Options, database.PollOption{
+			ID:       optionID.String(),
+			Position: i,
+			Text:     text,
+		})
+	}
+
+	if req.ClosesAt != nil {
+		closesAt, err := time.Parse(time.RFC3339, *req.ClosesAt)
+		if err != nil {
+			return nil, newInvalidFieldError("poll.closesAt", validation.CodeInvalidFormat, "closesAt must be an RFC 3339 date-time")
+		}
+		if !closesAt.After(globaltime.Now()) {
+			return nil, newInvalidFieldError("poll.closesAt", validation.CodeInvalidValue, "closesAt must be in the future")
+		}
+		formatted := closesAt.UTC().Format("2006-01-02T15:04:05Z")
+		poll.ClosesAt = &formatted
+	}
+
+	return poll, nil
+}
+
+// pollClosed reports whether the poll close time has passed
+func pollClosed(poll database.Poll) bool {
+	if poll.ClosesAt == nil {
+		return false
+	}
+	closesAt, err := time.Parse(time.RFC3339, *poll.ClosesAt)
+	return err == nil && !globaltime.Now().Before(closesAt)
+}
+
+// buildPollResponse aggregates the votes of a poll as seen by `viewerID`. `userMap` must contain the voters.
+func buildPollResponse(poll database.Poll, votes []database.PollVote, viewerID string, userMap map[string]database.User) PollResponse {
+	votesByOption := make(map[string][]database.PollVote)
+	voters := make(map[string]bool)
+	for _, v := range votes {
+		votesByOption[v.OptionID] = append(votesByOption[v.OptionID], v)
+		voters[v.UserID] = true
+	}
+
+	options := make([]PollOptionResponse, 0, len(poll.Options))
+	for _, o := range poll.Options {
+		option := PollOptionResponse{
+			ID:        o.ID,
+			Text:      o.Text,
+			VoteCount: len(votesByOption[o.ID]),
+		}
+		for _, v := range votesByOption[o.ID] {
+			if v.UserID == viewerID {
+				option.VotedByMe = true
+			}
+			if !poll.Anonymous {
+				voter := userMap[v.UserID]
+				option.Voters = append(option.Voters, UserResponse{
+					ID:          voter.ID,
+					Name:        voter.Name,
+					DisplayName: voter.DisplayName,
+					PhotoURL:    voter.PhotoURL,
+				})
+			}
+		}
+		options = append(options, option)
+	}
+
+	return PollResponse{
+		Question:       poll.Question,
+		Options:        options,
+		MultipleChoice: poll.MultipleChoice,
+		Anonymous:      poll.Anonymous,
+		ClosesAt:       poll.ClosesAt,
+		Closed:         pollClosed(poll),
+		TotalVoters:    len(voters),
+	}
+}
+
+// broadcastPollUpdate sends the current results of a poll to every participant as a "poll_updated" event, except
+// those who blocked `voterID`. Each participant gets their own view of the results (votedByMe).
+func (rt *_router) broadcastPollUpdate(logger logrus.FieldLogger, voterID string, msg *database.Message, poll database.Poll) {
+	votes, err := rt.db.GetPollVotes(msg.ID)
+	if err != nil {
+		logger.WithError(err).Warn("error fetching poll votes for broadcast")
+		return
+	}
+	participants, err := rt.db.GetParticipants(msg.ConversationID)
+	if err != nil {
+		logger.WithError(err).Warn("error getting participants for broadcast")
+		return
+	}
+
+	var voterIDs []string
+	for _, v := range votes {
+		voterIDs = append(voterIDs, v.UserID)
+	}
+	voters, err := rt.db.GetUsersByIDs(voterIDs)
+	if err != nil {
+		logger.WithError(err).Warn("error fetching voters in batch")
+		voters = []database.User{}
+	}
+	userMap := make(map[string]database.User)
+	for _, u := range voters {
+		userMap[u.ID] = u
+	}
+
+	blockers := rt.blockedBy(logger, voterID)
+	for _, p := range participants {
+		if blockers[p.ID] {
+			continue
+		}
+		go func(uid string) {
+			_ = rt.wsHub.SendToUser(uid, WebSocketMessage{
+				Type: "poll_updated",
+				Payload: map[string]interface{}{
+					"conversationId": msg.ConversationID,
+					"messageId":      msg.ID,
+					"poll":           buildPollResponse(poll, votes, uid, userMap),
+				},
+			})
+		}(p.ID)
+	}
+}
+
+// ============================================================================
+// POLL ENDPOINTS
+// ============================================================================
+
+// votePoll handles PUT /conversations/{conversationId}/messages/{messageId}/poll/votes/{optionId}
+// In single-choice polls the vote replaces the user's previous one
+func (rt *_router) votePoll(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changePollVote(w, r, ps, ctx, true)
+}
+
+// unvotePoll handles DELETE /conversations/{conversationId}/messages/{messageId}/poll/votes/{optionId}
+func (rt *_router) unvotePoll(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changePollVote(w, r, ps, ctx, false)
+}
+
+// changePollVote adds or removes the current user's vote for a poll option and answers with the updated results
+func (rt *_router) changePollVote(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, vote bool) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+	messageID := ps.ByName("messageId")
+	optionID := ps.ByName("optionId")
+
+	_, msg, err := rt.resolveMessage(user.ID, conversationID, messageID)
+	if err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	poll, err := rt.db.GetPoll(messageID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if poll == nil {
+		sendNotFound(w, "This message is not a poll")
+		return
+	}
+
+	validOption := false
+	for _, o := range poll.Options {
+		if o.ID == optionID {
+			validOption = true
+			break
+		}
+	}
+	if !validOption {
+		sendNotFound(w, "Poll option not found")
+		return
+	}
+
+	if pollClosed(*poll) {
+		sendError(w, http.StatusConflict, codePollClosed, "The poll is closed")
+		return
+	}
+
+	if vote {
+		err = rt.db.AddPollVote(database.PollVote{
+			MessageID: messageID,
+			OptionID:  optionID,
+			UserID:    user.ID,
+			CreatedAt: globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		}, !poll.MultipleChoice)
+	} else {
+		err = rt.db.RemovePollVote(messageID, optionID, user.ID)
+	}
+	if err != nil {
+		ctx.Logger.WithError(err).Error("error updating poll vote")
+		sendInternalError(w, "Error updating vote")
+		return
+	}
+
+	rt.broadcastPollUpdate(ctx.Logger, user.ID, msg, *poll)
+
+	votes, err := rt.db.GetPollVotes(messageID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting votes")
+		sendInternalError(w, "Database error")
+		return
+	}
+	var voterIDs []string
+	for _, v := range votes {
+		voterIDs = append(voterIDs, v.UserID)
+	}
+	voters, err := rt.db.GetUsersByIDs(voterIDs)
+	if err != nil {
+		ctx.Logger.WithError(err).Warn("error fetching voters in batch")
+		voters = []database.User{}
+	}
+	userMap := make(map[string]database.User)
+	for _, u := range voters {
+		userMap[u.ID] = u
+	}
+
+	sendJSON(w, http.StatusOK, buildPollResponse(*poll, votes, user.ID, userMap))
+}
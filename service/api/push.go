@@ -0,0 +1,289 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+	"github.com/ozberk-sevinc/wasa-project/service/webpush"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxPushEndpointLength bounds the endpoint of push subscriptions; real endpoints are a few hundred characters
+	maxPushEndpointLength = 2048
+
+	// maxPushBodyLength is the number of characters of a message shown in a push notification
+	maxPushBodyLength = 200
+)
+
+// PushSubscriptionRequest matches the PushSubscriptionRequest schema: the body of POST /me/push-subscriptions, as given
+// by PushSubscription.toJSON() in the browser
+type PushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// PushSubscriptionResponse matches the PushSubscription schema; the keys are not sent back
+type PushSubscriptionResponse struct {
+	ID        string `json:"id"`
+	Endpoint  string `json:"endpoint"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// PushNotification is the payload of push notifications, read by the service worker of the web UI
+type PushNotification struct {
+	Type           string `json:"type"`
+	ConversationID string `json:"conversationId"`
+	MessageID      string `json:"messageId"`
+	Title          string `json:"title"`
+	Body           string `json:"body,omitempty"`
+}
+
+func newPushSubscriptionResponse(s database.PushSubscription) PushSubscriptionResponse {
+	return PushSubscriptionResponse{ID: s.ID, Endpoint: s.Endpoint, CreatedAt: s.CreatedAt}
+}
+
+// getVAPIDPublicKey handles GET /push/vapid-public-key
+// Browsers need the key to subscribe (applicationServerKey). It is 404 when push notifications are disabled.
+func (rt *_router) getVAPIDPublicKey(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	if rt.push == nil {
+		sendNotFound(w, "Push notifications are disabled")
+		return
+	}
+	sendJSON(w, http.StatusOK, map[string]string{"publicKey": rt.push.PublicKey()})
+}
+
+// createPushSubscription handles POST /me/push-subscriptions
+// Subscribing again with the same endpoint updates the subscription, which moves to the current user if the browser
+// was subscribed for someone else.
+func (rt *_router) createPushSubscription(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	var req PushSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendInvalidJSON(w)
+		return
+	}
+	if len(req.Endpoint) > maxPushEndpointLength {
+		sendFieldError(w, "endpoint", validation.CodeTooLong, "Endpoint is too long")
+		return
+	}
+	sub := webpush.Subscription{Endpoint: req.Endpoint, P256dh: req.Keys.P256dh, Auth: req.Keys.Auth}
+	if err := webpush.ValidateSubscription(sub); err != nil {
+		sendBadRequest(w, "Invalid subscription: "+err.Error())
+		return
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		sendInternalError(w, "Error generating ID")
+		return
+	}
+	stored, err := rt.db.SavePushSubscription(database.PushSubscription{
+		ID:        id.String(),
+		UserID:    user.ID,
+		Endpoint:  sub.Endpoint,
+		P256dh:    sub.P256dh,
+		Auth:      sub.Auth,
+		CreatedAt: globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("error saving push subscription")
+		sendInternalError(w, "Error saving push subscription")
+		return
+	}
+
+	status := http.StatusOK
+	if stored.ID == id.String() {
+		status = http.StatusCreated
+	}
+	sendJSON(w, status, newPushSubscriptionResponse(*stored))
+}
+
+// listPushSubscriptions handles GET /me/push-subscriptions
+func (rt *_router) listPushSubscriptions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	subscriptions, err := rt.db.GetPushSubscriptions(user.ID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting push subscriptions")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	response := make([]PushSubscriptionResponse, 0, len(subscriptions))
+	for _, s := range subscriptions {
+		response = append(response, newPushSubscriptionResponse(s))
+	}
+	sendJSON(w, http.StatusOK, response)
+}
+
+// deletePushSubscription handles DELETE /me/push-subscriptions/{subscriptionId}
+func (rt *_router) deletePushSubscription(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	sub, err := rt.db.GetPushSubscription(ps.ByName("subscriptionId"))
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting push subscription")
+		sendInternalError(w, "Database error")
+		return
+	}
+	if sub == nil || sub.UserID != user.ID {
+		sendNotFound(w, "Push subscription not found")
+		return
+	}
+
+	if err := rt.db.DeletePushSubscription(sub.ID); err != nil {
+		ctx.Logger.WithError(err).Error("error deleting push subscription")
+		sendInternalError(w, "Error deleting push subscription")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pushBody is the text of a message shown in its push notification
+func pushBody(message MessageResponse) string {
+	var body string
+	switch {
+	case message.ContentType == contentTypePoll && message.Text != nil:
+		body = "Poll: " + *message.Text
+	case message.ContentType == contentTypePhoto:
+		body = "Photo"
+		if message.Text != nil && *message.Text != "" {
+			body += ": " + *message.Text
+		}
+	case message.Text != nil:
+		body = *message.Text
+	}
+	if utf8.RuneCountInString(body) > maxPushBodyLength {
+		body = string([]rune(body)[:maxPushBodyLength-1]) + "…"
+	}
+	return body
+}
+
+// pushNotificationFor returns the notification of a new message. Users who turned off previews only learn that there
+// is a new message.
+func pushNotificationFor(message MessageResponse, conv *database.Conversation, prefs database.UserPreferences) PushNotification {
+	n := PushNotification{
+		Type:           "new_message",
+		ConversationID: message.ConversationID,
+		MessageID:      message.ID,
+		Title:          "New message",
+	}
+	if !prefs.PushPreviews {
+		return n
+	}
+	n.Title = message.Sender.Name
+	if message.Sender.DisplayName != nil && *message.Sender.DisplayName != "" {
+		n.Title = *message.Sender.DisplayName
+	}
+	if conv != nil && conv.Type == "group" {
+		n.Title += " in " + conv.Name
+	}
+	n.Body = pushBody(message)
+	return n
+}
+
+// pushNewMessage sends a push notification of a new message to the participants who are offline, that is who have
+// no WebSocket connection. Users who turned push notifications off are skipped, and so are those who muted the
+// conversation unless they are mentioned. The notifications are sent in the background.
+func (rt *_router) pushNewMessage(logger logrus.FieldLogger, message MessageResponse, mentions []database.Mention, participantIDs []string) {
+	if rt.push == nil || message.ContentType == contentTypeSystem {
+		return
+	}
+
+	conv, err := rt.db.GetConversationByID(message.ConversationID)
+	if err != nil {
+		logger.WithError(err).Warn("error getting conversation for push notifications")
+		return
+	}
+	mentioned := mentionedUserIDs(message.Sender.ID, mentions, participantIDs)
+	now := globaltime.Now().UTC().Format("2006-01-02T15:04:05Z")
+
+	notifications := make(map[string]PushNotification)
+	for _, userID := range participantIDs {
+		if userID == message.Sender.ID || rt.wsHub.IsConnected(userID) {
+			continue
+		}
+		prefs, err := rt.db.GetUserPreferences(userID)
+		if err != nil || prefs == nil || !prefs.PushNotifications {
+			if err != nil {
+				logger.WithError(err).Warn("error getting preferences for push notifications")
+			}
+			continue
+		}
+		state, err := rt.db.GetConversationState(message.ConversationID, userID)
+		if err != nil {
+			logger.WithError(err).Warn("error getting conversation state for push notifications")
+			continue
+		}
+		if state != nil && state.MutedUntil != nil && *state.MutedUntil > now && !mentioned[userID] {
+			continue
+		}
+		notifications[userID] = pushNotificationFor(message, conv, *prefs)
+	}
+	if len(notifications) == 0 {
+		return
+	}
+
+	rt.goBackground(func() {
+		ctx, cancel := rt.backgroundContext()
+		defer cancel()
+		for userID, n := range notifications {
+			rt.sendPushNotification(ctx, logger.WithField("userId", userID), userID, n)
+		}
+	})
+}
+
+// sendPushNotification sends a notification to every push subscription of a user, deleting the subscriptions the
+// push service no longer knows
+func (rt *_router) sendPushNotification(ctx context.Context, logger logrus.FieldLogger, userID string, n PushNotification) {
+	subscriptions, err := rt.db.GetPushSubscriptions(userID)
+	if err != nil {
+		logger.WithError(err).Warn("error getting push subscriptions")
+		return
+	}
+	payload, err := json.Marshal(n)
+	if err != nil {
+		logger.WithError(err).Error("error encoding push notification")
+		return
+	}
+
+	for _, s := range subscriptions {
+		err := rt.push.Send(ctx, webpush.Subscription{Endpoint: s.Endpoint, P256dh: s.P256dh, Auth: s.Auth}, payload, webpush.DefaultTTL)
+		switch {
+		case errors.Is(err, webpush.ErrGone):
+			logger.WithField("subscriptionId", s.ID).Info("push subscription gone, deleting it")
+			if err := rt.db.DeletePushSubscriptionByEndpoint(s.Endpoint); err != nil {
+				logger.WithError(err).Warn("error deleting push subscription")
+			}
+		case err != nil:
+			logger.WithError(err).WithField("subscriptionId", s.ID).Warn("error sending push notification")
+		}
+	}
+}
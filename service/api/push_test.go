@@ -0,0 +1,113 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+	"github.com/ozberk-sevinc/wasa-project/service/webpush"
+)
+
+// startPush starts a server sending its push notifications to a local push service
+func startPush(t *testing.T) (*apitest.Server, *apitest.PushService) {
+	t.Helper()
+	service := apitest.StartPushService(t)
+	s := apitest.Start(t, apitest.Options{
+		Configure: func(cfg *api.Config) error {
+			key, err := webpush.LoadOrCreateKey("vapid.pem")
+			if err != nil {
+				return err
+			}
+			cfg.Push, err = webpush.NewSender(webpush.Config{
+				Key:             key,
+				Subject:         "mailto:test@example.com",
+				AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+			})
+			return err
+		},
+	})
+	return s, service
+}
+
+// TestPushNotification checks that offline participants get an encrypted notification of new messages, and online
+// ones don't
+func TestPushNotification(t *testing.T) {
+	s, service := startPush(t)
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	sub := service.Subscribe()
+	bob.Call(http.MethodPost, "/me/push-subscriptions", sub, nil, http.StatusCreated)
+
+	var sent api.MessageResponse
+	alice.Call(http.MethodPost, "/conversations/"+conv+"/messages", textMessage("Call me back"), &sent,
+		http.StatusCreated)
+	push := service.Wait()
+	var n api.PushNotification
+	if err := json.Unmarshal(push.Payload, &n); err != nil {
+		t.Fatalf("decoding the notification: %v", err)
+	}
+	if push.Endpoint != sub.Endpoint || n.Type != "new_message" || n.ConversationID != conv || n.MessageID != sent.ID ||
+		n.Title != "alice" || n.Body != "Call me back" {
+		t.Errorf("the notification to %s is %+v", push.Endpoint, n)
+	}
+	if push.Header.Get("TTL") == "" {
+		t.Error("the notification has no TTL")
+	}
+
+	// Online users see the message on their WebSocket instead; the sender never gets a notification
+	bobEvents := bob.Connect()
+	alice.Call(http.MethodPost, "/conversations/"+conv+"/messages", textMessage("Are you there?"), &sent,
+		http.StatusCreated)
+	bobEvents.WaitWith("new_message", "id", sent.ID)
+	service.ExpectNone(quietPeriod)
+}
+
+// TestPushForwardedMessage checks that offline participants are notified of forwarded messages too
+func TestPushForwardedMessage(t *testing.T) {
+	s, service := startPush(t)
+	alice, bob, carol := s.Login("alice"), s.Login("bob"), s.Login("carol")
+	direct, target := startConversation(bob, alice), startConversation(alice, carol)
+	sub := service.Subscribe()
+	carol.Call(http.MethodPost, "/me/push-subscriptions", sub, nil, http.StatusCreated)
+
+	var original, forwarded api.MessageResponse
+	bob.Call(http.MethodPost, "/conversations/"+direct+"/messages", textMessage("Party on Friday"), &original,
+		http.StatusCreated)
+	alice.Call(http.MethodPost, "/conversations/"+direct+"/messages/"+original.ID+"/forward",
+		map[string]string{"targetConversationId": target}, &forwarded, http.StatusCreated)
+	push := service.Wait()
+	var n api.PushNotification
+	if err := json.Unmarshal(push.Payload, &n); err != nil {
+		t.Fatalf("decoding the notification: %v", err)
+	}
+	if push.Endpoint != sub.Endpoint || n.ConversationID != target || n.MessageID != forwarded.ID ||
+		n.Body != "Party on Friday" {
+		t.Errorf("the notification to %s is %+v, expected the forward %s", push.Endpoint, n, forwarded.ID)
+	}
+}
+
+// TestPushSubscriptionGone checks that the subscriptions the push service no longer knows are deleted
+func TestPushSubscriptionGone(t *testing.T) {
+	s, service := startPush(t)
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	sub := service.Subscribe()
+	bob.Call(http.MethodPost, "/me/push-subscriptions", sub, nil, http.StatusCreated)
+	service.Expire(sub)
+
+	alice.Call(http.MethodPost, "/conversations/"+conv+"/messages", textMessage("Hello?"), nil, http.StatusCreated)
+	var list []api.PushSubscriptionResponse
+	for deadline := time.Now().Add(apitest.EventTimeout); ; time.Sleep(20 * time.Millisecond) {
+		bob.Call(http.MethodGet, "/me/push-subscriptions", nil, &list, http.StatusOK)
+		if len(list) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the expired subscription was not deleted")
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/ozberk-sevinc/wasa-project/service/ratelimit"
+)
+
+// Route classes sharing rate limits: the requests of all the routes of a class count together
+const (
+	rateLimitLogin   = "login"
+	rateLimitMessage = "message"
+	rateLimitUpload  = "upload"
+	rateLimitSearch  = "search"
+)
+
+// RateLimits configures the rate limits of each route class
+type RateLimits struct {
+	// Store keeps the buckets: a ratelimit.MemoryStore for a single server, or a store shared by the replicas
+	Store ratelimit.Store
+
+	Login   ratelimit.Rule
+	Message ratelimit.Rule
+	Upload  ratelimit.Rule
+	Search  ratelimit.Rule
+
+	// ClientIPHeader is the header where a reverse proxy puts the address of the client, like X-Forwarded-For or
+	// X-Real-IP; its last address is used. The address of the connection is used when it is empty, which is the only
+	// safe choice when clients can reach the server directly.
+	ClientIPHeader string
+}
+
+// rateLimited applies the rate limits of a route class to a handler: per client address, and per user for
+// authenticated routes. Requests over a limit get a 429 response with Retry-After.
+func (rt *_router) rateLimited(class string, fn httpRouterHandler) httpRouterHandler {
+	if rt.rateLimiter == nil {
+		return fn
+	}
+	rule := rt.rateLimitRules[class]
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+		now := globaltime.Now()
+		wait, err := rt.rateLimiter.Allow(class+":ip:"+rt.clientAddress(r), rule.PerIP, now)
+		if err == nil && wait == 0 {
+			if user := GetUserFromContext(r.Context()); user != nil {
+				wait, err = rt.rateLimiter.Allow(class+":user:"+user.ID, rule.PerUser, now)
+			}
+		}
+		if err != nil {
+			// A store that is not available does not take the API down with it
+			ctx.Logger.WithError(err).Error("error checking rate limit")
+		} else if wait > 0 {
+			ctx.Logger.WithField("class", class).Warn("rate limit exceeded")
+			sendTooManyRequests(w, wait)
+			return
+		}
+		fn(w, r, ps, ctx)
+	}
+}
+
+// clientAddress returns the address the rate limits of a request count for: the IP address of the client, with IPv6
+// addresses reduced to their /64 network, which usually belongs to a single client
+func (rt *_router) clientAddress(r *http.Request) string {
+	addr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if rt.clientIPHeader != "" {
+		if v := r.Header.Get(rt.clientIPHeader); v != "" {
+			// Proxies append the address they see to the ones sent by the client
+			parts := strings.Split(v, ",")
+			addr = strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return addr
+	}
+	ip = ip.Unmap()
+	if ip.Is6() {
+		prefix, err := ip.Prefix(64)
+		if err == nil {
+			return prefix.String()
+		}
+	}
+	return ip.String()
+}
@@ -0,0 +1,102 @@
+package api_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+	"github.com/ozberk-sevinc/wasa-project/service/ratelimit"
+)
+
+// expectRateLimited checks that a request was refused by a rate limit, and returns how long it asks to wait
+func expectRateLimited(t *testing.T, resp *apitest.Response) time.Duration {
+	t.Helper()
+	resp.ExpectError(http.StatusTooManyRequests, "too-many-requests")
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		t.Fatalf("Retry-After is %q, expected a number of seconds", resp.Header.Get("Retry-After"))
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// TestRateLimitPerUser checks that a user over the message limit gets a 429 with Retry-After, can send again once
+// it passed, and doesn't use up the limit of the other users
+func TestRateLimitPerUser(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{
+		Configure: func(cfg *api.Config) error {
+			cfg.RateLimits = api.RateLimits{
+				Store:   ratelimit.NewMemoryStore(),
+				Message: ratelimit.Rule{PerUser: ratelimit.Limit{Burst: 2, Every: time.Minute}},
+			}
+			return nil
+		},
+	})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	c := "/conversations/" + startConversation(alice, bob) + "/messages"
+
+	alice.Call(http.MethodPost, c, textMessage("One"), nil, http.StatusCreated)
+	alice.Call(http.MethodPost, c, textMessage("Two"), nil, http.StatusCreated)
+	retryAfter := expectRateLimited(t, alice.Do(http.MethodPost, c, textMessage("Three")))
+	if retryAfter > time.Minute {
+		t.Errorf("Retry-After is %s, expected at most the minute of the next request", retryAfter)
+	}
+
+	// The other routes of the class count together
+	var msg api.MessageResponse
+	bob.Call(http.MethodPost, c, textMessage("Hi"), &msg, http.StatusCreated)
+	expectRateLimited(t, alice.Do(http.MethodPost, c+"/"+msg.ID+"/comments", map[string]string{"emoji": "\U0001F44D"}))
+
+	// Bob's limit is his own, and one request a minute is allowed again
+	bob.Call(http.MethodPost, c, textMessage("Still here"), nil, http.StatusCreated)
+	s.Advance(retryAfter)
+	alice.Call(http.MethodPost, c, textMessage("Three"), nil, http.StatusCreated)
+	expectRateLimited(t, alice.Do(http.MethodPost, c, textMessage("Four")))
+}
+
+// TestRateLimitPerIP checks that the limits per address count the requests of every user, and of nobody, from the
+// same client address
+func TestRateLimitPerIP(t *testing.T) {
+	// Carol connects through a proxy from another address
+	var carolToken string
+	s := apitest.Start(t, apitest.Options{
+		Configure: func(cfg *api.Config) error {
+			cfg.RateLimits = api.RateLimits{
+				Store:          ratelimit.NewMemoryStore(),
+				Login:          ratelimit.Rule{PerIP: ratelimit.Limit{Burst: 3, Every: time.Hour}},
+				Search:         ratelimit.Rule{PerIP: ratelimit.Limit{Burst: 2, Every: time.Hour}},
+				ClientIPHeader: "X-Forwarded-For",
+			}
+			return nil
+		},
+		Wrap: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				address := "198.51.100.1"
+				if carolToken != "" && r.Header.Get("Authorization") == "Bearer "+carolToken {
+					address = "198.51.100.2"
+				}
+				r.Header.Set("X-Forwarded-For", address)
+				next.ServeHTTP(w, r)
+			})
+		},
+	})
+	alice, bob, carol := s.Login("alice"), s.Login("bob"), s.Login("carol")
+	carolToken = carol.ID
+
+	// Logins count per address, whoever logs in
+	retryAfter := expectRateLimited(t, s.Anonymous().Do(http.MethodPost, "/session", map[string]string{"name": "dave"}))
+	if retryAfter > time.Hour {
+		t.Errorf("Retry-After is %s, expected at most the hour of the next login", retryAfter)
+	}
+
+	alice.Call(http.MethodGet, "/users?q=ca", nil, nil, http.StatusOK)
+	bob.Call(http.MethodGet, "/users?q=ca", nil, nil, http.StatusOK)
+	expectRateLimited(t, alice.Do(http.MethodGet, "/users?q=bo", nil))
+	expectRateLimited(t, bob.Do(http.MethodGet, "/users?q=al", nil))
+	carol.Call(http.MethodGet, "/users?q=al", nil, nil, http.StatusOK)
+
+	s.Advance(retryAfter)
+	s.Anonymous().Call(http.MethodPost, "/session", map[string]string{"name": "dave"}, nil, http.StatusCreated)
+}
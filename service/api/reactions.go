@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+)
+
+// reactionSummaryReactors is how many users are listed for each emoji in a message reaction summary. The full list is
+// available from GET .../reactions?emoji=
+const reactionSummaryReactors = 3
+
+// ReactionSummaryResponse matches the ReactionSummary schema: the reactions to a message grouped by emoji
+type ReactionSummaryResponse struct {
+	Emoji        string         `json:"emoji"`
+	Count        int            `json:"count"`
+	ReactedByMe  bool           `json:"reactedByMe"`
+	MyReactionID *string        `json:"myReactionId,omitempty"`
+	Reactors     []UserResponse `json:"reactors"`
+}
+
+// ReactionListResponse matches the ReactionList schema: the response for GET .../reactions
+type ReactionListResponse struct {
+	Reactions []ReactionResponse `json:"reactions"`
+}
+
+// buildReactionSummary groups the reactions of a message by emoji, in the order each emoji was first used.
+// `reactions` must be sorted by creation time and `userMap` must contain the reactors.
+func buildReactionSummary(reactions []database.Reaction, viewerID string, userMap map[string]database.User) []ReactionSummaryResponse {
+	summary := []ReactionSummaryResponse{}
+	index := make(map[string]int)
+	for _, r := range reactions {
+		i, ok := index[r.Emoji]
+		if !ok {
+			i = len(summary)
+			index[r.Emoji] = i
+			summary = append(summary, ReactionSummaryResponse{Emoji: r.Emoji, Reactors: []UserResponse{}})
+		}
+
+		s := &summary[i]
+		s.Count++
+		if r.UserID == viewerID {
+			reactionID := r.ID
+			s.ReactedByMe = true
+			s.MyReactionID = &reactionID
+		}
+		if len(s.Reactors) < reactionSummaryReactors {
+			reactor := userMap[r.UserID]
+			s.Reactors = append(s.Reactors, UserResponse{
+				ID:          reactor.ID,
+				Name:        reactor.Name,
+				DisplayName: reactor.DisplayName,
+				PhotoURL:    reactor.PhotoURL,
+			})
+		}
+	}
+	return summary
+}
+
+// listReactions handles GET /conversations/{conversationId}/messages/{messageId}/reactions
+// An optional ?emoji= lists only the users who reacted with that emoji
+func (rt *_router) listReactions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+	messageID := ps.ByName("messageId")
+	emoji := r.URL.Query().Get("emoji")
+
+	if _, _, err := rt.resolveMessage(user.ID, conversationID, messageID); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	reactions, err := rt.db.GetReactionsByMessage(messageID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting reactions")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	var userIDs []string
+	for _, reaction := range reactions {
+		userIDs = append(userIDs, reaction.UserID)
+	}
+	users, err := rt.db.GetUsersByIDs(userIDs)
+	if err != nil {
+		ctx.Logger.WithError(err).Warn("error fetching users in batch")
+		users = []database.User{}
+	}
+	userMap := make(map[string]database.User)
+	for _, u := range users {
+		userMap[u.ID] = u
+	}
+
+	reactionResponses := []ReactionResponse{}
+	for _, reaction := range reactions {
+		if emoji != "" && reaction.Emoji != emoji {
+			continue
+		}
+		reactUser := userMap[reaction.UserID]
+		reactionResponses = append(reactionResponses, ReactionResponse{
+			ID:    reaction.ID,
+			Emoji: reaction.Emoji,
+			User: UserResponse{
+				ID:          reactUser.ID,
+				Name:        reactUser.Name,
+				DisplayName: reactUser.DisplayName,
+				PhotoURL:    reactUser.PhotoURL,
+			},
+			CreatedAt: reaction.CreatedAt,
+		})
+	}
+
+	sendJSON(w, http.StatusOK, ReactionListResponse{Reactions: reactionResponses})
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+	"github.com/sirupsen/logrus"
+)
+
+// replySnippetLength is the maximum number of characters of the replied-to text shown in a quote
+const replySnippetLength = 100
+
+// ReplyPreviewResponse matches the ReplyPreview schema: the quote shown above a reply. Only Deleted is set when the
+// replied-to message no longer exists.
+type ReplyPreviewResponse struct {
+	ID          string        `json:"id,omitempty"`
+	Sender      *UserResponse `json:"sender,omitempty"`
+	ContentType string        `json:"contentType,omitempty"`
+	Snippet     *string       `json:"snippet,omitempty"`
+	Deleted     bool          `json:"deleted"`
+}
+
+// ThreadResponse matches the Thread schema: the response for GET .../messages/{messageId}/thread
+type ThreadResponse struct {
+	Message MessageResponse   `json:"message"`
+	Replies []MessageResponse `json:"replies"`
+}
+
+// newReplyPreview builds the quote of `target`, sent by `sender`
+func newReplyPreview(target database.Message, sender database.User) *ReplyPreviewResponse {
+	var snippet *string
+	if target.Text != nil {
+		text := []rune(*target.Text)
+		if len(text) > replySnippetLength {
+			text = append(text[:replySnippetLength], '…')
+		}
+		s := string(text)
+		snippet = &s
+	}
+
+	return &ReplyPreviewResponse{
+		ID: target.ID,
+		Sender: &UserResponse{
+			ID:          sender.ID,
+			Name:        sender.Name,
+			DisplayName: sender.DisplayName,
+			PhotoURL:    sender.PhotoURL,
+		},
+		ContentType: target.ContentType,
+		Snippet:     snippet,
+	}
+}
+
+// deletedReplyPreview is the quote of a reply whose original message was deleted
+func deletedReplyPreview() *ReplyPreviewResponse {
+	return &ReplyPreviewResponse{Deleted: true}
+}
+
+// validateReplyTarget checks that `replyToMessageID`, if set, refers to a message of the conversation.
+// Errors caused by the request are returned as *requestError.
+func (rt *_router) validateReplyTarget(conversationID string, replyToMessageID *string) error {
+	if replyToMessageID == nil {
+		return nil
+	}
+	target, err := rt.db.GetMessageByID(*replyToMessageID)
+	if err != nil {
+		return fmt.Errorf("getting reply target: %w", err)
+	}
+	if target == nil || target.ConversationID != conversationID {
+		return newInvalidFieldError("replyToMessageId", validation.CodeInvalidValue, "replyToMessageId must refer to a message of this conversation")
+	}
+	return nil
+}
+
+// getMessageThread handles GET /conversations/{conversationId}/messages/{messageId}/thread
+// It returns the message and all its direct and indirect replies, oldest first
+func (rt *_router) getMessageThread(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+	messageID := ps.ByName("messageId")
+
+	if _, _, err := rt.resolveMessage(user.ID, conversationID, messageID); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	messages, err := rt.db.GetMessageThread(messageID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting thread")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	messageResponses := rt.buildMessageResponses(ctx.Logger, user.ID, conversationID, messages)
+	if len(messageResponses) == 0 {
+		sendNotFound(w, messageNotFoundMessage)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, ThreadResponse{
+		Message: messageResponses[0],
+		Replies: messageResponses[1:],
+	})
+}
+
+// replyPreviewFor loads the quote of a single message, for responses about one new message. It returns nil if the
+// message can't be loaded.
+func (rt *_router) replyPreviewFor(logger logrus.FieldLogger, messageID string) *ReplyPreviewResponse {
+	target, err := rt.db.GetMessageByID(messageID)
+	if err != nil {
+		logger.WithError(err).Warn("error fetching replied-to message")
+		return nil
+	}
+	if target == nil {
+		return nil
+	}
+
+	sender, err := rt.db.GetUserByID(target.SenderID)
+	if err != nil {
+		logger.WithError(err).Warn("error fetching replied-to sender")
+		return nil
+	}
+	if sender == nil {
+		return nil
+	}
+	return newReplyPreview(*target, *sender)
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+)
+
+// maxReportDetailsLength is the number of characters of the details of a report
+const maxReportDetailsLength = 1000
+
+// reportReasons are the reasons a message or user can be reported for
+var reportReasons = map[string]bool{
+	"spam":          true,
+	"harassment":    true,
+	"inappropriate": true,
+	"impersonation": true,
+	"other":         true,
+}
+
+// ReportRequest matches the ReportRequest schema: the body of POST /reports. Messages are identified by their
+// conversation and ID, users by their ID.
+type ReportRequest struct {
+	Type           string  `json:"type"`
+	ConversationID string  `json:"conversationId"`
+	MessageID      string  `json:"messageId"`
+	UserID         string  `json:"userId"`
+	Reason         string  `json:"reason"`
+	Details        *string `json:"details"`
+}
+
+// ReportResponse matches the Report schema
+type ReportResponse struct {
+	ID        string  `json:"id"`
+	Type      string  `json:"type"`
+	UserID    string  `json:"userId"`
+	MessageID *string `json:"messageId,omitempty"`
+	Reason    string  `json:"reason"`
+	Status    string  `json:"status"`
+	CreatedAt string  `json:"createdAt"`
+}
+
+// createReport handles POST /reports
+// A report flags a message, or a user, for the moderators. Reported messages are copied into the report, so that it
+// keeps its content if the message is deleted.
+func (rt *_router) createReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	var req ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendInvalidJSON(w)
+		return
+	}
+	if !reportReasons[req.Reason] {
+		sendFieldError(w, "reason", validation.CodeInvalidValue, "reason must be spam, harassment, inappropriate, impersonation or other")
+		return
+	}
+	if req.Details != nil && utf8.RuneCountInString(*req.Details) > maxReportDetailsLength {
+		sendFieldError(w, "details", validation.CodeTooLong, "details is too long")
+		return
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		sendInternalError(w, "Error generating ID")
+		return
+	}
+	report := database.Report{
+		ID:         id.String(),
+		ReporterID: user.ID,
+		TargetType: req.Type,
+		Reason:     req.Reason,
+		Details:    req.Details,
+		Status:     database.ReportOpen,
+		CreatedAt:  globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+
+	switch req.Type {
+	case database.ReportTargetMessage:
+		_, msg, err := rt.resolveMessage(user.ID, req.ConversationID, req.MessageID)
+		if err != nil {
+			sendResolveError(w, ctx.Logger, err)
+			return
+		}
+		if msg.SenderID == user.ID || msg.ContentType == contentTypeSystem {
+			sendBadRequest(w, "You can't report this message")
+			return
+		}
+		report.UserID = msg.SenderID
+		report.MessageID = &msg.ID
+		report.ConversationID = &msg.ConversationID
+		report.MessageText = msg.Text
+		report.MessagePhotoURL = msg.PhotoURL
+	case database.ReportTargetUser:
+		if req.UserID == user.ID {
+			sendBadRequest(w, "You can't report yourself")
+			return
+		}
+		reported, err := rt.db.GetUserByID(req.UserID)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("database error getting user")
+			sendInternalError(w, "Database error")
+			return
+		}
+		if reported == nil {
+			sendNotFound(w, "User not found")
+			return
+		}
+		report.UserID = reported.ID
+	default:
+		sendFieldError(w, "type", validation.CodeInvalidValue, "type must be message or user")
+		return
+	}
+
+	if err := rt.db.CreateReport(report); err != nil {
+		ctx.Logger.WithError(err).Error("error creating report")
+		sendInternalError(w, "Error creating report")
+		return
+	}
+	ctx.Logger.WithField("reportId", report.ID).Info("report created")
+
+	sendJSON(w, http.StatusCreated, ReportResponse{
+		ID:        report.ID,
+		Type:      report.TargetType,
+		UserID:    report.UserID,
+		MessageID: report.MessageID,
+		Reason:    report.Reason,
+		Status:    report.Status,
+		CreatedAt: report.CreatedAt,
+	})
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/sirupsen/logrus"
+)
+
+// Routes nested under /conversations/{conversationId} load their resources through the helpers below, so that
+// membership and containment are checked the same way everywhere. A conversation the user is not part of and a
+// message that belongs to another conversation are both reported as not found, without telling whether they exist.
+
+const (
+	conversationNotFoundMessage = "Conversation not found or you are not a participant"
+	messageNotFoundMessage      = "Message not found"
+)
+
+// resolveConversation loads the conversation `conversationID` and checks that `userID` participates in it.
+// Errors caused by the request are returned as *requestError.
+func (rt *_router) resolveConversation(userID, conversationID string) (*database.Conversation, error) {
+	conv, err := rt.db.GetConversationByID(conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("getting conversation: %w", err)
+	}
+	if conv == nil {
+		return nil, newNotFoundError(conversationNotFoundMessage)
+	}
+
+	isParticipant, err := rt.db.IsParticipant(conversationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("checking participant: %w", err)
+	}
+	if !isParticipant {
+		return nil, newNotFoundError(conversationNotFoundMessage)
+	}
+	return conv, nil
+}
+
+// resolveMessage loads the message `messageID`, checking that `userID` participates in `conversationID` and that the
+// message belongs to it. Errors caused by the request are returned as *requestError.
+func (rt *_router) resolveMessage(userID, conversationID, messageID string) (*database.Conversation, *database.Message, error) {
+	conv, err := rt.resolveConversation(userID, conversationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msg, err := rt.db.GetMessageByID(messageID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting message: %w", err)
+	}
+	if msg == nil || msg.ConversationID != conv.ID {
+		return nil, nil, newNotFoundError(messageNotFoundMessage)
+	}
+	return conv, msg, nil
+}
+
+// sendResolveError answers a request whose resources could not be resolved
+func sendResolveError(w http.ResponseWriter, logger logrus.FieldLogger, err error) {
+	if reqErr, ok := asRequestError(err); ok {
+		sendRequestError(w, reqErr)
+		return
+	}
+	logger.WithError(err).Error("database error")
+	sendInternalError(w, "Database error")
+}
@@ -2,11 +2,35 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
 )
 
+// requestIDHeader is the response header with the ID of the request, set by wrap and authWrap before calling the
+// handler. Error responses repeat it, so that users can report it and operators can find the request in the logs.
+const requestIDHeader = "X-Request-Id"
+
 // ErrorResponse matches the Error schema in api.yaml
 type ErrorResponse struct {
+	// Code is one of the codes in errorCodes
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// Details lists the fields of the request that are not valid, when the error is caused by some
+	Details []ErrorDetail `json:"details,omitempty"`
+
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// ErrorDetail matches the ErrorDetail schema: a field of the request that is not valid. Code is one of the codes of
+// the validation package.
+type ErrorDetail struct {
+	Field   string `json:"field"`
 	Code    string `json:"code"`
 	Message string `json:"message"`
 }
@@ -21,34 +45,115 @@ func sendJSON(w http.ResponseWriter, status int, data interface{}) {
 }
 
 // sendError writes a JSON error response matching the Error schema
-func sendError(w http.ResponseWriter, status int, code string, message string) {
-	sendJSON(w, status, ErrorResponse{
-		Code:    code,
-		Message: message,
-	})
+func sendError(w http.ResponseWriter, status int, code errorCode, message string) {
+	sendRequestError(w, &requestError{status: status, code: code, message: message})
 }
 
 // Common error helpers
 func sendBadRequest(w http.ResponseWriter, message string) {
-	sendError(w, http.StatusBadRequest, "bad-request", message)
+	sendError(w, http.StatusBadRequest, codeBadRequest, message)
+}
+
+// sendInvalidJSON tells the client the body of the request is not the JSON expected
+func sendInvalidJSON(w http.ResponseWriter) {
+	sendError(w, http.StatusBadRequest, codeInvalidJSON, "Invalid JSON")
+}
+
+// sendFieldError tells the client a field of the request is not valid; `code` is one of the codes of the validation
+// package
+func sendFieldError(w http.ResponseWriter, field, code, message string) {
+	sendRequestError(w, newInvalidFieldError(field, code, message))
 }
 
 func sendUnauthorized(w http.ResponseWriter, message string) {
-	sendError(w, http.StatusUnauthorized, "unauthorized", message)
+	sendError(w, http.StatusUnauthorized, codeUnauthorized, message)
 }
 
 func sendForbidden(w http.ResponseWriter, message string) {
-	sendError(w, http.StatusForbidden, "forbidden", message)
+	sendError(w, http.StatusForbidden, codeForbidden, message)
 }
 
 func sendNotFound(w http.ResponseWriter, message string) {
-	sendError(w, http.StatusNotFound, "not-found", message)
+	sendError(w, http.StatusNotFound, codeNotFound, message)
 }
 
 func sendConflict(w http.ResponseWriter, message string) {
-	sendError(w, http.StatusConflict, "conflict", message)
+	sendError(w, http.StatusConflict, codeConflict, message)
 }
 
 func sendInternalError(w http.ResponseWriter, message string) {
-	sendError(w, http.StatusInternalServerError, "internal-error", message)
+	sendError(w, http.StatusInternalServerError, codeInternalError, message)
+}
+
+// sendTooManyRequests tells the client to wait `retryAfter` before trying again, in whole seconds
+func sendTooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	sendError(w, http.StatusTooManyRequests, codeTooManyRequests,
+		fmt.Sprintf("Too many requests, try again in %d seconds", seconds))
+}
+
+// requestError is returned by helpers shared between several handlers (or background tasks) when a request can't be
+// fulfilled because of the caller's input. Handlers write it out with sendRequestError.
+type requestError struct {
+	status  int
+	code    errorCode
+	message string
+	details []ErrorDetail
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// newRequestError returns an error with a specific code of the catalogue
+func newRequestError(status int, code errorCode, message string) *requestError {
+	return &requestError{status: status, code: code, message: message}
+}
+
+func newBadRequestError(message string) *requestError {
+	return &requestError{status: http.StatusBadRequest, code: codeBadRequest, message: message}
+}
+
+func newNotFoundError(message string) *requestError {
+	return &requestError{status: http.StatusNotFound, code: codeNotFound, message: message}
+}
+
+// newFieldError turns the *validation.Error of a field into a validation-failed error naming the field. Other errors
+// are returned as they are.
+func newFieldError(err error) error {
+	vErr, ok := validation.As(err)
+	if !ok {
+		return err
+	}
+	return newInvalidFieldError(vErr.Field, vErr.Code, vErr.Message)
+}
+
+// newInvalidFieldError returns a validation-failed error about a single field of the request
+func newInvalidFieldError(field, code, message string) *requestError {
+	return &requestError{
+		status:  http.StatusBadRequest,
+		code:    codeValidationFailed,
+		message: message,
+		details: []ErrorDetail{{Field: field, Code: code, Message: message}},
+	}
+}
+
+// asRequestError returns the *requestError wrapped in err, if any
+func asRequestError(err error) (*requestError, bool) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr, true
+	}
+	return nil, false
+}
+
+// sendRequestError writes a requestError as a JSON error response
+func sendRequestError(w http.ResponseWriter, err *requestError) {
+	sendJSON(w, err.status, ErrorResponse{
+		Code:      string(err.code),
+		Message:   err.message,
+		Details:   err.details,
+		RequestID: w.Header().Get(requestIDHeader),
+	})
 }
@@ -0,0 +1,115 @@
+package api_test
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ozberk-sevinc/wasa-project/service/apispec"
+)
+
+// TestRoutesMatchSpec checks that every route registered on the router is documented, and every documented operation
+// has a route
+func TestRoutesMatchSpec(t *testing.T) {
+	for _, p := range checkRoutes(loadSpec(t), registeredRoutes(t, ".")) {
+		t.Error(p)
+	}
+}
+
+// route is a method and path registered on the router, with the path in the syntax of the specification
+type route struct {
+	Method string
+	Path   string
+}
+
+func (r route) String() string {
+	return r.Method + " " + r.Path
+}
+
+// registeredRoutes returns the routes registered in api-handler.go, like rt.router.GET("/me", ...). Files served with
+// ServeFiles are not part of the API.
+func registeredRoutes(t *testing.T, srcDir string) []route {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filepath.Join(srcDir, "api-handler.go"), nil, 0)
+	if err != nil {
+		t.Fatalf("parsing the routes: %v", err)
+	}
+	var routes []route
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		router, ok := sel.X.(*ast.SelectorExpr)
+		if !ok || router.Sel.Name != "router" {
+			return true
+		}
+		switch sel.Sel.Name {
+		case "GET", "PUT", "POST", "DELETE", "PATCH":
+		default:
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok {
+			return true
+		}
+		path, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return true
+		}
+		routes = append(routes, route{Method: sel.Sel.Name, Path: specPath(path)})
+		return true
+	})
+	if len(routes) == 0 {
+		t.Fatalf("no routes found in %s", srcDir)
+	}
+	return routes
+}
+
+// specPath turns a httprouter path like /groups/:groupId into /groups/{groupId}
+func specPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") {
+			segments[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// checkRoutes reports the routes of the server the specification doesn't document, and the other way round
+func checkRoutes(spec *apispec.Spec, routes []route) []string {
+	registered := make(map[string]bool)
+	for _, r := range routes {
+		registered[r.String()] = true
+	}
+	documented := make(map[string]bool)
+	for _, op := range spec.Operations() {
+		documented[op.String()] = true
+	}
+
+	var problems []string
+	for _, r := range routes {
+		if !documented[r.String()] {
+			problems = append(problems, fmt.Sprintf("route %s is not documented", r))
+		}
+	}
+	for _, op := range spec.Operations() {
+		if !registered[op.String()] {
+			problems = append(problems, fmt.Sprintf("operation %s (%s) has no route", op, op.ID))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
@@ -0,0 +1,406 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/ozberk-sevinc/wasa-project/service/validation"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxScheduleAhead is how far in the future a message can be scheduled
+	maxScheduleAhead = 365 * 24 * time.Hour
+	// schedulerMaxWait is the longest the scheduler sleeps without looking for due messages
+	schedulerMaxWait = time.Minute
+	// schedulerMinWait keeps the scheduler from spinning on messages it could not send because of a server error
+	schedulerMinWait = time.Second
+	// schedulerBatchSize is the number of due messages sent in a round
+	schedulerBatchSize = 100
+)
+
+// ScheduleMessageRequest matches the ScheduleMessageRequest schema: the request body for POST and PUT on scheduled
+// messages, with the message, as for sendMessage, and when to send it
+type ScheduleMessageRequest struct {
+	SendMessageRequest
+	SendAt string `json:"sendAt"`
+}
+
+// ScheduledMessageResponse matches the ScheduledMessage schema
+type ScheduledMessageResponse struct {
+	ID               string       `json:"id"`
+	ConversationID   string       `json:"conversationId"`
+	CreatedAt        string       `json:"createdAt"`
+	SendAt           string       `json:"sendAt"`
+	ContentType      string       `json:"contentType"`
+	Text             *string      `json:"text,omitempty"`
+	PhotoURL         *string      `json:"photoUrl,omitempty"`
+	ReplyToMessageID *string      `json:"replyToMessageId,omitempty"`
+	Poll             *PollRequest `json:"poll,omitempty"`
+	Status           string       `json:"status"`
+	Error            *string      `json:"error,omitempty"`
+}
+
+func newScheduledMessageResponse(m database.ScheduledMessage) ScheduledMessageResponse {
+	response := ScheduledMessageResponse{
+		ID:               m.ID,
+		ConversationID:   m.ConversationID,
+		CreatedAt:        m.CreatedAt,
+		SendAt:           m.SendAt,
+		ContentType:      m.ContentType,
+		Text:             m.Text,
+		PhotoURL:         m.PhotoURL,
+		ReplyToMessageID: m.RepliedToMessageID,
+		Status:           m.Status,
+		Error:            m.Error,
+	}
+	if m.Poll != nil {
+		var poll PollRequest
+		if err := json.Unmarshal([]byte(*m.Poll), &poll); err == nil {
+			response.Poll = &poll
+		}
+	}
+	return response
+}
+
+// applyScheduleRequest validates a ScheduleMessageRequest and copies it into `m`
+func (rt *_router) applyScheduleRequest(m *database.ScheduledMessage, req ScheduleMessageRequest) error {
+	sendAt, err := time.Parse(time.RFC3339, req.SendAt)
+	if err != nil {
+		return newInvalidFieldError("sendAt", validation.CodeInvalidFormat, "sendAt must be an RFC 3339 date-time")
+	}
+	now := globaltime.Now()
+	if !sendAt.After(now) {
+		return newInvalidFieldError("sendAt", validation.CodeInvalidValue, "sendAt must be in the future")
+	}
+	if sendAt.Sub(now) > maxScheduleAhead {
+		return newInvalidFieldError("sendAt", validation.CodeInvalidValue, "sendAt must be within a year")
+	}
+
+	if _, err := rt.prepareMessage(m.ConversationID, &req.SendMessageRequest); err != nil {
+		return err
+	}
+
+	m.SendAt = sendAt.UTC().Format("2006-01-02T15:04:05Z")
+	m.ContentType = req.ContentType
+	m.Text = req.Text
+	m.PhotoURL = req.PhotoURL
+	m.RepliedToMessageID = req.ReplyToMessageID
+	m.Poll = nil
+	if req.ContentType == contentTypePoll {
+		data, err := json.Marshal(req.Poll)
+		if err != nil {
+			return err
+		}
+		poll := string(data)
+		m.Poll = &poll
+	}
+	m.Status = database.ScheduledPending
+	m.Error = nil
+	return nil
+}
+
+// scheduleMessage handles POST /conversations/{conversationId}/scheduled-messages
+func (rt *_router) scheduleMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+
+	var req ScheduleMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendInvalidJSON(w)
+		return
+	}
+
+	if _, err := rt.resolveConversation(user.ID, conversationID); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	id, _ := uuid.NewV4()
+	scheduled := database.ScheduledMessage{
+		ID:             id.String(),
+		ConversationID: conversationID,
+		SenderID:       user.ID,
+		CreatedAt:      globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if err := rt.applyScheduleRequest(&scheduled, req); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	if err := rt.db.CreateScheduledMessage(scheduled); err != nil {
+		ctx.Logger.WithError(err).Error("error creating scheduled message")
+		sendInternalError(w, "Error scheduling message")
+		return
+	}
+	rt.wakeScheduler()
+
+	sendJSON(w, http.StatusCreated, newScheduledMessageResponse(scheduled))
+}
+
+// listScheduledMessages handles GET /conversations/{conversationId}/scheduled-messages
+// Only the messages scheduled by the current user are listed; messages are removed from the list once sent
+func (rt *_router) listScheduledMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+
+	if _, err := rt.resolveConversation(user.ID, conversationID); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	scheduled, err := rt.db.GetScheduledMessagesBySender(conversationID, user.ID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting scheduled messages")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	response := make([]ScheduledMessageResponse, 0, len(scheduled))
+	for _, m := range scheduled {
+		response = append(response, newScheduledMessageResponse(m))
+	}
+	sendJSON(w, http.StatusOK, response)
+}
+
+// updateScheduledMessage handles PUT /conversations/{conversationId}/scheduled-messages/{scheduledMessageId}
+// The message and its time are replaced; a message that failed to be sent is scheduled again
+func (rt *_router) updateScheduledMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	var req ScheduleMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendInvalidJSON(w)
+		return
+	}
+
+	// Keep the scheduler from sending the message while it changes
+	rt.schedulerMu.Lock()
+	defer rt.schedulerMu.Unlock()
+
+	scheduled, err := rt.resolveScheduledMessage(user.ID, ps.ByName("conversationId"), ps.ByName("scheduledMessageId"))
+	if err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	if err := rt.applyScheduleRequest(scheduled, req); err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	if err := rt.db.UpdateScheduledMessage(*scheduled); err != nil {
+		ctx.Logger.WithError(err).Error("error updating scheduled message")
+		sendInternalError(w, "Error updating scheduled message")
+		return
+	}
+	rt.wakeScheduler()
+
+	sendJSON(w, http.StatusOK, newScheduledMessageResponse(*scheduled))
+}
+
+// cancelScheduledMessage handles DELETE /conversations/{conversationId}/scheduled-messages/{scheduledMessageId}
+func (rt *_router) cancelScheduledMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	rt.schedulerMu.Lock()
+	defer rt.schedulerMu.Unlock()
+
+	scheduled, err := rt.resolveScheduledMessage(user.ID, ps.ByName("conversationId"), ps.ByName("scheduledMessageId"))
+	if err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	if err := rt.db.DeleteScheduledMessage(scheduled.ID); err != nil {
+		ctx.Logger.WithError(err).Error("error deleting scheduled message")
+		sendInternalError(w, "Error cancelling scheduled message")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resolveScheduledMessage loads a message scheduled by `userID` in a conversation they are part of. Messages
+// scheduled by others are reported as not found.
+func (rt *_router) resolveScheduledMessage(userID, conversationID, scheduledMessageID string) (*database.ScheduledMessage, error) {
+	if _, err := rt.resolveConversation(userID, conversationID); err != nil {
+		return nil, err
+	}
+	scheduled, err := rt.db.GetScheduledMessage(scheduledMessageID)
+	if err != nil {
+		return nil, err
+	}
+	if scheduled == nil || scheduled.ConversationID != conversationID || scheduled.SenderID != userID {
+		return nil, newNotFoundError("Scheduled message not found")
+	}
+	return scheduled, nil
+}
+
+// wakeScheduler makes the scheduler look again for the next message to send, after a change of the schedule
+func (rt *_router) wakeScheduler() {
+	select {
+	case rt.schedulerWake <- struct{}{}:
+	default:
+	}
+}
+
+// runScheduler sends the scheduled messages when they are due, until `stop` is closed. The schedule is kept in the
+// database, so messages that became due while the server was down are sent as soon as it starts.
+func (rt *_router) runScheduler(stop <-chan struct{}) {
+	logger := rt.baseLogger.WithField("worker", "scheduler")
+	for {
+		rt.sendDueMessages(logger)
+
+		wait := schedulerMaxWait
+		next, err := rt.db.GetNextScheduledSendAt()
+		if err != nil {
+			logger.WithError(err).Error("error getting the next scheduled message")
+		} else if next != nil {
+			if sendAt, err := time.Parse(time.RFC3339, *next); err == nil && sendAt.Sub(globaltime.Now()) < wait {
+				wait = max(sendAt.Sub(globaltime.Now()), schedulerMinWait)
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-rt.schedulerWake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// sendDueMessages sends a batch of the scheduled messages that are due
+func (rt *_router) sendDueMessages(logger logrus.FieldLogger) {
+	rt.schedulerMu.Lock()
+	defer rt.schedulerMu.Unlock()
+
+	now := globaltime.Now().UTC().Format("2006-01-02T15:04:05Z")
+	due, err := rt.db.GetDueScheduledMessages(now, schedulerBatchSize)
+	if err != nil {
+		logger.WithError(err).Error("error getting due scheduled messages")
+		return
+	}
+	for _, scheduled := range due {
+		rt.sendScheduledMessage(logger.WithField("scheduledMessageId", scheduled.ID), scheduled)
+	}
+}
+
+// sendScheduledMessage posts a scheduled message through submitMessage, like sendMessage does, and tells the sender
+// with a "scheduled_message_sent" or "scheduled_message_failed" event. Messages that can no longer be sent (the
+// sender left the conversation or was suspended, the replied-to message was deleted...) are marked as failed; after a
+// server error, the message is tried again in the next round.
+func (rt *_router) sendScheduledMessage(logger logrus.FieldLogger, scheduled database.ScheduledMessage) {
+	// The message is sent with the ID of the schedule: if it exists, it was sent just before a restart
+	existing, err := rt.db.GetMessageByID(scheduled.ID)
+	if err != nil {
+		logger.WithError(err).Error("error checking scheduled message")
+		return
+	}
+	if existing != nil {
+		if err := rt.db.DeleteScheduledMessage(scheduled.ID); err != nil {
+			logger.WithError(err).Error("error deleting sent scheduled message")
+		}
+		return
+	}
+
+	sender, err := rt.db.GetUserByID(scheduled.SenderID)
+	if err != nil {
+		logger.WithError(err).Error("error getting sender of scheduled message")
+		return
+	}
+	inactive := false
+	if sender != nil {
+		if inactive, err = rt.db.IsInactiveUser(sender.ID); err != nil {
+			logger.WithError(err).Error("error getting sender of scheduled message")
+			return
+		}
+	}
+	if sender == nil || inactive {
+		if err := rt.db.DeleteScheduledMessage(scheduled.ID); err != nil {
+			logger.WithError(err).Error("error deleting orphan scheduled message")
+		}
+		return
+	}
+
+	req := SendMessageRequest{
+		ContentType:      scheduled.ContentType,
+		Text:             scheduled.Text,
+		PhotoURL:         scheduled.PhotoURL,
+		ReplyToMessageID: scheduled.RepliedToMessageID,
+		messageID:        scheduled.ID,
+	}
+	if scheduled.Poll != nil {
+		if err := json.Unmarshal([]byte(*scheduled.Poll), &req.Poll); err != nil {
+			logger.WithError(err).Error("error decoding scheduled poll")
+		}
+	}
+
+	// Senders who are suspended or banned can't post, as when authWrap rejects them
+	var submission *messageSubmission
+	if err = rt.checkAccountStatus(sender.ID); err == nil {
+		submission, err = rt.submitMessage(logger, sender, scheduled.ConversationID, req)
+	}
+	if reqErr, ok := asRequestError(err); ok {
+		if err := rt.db.FailScheduledMessage(scheduled.ID, reqErr.message); err != nil {
+			logger.WithError(err).Error("error marking scheduled message as failed")
+			return
+		}
+		scheduled.Status = database.ScheduledFailed
+		scheduled.Error = &reqErr.message
+		_ = rt.wsHub.SendToUser(sender.ID, WebSocketMessage{
+			Type:    "scheduled_message_failed",
+			Payload: newScheduledMessageResponse(scheduled),
+		})
+		return
+	} else if err != nil {
+		logger.WithError(err).Error("error sending scheduled message")
+		return
+	}
+
+	if err := rt.db.DeleteScheduledMessage(scheduled.ID); err != nil {
+		logger.WithError(err).Error("error deleting sent scheduled message")
+	}
+	// Slash commands that did not post a public message are announced with their result instead
+	payload := map[string]interface{}{
+		"scheduledMessageId": scheduled.ID,
+		"conversationId":     scheduled.ConversationID,
+	}
+	if submission.Message != nil {
+		payload["message"] = submission.Message
+	} else {
+		payload["command"] = submission.Command
+	}
+	_ = rt.wsHub.SendToUser(sender.ID, WebSocketMessage{
+		Type:    "scheduled_message_sent",
+		Payload: payload,
+	})
+}
@@ -0,0 +1,212 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+)
+
+// schedule schedules a text message in a conversation, to be sent after `in`
+func schedule(s *apitest.Server, c *apitest.Client, conversationID, text string, in time.Duration,
+	replyTo *string) api.ScheduledMessageResponse {
+	body := api.ScheduleMessageRequest{
+		SendMessageRequest: api.SendMessageRequest{ContentType: "text", Text: &text, ReplyToMessageID: replyTo},
+		SendAt:             s.Now().Add(in).UTC().Format(time.RFC3339),
+	}
+	var scheduled api.ScheduledMessageResponse
+	c.Call(http.MethodPost, "/conversations/"+conversationID+"/scheduled-messages", body, &scheduled,
+		http.StatusCreated)
+	return scheduled
+}
+
+// TestScheduledMessageSent checks that a due message is sent like any other, under the ID of the schedule, and
+// removed from the schedule
+func TestScheduledMessageSent(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	aliceEvents, bobEvents := alice.Connect(), bob.Connect()
+
+	scheduled := schedule(s, alice, conv, "Happy birthday!", time.Hour, nil)
+	api.SendDueMessages(s.Router)
+	bobEvents.ExpectNone("new_message", quietPeriod)
+
+	s.Advance(time.Hour)
+	api.SendDueMessages(s.Router)
+	events := bobEvents.WaitEach("new_message", "conversation_updated")
+	var received api.MessageResponse
+	events[0].Decode(&received)
+	if received.ID != scheduled.ID || text(received) != "Happy birthday!" || received.Sender.ID != alice.ID {
+		t.Errorf("bob received %s %q from %s, expected %s from alice", received.ID, text(received),
+			received.Sender.Name, scheduled.ID)
+	}
+	var updated struct {
+		ConversationID     string  `json:"conversationId"`
+		LastMessageSnippet *string `json:"lastMessageSnippet"`
+	}
+	events[1].Decode(&updated)
+	if updated.ConversationID != conv || updated.LastMessageSnippet == nil || *updated.LastMessageSnippet != "Happy birthday!" {
+		t.Errorf("conversation_updated announced %s, expected the new snippet of %s", updated.ConversationID, conv)
+	}
+	var sent struct {
+		ScheduledMessageID string              `json:"scheduledMessageId"`
+		Message            api.MessageResponse `json:"message"`
+	}
+	aliceEvents.Wait("scheduled_message_sent").Decode(&sent)
+	if sent.ScheduledMessageID != scheduled.ID || sent.Message.ID != scheduled.ID {
+		t.Errorf("scheduled_message_sent announced %s as %s, expected %s", sent.ScheduledMessageID, sent.Message.ID,
+			scheduled.ID)
+	}
+
+	var list []api.ScheduledMessageResponse
+	alice.Call(http.MethodGet, "/conversations/"+conv+"/scheduled-messages", nil, &list, http.StatusOK)
+	if len(list) != 0 {
+		t.Errorf("%d messages are still scheduled after being sent", len(list))
+	}
+}
+
+// TestScheduledMessageAlreadySent checks that a message sent just before a restart, whose schedule was not deleted
+// yet, is not sent again
+func TestScheduledMessageAlreadySent(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	bobEvents := bob.Connect()
+
+	scheduled := schedule(s, alice, conv, "Only once", time.Minute, nil)
+	s.Advance(time.Minute)
+	api.SendDueMessages(s.Router)
+	bobEvents.WaitWith("new_message", "id", scheduled.ID)
+
+	// The schedule as it was when the server stopped
+	err := s.DB.CreateScheduledMessage(database.ScheduledMessage{
+		ID:             scheduled.ID,
+		ConversationID: conv,
+		SenderID:       alice.ID,
+		CreatedAt:      scheduled.CreatedAt,
+		SendAt:         scheduled.SendAt,
+		ContentType:    scheduled.ContentType,
+		Text:           scheduled.Text,
+		Status:         database.ScheduledPending,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.SendDueMessages(s.Router)
+	bobEvents.ExpectNone("new_message", quietPeriod)
+
+	var list []api.ScheduledMessageResponse
+	alice.Call(http.MethodGet, "/conversations/"+conv+"/scheduled-messages", nil, &list, http.StatusOK)
+	if len(list) != 0 {
+		t.Errorf("%d messages are still scheduled, expected the schedule to be deleted", len(list))
+	}
+	var c api.ConversationResponse
+	bob.Call(http.MethodGet, "/conversations/"+conv, nil, &c, http.StatusOK)
+	if len(c.Messages) != 1 {
+		t.Errorf("the conversation has %d messages, expected 1", len(c.Messages))
+	}
+}
+
+// TestScheduledMessageFailed checks that a message that can no longer be sent is kept as failed, and its sender told
+func TestScheduledMessageFailed(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	aliceEvents, bobEvents := alice.Connect(), bob.Connect()
+
+	var question api.MessageResponse
+	alice.Call(http.MethodPost, "/conversations/"+conv+"/messages", textMessage("Dinner?"), &question,
+		http.StatusCreated)
+	bobEvents.WaitWith("new_message", "id", question.ID)
+	scheduled := schedule(s, alice, conv, "Still on?", time.Hour, &question.ID)
+	alice.Call(http.MethodDelete, "/conversations/"+conv+"/messages/"+question.ID, nil, nil, http.StatusNoContent)
+
+	s.Advance(time.Hour)
+	api.SendDueMessages(s.Router)
+	var failed api.ScheduledMessageResponse
+	aliceEvents.Wait("scheduled_message_failed").Decode(&failed)
+	if failed.ID != scheduled.ID || failed.Status != database.ScheduledFailed || failed.Error == nil {
+		t.Errorf("scheduled_message_failed announced %s as %s, expected %s as failed with an error", failed.ID,
+			failed.Status, scheduled.ID)
+	}
+	bobEvents.ExpectNone("new_message", quietPeriod)
+
+	// Failed messages stay listed, and are not tried again
+	var list []api.ScheduledMessageResponse
+	alice.Call(http.MethodGet, "/conversations/"+conv+"/scheduled-messages", nil, &list, http.StatusOK)
+	if len(list) != 1 || list[0].Status != database.ScheduledFailed {
+		t.Fatalf("the schedule lists %d messages, expected the failed one", len(list))
+	}
+	api.SendDueMessages(s.Router)
+	aliceEvents.ExpectNone("scheduled_message_failed", quietPeriod)
+}
+
+// TestScheduledMessageOfSuspendedSender checks that the messages a user scheduled are not sent while they are
+// suspended, but kept as failed
+func TestScheduledMessageOfSuspendedSender(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob, admin := s.Login("alice"), s.Login("bob"), s.Login("admin")
+	s.GrantAdmin(admin)
+	conv := startConversation(alice, bob)
+	bobEvents := bob.Connect()
+
+	scheduled := schedule(s, alice, conv, "See you", time.Hour, nil)
+	until := s.Now().Add(2 * time.Hour).UTC().Format(time.RFC3339)
+	admin.Call(http.MethodPut, "/admin/users/"+alice.ID+"/status",
+		api.AccountStatusRequest{Status: database.AccountSuspended, SuspendedUntil: &until}, nil, http.StatusOK)
+
+	s.Advance(time.Hour)
+	api.SendDueMessages(s.Router)
+	bobEvents.ExpectNone("new_message", quietPeriod)
+
+	// Once the suspension is over, alice finds the message failed rather than sent late
+	s.Advance(time.Hour)
+	api.SendDueMessages(s.Router)
+	bobEvents.ExpectNone("new_message", quietPeriod)
+	var list []api.ScheduledMessageResponse
+	alice.Call(http.MethodGet, "/conversations/"+conv+"/scheduled-messages", nil, &list, http.StatusOK)
+	if len(list) != 1 || list[0].ID != scheduled.ID || list[0].Status != database.ScheduledFailed {
+		t.Fatalf("the schedule lists %d messages, expected %s as failed", len(list), scheduled.ID)
+	}
+	if list[0].Error == nil || !strings.Contains(*list[0].Error, "suspended") {
+		t.Errorf("the message failed with %v, expected the suspension", list[0].Error)
+	}
+}
+
+// TestScheduledCommand checks that a scheduled slash command answered privately is announced with its result, and
+// no message
+func TestScheduledCommand(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob := s.Login("alice"), s.Login("bob")
+	conv := startConversation(alice, bob)
+	aliceEvents := alice.Connect()
+
+	// The bot is not connected, so the command gets an ephemeral reply
+	bob.Call(http.MethodPut, "/conversations/"+conv+"/commands/deploy", api.RegisterCommandRequest{}, nil,
+		http.StatusOK)
+	scheduled := schedule(s, alice, conv, "/deploy staging", time.Hour, nil)
+	s.Advance(time.Hour)
+	api.SendDueMessages(s.Router)
+	aliceEvents.Wait("ephemeral_message")
+
+	var sent map[string]json.RawMessage
+	aliceEvents.Wait("scheduled_message_sent").Decode(&sent)
+	if _, ok := sent["message"]; ok {
+		t.Errorf("scheduled_message_sent announced the message %s, expected none", sent["message"])
+	}
+	var command api.CommandResultResponse
+	if err := json.Unmarshal(sent["command"], &command); err != nil || command.Command != "deploy" ||
+		command.Ephemeral == nil {
+		t.Errorf("scheduled_message_sent announced the command %s, expected the ephemeral reply of /deploy",
+			sent["command"])
+	}
+	if string(sent["scheduledMessageId"]) != `"`+scheduled.ID+`"` {
+		t.Errorf("scheduled_message_sent announced %s, expected %s", sent["scheduledMessageId"], scheduled.ID)
+	}
+}
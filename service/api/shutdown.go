@@ -1,6 +1,33 @@
 package api
 
 // Close should close everything opened in the lifecycle of the `_router`; for example, background goroutines.
+// Background work started after Close is refused, so the HTTP server should be shut down first.
 func (rt *_router) Close() error {
+	rt.backgroundMu.Lock()
+	if rt.closed {
+		rt.backgroundMu.Unlock()
+		return nil
+	}
+	rt.closed = true
+	rt.backgroundMu.Unlock()
+
+	close(rt.stopWorkers)
+	rt.background.Wait()
 	return nil
 }
+
+// goBackground runs `fn` in a goroutine Close waits for. It returns false, without running `fn`, once the router is
+// closed.
+func (rt *_router) goBackground(fn func()) bool {
+	rt.backgroundMu.Lock()
+	defer rt.backgroundMu.Unlock()
+	if rt.closed {
+		return false
+	}
+	rt.background.Add(1)
+	go func() {
+		defer rt.background.Done()
+		fn()
+	}()
+	return true
+}
@@ -0,0 +1,26 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+)
+
+// TestCloseRefusesBackgroundWork checks that a request arriving after Close doesn't start background work: the
+// account export it asks for fails at once instead of staying pending
+func TestCloseRefusesBackgroundWork(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice := s.Login("alice")
+	if err := s.Router.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var export struct {
+		Status string `json:"status"`
+	}
+	alice.Call(http.MethodPost, "/me/export", nil, &export, http.StatusAccepted)
+	if export.Status != "failed" {
+		t.Errorf("the export requested after Close is %s, expected failed", export.Status)
+	}
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ozberk-sevinc/wasa-project/service/api/reqcontext"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/sirupsen/logrus"
+)
+
+// ConversationReferenceResponse matches the ConversationReference schema: the conversation of a message listed
+// outside of it
+type ConversationReferenceResponse struct {
+	ID       string  `json:"id"`
+	Type     string  `json:"type"`
+	Title    string  `json:"title"`
+	PhotoURL *string `json:"photoUrl,omitempty"`
+}
+
+// StarredMessageResponse matches the StarredMessage schema
+type StarredMessageResponse struct {
+	Message      MessageResponse               `json:"message"`
+	Conversation ConversationReferenceResponse `json:"conversation"`
+	StarredAt    string                        `json:"starredAt"`
+}
+
+// StarredMessagesResponse matches the StarredMessagePage schema: the response for GET /me/starred. NextCursor is set
+// when there are more pages.
+type StarredMessagesResponse struct {
+	Messages   []StarredMessageResponse `json:"messages"`
+	NextCursor *string                  `json:"nextCursor,omitempty"`
+}
+
+// starMessage handles PUT /conversations/{conversationId}/messages/{messageId}/star
+// Stars are private to the user; starring a starred message does nothing
+func (rt *_router) starMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	_, msg, err := rt.resolveMessage(user.ID, ps.ByName("conversationId"), ps.ByName("messageId"))
+	if err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	err = rt.db.StarMessage(database.StarredMessage{
+		UserID:         user.ID,
+		MessageID:      msg.ID,
+		ConversationID: msg.ConversationID,
+		StarredAt:      globaltime.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("error starring message")
+		sendInternalError(w, "Error starring message")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unstarMessage handles DELETE /conversations/{conversationId}/messages/{messageId}/star
+func (rt *_router) unstarMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	_, msg, err := rt.resolveMessage(user.ID, ps.ByName("conversationId"), ps.ByName("messageId"))
+	if err != nil {
+		sendResolveError(w, ctx.Logger, err)
+		return
+	}
+
+	if err := rt.db.UnstarMessage(user.ID, msg.ID); err != nil {
+		ctx.Logger.WithError(err).Error("error unstarring message")
+		sendInternalError(w, "Error unstarring message")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getStarredMessages handles GET /me/starred, one page at a time (see parsePage)
+func (rt *_router) getStarredMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		sendUnauthorized(w, "User not found in context")
+		return
+	}
+
+	limit, beforeStarredAt, beforeMessageID, reqErr := parsePage(r)
+	if reqErr != nil {
+		sendRequestError(w, reqErr)
+		return
+	}
+
+	// One more than the page size tells whether there is a next page
+	stars, err := rt.db.GetStarredMessages(user.ID, beforeStarredAt, beforeMessageID, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting starred messages")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	response := StarredMessagesResponse{Messages: []StarredMessageResponse{}}
+	if len(stars) > limit {
+		stars = stars[:limit]
+		next := pageCursor(stars[limit-1].StarredAt, stars[limit-1].MessageID)
+		response.NextCursor = &next
+	}
+
+	response.Messages, err = rt.starredMessageResponses(ctx.Logger, user.ID, stars)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("database error getting starred messages")
+		sendInternalError(w, "Database error")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// starredMessageResponses loads the messages of `stars` with their conversations
+func (rt *_router) starredMessageResponses(logger logrus.FieldLogger, viewerID string, stars []database.StarredMessage) ([]StarredMessageResponse, error) {
+	var messages []database.Message
+	for _, star := range stars {
+		msg, err := rt.db.GetMessageByID(star.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		if msg != nil {
+			messages = append(messages, *msg)
+		}
+	}
+
+	responses, conversations, err := rt.messageResponsesWithConversations(logger, viewerID, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	// Expired messages are left out by buildMessageResponses
+	response := make([]StarredMessageResponse, 0, len(stars))
+	for _, star := range stars {
+		m, ok := responses[star.MessageID]
+		if !ok {
+			continue
+		}
+		response = append(response, StarredMessageResponse{
+			Message:      m,
+			Conversation: conversations[m.ConversationID],
+			StarredAt:    star.StarredAt,
+		})
+	}
+	return response, nil
+}
+
+// messageResponsesWithConversations builds the responses of messages from several conversations, keyed by message
+// ID, along with their conversations keyed by conversation ID. Messages are built with buildMessageResponses, once
+// per conversation, so that they look the same as in the conversation; expired messages are left out.
+func (rt *_router) messageResponsesWithConversations(logger logrus.FieldLogger, viewerID string, messages []database.Message) (map[string]MessageResponse, map[string]ConversationReferenceResponse, error) {
+	messagesByConversation := make(map[string][]database.Message)
+	for _, msg := range messages {
+		messagesByConversation[msg.ConversationID] = append(messagesByConversation[msg.ConversationID], msg)
+	}
+
+	blockers := rt.blockedBy(logger, viewerID)
+	conversations := make(map[string]ConversationReferenceResponse)
+	responses := make(map[string]MessageResponse)
+	for conversationID, convMessages := range messagesByConversation {
+		conv, err := rt.db.GetConversationByID(conversationID)
+		if err != nil {
+			return nil, nil, err
+		}
+		participants, err := rt.db.GetParticipants(conversationID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if conv == nil {
+			continue
+		}
+
+		cr := ConversationReferenceResponse{ID: conv.ID, Type: conv.Type, Title: conv.Name, PhotoURL: conv.PhotoURL}
+		if conv.Type == "direct" {
+			cr.Title = selfConversationTitle
+			for _, p := range participants {
+				if p.ID != viewerID {
+					cr.Title = p.Name
+					cr.PhotoURL = visiblePhoto(blockers, p.ID, p.PhotoURL)
+				}
+			}
+		}
+		conversations[conversationID] = cr
+
+		for _, m := range rt.buildMessageResponses(logger, viewerID, conversationID, convMessages) {
+			responses[m.ID] = m
+		}
+	}
+	return responses, conversations, nil
+}
@@ -0,0 +1,96 @@
+package api_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+)
+
+// starredIDs lists the IDs of the messages on a page of starred messages
+func starredIDs(page api.StarredMessagesResponse) []string {
+	ids := make([]string, 0, len(page.Messages))
+	for _, st := range page.Messages {
+		ids = append(ids, st.Message.ID)
+	}
+	return ids
+}
+
+// TestStarredMessages checks that stars are private, listed across conversations with their context, one page at a
+// time, and go away with the message or when the user leaves the conversation
+func TestStarredMessages(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob, carol := s.Login("alice"), s.Login("bob"), s.Login("carol")
+	conv := startConversation(alice, bob)
+	var group api.GroupResponse
+	create := map[string]interface{}{"name": "Crag", "memberIds": []string{bob.ID, carol.ID}}
+	alice.Call(http.MethodPost, "/groups", create, &group, http.StatusCreated)
+
+	var direct, address, time api.MessageResponse
+	bob.Call(http.MethodPost, "/conversations/"+conv+"/messages", textMessage("Wi-Fi: crag2024"), &direct,
+		http.StatusCreated)
+	bob.Call(http.MethodPost, "/conversations/"+group.ID+"/messages", textMessage("Via Roma 1"), &address,
+		http.StatusCreated)
+	carol.Call(http.MethodPost, "/conversations/"+group.ID+"/messages", textMessage("Saturday 9am"), &time,
+		http.StatusCreated)
+	star := func(conversationID string, msg api.MessageResponse) {
+		alice.Call(http.MethodPut, "/conversations/"+conversationID+"/messages/"+msg.ID+"/star", nil, nil,
+			http.StatusNoContent)
+	}
+	star(conv, direct)
+	star(group.ID, address)
+	star(group.ID, time)
+	star(conv, direct)
+
+	if m := getMessage(t, alice, conv, direct.ID); !m.Starred {
+		t.Errorf("alice doesn't see the message she starred as starred")
+	}
+	if m := getMessage(t, bob, conv, direct.ID); m.Starred {
+		t.Errorf("bob sees the message alice starred as starred")
+	}
+
+	// The most recently starred first, starring again keeping the first star, with the conversation of each message
+	var page api.StarredMessagesResponse
+	alice.Call(http.MethodGet, "/me/starred?limit=2", nil, &page, http.StatusOK)
+	if ids := starredIDs(page); len(ids) != 2 || ids[0] != time.ID || ids[1] != address.ID || page.NextCursor == nil {
+		t.Fatalf("the first page lists %v, expected %s and %s and a next page", ids, time.ID, address.ID)
+	}
+	if ref := page.Messages[0].Conversation; ref.ID != group.ID || ref.Type != "group" || ref.Title != "Crag" {
+		t.Errorf("the group message is listed in %s %s %q, expected the group", ref.Type, ref.ID, ref.Title)
+	}
+	if !page.Messages[0].Message.Starred || page.Messages[0].StarredAt == "" {
+		t.Errorf("the starred message is listed as starred %t at %q", page.Messages[0].Message.Starred,
+			page.Messages[0].StarredAt)
+	}
+	cursor := *page.NextCursor
+	page = api.StarredMessagesResponse{}
+	alice.Call(http.MethodGet, "/me/starred?limit=2&cursor="+url.QueryEscape(cursor), nil, &page, http.StatusOK)
+	if ids := starredIDs(page); len(ids) != 1 || ids[0] != direct.ID || page.NextCursor != nil {
+		t.Fatalf("the second page lists %v, expected only %s", ids, direct.ID)
+	}
+	if ref := page.Messages[0].Conversation; ref.ID != conv || ref.Type != "direct" || ref.Title != "bob" {
+		t.Errorf("the direct message is listed in %s %s %q, expected the conversation with bob", ref.Type, ref.ID,
+			ref.Title)
+	}
+
+	// Stars go away with the message, and when leaving the conversation
+	alice.Call(http.MethodDelete, "/conversations/"+conv+"/messages/"+direct.ID+"/star", nil, nil,
+		http.StatusNoContent)
+	bob.Call(http.MethodDelete, "/conversations/"+group.ID+"/messages/"+address.ID, nil, nil, http.StatusNoContent)
+	alice.Call(http.MethodGet, "/me/starred", nil, &page, http.StatusOK)
+	if ids := starredIDs(page); len(ids) != 1 || ids[0] != time.ID {
+		t.Errorf("alice has %v starred, expected only %s", ids, time.ID)
+	}
+	alice.Call(http.MethodDelete, "/groups/"+group.ID+"/members/me", nil, nil, http.StatusNoContent)
+	alice.Call(http.MethodGet, "/me/starred", nil, &page, http.StatusOK)
+	if ids := starredIDs(page); len(ids) != 0 {
+		t.Errorf("alice still has %v starred after leaving the group", ids)
+	}
+
+	carol.Do(http.MethodPut, "/conversations/"+conv+"/messages/"+direct.ID+"/star", nil).
+		ExpectError(http.StatusNotFound, "not-found")
+	alice.Do(http.MethodGet, "/me/starred?cursor=%21", nil).
+		ExpectError(http.StatusBadRequest, "validation-failed", "cursor:invalid-format")
+}
@@ -0,0 +1,209 @@
+package api_test
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ozberk-sevinc/wasa-project/service/apispec"
+)
+
+// matchesSchema finds the doc comments of the types standing for a schema, like "UserResponse matches the User
+// schema"
+var matchesSchema = regexp.MustCompile(`^(\w+) matches the (\w+) schema`)
+
+// TestTypesMatchSpec checks that the types documented as matching a schema, like "UserResponse matches the User
+// schema", have the properties of the schema, with the same JSON types, and don't leave out required properties
+func TestTypesMatchSpec(t *testing.T) {
+	for _, p := range checkTypes(t, loadSpec(t), ".") {
+		t.Error(p)
+	}
+}
+
+// jsonField is a field of a struct as encoding/json sees it
+type jsonField struct {
+	GoName    string
+	Name      string
+	OmitEmpty bool
+	Type      types.Type
+}
+
+// checkTypes compares the types of the api package documented as matching a schema with their schema. Request types,
+// named like ...Request, are only compared on their properties and types: clients decide what they leave out. Nulls
+// depend on the values, so the exchanges check them instead.
+func checkTypes(t *testing.T, spec *apispec.Spec, srcDir string) []string {
+	t.Helper()
+	fset := token.NewFileSet()
+	files := parseDir(t, fset, srcDir)
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	conf := types.Config{Importer: noImporter{}, Error: func(error) {}}
+	_, _ = conf.Check("api", fset, files, info)
+
+	var problems []string
+	checked := 0
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE || gen.Doc == nil {
+				continue
+			}
+			m := matchesSchema.FindStringSubmatch(gen.Doc.Text())
+			if m == nil {
+				continue
+			}
+			for _, s := range gen.Specs {
+				ts, ok := s.(*ast.TypeSpec)
+				if !ok || ts.Name.Name != m[1] {
+					continue
+				}
+				st, ok := info.Defs[ts.Name].Type().Underlying().(*types.Struct)
+				if !ok {
+					continue
+				}
+				where := fmt.Sprintf("%s: %s", fset.Position(ts.Pos()), ts.Name.Name)
+				schema := spec.Schema(m[2])
+				if schema == nil {
+					problems = append(problems, fmt.Sprintf("%s: there is no %s schema", where, m[2]))
+					continue
+				}
+				request := strings.HasSuffix(ts.Name.Name, "Request")
+				problems = append(problems, compareStruct(spec, where, m[2], schema, jsonFields(st), request)...)
+				checked++
+			}
+		}
+	}
+	if checked == 0 {
+		t.Fatalf("no type of %s matches a schema", srcDir)
+	}
+	return problems
+}
+
+// compareStruct compares the fields of a struct with the properties of its schema
+func compareStruct(spec *apispec.Spec, where, name string, schema *apispec.Schema, fields []jsonField,
+	request bool) []string {
+	schema = spec.Resolve(schema)
+	required := make(map[string]bool)
+	for _, prop := range schema.Required {
+		required[prop] = true
+	}
+	var problems []string
+
+	byName := make(map[string]jsonField)
+	for _, f := range fields {
+		byName[f.Name] = f
+		prop, ok := schema.Properties[f.Name]
+		if !ok {
+			if !schema.AllowAdditional {
+				problems = append(problems, fmt.Sprintf("%s.%s is sent as %q, which the %s schema doesn't document",
+					where, f.GoName, f.Name, name))
+			}
+			continue
+		}
+		if got, want := compareType(spec, f.Type, prop); got != want {
+			problems = append(problems, fmt.Sprintf("%s.%s is %s, but %s.%s is %s",
+				where, f.GoName, article(got), name, f.Name, article(want)))
+		}
+		if !request && required[f.Name] && f.OmitEmpty {
+			problems = append(problems, fmt.Sprintf("%s.%s is left out when empty, but %s.%s is required",
+				where, f.GoName, name, f.Name))
+		}
+	}
+
+	names := make([]string, 0, len(schema.Properties))
+	for prop := range schema.Properties {
+		names = append(names, prop)
+	}
+	sort.Strings(names)
+	for _, prop := range names {
+		if _, ok := byName[prop]; !ok {
+			problems = append(problems, fmt.Sprintf("%s has no field for %s.%s", where, name, prop))
+		}
+	}
+	return problems
+}
+
+// jsonFields lists the fields of a struct encoded in JSON, with the fields of embedded structs
+func jsonFields(st *types.Struct) []jsonField {
+	var fields []jsonField
+	for i := 0; i < st.NumFields(); i++ {
+		v := st.Field(i)
+		tag := reflect.StructTag(st.Tag(i)).Get("json")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if v.Embedded() && name == "" {
+			if embedded, ok := v.Type().Underlying().(*types.Struct); ok {
+				fields = append(fields, jsonFields(embedded)...)
+				continue
+			}
+		}
+		if !v.Exported() {
+			continue
+		}
+		if name == "" {
+			name = v.Name()
+		}
+		fields = append(fields, jsonField{
+			GoName:    v.Name(),
+			Name:      name,
+			OmitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+			Type:      v.Type(),
+		})
+	}
+	return fields
+}
+
+// compareType returns the JSON types of a Go type and of a schema, the same when they are compatible
+func compareType(spec *apispec.Spec, t types.Type, prop *apispec.Schema) (string, string) {
+	want := spec.Resolve(prop).Type
+	for {
+		p, ok := t.Underlying().(*types.Pointer)
+		if !ok {
+			break
+		}
+		t = p.Elem()
+	}
+	var got string
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Kind() == types.Invalid:
+			return want, want // a type of another package, not loaded
+		case u.Info()&types.IsString != 0:
+			got = "string"
+		case u.Info()&types.IsInteger != 0:
+			got = "integer"
+		case u.Info()&types.IsFloat != 0:
+			got = "number"
+		case u.Info()&types.IsBoolean != 0:
+			got = "boolean"
+		}
+	case *types.Slice, *types.Array:
+		got = "array"
+	case *types.Struct, *types.Map:
+		got = "object"
+	case *types.Interface:
+		return want, want
+	}
+	if want == "" || got == "integer" && want == "number" {
+		return got, got
+	}
+	return got, want
+}
+
+func article(jsonType string) string {
+	switch jsonType {
+	case "":
+		return "not a JSON type"
+	case "array", "integer", "object":
+		return "an " + jsonType
+	}
+	return "a " + jsonType
+}
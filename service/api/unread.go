@@ -0,0 +1,33 @@
+package api
+
+import (
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/sirupsen/logrus"
+)
+
+// notifyUnreadChanged sends the unread counts of a conversation, and their totals, to each of `userIDs`. It is
+// called whenever the counts may have changed: messages sent, read or deleted, and participants added or removed.
+func (rt *_router) notifyUnreadChanged(logger logrus.FieldLogger, conversationID string, userIDs []string) {
+	if len(userIDs) == 0 {
+		return
+	}
+	now := globaltime.Now().UTC().Format("2006-01-02T15:04:05Z")
+	counts, err := rt.db.GetParticipantUnreadCounts(conversationID, userIDs, now)
+	if err != nil {
+		logger.WithError(err).Warn("error counting unread messages")
+		return
+	}
+	for _, userID := range userIDs {
+		c := counts[userID]
+		_ = rt.wsHub.SendToUser(userID, WebSocketMessage{
+			Type: "unread_changed",
+			Payload: map[string]interface{}{
+				"conversationId":          conversationID,
+				"unreadCount":             c.Conversation.Messages,
+				"unreadMentionCount":      c.Conversation.Mentions,
+				"totalUnreadCount":        c.Total.Messages,
+				"totalUnreadMentionCount": c.Total.Mentions,
+			},
+		})
+	}
+}
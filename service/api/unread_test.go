@@ -0,0 +1,128 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/apitest"
+)
+
+// TestUnreadCountsUnderConcurrency checks the unread counts of a group whose members send and read at the same time:
+// whatever the order the requests run in, nothing is counted twice or lost
+func TestUnreadCountsUnderConcurrency(t *testing.T) {
+	const perSender = 20
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob, carol, dave := s.Login("alice"), s.Login("bob"), s.Login("carol"), s.Login("dave")
+	var group api.GroupResponse
+	create := map[string]interface{}{"name": "Busy", "memberIds": []string{bob.ID, carol.ID, dave.ID}}
+	alice.Call(http.MethodPost, "/groups", create, &group, http.StatusCreated)
+	c := "/conversations/" + group.ID
+	daveEvents := dave.Connect()
+
+	// alice and carol send while bob keeps reading; dave does nothing
+	var wg sync.WaitGroup
+	statuses := make(chan string, 3*perSender)
+	for _, sender := range []*apitest.Client{alice, carol} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perSender {
+				resp := sender.Do(http.MethodPost, c+"/messages", textMessage(fmt.Sprintf("%s %d", sender.Name, i)))
+				if resp.Status != http.StatusCreated {
+					statuses <- fmt.Sprintf("%s sending: status %d", sender.Name, resp.Status)
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range perSender {
+			if resp := bob.Do(http.MethodGet, c, nil); resp.Status != http.StatusOK {
+				statuses <- fmt.Sprintf("bob reading: status %d", resp.Status)
+			}
+		}
+	}()
+	wg.Wait()
+	close(statuses)
+	for status := range statuses {
+		t.Error(status)
+	}
+
+	// dave counts every message, bob none once he read the last ones. Sending reads the conversation, so alice and
+	// carol only count the messages of the other sent after their own last one, but /me and the list must agree.
+	bob.Call(http.MethodGet, c, nil, nil, http.StatusOK)
+	for c, want := range map[*apitest.Client]int{dave: 2 * perSender, bob: 0} {
+		if total, inConversation := unreadCounts(c, group.ID); total != want || inConversation != want {
+			t.Errorf("%s has %d unread messages in total and %d in the group, expected %d", c.Name, total,
+				inConversation, want)
+		}
+	}
+	for _, c := range []*apitest.Client{alice, carol} {
+		if total, inConversation := unreadCounts(c, group.ID); total != inConversation || total > perSender {
+			t.Errorf("%s has %d unread messages in total and %d in the group, expected the same, at most %d", c.Name,
+				total, inConversation, perSender)
+		}
+	}
+
+	// The counts pushed to each member match: dave gets his with the next message, which mentions him
+	alice.Call(http.MethodPost, c+"/messages", textMessage("@dave are you there?"), nil, http.StatusCreated)
+	var unread struct {
+		ConversationID          string `json:"conversationId"`
+		UnreadCount             int    `json:"unreadCount"`
+		UnreadMentionCount      int    `json:"unreadMentionCount"`
+		TotalUnreadCount        int    `json:"totalUnreadCount"`
+		TotalUnreadMentionCount int    `json:"totalUnreadMentionCount"`
+	}
+	daveEvents.WaitWith("unread_changed", "unreadCount", float64(2*perSender+1)).Decode(&unread)
+	if unread.ConversationID != group.ID || unread.TotalUnreadCount != 2*perSender+1 ||
+		unread.UnreadMentionCount != 1 || unread.TotalUnreadMentionCount != 1 {
+		t.Errorf("dave was sent the counts %+v, expected %d unread messages and 1 mention", unread, 2*perSender+1)
+	}
+}
+
+// unreadCounts returns the unread count of a user in total, from /me, and in a conversation, from the list of their
+// conversations
+func unreadCounts(c *apitest.Client, conversationID string) (total, inConversation int) {
+	var me api.MeResponse
+	c.Call(http.MethodGet, "/me", nil, &me, http.StatusOK)
+	var list []api.ConversationSummaryResponse
+	c.Call(http.MethodGet, "/conversations", nil, &list, http.StatusOK)
+	for _, conv := range list {
+		if conv.ID == conversationID {
+			inConversation = conv.UnreadCount
+		}
+	}
+	return me.UnreadCount, inConversation
+}
+
+// TestForwardUpdatesUnreadCounts checks that the participants of the conversation a message is forwarded to are sent
+// their new unread counts, like for any new message
+func TestForwardUpdatesUnreadCounts(t *testing.T) {
+	s := apitest.Start(t, apitest.Options{})
+	alice, bob, carol := s.Login("alice"), s.Login("bob"), s.Login("carol")
+	direct, target := startConversation(bob, alice), startConversation(alice, carol)
+	carolEvents := carol.Connect()
+
+	var original api.MessageResponse
+	bob.Call(http.MethodPost, "/conversations/"+direct+"/messages", textMessage("Party on Friday"), &original,
+		http.StatusCreated)
+	alice.Call(http.MethodPost, "/conversations/"+direct+"/messages/"+original.ID+"/forward",
+		map[string]string{"targetConversationId": target}, nil, http.StatusCreated)
+
+	var unread struct {
+		ConversationID   string `json:"conversationId"`
+		UnreadCount      int    `json:"unreadCount"`
+		TotalUnreadCount int    `json:"totalUnreadCount"`
+	}
+	carolEvents.Wait("unread_changed").Decode(&unread)
+	if unread.ConversationID != target || unread.UnreadCount != 1 || unread.TotalUnreadCount != 1 {
+		t.Errorf("carol was sent the counts %+v, expected 1 unread message in %s", unread, target)
+	}
+	if total, inConversation := unreadCounts(carol, target); total != 1 || inConversation != 1 {
+		t.Errorf("carol has %d unread messages in total and %d in the conversation, expected 1", total, inConversation)
+	}
+}
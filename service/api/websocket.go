@@ -123,6 +123,14 @@ func (h *WebSocketHub) SendToUser(userID string, message WebSocketMessage) error
 	return nil
 }
 
+// IsConnected reports whether the user currently has an open WebSocket connection
+func (h *WebSocketHub) IsConnected(userID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, exists := h.connections[userID]
+	return exists
+}
+
 // BroadcastToUsers sends a message to multiple users
 func (h *WebSocketHub) BroadcastToUsers(userIDs []string, message WebSocketMessage) {
 	for _, userID := range userIDs {
@@ -145,7 +153,15 @@ func (rt *_router) handleWebSocket(w http.ResponseWriter, r *http.Request, ps ht
 			var err error
 			user, err = rt.db.GetUserByID(token)
 			if err != nil || user == nil {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				sendUnauthorized(w, "Invalid token")
+				return
+			}
+			if inactive, err := rt.db.IsInactiveUser(user.ID); err != nil || inactive {
+				sendUnauthorized(w, "Invalid token")
+				return
+			}
+			if err := rt.checkAccountStatus(user.ID); err != nil {
+				sendResolveError(w, ctx.Logger, err)
 				return
 			}
 		} else {
@@ -0,0 +1,223 @@
+/*
+Package apispec checks HTTP exchanges against the OpenAPI 3 specification of the API (doc/api.yaml). It supports the
+parts of OpenAPI the specification uses: path and query parameters, JSON and other request bodies, responses by status,
+and schemas with $ref, allOf, nullable, enum, pattern, lengths and bounds.
+
+Schemas are strict: objects may only have the properties they document, unless they set additionalProperties or
+document none, so that a field added to a response without documenting it is caught.
+
+Load the specification with Load, then check exchanges with CheckRequest and CheckResponse, or wrap a handler with
+Spec.Handler to check all of them.
+*/
+package apispec
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Spec is a loaded OpenAPI specification
+type Spec struct {
+	schemas    map[string]*Schema
+	operations []*Operation
+}
+
+// Operation is a method on a path of the specification
+type Operation struct {
+	// Method is the HTTP method, in upper case
+	Method string
+
+	// Path is the path template, like /conversations/{conversationId}
+	Path string
+
+	ID          string       `yaml:"operationId"`
+	Parameters  []*Parameter `yaml:"parameters"`
+	RequestBody *RequestBody `yaml:"requestBody"`
+
+	// Responses are the documented responses by status code, or "default"
+	Responses map[string]*Response `yaml:"responses"`
+
+	segments []string
+}
+
+// Parameter is a path or query parameter
+type Parameter struct {
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+// RequestBody is the documented body of the requests of an operation
+type RequestBody struct {
+	Required bool                  `yaml:"required"`
+	Content  map[string]*MediaType `yaml:"content"`
+}
+
+// Response is a documented response of an operation
+type Response struct {
+	Headers map[string]*Header    `yaml:"headers"`
+	Content map[string]*MediaType `yaml:"content"`
+}
+
+// Header is a documented response header
+type Header struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+// MediaType is the documented body of a content type
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+// Load reads the specification from a YAML file
+func Load(filename string) (*Spec, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading the specification: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses a specification in YAML
+func Parse(data []byte) (*Spec, error) {
+	var doc struct {
+		Components struct {
+			Schemas map[string]*Schema `yaml:"schemas"`
+		} `yaml:"components"`
+		Paths map[string]struct {
+			Parameters []*Parameter `yaml:"parameters"`
+			Get        *Operation   `yaml:"get"`
+			Put        *Operation   `yaml:"put"`
+			Post       *Operation   `yaml:"post"`
+			Delete     *Operation   `yaml:"delete"`
+			Patch      *Operation   `yaml:"patch"`
+		} `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing the specification: %w", err)
+	}
+	if len(doc.Paths) == 0 {
+		return nil, errors.New("the specification has no paths")
+	}
+
+	spec := &Spec{schemas: doc.Components.Schemas}
+	for path, item := range doc.Paths {
+		methods := map[string]*Operation{
+			http.MethodGet:    item.Get,
+			http.MethodPut:    item.Put,
+			http.MethodPost:   item.Post,
+			http.MethodDelete: item.Delete,
+			http.MethodPatch:  item.Patch,
+		}
+		for method, op := range methods {
+			if op == nil {
+				continue
+			}
+			op.Method = method
+			op.Path = path
+			op.segments = strings.Split(strings.Trim(path, "/"), "/")
+			op.Parameters = append(append([]*Parameter(nil), item.Parameters...), op.Parameters...)
+			spec.operations = append(spec.operations, op)
+		}
+	}
+	sort.Slice(spec.operations, func(i, j int) bool {
+		if spec.operations[i].Path != spec.operations[j].Path {
+			return spec.operations[i].Path < spec.operations[j].Path
+		}
+		return spec.operations[i].Method < spec.operations[j].Method
+	})
+
+	// Check the references and patterns once, so that checking exchanges can't fail because of the specification
+	for name, schema := range spec.schemas {
+		if err := spec.compile(schema, "#/components/schemas/"+name); err != nil {
+			return nil, err
+		}
+	}
+	for _, op := range spec.operations {
+		where := op.Method + " " + op.Path
+		for _, p := range op.Parameters {
+			if err := spec.compile(p.Schema, where+" parameter "+p.Name); err != nil {
+				return nil, err
+			}
+		}
+		if op.RequestBody != nil {
+			for contentType, media := range op.RequestBody.Content {
+				if err := spec.compile(media.Schema, where+" request "+contentType); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for status, resp := range op.Responses {
+			for contentType, media := range resp.Content {
+				if err := spec.compile(media.Schema, where+" response "+status+" "+contentType); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return spec, nil
+}
+
+// Operations returns the operations of the specification, sorted by path then method
+func (s *Spec) Operations() []*Operation {
+	return s.operations
+}
+
+// Schema returns a schema of the components of the specification, or nil
+func (s *Spec) Schema(name string) *Schema {
+	return s.schemas[name]
+}
+
+// Find returns the operation handling a request, and the values of its path parameters. Literal path segments take
+// precedence over parameters, like in /groups/{groupId}/members/me.
+func (s *Spec) Find(method, path string) (*Operation, map[string]string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var best *Operation
+	bestLiterals := -1
+	for _, op := range s.operations {
+		if op.Method != method || len(op.segments) != len(segments) {
+			continue
+		}
+		literals := 0
+		match := true
+		for i, seg := range op.segments {
+			if isParameter(seg) {
+				continue
+			}
+			if seg != segments[i] {
+				match = false
+				break
+			}
+			literals++
+		}
+		if match && literals > bestLiterals {
+			best, bestLiterals = op, literals
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	params := make(map[string]string)
+	for i, seg := range best.segments {
+		if isParameter(seg) {
+			params[strings.Trim(seg, "{}")] = segments[i]
+		}
+	}
+	return best, params
+}
+
+func isParameter(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// String returns the method and path of the operation, like GET /me
+func (op *Operation) String() string {
+	return op.Method + " " + op.Path
+}
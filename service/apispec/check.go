@@ -0,0 +1,236 @@
+package apispec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CheckRequest finds the operation of a request and checks its parameters and body. The body is read from `body`, so
+// that the request body can be passed on. The operation is nil when the specification doesn't document the request.
+func (s *Spec) CheckRequest(r *http.Request, body []byte) (*Operation, []error) {
+	op, pathParams := s.Find(r.Method, r.URL.Path)
+	if op == nil {
+		return nil, []error{fmt.Errorf("%s %s is not documented", r.Method, r.URL.Path)}
+	}
+
+	var errs []error
+	query := r.URL.Query()
+	documented := make(map[string]bool)
+	for _, p := range op.Parameters {
+		var value string
+		var present bool
+		switch p.In {
+		case "path":
+			value, present = pathParams[p.Name]
+		case "query":
+			documented[p.Name] = true
+			present = query.Has(p.Name)
+			value = query.Get(p.Name)
+		default:
+			continue
+		}
+		if !present {
+			if p.Required {
+				errs = append(errs, fmt.Errorf("%s parameter %q: required but missing", p.In, p.Name))
+			}
+			continue
+		}
+		errs = append(errs, s.checkParameter(p, value)...)
+	}
+	for name := range query {
+		if !documented[name] {
+			errs = append(errs, fmt.Errorf("query parameter %q is not documented", name))
+		}
+	}
+
+	contentType := mediaType(r.Header.Get("Content-Type"))
+	switch {
+	case len(body) == 0:
+		if op.RequestBody != nil && op.RequestBody.Required {
+			errs = append(errs, errors.New("request body: required but missing"))
+		}
+	case op.RequestBody == nil:
+		errs = append(errs, errors.New("request body: not documented"))
+	default:
+		media, ok := op.RequestBody.Content[contentType]
+		if !ok {
+			errs = append(errs, fmt.Errorf("request body: content type %q is not documented", contentType))
+		} else if isJSON(contentType) && media.Schema != nil {
+			// Other bodies, like multipart forms with files, only have their content type checked
+			errs = append(errs, s.ValidateJSON(media.Schema, body, "request body")...)
+		}
+	}
+	return op, errs
+}
+
+// checkParameter checks the value of a path or query parameter, converted to the type of its schema
+func (s *Spec) checkParameter(p *Parameter, value string) []error {
+	at := p.In + " parameter " + strconv.Quote(p.Name)
+	schema, err := s.resolve(p.Schema)
+	if err != nil || schema == nil {
+		return nil
+	}
+	var v interface{} = value
+	switch schema.Type {
+	case "integer", "number":
+		v = json.Number(value)
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return []error{fmt.Errorf("%s: %q is not a number", at, value)}
+		}
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return []error{fmt.Errorf("%s: %q is not a boolean", at, value)}
+		}
+		v = b
+	}
+	return s.Validate(schema, v, at)
+}
+
+// CheckResponse checks the status, headers and body of a response to an operation
+func (s *Spec) CheckResponse(op *Operation, status int, header http.Header, body []byte) []error {
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return []error{fmt.Errorf("status %d is not documented", status)}
+	}
+
+	var errs []error
+	for name, h := range resp.Headers {
+		value := header.Get(name)
+		if value == "" {
+			errs = append(errs, fmt.Errorf("response header %s: missing", name))
+			continue
+		}
+		errs = append(errs, s.checkParameter(&Parameter{Name: name, In: "header", Schema: h.Schema}, value)...)
+	}
+
+	if len(body) == 0 || status == http.StatusSwitchingProtocols {
+		return errs
+	}
+	if len(resp.Content) == 0 {
+		return append(errs, fmt.Errorf("response body: not documented for status %d", status))
+	}
+	contentType := mediaType(header.Get("Content-Type"))
+	media, ok := resp.Content[contentType]
+	if !ok {
+		documented := make([]string, 0, len(resp.Content))
+		for ct := range resp.Content {
+			documented = append(documented, ct)
+		}
+		sort.Strings(documented)
+		return append(errs, fmt.Errorf("response body: content type %q is not documented, expected %s",
+			contentType, strings.Join(documented, " or ")))
+	}
+	if isJSON(contentType) && media.Schema != nil {
+		errs = append(errs, s.ValidateJSON(media.Schema, body, "response body")...)
+	}
+	return errs
+}
+
+// Exchange is a request and its response checked by Spec.Handler
+type Exchange struct {
+	Request *http.Request
+
+	// Operation is nil when the request is not documented
+	Operation *Operation
+	Status    int
+
+	// RequestProblems are what doesn't match the specification in the request, and ResponseProblems in the response
+	RequestProblems  []error
+	ResponseProblems []error
+}
+
+// Handler returns a handler passing requests to `next`, and calling `report` with each request and response checked
+// against the specification. Upgraded connections, like WebSockets, are reported with status 101 when upgraded.
+func (s *Spec) Handler(next http.Handler, report func(Exchange)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		op, requestProblems := s.CheckRequest(r, body)
+
+		rec := &recorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		var responseProblems []error
+		if op != nil {
+			responseProblems = s.CheckResponse(op, rec.status, w.Header(), rec.body.Bytes())
+		}
+		report(Exchange{
+			Request:          r,
+			Operation:        op,
+			Status:           rec.status,
+			RequestProblems:  requestProblems,
+			ResponseProblems: responseProblems,
+		})
+	})
+}
+
+// recorder passes a response on while keeping its status and body
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(data []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(data)
+	return rec.ResponseWriter.Write(data)
+}
+
+// Hijack lets WebSocket connections be upgraded
+func (rec *recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response can't be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mt
+}
+
+func isJSON(mt string) bool {
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
@@ -0,0 +1,416 @@
+package apispec
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema is a schema of the specification. Only the keywords the specification uses are supported.
+type Schema struct {
+	Ref        string             `yaml:"$ref"`
+	Type       string             `yaml:"type"`
+	Format     string             `yaml:"format"`
+	Nullable   bool               `yaml:"nullable"`
+	Enum       []interface{}      `yaml:"enum"`
+	Pattern    string             `yaml:"pattern"`
+	MinLength  *int               `yaml:"minLength"`
+	MaxLength  *int               `yaml:"maxLength"`
+	Minimum    *float64           `yaml:"minimum"`
+	Maximum    *float64           `yaml:"maximum"`
+	MinItems   *int               `yaml:"minItems"`
+	MaxItems   *int               `yaml:"maxItems"`
+	Items      *Schema            `yaml:"items"`
+	Properties map[string]*Schema `yaml:"properties"`
+	Required   []string           `yaml:"required"`
+	AllOf      []*Schema          `yaml:"allOf"`
+
+	// AdditionalProperties is the schema of the properties of an object that Properties doesn't list, when
+	// additionalProperties is a schema; AllowAdditional is set when it is true or a schema
+	AdditionalProperties *Schema `yaml:"-"`
+	AllowAdditional      bool    `yaml:"-"`
+
+	pattern *regexp.Regexp
+}
+
+// UnmarshalYAML decodes a schema, whose additionalProperties may be a boolean or a schema
+func (schema *Schema) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Schema
+	if err := unmarshal((*plain)(schema)); err != nil {
+		return err
+	}
+	var additional struct {
+		Value interface{} `yaml:"additionalProperties"`
+	}
+	if err := unmarshal(&additional); err != nil {
+		return err
+	}
+	switch v := additional.Value.(type) {
+	case nil:
+	case bool:
+		schema.AllowAdditional = v
+	default:
+		var sub struct {
+			Schema *Schema `yaml:"additionalProperties"`
+		}
+		if err := unmarshal(&sub); err != nil {
+			return err
+		}
+		schema.AdditionalProperties = sub.Schema
+		schema.AllowAdditional = true
+	}
+	return nil
+}
+
+// compile resolves the references and compiles the patterns of a schema and its subschemas
+func (s *Spec) compile(schema *Schema, where string) error {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != "" {
+		if _, err := s.resolve(schema); err != nil {
+			return fmt.Errorf("%s: %w", where, err)
+		}
+		return nil
+	}
+	if schema.Pattern != "" && schema.pattern == nil {
+		re, err := compilePattern(schema.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: pattern %q: %w", where, schema.Pattern, err)
+		}
+		schema.pattern = re
+	}
+	if err := s.compile(schema.Items, where+".items"); err != nil {
+		return err
+	}
+	for name, prop := range schema.Properties {
+		if err := s.compile(prop, where+"."+name); err != nil {
+			return err
+		}
+	}
+	for i, sub := range schema.AllOf {
+		if err := s.compile(sub, fmt.Sprintf("%s.allOf[%d]", where, i)); err != nil {
+			return err
+		}
+	}
+	return s.compile(schema.AdditionalProperties, where+".additionalProperties")
+}
+
+// largeRepeat matches the counted repetitions Go regular expressions don't support, like {1,4096}
+var largeRepeat = regexp.MustCompile(`\{(\d+),(\d{4,})\}`)
+
+// compilePattern compiles an ECMAScript pattern with Go regular expressions. Repetitions of more than 1000, which Go
+// doesn't support, are left unbounded: they are limits on lengths, which minLength and maxLength check anyway.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err == nil {
+		return re, nil
+	}
+	relaxed := largeRepeat.ReplaceAllStringFunc(pattern, func(m string) string {
+		bounds := largeRepeat.FindStringSubmatch(m)
+		if max, _ := strconv.Atoi(bounds[2]); max <= 1000 {
+			return m
+		}
+		return "{" + bounds[1] + ",}"
+	})
+	if relaxed == pattern {
+		return nil, err
+	}
+	return regexp.Compile(relaxed)
+}
+
+// resolve follows the $ref of a schema, if any
+func (s *Spec) resolve(schema *Schema) (*Schema, error) {
+	for seen := 0; schema.Ref != ""; seen++ {
+		name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/")
+		if !ok {
+			return nil, fmt.Errorf("unsupported reference %q", schema.Ref)
+		}
+		target, ok := s.schemas[name]
+		if !ok || seen > len(s.schemas) {
+			return nil, fmt.Errorf("unknown schema %q", schema.Ref)
+		}
+		schema = target
+	}
+	return schema, nil
+}
+
+// Resolve returns the schema a schema stands for, with its $ref followed and its allOf schemas merged, or nil
+func (s *Spec) Resolve(schema *Schema) *Schema {
+	if schema == nil {
+		return nil
+	}
+	schema, err := s.resolve(schema)
+	if err != nil {
+		return nil
+	}
+	if len(schema.AllOf) > 0 {
+		schema = s.merge(schema)
+	}
+	return schema
+}
+
+// Validate checks a JSON value, decoded with json.Decoder.UseNumber, against a schema. `at` names the value in the
+// errors, like "response body".
+func (s *Spec) Validate(schema *Schema, value interface{}, at string) []error {
+	var errs []error
+	s.validate(schema, value, at, &errs)
+	return errs
+}
+
+// ValidateJSON decodes a JSON document and checks it against a schema
+func (s *Spec) ValidateJSON(schema *Schema, data []byte, at string) []error {
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return []error{fmt.Errorf("%s: invalid JSON: %w", at, err)}
+	}
+	if dec.More() {
+		return []error{fmt.Errorf("%s: invalid JSON: data after the value", at)}
+	}
+	return s.Validate(schema, value, at)
+}
+
+func (s *Spec) validate(schema *Schema, value interface{}, at string, errs *[]error) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, fmt.Errorf("%s: %s", at, fmt.Sprintf(format, args...)))
+	}
+	if schema == nil {
+		return
+	}
+	schema, err := s.resolve(schema)
+	if err != nil {
+		fail("%s", err)
+		return
+	}
+	if len(schema.AllOf) > 0 {
+		schema = s.merge(schema)
+	}
+
+	if value == nil {
+		if !schema.Nullable && schema.Type != "" {
+			fail("is null, expected %s", schema.Type)
+		}
+		return
+	}
+
+	switch schema.Type {
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			fail("is %s, expected string", jsonType(value))
+			return
+		}
+		s.validateString(schema, str, fail)
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			fail("is %s, expected %s", jsonType(value), schema.Type)
+			return
+		}
+		f, err := n.Float64()
+		if err != nil {
+			fail("is not a number: %s", n)
+			return
+		}
+		if schema.Type == "integer" && (f != math.Trunc(f) || strings.ContainsAny(n.String(), ".eE")) {
+			fail("is %s, expected an integer", n)
+		}
+		if schema.Minimum != nil && f < *schema.Minimum {
+			fail("is %s, less than the minimum %v", n, *schema.Minimum)
+		}
+		if schema.Maximum != nil && f > *schema.Maximum {
+			fail("is %s, more than the maximum %v", n, *schema.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("is %s, expected boolean", jsonType(value))
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			fail("is %s, expected array", jsonType(value))
+			return
+		}
+		if schema.MinItems != nil && len(items) < *schema.MinItems {
+			fail("has %d items, less than %d", len(items), *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(items) > *schema.MaxItems {
+			fail("has %d items, more than %d", len(items), *schema.MaxItems)
+		}
+		for i, item := range items {
+			s.validate(schema.Items, item, fmt.Sprintf("%s[%d]", at, i), errs)
+		}
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			fail("is %s, expected object", jsonType(value))
+			return
+		}
+		s.validateObject(schema, obj, at, errs)
+	case "":
+		// Any value
+	default:
+		fail("unsupported schema type %q", schema.Type)
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		fail("is %v, not one of %v", value, schema.Enum)
+	}
+}
+
+func (s *Spec) validateString(schema *Schema, str string, fail func(string, ...interface{})) {
+	n := utf8.RuneCountInString(str)
+	if schema.MinLength != nil && n < *schema.MinLength {
+		fail("has %d characters, less than %d", n, *schema.MinLength)
+	}
+	if schema.MaxLength != nil && n > *schema.MaxLength {
+		fail("has %d characters, more than %d", n, *schema.MaxLength)
+	}
+	if schema.pattern != nil && !schema.pattern.MatchString(str) {
+		fail("%q doesn't match the pattern %s", abbreviate(str), schema.Pattern)
+	}
+	switch schema.Format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			fail("%q is not an RFC 3339 date-time", abbreviate(str))
+		}
+	case "email":
+		if _, err := mail.ParseAddress(str); err != nil {
+			fail("%q is not an email address", abbreviate(str))
+		}
+	case "url", "uri":
+		// Relative references, like the paths of uploaded files, are allowed
+		if _, err := url.Parse(str); err != nil {
+			fail("%q is not a URL", abbreviate(str))
+		}
+	}
+}
+
+func (s *Spec) validateObject(schema *Schema, obj map[string]interface{}, at string, errs *[]error) {
+	for _, name := range schema.Required {
+		if _, ok := obj[name]; !ok {
+			*errs = append(*errs, fmt.Errorf("%s: required property %q is missing", at, name))
+		}
+	}
+	if len(schema.Properties) == 0 && schema.AdditionalProperties == nil {
+		// An object without documented properties, like the export document, may have any
+		return
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop, ok := schema.Properties[name]
+		switch {
+		case ok:
+			s.validate(prop, obj[name], at+"."+name, errs)
+		case schema.AdditionalProperties != nil:
+			s.validate(schema.AdditionalProperties, obj[name], at+"."+name, errs)
+		case !schema.AllowAdditional:
+			*errs = append(*errs, fmt.Errorf("%s: property %q is not documented", at, name))
+		}
+	}
+}
+
+// merge returns a schema with the properties and constraints of a schema and of all its allOf schemas
+func (s *Spec) merge(schema *Schema) *Schema {
+	merged := *schema
+	merged.AllOf = nil
+	merged.Properties = make(map[string]*Schema)
+	merged.Required = append([]string(nil), schema.Required...)
+	for name, prop := range schema.Properties {
+		merged.Properties[name] = prop
+	}
+	for _, sub := range schema.AllOf {
+		sub, err := s.resolve(sub)
+		if err != nil {
+			continue
+		}
+		if len(sub.AllOf) > 0 {
+			sub = s.merge(sub)
+		}
+		if merged.Type == "" {
+			merged.Type = sub.Type
+		}
+		for name, prop := range sub.Properties {
+			merged.Properties[name] = prop
+		}
+		merged.Required = append(merged.Required, sub.Required...)
+		if sub.AllowAdditional {
+			merged.AllowAdditional = true
+		}
+	}
+	return &merged
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		switch v := value.(type) {
+		case string:
+			if s, ok := e.(string); ok && s == v {
+				return true
+			}
+		case json.Number:
+			f, err := v.Float64()
+			if n, ok := toFloat(e); ok && err == nil && n == f {
+				return true
+			}
+		case bool:
+			if b, ok := e.(bool); ok && b == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// toFloat converts a number of the specification, decoded from YAML
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "null"
+}
+
+// abbreviate shortens long values in errors
+func abbreviate(s string) string {
+	if utf8.RuneCountInString(s) <= 60 {
+		return s
+	}
+	return string([]rune(s)[:57]) + "..."
+}
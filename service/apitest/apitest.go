@@ -0,0 +1,196 @@
+/*
+Package apitest runs the API server end to end for the tests driving it over HTTP and WebSockets: the router of the
+api package on a new SQLite database in a temporary directory, served on a local port, with the clock of the server fixed.
+
+Start a server, log users in, and call the API as them:
+
+	func TestSend(t *testing.T) {
+		s := apitest.Start(t, apitest.Options{})
+		alice, bob := s.Login("alice"), s.Login("bob")
+		events := bob.Connect()
+
+		var msg api.MessageResponse
+		alice.Call(http.MethodPost, "/conversations/"+id+"/messages", body, &msg, http.StatusCreated)
+		ev := events.Wait("new_message")
+		...
+	}
+
+The helpers fail the test (t.Fatal) when a request can't be sent or doesn't get the expected answer, and the server
+is closed when the test ends (t.Cleanup).
+
+The clock of the server (globaltime) starts at Options.Now and moves one second forward before every request, so
+that what the requests create is ordered and has predictable timestamps. The handlers store uploads and exports
+relative to the working directory, so Start moves to a temporary directory (t.Chdir). Both are global to the process:
+tests using a server can't run in parallel.
+*/
+package apitest
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultNow is the time the clock of the server starts at, unless Options.Now is set
+var DefaultNow = time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// Options configure a test server. The zero value runs the server with the default configuration.
+type Options struct {
+	// Now is the time the clock of the server starts at (default DefaultNow)
+	Now time.Time
+
+	// Configure, if set, changes the configuration of the router before it is created. It runs in the directory of
+	// the server, where it can create files.
+	Configure func(cfg *api.Config) error
+
+	// Wrap, if set, wraps the handler of the router, for example to check every exchange
+	Wrap func(http.Handler) http.Handler
+
+	// OnEvent, if set, is called with every WebSocket message received by a client, as sent by the server. It runs
+	// in the goroutine reading the WebSocket: it may call t.Error, but not t.Fatal.
+	OnEvent func(data []byte)
+
+	// Logger receives the logs of the server (default: discarded)
+	Logger logrus.FieldLogger
+}
+
+// Server is a running API server
+type Server struct {
+	// URL is the base URL of the API, like http://127.0.0.1:41234
+	URL string
+
+	// DB is the database of the server, to prepare data the API can't create
+	DB database.AppDatabase
+
+	// Router is the router of the server, to run its background tasks in tests of the api package
+	Router api.Router
+
+	// SQL is the connection to the database of the server, to check what the database enforces by itself
+	SQL *sql.DB
+
+	tb     testing.TB
+	opts   Options
+	dbconn *sql.DB
+	http   *httptest.Server
+
+	mu      sync.Mutex
+	sockets []*Socket
+}
+
+// Start starts a server on a new database. It is closed when the test ends.
+func Start(tb testing.TB, opts Options) *Server {
+	tb.Helper()
+	if !globaltime.FixedTime().IsZero() {
+		tb.Fatal("the clock is already fixed: is another server running?")
+	}
+	if opts.Now.IsZero() {
+		opts.Now = DefaultNow
+	}
+	if opts.Logger == nil {
+		logger := logrus.New()
+		logger.SetOutput(io.Discard)
+		opts.Logger = logger
+	}
+
+	tb.Chdir(tb.TempDir())
+	globaltime.SetFixedTime(opts.Now)
+	s := &Server{tb: tb, opts: opts}
+	tb.Cleanup(s.close)
+
+	// A database file in the directory of the server, with a pool like the one of webapi. An in-memory database
+	// doesn't fit: with a shared cache, concurrent writes fail with "table is locked" instead of waiting for the busy
+	// timeout, and a pool of a single connection deadlocks on the queries the database package runs while iterating
+	// the rows of another (MarkMessagesAsRead).
+	var err error
+	s.dbconn, err = sql.Open("sqlite3", "file:wasatext.db?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		tb.Fatalf("opening SQLite: %v", err)
+	}
+	s.dbconn.SetMaxOpenConns(5)
+	s.dbconn.SetMaxIdleConns(2)
+	s.SQL = s.dbconn
+	if s.DB, err = database.New(s.dbconn); err != nil {
+		tb.Fatalf("creating the database: %v", err)
+	}
+
+	cfg := api.Config{Logger: opts.Logger, Database: s.DB}
+	if opts.Configure != nil {
+		if err := opts.Configure(&cfg); err != nil {
+			tb.Fatalf("configuring the server: %v", err)
+		}
+	}
+	if s.Router, err = api.New(cfg); err != nil {
+		tb.Fatalf("creating the API server: %v", err)
+	}
+
+	handler := s.Router.Handler()
+	if opts.Wrap != nil {
+		handler = opts.Wrap(handler)
+	}
+	s.http = httptest.NewServer(handler)
+	s.URL = s.http.URL
+	return s
+}
+
+// close closes the WebSockets of the clients and stops the server. Its background tasks are stopped before the
+// database is closed and the clock is reset.
+func (s *Server) close() {
+	s.mu.Lock()
+	sockets := s.sockets
+	s.sockets = nil
+	s.mu.Unlock()
+	for _, socket := range sockets {
+		_ = socket.conn.Close()
+	}
+
+	if s.http != nil {
+		s.http.Close()
+	}
+	if s.Router != nil {
+		_ = s.Router.Close()
+	}
+	if s.dbconn != nil {
+		_ = s.dbconn.Close()
+	}
+	globaltime.SetFixedTime(time.Time{})
+}
+
+// Now returns the time of the clock of the server
+func (s *Server) Now() time.Time {
+	return globaltime.Now()
+}
+
+// Advance moves the clock of the server forward
+func (s *Server) Advance(d time.Duration) {
+	globaltime.Advance(d)
+}
+
+// GrantAdmin grants the admin role to a user, as the admin command of the server does
+func (s *Server) GrantAdmin(c *Client) {
+	s.tb.Helper()
+	id, err := uuid.NewV4()
+	if err != nil {
+		s.tb.Fatal(err)
+	}
+	err = s.DB.SetAdmin(c.ID, true, database.AuditEntry{
+		ID:         id.String(),
+		Action:     "admin.grant",
+		TargetType: "user",
+		TargetID:   c.ID,
+		CreatedAt:  s.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		s.tb.Fatalf("granting the admin role to %s: %v", c.Name, err)
+	}
+}
@@ -0,0 +1,173 @@
+package apitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozberk-sevinc/wasa-project/service/api"
+)
+
+// Client calls the API as a user, or as nobody
+type Client struct {
+	// ID is the identifier of the user, sent as the bearer token; empty for Anonymous clients
+	ID   string
+	Name string
+
+	server *Server
+}
+
+// Response is a response of the server
+type Response struct {
+	Method, Path string
+	Status       int
+	Header       http.Header
+	Body         []byte
+
+	tb testing.TB
+}
+
+// Decode decodes the JSON body of the response
+func (r *Response) Decode(v interface{}) {
+	r.tb.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		r.tb.Fatalf("%s %s: decoding the response: %v", r.Method, r.Path, err)
+	}
+}
+
+// Expect checks that the response has status `want`, and decodes its body in `out`, if not nil
+func (r *Response) Expect(want int, out interface{}) {
+	r.tb.Helper()
+	if r.Status != want {
+		r.tb.Fatalf("%s %s: status %d, expected %d: %s", r.Method, r.Path, r.Status, want,
+			strings.TrimSpace(string(r.Body)))
+	}
+	if out != nil {
+		r.Decode(out)
+	}
+}
+
+// ExpectError checks that the response is an error with a status and an error code. Its details, if any, must be
+// `fieldCodes`, in the form "field:code".
+func (r *Response) ExpectError(status int, code string, fieldCodes ...string) {
+	r.tb.Helper()
+	var body api.ErrorResponse
+	r.Decode(&body)
+	if r.Status != status || body.Code != code {
+		r.tb.Fatalf("%s %s: expected a %d %s error, got %d %s", r.Method, r.Path, status, code, r.Status, body.Code)
+	}
+	var got []string
+	for _, d := range body.Details {
+		got = append(got, d.Field+":"+d.Code)
+	}
+	if strings.Join(got, " ") != strings.Join(fieldCodes, " ") {
+		r.tb.Fatalf("%s %s: expected the error details %v, got %v", r.Method, r.Path, fieldCodes, got)
+	}
+}
+
+// Anonymous returns a client sending no identifier
+func (s *Server) Anonymous() *Client {
+	return &Client{server: s}
+}
+
+// Login logs a user in, creating them if needed, and returns a client calling the API as them
+func (s *Server) Login(name string) *Client {
+	s.tb.Helper()
+	var resp api.LoginResponse
+	s.Anonymous().Call(http.MethodPost, "/session", api.LoginRequest{Name: name}, &resp, http.StatusCreated)
+	return &Client{ID: resp.Identifier, Name: name, server: s}
+}
+
+// Do sends a request with `body` encoded in JSON, if not nil. Paths are relative to the API, like /me.
+func (c *Client) Do(method, path string, body interface{}) *Response {
+	c.server.tb.Helper()
+	var reader io.Reader
+	contentType := ""
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.server.tb.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+	return c.send(method, path, contentType, reader)
+}
+
+// Call sends a request like Do, checks that the response has status `want`, and decodes its body in `out`, if not
+// nil
+func (c *Client) Call(method, path string, body, out interface{}, want int) {
+	c.server.tb.Helper()
+	c.Do(method, path, body).Expect(want, out)
+}
+
+// DoUpload sends a multipart form with a file and text fields
+func (c *Client) DoUpload(method, path, fileField, fileName string, file []byte, fields map[string]string) *Response {
+	c.server.tb.Helper()
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			c.server.tb.Fatal(err)
+		}
+	}
+	part, err := form.CreateFormFile(fileField, fileName)
+	if err != nil {
+		c.server.tb.Fatal(err)
+	}
+	if _, err := part.Write(file); err != nil {
+		c.server.tb.Fatal(err)
+	}
+	if err := form.Close(); err != nil {
+		c.server.tb.Fatal(err)
+	}
+	return c.send(method, path, form.FormDataContentType(), &buf)
+}
+
+// Upload sends a multipart form like DoUpload, and checks the response like Call
+func (c *Client) Upload(method, path, fileField, fileName string, file []byte, fields map[string]string,
+	out interface{}, want int) {
+	c.server.tb.Helper()
+	c.DoUpload(method, path, fileField, fileName, file, fields).Expect(want, out)
+}
+
+func (c *Client) send(method, path, contentType string, body io.Reader) *Response {
+	tb := c.server.tb
+	tb.Helper()
+	req, err := http.NewRequest(method, c.server.URL+path, body)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.ID != "" {
+		req.Header.Set("Authorization", "Bearer "+c.ID)
+	}
+
+	c.server.Advance(time.Second)
+	resp, err := c.server.http.Client().Do(req)
+	if err != nil {
+		tb.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		tb.Fatalf("%s %s: %v", method, path, err)
+	}
+	return &Response{Method: method, Path: path, Status: resp.StatusCode, Header: resp.Header, Body: data, tb: tb}
+}
+
+// Photo returns a small PNG image, to upload as a photo
+func Photo() []byte {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)))
+	return buf.Bytes()
+}
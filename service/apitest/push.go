@@ -0,0 +1,220 @@
+package apitest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// PushSubscription is a subscription of a browser to a PushService, as the browser gives it to the API
+type PushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// Push is a notification received by a PushService, decrypted as the browser would
+type Push struct {
+	Endpoint string
+	Header   http.Header
+	Payload  []byte
+}
+
+// PushService is a local web push service standing in for the ones of the browsers. It decrypts the notifications
+// (RFC 8291) with the keys of the subscriptions it made, and answers 410 Gone for the expired ones.
+type PushService struct {
+	// URL is the base URL of the service, like http://127.0.0.1:41234
+	URL string
+
+	http   *httptest.Server
+	pushes chan Push
+	tb     testing.TB
+
+	mu       sync.Mutex
+	browsers map[string]*browserKeys // by endpoint path
+	expired  map[string]bool
+}
+
+// browserKeys are the keys a browser keeps for a subscription
+type browserKeys struct {
+	private *ecdh.PrivateKey
+	auth    []byte
+}
+
+// StartPushService starts a push service on a local port. It is closed when the test ends.
+func StartPushService(tb testing.TB) *PushService {
+	tb.Helper()
+	p := &PushService{
+		pushes:   make(chan Push, 64),
+		tb:       tb,
+		browsers: make(map[string]*browserKeys),
+		expired:  make(map[string]bool),
+	}
+	p.http = httptest.NewServer(http.HandlerFunc(p.serve))
+	p.URL = p.http.URL
+	tb.Cleanup(p.http.Close)
+	return p
+}
+
+// Subscribe creates a subscription, with new browser keys
+func (p *PushService) Subscribe() PushSubscription {
+	p.tb.Helper()
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		p.tb.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	if _, err := rand.Read(auth); err != nil {
+		p.tb.Fatal(err)
+	}
+
+	p.mu.Lock()
+	path := "/push/" + strconv.Itoa(len(p.browsers)+1)
+	p.browsers[path] = &browserKeys{private: private, auth: auth}
+	p.mu.Unlock()
+
+	var sub PushSubscription
+	sub.Endpoint = p.URL + path
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(private.PublicKey().Bytes())
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(auth)
+	return sub
+}
+
+// Expire makes the service answer 410 Gone to the notifications of a subscription, as when the user revoked it
+func (p *PushService) Expire(sub PushSubscription) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expired[strings.TrimPrefix(sub.Endpoint, p.URL)] = true
+}
+
+// Wait returns the next notification the service accepts
+func (p *PushService) Wait() Push {
+	p.tb.Helper()
+	select {
+	case push := <-p.pushes:
+		return push
+	case <-time.After(EventTimeout):
+		p.tb.Fatalf("the push service got no notification after %s", EventTimeout)
+		return Push{}
+	}
+}
+
+// ExpectNone checks that the service accepts no notification within `d`
+func (p *PushService) ExpectNone(d time.Duration) {
+	p.tb.Helper()
+	select {
+	case push := <-p.pushes:
+		p.tb.Fatalf("the push service got an unexpected notification for %s: %s", push.Endpoint, push.Payload)
+	case <-time.After(d):
+	}
+}
+
+func (p *PushService) serve(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	keys, known := p.browsers[r.URL.Path]
+	expired := p.expired[r.URL.Path]
+	p.mu.Unlock()
+	switch {
+	case !known:
+		http.NotFound(w, r)
+		return
+	case expired:
+		w.WriteHeader(http.StatusGone)
+		return
+	case r.Method != http.MethodPost || r.Header.Get("Content-Encoding") != "aes128gcm" ||
+		!strings.HasPrefix(r.Header.Get("Authorization"), "vapid t="):
+		http.Error(w, "not a web push request", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payload, err := keys.decrypt(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.pushes <- Push{Endpoint: p.URL + r.URL.Path, Header: r.Header.Clone(), Payload: payload}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// decrypt decrypts a single-record aes128gcm body (RFC 8188) with the keys of the browser (RFC 8291)
+func (k *browserKeys) decrypt(body []byte) ([]byte, error) {
+	const saltSize, publicSize = 16, 65
+	if len(body) < saltSize+5+publicSize || body[saltSize+4] != publicSize {
+		return nil, errors.New("invalid aes128gcm header")
+	}
+	salt := body[:saltSize]
+	if binary.BigEndian.Uint32(body[saltSize:]) < uint32(len(body)) {
+		return nil, errors.New("more than one record")
+	}
+	serverPublic := body[saltSize+5 : saltSize+5+publicSize]
+	ciphertext := body[saltSize+5+publicSize:]
+
+	server, err := ecdh.P256().NewPublicKey(serverPublic)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := k.private.ECDH(server)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo := "WebPush: info\x00" + string(k.private.PublicKey().Bytes()) + string(serverPublic)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, k.auth, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The content ends with the delimiter of the last record, then zero padding
+	end := len(plaintext) - 1
+	for end >= 0 && plaintext[end] == 0 {
+		end--
+	}
+	if end < 0 || plaintext[end] != 0x02 {
+		return nil, errors.New("missing last record delimiter")
+	}
+	return plaintext[:end], nil
+}
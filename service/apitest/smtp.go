@@ -0,0 +1,177 @@
+package apitest
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Mail is an email received by an SMTPSink
+type Mail struct {
+	From    string
+	To      []string
+	Header  mail.Header
+	Subject string // decoded
+	Text    string // the text/plain part, decoded
+	HTML    string // the text/html part, decoded
+}
+
+// SMTPSink is a local SMTP server keeping the emails it receives, for the tests of what the server mails. It offers
+// no extension, STARTTLS and AUTH included, and accepts every sender and recipient.
+type SMTPSink struct {
+	// Host and Port are the address of the sink, for mailer.SMTPConfig
+	Host string
+	Port int
+
+	ln    net.Listener
+	mails chan Mail
+	tb    testing.TB
+}
+
+// StartSMTPSink starts an SMTP sink on a local port. It is closed when the test ends.
+func StartSMTPSink(tb testing.TB) *SMTPSink {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("starting the SMTP sink: %v", err)
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	s := &SMTPSink{Host: addr.IP.String(), Port: addr.Port, ln: ln, mails: make(chan Mail, 64), tb: tb}
+	tb.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// Wait returns the next email the sink receives
+func (s *SMTPSink) Wait() Mail {
+	s.tb.Helper()
+	select {
+	case m := <-s.mails:
+		return m
+	case <-time.After(EventTimeout):
+		s.tb.Fatalf("the SMTP sink got no email after %s", EventTimeout)
+		return Mail{}
+	}
+}
+
+// ExpectNone checks that the sink receives no email within `d`
+func (s *SMTPSink) ExpectNone(d time.Duration) {
+	s.tb.Helper()
+	select {
+	case m := <-s.mails:
+		s.tb.Fatalf("the SMTP sink got an unexpected email to %v: %s", m.To, m.Subject)
+	case <-time.After(d):
+	}
+}
+
+// serve runs an SMTP session
+func (s *SMTPSink) serve(conn net.Conn) {
+	c := textproto.NewConn(conn)
+	defer c.Close()
+	_ = conn.SetDeadline(time.Now().Add(EventTimeout))
+
+	var m Mail
+	reply := func(line string) bool { return c.PrintfLine("%s", line) == nil }
+	if !reply("220 apitest SMTP sink") {
+		return
+	}
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250 apitest")
+		case "MAIL":
+			m = Mail{From: address(arg)}
+			reply("250 OK")
+		case "RCPT":
+			m.To = append(m.To, address(arg))
+			reply("250 OK")
+		case "DATA":
+			if !reply("354 End data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			if err := parseMail(&m, data); err != nil {
+				reply("554 " + err.Error())
+				continue
+			}
+			s.mails <- m
+			reply("250 OK")
+		case "RSET", "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// address returns the address of a MAIL FROM:<...> or RCPT TO:<...> argument
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	return strings.Trim(strings.TrimSpace(addr), "<>")
+}
+
+// parseMail decodes the headers and the parts of an email
+func parseMail(m *Mail, data []byte) error {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	m.Header = msg.Header
+	if m.Subject, err = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); err != nil {
+		return err
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		body, err := io.ReadAll(msg.Body)
+		m.Text = string(body)
+		return err
+	}
+	// The multipart reader decodes quoted-printable parts
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			return err
+		}
+		switch contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); contentType {
+		case "text/plain":
+			m.Text = string(body)
+		case "text/html":
+			m.HTML = string(body)
+		}
+	}
+}
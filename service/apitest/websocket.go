@@ -0,0 +1,189 @@
+package apitest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// EventTimeout is how long Wait waits for an event
+var EventTimeout = 5 * time.Second
+
+// Event is a message received on a WebSocket
+type Event struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+
+	tb testing.TB
+}
+
+// Decode decodes the payload of the event
+func (ev Event) Decode(v interface{}) {
+	ev.tb.Helper()
+	if err := json.Unmarshal(ev.Payload, v); err != nil {
+		ev.tb.Fatalf("decoding the %s event: %v", ev.Type, err)
+	}
+}
+
+// Socket is the WebSocket of a client. Events are kept in order until a Wait returns or skips them.
+type Socket struct {
+	name   string
+	conn   *websocket.Conn
+	events chan Event
+	tb     testing.TB
+}
+
+// Connect opens the WebSocket of the user of the client
+func (c *Client) Connect() *Socket {
+	tb := c.server.tb
+	tb.Helper()
+	url := "ws" + strings.TrimPrefix(c.server.URL, "http") + "/ws?token=" + c.ID
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		tb.Fatalf("connecting the WebSocket of %s: %v", c.Name, err)
+	}
+	_ = resp.Body.Close()
+
+	s := &Socket{name: c.Name, conn: conn, events: make(chan Event, 1024), tb: tb}
+	c.server.mu.Lock()
+	c.server.sockets = append(c.server.sockets, s)
+	c.server.mu.Unlock()
+
+	onEvent := c.server.opts.OnEvent
+	go func() {
+		defer close(s.events)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if onEvent != nil {
+				onEvent(data)
+			}
+			ev := Event{tb: tb}
+			if err := json.Unmarshal(data, &ev); err != nil {
+				continue
+			}
+			select {
+			case s.events <- ev:
+			default:
+				// Events nobody waits for are dropped once the buffer is full
+			}
+		}
+	}()
+	return s
+}
+
+// Wait returns the next event of a type, skipping the events of other types
+func (s *Socket) Wait(eventType string) Event {
+	s.tb.Helper()
+	return s.WaitFor(eventType, nil)
+}
+
+// WaitFor returns the next event of a type that `match` accepts, skipping the other events. A nil `match` accepts
+// every event of the type.
+func (s *Socket) WaitFor(eventType string, match func(Event) bool) Event {
+	s.tb.Helper()
+	timeout := time.After(EventTimeout)
+	for {
+		select {
+		case ev, ok := <-s.events:
+			if !ok {
+				s.tb.Fatalf("the WebSocket of %s closed while waiting for a %s event", s.name, eventType)
+			}
+			if ev.Type == eventType && (match == nil || match(ev)) {
+				return ev
+			}
+		case <-timeout:
+			s.tb.Fatalf("%s got no %s event after %s", s.name, eventType, EventTimeout)
+		}
+	}
+}
+
+// WaitWith returns the next event of a type whose payload has `value` in the property `key`, skipping the other
+// events
+func (s *Socket) WaitWith(eventType, key string, value interface{}) Event {
+	s.tb.Helper()
+	return s.WaitFor(eventType, func(ev Event) bool {
+		var payload map[string]interface{}
+		return json.Unmarshal(ev.Payload, &payload) == nil && payload[key] == value
+	})
+}
+
+// WaitEach returns the next event of each type, in the order of `eventTypes`, whatever the order they arrive in. The
+// events a request broadcasts to several users are sent concurrently, so their order isn't guaranteed.
+func (s *Socket) WaitEach(eventTypes ...string) []Event {
+	s.tb.Helper()
+	found := make(map[string]Event, len(eventTypes))
+	timeout := time.After(EventTimeout)
+	for len(found) < len(eventTypes) {
+		select {
+		case ev, ok := <-s.events:
+			if !ok {
+				s.tb.Fatalf("the WebSocket of %s closed while waiting for %v events", s.name, eventTypes)
+			}
+			if _, seen := found[ev.Type]; !seen && contains(eventTypes, ev.Type) {
+				found[ev.Type] = ev
+			}
+		case <-timeout:
+			s.tb.Fatalf("%s got no %v events after %s, only %d of them", s.name, eventTypes, EventTimeout, len(found))
+		}
+	}
+	events := make([]Event, len(eventTypes))
+	for i, eventType := range eventTypes {
+		events[i] = found[eventType]
+	}
+	return events
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpectNone checks that no event of a type arrives within `d`, skipping the events of other types
+func (s *Socket) ExpectNone(eventType string, d time.Duration) {
+	s.tb.Helper()
+	timeout := time.After(d)
+	for {
+		select {
+		case ev, ok := <-s.events:
+			if !ok {
+				return
+			}
+			if ev.Type == eventType {
+				s.tb.Fatalf("%s got an unexpected %s event: %s", s.name, eventType, ev.Payload)
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// WaitClosed waits for the server to close the WebSocket, skipping the events received before
+func (s *Socket) WaitClosed() {
+	s.tb.Helper()
+	timeout := time.After(EventTimeout)
+	for {
+		select {
+		case _, ok := <-s.events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			s.tb.Fatalf("the WebSocket of %s is still open after %s", s.name, EventTimeout)
+		}
+	}
+}
+
+// Close closes the WebSocket
+func (s *Socket) Close() {
+	_ = s.conn.Close()
+}
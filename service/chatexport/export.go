@@ -0,0 +1,131 @@
+/*
+Package chatexport writes the history of a conversation as a self-contained document, in JSON, HTML or plain text.
+
+Documents are written one message at a time through a Writer, so that a conversation of any size can be exported
+without holding it in memory. The JSON format is the one read back by the importer.
+*/
+package chatexport
+
+import (
+	"fmt"
+	"io"
+)
+
+// FormatVersion is the version of the JSON export format
+const FormatVersion = 1
+
+// Format is an export document format
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatHTML Format = "html"
+	FormatText Format = "txt"
+)
+
+// ParseFormat returns the Format named `s`
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatJSON, FormatHTML, FormatText:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown export format %q", s)
+}
+
+// ContentType is the MIME type of documents in this format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	case FormatText:
+		return "text/plain; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// Extension is the file name extension of documents in this format, without the dot
+func (f Format) Extension() string {
+	return string(f)
+}
+
+// User identifies a participant or a message sender
+type User struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	DisplayName *string `json:"displayName,omitempty"`
+}
+
+// Conversation is the document header
+type Conversation struct {
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	Participants []User `json:"participants"`
+	ExportedAt   string `json:"exportedAt"`
+	ExportedBy   User   `json:"exportedBy"`
+}
+
+// Reaction is an emoji reaction to a message
+type Reaction struct {
+	Emoji     string `json:"emoji"`
+	User      User   `json:"user"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// PollOption is an answer of a poll with its final count
+type PollOption struct {
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+// Poll is the content of a poll message
+type Poll struct {
+	Question       string       `json:"question"`
+	Options        []PollOption `json:"options"`
+	MultipleChoice bool         `json:"multipleChoice"`
+}
+
+// Message is a message of the exported conversation. Media is set, instead of PhotoURL, when the photo is bundled in
+// the same archive as the document; it is the path of the file inside the archive.
+type Message struct {
+	ID               string     `json:"id"`
+	Sender           User       `json:"sender"`
+	CreatedAt        string     `json:"createdAt"`
+	ContentType      string     `json:"contentType"`
+	Text             *string    `json:"text,omitempty"`
+	PhotoURL         *string    `json:"photoUrl,omitempty"`
+	Media            *string    `json:"media,omitempty"`
+	ReplyToMessageID *string    `json:"replyToMessageId,omitempty"`
+	IsForwarded      bool       `json:"isForwarded,omitempty"`
+	Reactions        []Reaction `json:"reactions,omitempty"`
+	Poll             *Poll      `json:"poll,omitempty"`
+}
+
+// Writer writes an export document. WriteHeader must be called once, before the messages; Close completes the
+// document but does not close the underlying io.Writer.
+type Writer interface {
+	WriteHeader(c Conversation) error
+	WriteMessage(m Message) error
+	Close() error
+}
+
+// NewWriter returns a Writer for documents in format `f`
+func NewWriter(f Format, w io.Writer) Writer {
+	switch f {
+	case FormatHTML:
+		return &htmlWriter{w: w}
+	case FormatText:
+		return &textWriter{w: w}
+	default:
+		return &jsonWriter{w: w}
+	}
+}
+
+// displayName is the name shown for a user in human-readable documents
+func displayName(u User) string {
+	if u.DisplayName != nil && *u.DisplayName != "" {
+		return *u.DisplayName
+	}
+	return u.Name
+}
@@ -0,0 +1,77 @@
+package chatexport
+
+import (
+	"html/template"
+	"io"
+)
+
+var htmlHeader = template.Must(template.New("header").Funcs(htmlFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 48em; margin: 2em auto; color: #222; }
+header { border-bottom: 1px solid #ddd; margin-bottom: 1em; }
+.message { margin: 0.75em 0; }
+.meta { color: #777; font-size: 0.85em; }
+.sender { font-weight: bold; }
+.text { white-space: pre-wrap; }
+.quote, .reactions { color: #555; font-size: 0.85em; }
+img { max-width: 20em; display: block; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<p>Participants: {{range $i, $p := .Participants}}{{if $i}}, {{end}}{{name $p}}{{end}}</p>
+<p class="meta">Exported by {{name .ExportedBy}} on {{time .ExportedAt}}</p>
+</header>
+<main>
+`))
+
+var htmlMessage = template.Must(template.New("message").Funcs(htmlFuncs).Parse(`<div class="message" id="m-{{.ID}}">
+<div class="meta"><span class="sender">{{name .Sender}}</span> · {{time .CreatedAt}}{{if .IsForwarded}} · forwarded{{end}}</div>
+{{- if .ReplyToMessageID}}
+<div class="quote"><a href="#m-{{.ReplyToMessageID}}">↳ in reply to a message</a></div>
+{{- end}}
+{{- if .Poll}}
+<div class="text">📊 {{.Poll.Question}}</div>
+<ul>{{range .Poll.Options}}<li>{{.Text}} ({{.Votes}})</li>{{end}}</ul>
+{{- else if .Text}}
+<div class="text">{{.Text}}</div>
+{{- end}}
+{{- if .Media}}
+<img src="{{.Media}}" alt="photo">
+{{- else if .PhotoURL}}
+<img src="{{.PhotoURL}}" alt="photo">
+{{- end}}
+{{- if .Reactions}}
+<div class="reactions">{{range $i, $r := .Reactions}}{{if $i}}, {{end}}{{$r.Emoji}} {{name $r.User}}{{end}}</div>
+{{- end}}
+</div>
+`))
+
+var htmlFuncs = template.FuncMap{
+	"name": displayName,
+	"time": textTime,
+}
+
+// htmlWriter writes a standalone page. Media bundled in the archive is referenced by its relative path, so the page
+// displays it once the archive is extracted.
+type htmlWriter struct {
+	w io.Writer
+}
+
+func (h *htmlWriter) WriteHeader(c Conversation) error {
+	return htmlHeader.Execute(h.w, c)
+}
+
+func (h *htmlWriter) WriteMessage(m Message) error {
+	return htmlMessage.Execute(h.w, m)
+}
+
+func (h *htmlWriter) Close() error {
+	_, err := io.WriteString(h.w, "</main>\n</body>\n</html>\n")
+	return err
+}
@@ -0,0 +1,51 @@
+package chatexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Document is the layout of the JSON format. The writer produces it incrementally; the importer decodes it.
+type Document struct {
+	Version      int          `json:"version"`
+	Conversation Conversation `json:"conversation"`
+	Messages     []Message    `json:"messages"`
+}
+
+// jsonWriter streams a Document: the header first, then the elements of the messages array one by one
+type jsonWriter struct {
+	w        io.Writer
+	messages int
+}
+
+func (j *jsonWriter) WriteHeader(c Conversation) error {
+	header, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(j.w, "{\"version\":%d,\"conversation\":%s,\"messages\":[", FormatVersion, header)
+	return err
+}
+
+func (j *jsonWriter) WriteMessage(m Message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if j.messages == 0 {
+		sep = "\n"
+	}
+	j.messages++
+	if _, err := io.WriteString(j.w, sep); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	_, err := io.WriteString(j.w, "\n]}\n")
+	return err
+}
@@ -0,0 +1,80 @@
+package chatexport
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// textWriter writes one line per message, in the style of the chat exports of other messaging apps:
+//
+//	[2025-01-01 12:00:00] alice: Hello
+//	    ↳ reply to 1a2b3c
+//	    reactions: 👍 bob, 😂 carol
+type textWriter struct {
+	w io.Writer
+}
+
+func (t *textWriter) WriteHeader(c Conversation) error {
+	names := make([]string, 0, len(c.Participants))
+	for _, p := range c.Participants {
+		names = append(names, displayName(p))
+	}
+	_, err := fmt.Fprintf(t.w, "%s\nParticipants: %s\nExported by %s on %s\n\n",
+		c.Title, strings.Join(names, ", "), displayName(c.ExportedBy), textTime(c.ExportedAt))
+	return err
+}
+
+func (t *textWriter) WriteMessage(m Message) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%s] %s: ", textTime(m.CreatedAt), displayName(m.Sender))
+	if m.IsForwarded {
+		sb.WriteString("(forwarded) ")
+	}
+
+	var body []string
+	if m.Poll != nil {
+		body = append(body, "POLL: "+m.Poll.Question)
+		for _, o := range m.Poll.Options {
+			body = append(body, fmt.Sprintf("- %s (%d)", o.Text, o.Votes))
+		}
+	} else if m.Text != nil {
+		body = append(body, *m.Text)
+	}
+	if m.Media != nil {
+		body = append(body, "<attached: "+*m.Media+">")
+	} else if m.PhotoURL != nil {
+		body = append(body, "<photo: "+*m.PhotoURL+">")
+	}
+	// Continuation lines are indented so that every message starts with a timestamp
+	sb.WriteString(strings.ReplaceAll(strings.Join(body, "\n"), "\n", "\n    "))
+	sb.WriteString("\n")
+
+	if m.ReplyToMessageID != nil {
+		fmt.Fprintf(&sb, "    ↳ reply to %s\n", *m.ReplyToMessageID)
+	}
+	if len(m.Reactions) > 0 {
+		reactions := make([]string, 0, len(m.Reactions))
+		for _, r := range m.Reactions {
+			reactions = append(reactions, r.Emoji+" "+displayName(r.User))
+		}
+		fmt.Fprintf(&sb, "    reactions: %s\n", strings.Join(reactions, ", "))
+	}
+
+	_, err := io.WriteString(t.w, sb.String())
+	return err
+}
+
+func (t *textWriter) Close() error {
+	return nil
+}
+
+// textTime formats an RFC 3339 timestamp for reading; other values are returned unchanged
+func textTime(s string) string {
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return s
+	}
+	return ts.UTC().Format("2006-01-02 15:04:05")
+}
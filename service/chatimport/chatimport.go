@@ -0,0 +1,120 @@
+/*
+Package chatimport reads conversation histories exported by WhatsApp (.txt) or by this application (the JSON format
+of package chatexport) and adds them to an existing conversation.
+
+Every parsed message carries a key that identifies it within the export. Keys are stored with the imported messages,
+so running the same import twice, or importing a longer export of the same chat, only adds the messages that are
+missing.
+*/
+package chatimport
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Format is the format of an imported document
+type Format string
+
+const (
+	FormatWhatsApp Format = "whatsapp"
+	FormatJSON     Format = "json"
+)
+
+// ParseFormat returns the Format named `s`
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatWhatsApp, FormatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown import format %q", s)
+}
+
+// DateOrder is the order of day and month in WhatsApp timestamps, which depends on the locale of the exporting phone
+type DateOrder string
+
+const (
+	// DateOrderAuto guesses the order from the dates in the file, falling back to day first
+	DateOrderAuto DateOrder = ""
+	DateOrderDMY  DateOrder = "dmy"
+	DateOrderMDY  DateOrder = "mdy"
+)
+
+// ParseDateOrder returns the DateOrder named `s`; an empty string is DateOrderAuto
+func ParseDateOrder(s string) (DateOrder, error) {
+	switch o := DateOrder(s); o {
+	case DateOrderAuto, DateOrderDMY, DateOrderMDY:
+		return o, nil
+	}
+	return "", fmt.Errorf("unknown date order %q", s)
+}
+
+// Options control how a document is parsed
+type Options struct {
+	Format    Format
+	DateOrder DateOrder
+	// Location is the time zone of WhatsApp timestamps, which are written in local time. Defaults to UTC.
+	Location *time.Location
+}
+
+// Sender is the author of a message or reaction as named in the export. ID is only known for JSON exports.
+type Sender struct {
+	ID          string
+	Name        string
+	DisplayName string
+}
+
+// Label is the name a sender is shown with
+func (s Sender) Label() string {
+	if s.DisplayName != "" {
+		return s.DisplayName
+	}
+	return s.Name
+}
+
+// Reaction is an emoji reaction to an imported message
+type Reaction struct {
+	Sender    Sender
+	Emoji     string
+	CreatedAt time.Time
+}
+
+// Message is a message read from an export
+type Message struct {
+	Key        string // stable identity of the message within the export
+	Sender     Sender
+	CreatedAt  time.Time
+	Text       string
+	PhotoURL   string // photo of the original message, empty for text messages
+	ReplyToKey string // key of the message this one replies to, if known
+	Forwarded  bool
+	Reactions  []Reaction
+}
+
+// InputError reports a document that can't be imported, or options that don't apply to it
+type InputError struct {
+	Line int // 1-based line of WhatsApp documents, 0 if not relevant
+	Msg  string
+}
+
+func (e *InputError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	return e.Msg
+}
+
+// Parse reads all the messages of a document, oldest first
+func Parse(r io.Reader, opts Options) ([]Message, error) {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	switch opts.Format {
+	case FormatWhatsApp:
+		return parseWhatsApp(r, opts)
+	case FormatJSON:
+		return parseJSON(r)
+	}
+	return nil, &InputError{Msg: fmt.Sprintf("unknown import format %q", opts.Format)}
+}
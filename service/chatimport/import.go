@@ -0,0 +1,319 @@
+package chatimport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/ozberk-sevinc/wasa-project/service/database"
+	"github.com/ozberk-sevinc/wasa-project/service/globaltime"
+)
+
+// photoOmitted replaces photos whose file is not available on this server
+const photoOmitted = "<photo omitted>"
+
+// Request describes an import into an existing conversation. The caller is responsible for checking that the
+// conversation exists and that the importing user may write to it.
+type Request struct {
+	ConversationID string
+	Options        Options
+	// Senders maps names found in the export to usernames of participants, for the senders that automatic matching
+	// gets wrong
+	Senders map[string]string
+	// KeepPhoto reports whether the photo URL of an exported message can be used as is. When nil, or when it
+	// returns false, the photo is replaced by a placeholder text.
+	KeepPhoto func(url string) bool
+}
+
+// SenderMapping is the user the messages of a sender were attributed to
+type SenderMapping struct {
+	Name        string
+	UserID      string
+	Placeholder bool // the user is a placeholder created for the sender
+}
+
+// Result summarizes an import
+type Result struct {
+	Imported int // messages added to the conversation
+	Skipped  int // messages already imported by an earlier run
+	Senders  []SenderMapping
+}
+
+// Import parses a document and adds its messages to a conversation, with their original timestamps. Senders are
+// matched to participants by name; the others get a placeholder account that can't be logged into.
+func Import(db database.AppDatabase, r io.Reader, req Request) (*Result, error) {
+	messages, err := Parse(r, req.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	participants, err := db.GetParticipants(req.ConversationID)
+	if err != nil {
+		return nil, fmt.Errorf("loading participants: %w", err)
+	}
+	senders, err := newSenderResolver(db, req, participants)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(messages))
+	for _, m := range messages {
+		keys = append(keys, m.Key)
+	}
+	ids, err := db.GetMessageIDsByImportKey(req.ConversationID, keys)
+	if err != nil {
+		return nil, fmt.Errorf("loading imported messages: %w", err)
+	}
+
+	var newMessages []database.Message
+	var reactions []database.Reaction
+	for _, m := range messages {
+		_, exists := ids[m.Key]
+		if !exists {
+			id, err := uuid.NewV4()
+			if err != nil {
+				return nil, err
+			}
+			ids[m.Key] = id.String()
+
+			senderID, err := senders.resolve(m.Sender)
+			if err != nil {
+				return nil, err
+			}
+			newMessages = append(newMessages, req.message(m, ids[m.Key], senderID, ids))
+		}
+
+		// Reactions of messages imported earlier are merged, so that a newer export brings in the new ones
+		for _, er := range m.Reactions {
+			userID, err := senders.resolve(er.Sender)
+			if err != nil {
+				return nil, err
+			}
+			id, err := uuid.NewV4()
+			if err != nil {
+				return nil, err
+			}
+			reactions = append(reactions, database.Reaction{
+				ID:        id.String(),
+				MessageID: ids[m.Key],
+				UserID:    userID,
+				Emoji:     er.Emoji,
+				CreatedAt: er.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			})
+		}
+	}
+
+	imported, err := db.ImportMessages(newMessages, reactions)
+	if err != nil {
+		return nil, fmt.Errorf("saving messages: %w", err)
+	}
+	return &Result{
+		Imported: imported,
+		Skipped:  len(messages) - imported,
+		Senders:  senders.mappings(),
+	}, nil
+}
+
+// message converts a parsed message into the row to insert. `ids` maps the keys of the export to message IDs in the
+// conversation, and resolves replies.
+func (req Request) message(m Message, id, senderID string, ids map[string]string) database.Message {
+	key := m.Key
+	msg := database.Message{
+		ID:             id,
+		ConversationID: req.ConversationID,
+		SenderID:       senderID,
+		CreatedAt:      m.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		ContentType:    "text",
+		Status:         database.StatusRead,
+		IsForwarded:    m.Forwarded,
+		IsImported:     true,
+		ImportKey:      &key,
+	}
+
+	text := m.Text
+	if m.PhotoURL != "" {
+		if req.KeepPhoto != nil && req.KeepPhoto(m.PhotoURL) {
+			photoURL := m.PhotoURL
+			msg.ContentType = "photo"
+			msg.PhotoURL = &photoURL
+		} else {
+			text = strings.TrimSpace(text + "\n" + photoOmitted)
+		}
+	}
+	if text != "" || msg.ContentType == "text" {
+		msg.Text = &text
+	}
+
+	if m.ReplyToKey != "" {
+		if replyTo, ok := ids[m.ReplyToKey]; ok {
+			msg.RepliedToMessageID = &replyTo
+		}
+	}
+	return msg
+}
+
+// LocalPhotos returns a Request.KeepPhoto that accepts the photos uploaded to the same conversation and still stored
+// under `uploadsDir`, which is the case when a conversation is restored from its own export
+func LocalPhotos(conversationID, uploadsDir string) func(url string) bool {
+	prefix := "/uploads/messages/" + conversationID + "/"
+	return func(url string) bool {
+		if path.Clean(url) != url || !strings.HasPrefix(url, prefix) {
+			return false
+		}
+		info, err := os.Stat(filepath.Join(uploadsDir, filepath.FromSlash(strings.TrimPrefix(url, "/uploads/"))))
+		return err == nil && info.Mode().IsRegular()
+	}
+}
+
+// senderResolver attributes the senders of an export to users, creating placeholders as needed
+type senderResolver struct {
+	db             database.AppDatabase
+	conversationID string
+	explicit       map[string]string // export name -> user ID
+	byID           map[string]string
+	byName         map[string]string // lowercase name or display name -> user ID
+	resolved       map[string]SenderMapping
+}
+
+func newSenderResolver(db database.AppDatabase, req Request, participants []database.User) (*senderResolver, error) {
+	s := &senderResolver{
+		db:             db,
+		conversationID: req.ConversationID,
+		explicit:       make(map[string]string),
+		byID:           make(map[string]string),
+		byName:         make(map[string]string),
+		resolved:       make(map[string]SenderMapping),
+	}
+
+	byUsername := make(map[string]string)
+	for _, p := range participants {
+		s.byID[p.ID] = p.ID
+		byUsername[p.Name] = p.ID
+		if p.DisplayName != nil && *p.DisplayName != "" {
+			s.byName[strings.ToLower(*p.DisplayName)] = p.ID
+		}
+	}
+	// Usernames take precedence over display names
+	for _, p := range participants {
+		s.byName[strings.ToLower(p.Name)] = p.ID
+	}
+
+	for name, username := range req.Senders {
+		id, ok := byUsername[username]
+		if !ok {
+			return nil, &InputError{Msg: fmt.Sprintf("%q is not a participant of the conversation", username)}
+		}
+		s.explicit[name] = id
+	}
+	return s, nil
+}
+
+// resolve returns the ID of the user standing for `sender`
+func (s *senderResolver) resolve(sender Sender) (string, error) {
+	label := sender.Label()
+	cacheKey := "name:" + label
+	if sender.ID != "" {
+		cacheKey = "id:" + sender.ID
+	}
+	if m, ok := s.resolved[cacheKey]; ok {
+		return m.UserID, nil
+	}
+
+	mapping := SenderMapping{Name: label}
+	switch {
+	case s.explicit[label] != "":
+		mapping.UserID = s.explicit[label]
+	case s.explicit[sender.Name] != "":
+		mapping.UserID = s.explicit[sender.Name]
+	case s.byID[sender.ID] != "":
+		mapping.UserID = sender.ID
+	case s.byName[strings.ToLower(sender.Name)] != "":
+		mapping.UserID = s.byName[strings.ToLower(sender.Name)]
+	case s.byName[strings.ToLower(label)] != "":
+		mapping.UserID = s.byName[strings.ToLower(label)]
+	default:
+		// Placeholders have no owner, so the ones of other conversations are reused when an export refers to them
+		if sender.ID != "" {
+			reuse, err := s.db.IsPlaceholderUser(sender.ID)
+			if err != nil {
+				return "", err
+			}
+			if reuse {
+				mapping.UserID = sender.ID
+				mapping.Placeholder = true
+				break
+			}
+		}
+		id, err := s.placeholder(label)
+		if err != nil {
+			return "", err
+		}
+		mapping.UserID = id
+		mapping.Placeholder = true
+	}
+
+	s.resolved[cacheKey] = mapping
+	return mapping.UserID, nil
+}
+
+// placeholder returns the placeholder user of a sender in this conversation, creating it on the first import. Its
+// username is derived from the conversation and the sender name, so that later imports find it again.
+func (s *senderResolver) placeholder(label string) (string, error) {
+	for attempt := 0; attempt < 10; attempt++ {
+		seed := s.conversationID + "\x00" + label
+		if attempt > 0 {
+			seed += "\x00" + strconv.Itoa(attempt)
+		}
+		sum := sha256.Sum256([]byte(seed))
+		name := "imported-" + hex.EncodeToString(sum[:])[:7]
+
+		existing, err := s.db.GetUserByName(name)
+		if err != nil {
+			return "", err
+		}
+		if existing != nil {
+			isPlaceholder, err := s.db.IsPlaceholderUser(existing.ID)
+			if err != nil {
+				return "", err
+			}
+			if isPlaceholder && existing.DisplayName != nil && *existing.DisplayName == label {
+				return existing.ID, nil
+			}
+			// Taken by a real user, or by the placeholder of another sender
+			continue
+		}
+
+		id, err := uuid.NewV4()
+		if err != nil {
+			return "", err
+		}
+		displayName := label
+		user := database.User{ID: id.String(), Name: name, DisplayName: &displayName}
+		createdAt := globaltime.Now().UTC().Format("2006-01-02T15:04:05Z")
+		if err := s.db.CreatePlaceholderUser(user, label, s.conversationID, createdAt); err != nil {
+			return "", fmt.Errorf("creating placeholder user: %w", err)
+		}
+		return user.ID, nil
+	}
+	return "", fmt.Errorf("no username available for the placeholder of %q", label)
+}
+
+// mappings lists the senders seen so far, sorted by name
+func (s *senderResolver) mappings() []SenderMapping {
+	mappings := make([]SenderMapping, 0, len(s.resolved))
+	for _, m := range s.resolved {
+		mappings = append(mappings, m)
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].Name < mappings[j].Name
+	})
+	return mappings
+}
@@ -0,0 +1,87 @@
+package chatimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ozberk-sevinc/wasa-project/service/chatexport"
+)
+
+// parseJSON reads a document written by chatexport in the JSON format. Polls are imported as text, with their final
+// results; photos keep their original URL and the caller decides whether it can still be used.
+func parseJSON(r io.Reader) ([]Message, error) {
+	var doc chatexport.Document
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, &InputError{Msg: "invalid JSON export: " + err.Error()}
+	}
+	if doc.Version < 1 || doc.Version > chatexport.FormatVersion {
+		return nil, &InputError{Msg: fmt.Sprintf("unsupported export version %d", doc.Version)}
+	}
+
+	messages := make([]Message, 0, len(doc.Messages))
+	for i, em := range doc.Messages {
+		if em.ID == "" {
+			return nil, &InputError{Msg: fmt.Sprintf("message %d has no id", i)}
+		}
+		createdAt, err := time.Parse(time.RFC3339, em.CreatedAt)
+		if err != nil {
+			return nil, &InputError{Msg: fmt.Sprintf("message %s has an invalid createdAt", em.ID)}
+		}
+
+		msg := Message{
+			Key:       jsonKey(em.ID),
+			Sender:    jsonSender(em.Sender),
+			CreatedAt: createdAt.UTC(),
+			Forwarded: em.IsForwarded,
+		}
+		if em.Text != nil {
+			msg.Text = *em.Text
+		}
+		if em.Poll != nil {
+			msg.Text = pollText(em.Poll)
+		}
+		switch {
+		case em.PhotoURL != nil:
+			msg.PhotoURL = *em.PhotoURL
+		case em.Media != nil:
+			// The file was bundled in an archive, which is not part of the import
+			msg.Text = strings.TrimSpace(msg.Text + "\n<attached: " + *em.Media + ">")
+		}
+		if em.ReplyToMessageID != nil {
+			msg.ReplyToKey = jsonKey(*em.ReplyToMessageID)
+		}
+		for _, er := range em.Reactions {
+			reaction := Reaction{Sender: jsonSender(er.User), Emoji: er.Emoji, CreatedAt: msg.CreatedAt}
+			if t, err := time.Parse(time.RFC3339, er.CreatedAt); err == nil {
+				reaction.CreatedAt = t.UTC()
+			}
+			msg.Reactions = append(msg.Reactions, reaction)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func jsonKey(messageID string) string {
+	return "json:" + messageID
+}
+
+func jsonSender(u chatexport.User) Sender {
+	s := Sender{ID: u.ID, Name: u.Name}
+	if u.DisplayName != nil {
+		s.DisplayName = *u.DisplayName
+	}
+	return s
+}
+
+// pollText renders a poll like the text export does
+func pollText(p *chatexport.Poll) string {
+	lines := []string{"POLL: " + p.Question}
+	for _, o := range p.Options {
+		lines = append(lines, fmt.Sprintf("- %s (%d)", o.Text, o.Votes))
+	}
+	return strings.Join(lines, "\n")
+}
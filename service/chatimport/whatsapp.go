@@ -0,0 +1,201 @@
+package chatimport
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxWhatsAppLineLength is the longest line accepted in a WhatsApp export
+const maxWhatsAppLineLength = 1 << 20
+
+// whatsAppLine matches the first line of a message. The layout depends on the platform and locale of the phone:
+//
+//	[31/12/2023, 23:59:59] Alice: text      (iOS)
+//	[12/31/23, 11:59:59 PM] Alice: text     (iOS, US English)
+//	31/12/2023, 23:59 - Alice: text         (Android)
+//	12/31/23, 11:59 PM - Alice: text        (Android, US English)
+//	31.12.23, 23:59 - Alice: text           (Android, German)
+//	2023-12-31, 23:59 - Alice: text         (Android, ISO dates)
+//
+// Lines that don't match continue the text of the previous message.
+var whatsAppLine = regexp.MustCompile(`^\[?(\d{1,4})[./-](\d{1,2})[./-](\d{1,4}),?\s+(\d{1,2})[:.](\d{2})(?:[:.](\d{2}))?(?:\s*([AaPp])\.?\s*[Mm]\.?)?(?:\]\s+|\s+-\s+)(.*)$`)
+
+// whatsAppEntry is a message whose date is not resolved yet, since the order of day and month is only known once all
+// dates have been read
+type whatsAppEntry struct {
+	line           int
+	date           [3]int
+	yearFirst      bool
+	hour, min, sec int
+	meridiem       bool // 12-hour clock
+	pm             bool
+	sender         string
+	text           strings.Builder
+	system         bool // a notice from WhatsApp rather than a message
+}
+
+// parseWhatsApp reads a chat exported by WhatsApp with "Export chat". System lines (encryption notices, members
+// joining, ...) are skipped; attachments are kept as their textual placeholder, like "<Media omitted>".
+func parseWhatsApp(r io.Reader, opts Options) ([]Message, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxWhatsAppLineLength)
+
+	var entries []*whatsAppEntry
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := normalizeWhatsAppLine(scanner.Text())
+
+		m := whatsAppLine.FindStringSubmatch(line)
+		if m == nil {
+			if len(entries) > 0 {
+				last := entries[len(entries)-1]
+				last.text.WriteString("\n")
+				last.text.WriteString(line)
+			}
+			continue
+		}
+
+		e := &whatsAppEntry{line: lineNumber, yearFirst: len(m[1]) == 4}
+		for i := 0; i < 3; i++ {
+			e.date[i], _ = strconv.Atoi(m[i+1])
+		}
+		e.hour, _ = strconv.Atoi(m[4])
+		e.min, _ = strconv.Atoi(m[5])
+		if m[6] != "" {
+			e.sec, _ = strconv.Atoi(m[6])
+		}
+		if m[7] != "" {
+			e.meridiem = true
+			e.pm = strings.EqualFold(m[7], "p")
+		}
+
+		sender, text, ok := strings.Cut(m[8], ": ")
+		if ok && sender != "" {
+			e.sender = strings.TrimSpace(sender)
+			e.text.WriteString(text)
+		} else {
+			e.system = true
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			return nil, &InputError{Line: lineNumber + 1, Msg: "line too long"}
+		}
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, &InputError{Msg: "no WhatsApp messages found"}
+	}
+
+	order, err := resolveDateOrder(entries, opts.DateOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []Message
+	occurrences := make(map[string]int)
+	for _, e := range entries {
+		if e.system {
+			continue
+		}
+		createdAt, err := e.time(order, opts.Location)
+		if err != nil {
+			return nil, &InputError{Line: e.line, Msg: err.Error()}
+		}
+
+		msg := Message{
+			Sender:    Sender{Name: e.sender},
+			CreatedAt: createdAt.UTC(),
+			Text:      e.text.String(),
+		}
+		// WhatsApp doesn't export message IDs: identical messages sent in the same second are told apart by their
+		// position among them
+		identity := msg.CreatedAt.Format(time.RFC3339) + "\x00" + msg.Sender.Name + "\x00" + msg.Text
+		msg.Key = whatsAppKey(identity, occurrences[identity])
+		occurrences[identity]++
+
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// normalizeWhatsAppLine removes the invisible characters WhatsApp adds around names and attachments, and the special
+// spaces some locales use before AM/PM
+func normalizeWhatsAppLine(line string) string {
+	line = strings.TrimPrefix(line, "\ufeff")
+	line = strings.NewReplacer("\u200e", "", "\u200f", "", "\u202f", " ", "\u00a0", " ").Replace(line)
+	return strings.TrimRight(line, "\r")
+}
+
+// resolveDateOrder returns `order`, or the order of day and month that fits every date of the file if it is
+// DateOrderAuto
+func resolveDateOrder(entries []*whatsAppEntry, order DateOrder) (DateOrder, error) {
+	if order != DateOrderAuto {
+		return order, nil
+	}
+
+	firstOver12, secondOver12 := false, false
+	for _, e := range entries {
+		if e.yearFirst {
+			continue
+		}
+		firstOver12 = firstOver12 || e.date[0] > 12
+		secondOver12 = secondOver12 || e.date[1] > 12
+	}
+	switch {
+	case firstOver12 && secondOver12:
+		return "", &InputError{Msg: "dates use both day-month and month-day order"}
+	case secondOver12:
+		return DateOrderMDY, nil
+	default:
+		return DateOrderDMY, nil
+	}
+}
+
+// time returns the moment the message was sent
+func (e *whatsAppEntry) time(order DateOrder, loc *time.Location) (time.Time, error) {
+	var year, month, day int
+	switch {
+	case e.yearFirst:
+		year, month, day = e.date[0], e.date[1], e.date[2]
+	case order == DateOrderMDY:
+		month, day, year = e.date[0], e.date[1], e.date[2]
+	default:
+		day, month, year = e.date[0], e.date[1], e.date[2]
+	}
+	if year < 100 {
+		year += 2000
+	}
+
+	hour := e.hour
+	if e.meridiem {
+		if hour < 1 || hour > 12 {
+			return time.Time{}, fmt.Errorf("invalid hour %d", hour)
+		}
+		hour %= 12
+		if e.pm {
+			hour += 12
+		}
+	}
+
+	t := time.Date(year, time.Month(month), day, hour, e.min, e.sec, 0, loc)
+	// time.Date normalizes out-of-range values, e.g. 31/02 becomes 03/03
+	if t.Year() != year || int(t.Month()) != month || t.Day() != day || t.Hour() != hour || t.Minute() != e.min || t.Second() != e.sec {
+		return time.Time{}, fmt.Errorf("invalid date or time %02d/%02d/%04d %02d:%02d:%02d", day, month, year, hour, e.min, e.sec)
+	}
+	return t, nil
+}
+
+func whatsAppKey(identity string, occurrence int) string {
+	sum := sha256.Sum256([]byte(identity + "\x00" + strconv.Itoa(occurrence)))
+	return "whatsapp:" + hex.EncodeToString(sum[:16])
+}
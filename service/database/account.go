@@ -0,0 +1,312 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// GetMessagesBySender returns all the messages sent by a user, in every conversation, oldest first
+func (db *appdbimpl) GetMessagesBySender(userID string) ([]Message, error) {
+	rows, err := db.c.Query(`
+        SELECT id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, reply_to_deleted, status, is_forwarded, is_imported, expires_after, expire_on_read, expires_at
+        FROM messages
+        WHERE sender_id = ?
+        ORDER BY created_at ASC, id ASC
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.FileURL, &m.FileName, &m.RepliedToMessageID, &m.RepliedToDeleted, &m.Status, &m.IsForwarded, &m.IsImported, &m.ExpiresAfter, &m.ExpireOnRead, &m.ExpiresAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// GetReactionsByUser returns all the reactions of a user, oldest first
+func (db *appdbimpl) GetReactionsByUser(userID string) ([]Reaction, error) {
+	rows, err := db.c.Query(`
+		SELECT id, message_id, user_id, emoji, created_at
+		FROM reactions
+		WHERE user_id = ?
+		ORDER BY created_at ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactions []Reaction
+	for rows.Next() {
+		var r Reaction
+		if err := rows.Scan(&r.ID, &r.MessageID, &r.UserID, &r.Emoji, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, r)
+	}
+	return reactions, rows.Err()
+}
+
+func (db *appdbimpl) CreateAccountExport(e AccountExport) error {
+	_, err := db.c.Exec(`
+		INSERT INTO account_exports (id, user_id, status, created_at, completed_at, file_path, size)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, e.ID, e.UserID, e.Status, e.CreatedAt, e.CompletedAt, e.FilePath, e.Size)
+	return err
+}
+
+// UpdateAccountExport saves the status and result of an export
+func (db *appdbimpl) UpdateAccountExport(e AccountExport) error {
+	_, err := db.c.Exec(`
+		UPDATE account_exports SET status = ?, completed_at = ?, file_path = ?, size = ? WHERE id = ?
+	`, e.Status, e.CompletedAt, e.FilePath, e.Size, e.ID)
+	return err
+}
+
+func (db *appdbimpl) GetAccountExport(id string) (*AccountExport, error) {
+	var e AccountExport
+	err := db.c.QueryRow(`
+		SELECT id, user_id, status, created_at, completed_at, file_path, size
+		FROM account_exports WHERE id = ?
+	`, id).Scan(&e.ID, &e.UserID, &e.Status, &e.CreatedAt, &e.CompletedAt, &e.FilePath, &e.Size)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// GetPendingAccountExport returns the export of a user that is still being built, if any
+func (db *appdbimpl) GetPendingAccountExport(userID string) (*AccountExport, error) {
+	var e AccountExport
+	err := db.c.QueryRow(`
+		SELECT id, user_id, status, created_at, completed_at, file_path, size
+		FROM account_exports WHERE user_id = ? AND status = 'pending'
+		ORDER BY created_at DESC LIMIT 1
+	`, userID).Scan(&e.ID, &e.UserID, &e.Status, &e.CreatedAt, &e.CompletedAt, &e.FilePath, &e.Size)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// FailPendingAccountExports marks as failed the exports interrupted by a restart of the server
+func (db *appdbimpl) FailPendingAccountExports() error {
+	_, err := db.c.Exec("UPDATE account_exports SET status = 'failed' WHERE status = 'pending'")
+	return err
+}
+
+// messageDependents are the tables whose rows belong to a message, in deletion order
+var messageDependents = []string{"poll_votes", "poll_options", "polls", "reactions", "message_reads", "pinned_messages", "starred_messages", "message_mentions", "message_link_previews"}
+
+// deleteMessagesWhere deletes the messages matching `where` (a condition on the messages table) with everything that
+// belongs to them. Foreign key cascades are not relied upon, since foreign_keys is a per-connection setting. Replies
+// to the deleted messages keep a flag, like with DeleteMessage.
+func deleteMessagesWhere(tx *sql.Tx, where string, args ...interface{}) error {
+	ids := "SELECT id FROM messages WHERE " + where
+	if _, err := tx.Exec("UPDATE messages SET replied_to_message_id = NULL, reply_to_deleted = 1 WHERE replied_to_message_id IN ("+ids+")", args...); err != nil {
+		return err
+	}
+	for _, table := range messageDependents {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE message_id IN ("+ids+")", args...); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec("DELETE FROM messages WHERE "+where, args...)
+	return err
+}
+
+// deleteConversation deletes a conversation with its messages, participants, commands and scheduled messages
+func deleteConversation(tx *sql.Tx, conversationID string) error {
+	if err := deleteMessagesWhere(tx, "conversation_id = ?", conversationID); err != nil {
+		return err
+	}
+	statements := []string{
+		"DELETE FROM conversation_participants WHERE conversation_id = ?",
+		"DELETE FROM conversation_commands WHERE conversation_id = ?",
+		"DELETE FROM scheduled_messages WHERE conversation_id = ?",
+		"DELETE FROM conversations WHERE id = ?",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, conversationID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detachPhotos removes photos from every message showing them, forwarded copies included. Messages without a caption
+// say that the photo was removed.
+func detachPhotos(tx *sql.Tx, photoURLs []string) error {
+	for _, photoURL := range photoURLs {
+		_, err := tx.Exec(`
+			UPDATE messages SET content_type = 'text', photo_url = NULL, text = COALESCE(text, 'Photo removed')
+			WHERE photo_url = ?
+		`, photoURL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryStrings runs a query returning a single text column
+func queryStrings(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// DeleteAccount deletes a user and their data in a single transaction, following `policy`:
+//
+//   - DeletionPolicyAnonymize keeps the user's messages, reactions and votes, and turns the account into `tombstone`
+//     (same ID, new name, no photo) recorded in deleted_users, so that it can't be used any more. The user leaves
+//     their groups but stays in direct conversations, so the other participant keeps the history.
+//   - DeletionPolicyRemove deletes the messages, reactions and votes of the user, their direct conversations, and the
+//     account itself.
+//
+// With both policies, photos uploaded by the user are detached from every message showing them, groups left empty
+// are deleted, and the user's bot commands, scheduled messages and account exports are removed.
+//
+// Dependent rows are deleted explicitly: the ON DELETE CASCADE foreign keys only apply on connections where
+// foreign_keys is enabled, and with DeletionPolicyAnonymize the users row is kept, so they never fire.
+func (db *appdbimpl) DeleteAccount(userID, policy string, tombstone User, deletedAt string) (*AccountDeletion, error) {
+	if policy != DeletionPolicyAnonymize && policy != DeletionPolicyRemove {
+		return nil, errors.New("unknown account deletion policy " + policy)
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var deletion AccountDeletion
+
+	// Conversations deleted with the account
+	deletion.DeletedConversationIDs, err = queryStrings(tx, `
+		SELECT c.id FROM conversations c
+		JOIN conversation_participants cp ON cp.conversation_id = c.id
+		WHERE cp.user_id = ? AND (
+			(c.type = 'direct' AND ?)
+			OR NOT EXISTS (
+				SELECT 1 FROM conversation_participants o WHERE o.conversation_id = c.id AND o.user_id != ?
+			)
+		)
+	`, userID, policy == DeletionPolicyRemove, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Photos the user uploaded, and those of the deleted conversations; forwarded messages reuse the photo of the
+	// original, so the photos are detached from every message
+	deletion.PhotoURLs, err = queryStrings(tx, `
+		SELECT DISTINCT photo_url FROM messages
+		WHERE sender_id = ? AND photo_url IS NOT NULL AND is_forwarded = 0
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range deletion.DeletedConversationIDs {
+		photoURLs, err := queryStrings(tx, `
+			SELECT DISTINCT photo_url FROM messages
+			WHERE conversation_id = ? AND sender_id != ? AND photo_url IS NOT NULL AND is_forwarded = 0
+		`, id, userID)
+		if err != nil {
+			return nil, err
+		}
+		deletion.PhotoURLs = append(deletion.PhotoURLs, photoURLs...)
+	}
+	if err := detachPhotos(tx, deletion.PhotoURLs); err != nil {
+		return nil, err
+	}
+
+	for _, id := range deletion.DeletedConversationIDs {
+		if err := deleteConversation(tx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	deletion.ExportFiles, err = queryStrings(tx, "SELECT file_path FROM account_exports WHERE user_id = ? AND file_path IS NOT NULL", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := []string{
+		"DELETE FROM conversation_commands WHERE bot_user_id = ?",
+		"UPDATE conversations SET created_by = NULL WHERE created_by = ?",
+		"DELETE FROM account_exports WHERE user_id = ?",
+		"DELETE FROM scheduled_messages WHERE sender_id = ?",
+		"DELETE FROM starred_messages WHERE user_id = ?",
+		"DELETE FROM message_mentions WHERE user_id = ?",
+		"DELETE FROM push_subscriptions WHERE user_id = ?",
+		"DELETE FROM user_blocks WHERE blocker_id = ?",
+		"DELETE FROM user_blocks WHERE blocked_id = ?",
+	}
+	if policy == DeletionPolicyRemove {
+		if err := deleteMessagesWhere(tx, "sender_id = ?", userID); err != nil {
+			return nil, err
+		}
+		statements = append(statements,
+			"DELETE FROM reactions WHERE user_id = ?",
+			"DELETE FROM poll_votes WHERE user_id = ?",
+			"DELETE FROM message_reads WHERE user_id = ?",
+			"DELETE FROM pinned_messages WHERE pinned_by = ?",
+			"DELETE FROM conversation_participants WHERE user_id = ?",
+			"DELETE FROM users WHERE id = ?",
+		)
+	} else {
+		statements = append(statements,
+			"DELETE FROM conversation_participants WHERE user_id = ? AND conversation_id IN (SELECT id FROM conversations WHERE type = 'group')",
+		)
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if policy == DeletionPolicyAnonymize {
+		_, err := tx.Exec(`
+			UPDATE users SET name = ?, display_name = ?, photo_url = NULL, email = NULL, digest_frequency = 'never', digest_since = NULL,
+				is_admin = 0
+			WHERE id = ?
+		`, tombstone.Name, tombstone.DisplayName, userID)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec("INSERT INTO deleted_users (user_id, deleted_at) VALUES (?, ?)", userID, deletedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &deletion, tx.Commit()
+}
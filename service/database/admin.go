@@ -0,0 +1,292 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const adminUserColumns = `id, name, display_name, photo_url, is_admin, account_status, suspended_until, status_reason`
+
+func scanAdminUser(row interface{ Scan(...interface{}) error }) (AdminUser, error) {
+	var u AdminUser
+	err := row.Scan(&u.User.ID, &u.User.Name, &u.User.DisplayName, &u.User.PhotoURL, &u.IsAdmin, &u.Account.Status,
+		&u.Account.SuspendedUntil, &u.Account.Reason)
+	return u, err
+}
+
+const reportColumns = `id, reporter_id, target_type, user_id, message_id, conversation_id, message_text,
+        message_photo_url, reason, details, status, created_at, reviewed_by, reviewed_at`
+
+func scanReport(row interface{ Scan(...interface{}) error }) (Report, error) {
+	var r Report
+	err := row.Scan(&r.ID, &r.ReporterID, &r.TargetType, &r.UserID, &r.MessageID, &r.ConversationID, &r.MessageText,
+		&r.MessagePhotoURL, &r.Reason, &r.Details, &r.Status, &r.CreatedAt, &r.ReviewedBy, &r.ReviewedAt)
+	return r, err
+}
+
+// appendAudit records an admin action in the audit log
+func appendAudit(tx *sql.Tx, e AuditEntry) error {
+	_, err := tx.Exec(`
+        INSERT INTO admin_audit_log (id, admin_id, action, target_type, target_id, details, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    `, e.ID, e.AdminID, e.Action, e.TargetType, e.TargetID, e.Details, e.CreatedAt)
+	return err
+}
+
+// inTransactionWithAudit runs `fn` and records `audit` in the same transaction
+func (db *appdbimpl) inTransactionWithAudit(audit AuditEntry, fn func(tx *sql.Tx) error) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := appendAudit(tx, audit); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsAdmin reports whether a user was granted the admin role in the database
+func (db *appdbimpl) IsAdmin(userID string) (bool, error) {
+	var admin bool
+	err := db.c.QueryRow("SELECT is_admin FROM users WHERE id = ?", userID).Scan(&admin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return admin, err
+}
+
+// SetAdmin grants or revokes the admin role of a user
+func (db *appdbimpl) SetAdmin(userID string, admin bool, audit AuditEntry) error {
+	return db.inTransactionWithAudit(audit, func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE users SET is_admin = ? WHERE id = ?", admin, userID)
+		return err
+	})
+}
+
+// GetAdminIDs returns the users granted the admin role in the database
+func (db *appdbimpl) GetAdminIDs() ([]string, error) {
+	return queryStrings(db.c, "SELECT id FROM users WHERE is_admin = 1 ORDER BY name")
+}
+
+// GetAccountStatus returns the status of an account as stored: suspensions that ended are still reported as
+// suspended, with their end in the past. Unknown users are active.
+func (db *appdbimpl) GetAccountStatus(userID string) (AccountStatus, error) {
+	status := AccountStatus{Status: AccountActive}
+	err := db.c.QueryRow(`
+        SELECT account_status, suspended_until, status_reason
+        FROM users
+        WHERE id = ?
+    `, userID).Scan(&status.Status, &status.SuspendedUntil, &status.Reason)
+	if errors.Is(err, sql.ErrNoRows) {
+		return status, nil
+	}
+	return status, err
+}
+
+func (db *appdbimpl) SetAccountStatus(userID string, status AccountStatus, audit AuditEntry) error {
+	return db.inTransactionWithAudit(audit, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+            UPDATE users SET account_status = ?, suspended_until = ?, status_reason = ?
+            WHERE id = ?
+        `, status.Status, status.SuspendedUntil, status.Reason, userID)
+		return err
+	})
+}
+
+// GetAdminUser returns a user with their role and account status, or nil for unknown, placeholder and deleted users
+func (db *appdbimpl) GetAdminUser(userID string) (*AdminUser, error) {
+	u, err := scanAdminUser(db.c.QueryRow(`
+        SELECT `+adminUserColumns+`
+        FROM users u
+        WHERE id = ?
+            AND NOT EXISTS (SELECT 1 FROM placeholder_users p WHERE p.user_id = u.id)
+            AND NOT EXISTS (SELECT 1 FROM deleted_users d WHERE d.user_id = u.id)
+    `, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetAdminUsers returns at most `limit` users ordered by name, after the user `afterName`/`afterID` if set.
+// Placeholder and deleted users are left out. `query` matches usernames and display names, `status` the account
+// status; both are ignored when empty.
+func (db *appdbimpl) GetAdminUsers(query, status, afterName, afterID string, limit int) ([]AdminUser, error) {
+	rows, err := db.c.Query(`
+        SELECT `+adminUserColumns+`
+        FROM users u
+        WHERE NOT EXISTS (SELECT 1 FROM placeholder_users p WHERE p.user_id = u.id)
+            AND NOT EXISTS (SELECT 1 FROM deleted_users d WHERE d.user_id = u.id)
+            AND (? = '' OR name LIKE ? OR display_name LIKE ?)
+            AND (? = '' OR account_status = ?)
+            AND (? = '' OR name > ? OR (name = ? AND id > ?))
+        ORDER BY name ASC, id ASC
+        LIMIT ?
+    `, query, "%"+query+"%", "%"+query+"%", status, status, afterName, afterName, afterName, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []AdminUser
+	for rows.Next() {
+		u, err := scanAdminUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (db *appdbimpl) GetReport(id string) (*Report, error) {
+	r, err := scanReport(db.c.QueryRow(`
+        SELECT `+reportColumns+`
+        FROM reports
+        WHERE id = ?
+    `, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetReports returns at most `limit` reports, the most recent first, before the report `beforeCreatedAt`/`beforeID`
+// if set. `status` and `userID` (the reported user) filter the reports when not empty.
+func (db *appdbimpl) GetReports(status, userID, beforeCreatedAt, beforeID string, limit int) ([]Report, error) {
+	rows, err := db.c.Query(`
+        SELECT `+reportColumns+`
+        FROM reports
+        WHERE (? = '' OR status = ?)
+            AND (? = '' OR user_id = ?)
+            AND (? = '' OR created_at < ? OR (created_at = ? AND id < ?))
+        ORDER BY created_at DESC, id DESC
+        LIMIT ?
+    `, status, status, userID, userID, beforeCreatedAt, beforeCreatedAt, beforeCreatedAt, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []Report
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// ReviewReport sets the status of a report, recording the admin of `audit` as its reviewer
+func (db *appdbimpl) ReviewReport(id, status string, audit AuditEntry) error {
+	return db.inTransactionWithAudit(audit, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+            UPDATE reports SET status = ?, reviewed_by = ?, reviewed_at = ?
+            WHERE id = ?
+        `, status, audit.AdminID, audit.CreatedAt, id)
+		return err
+	})
+}
+
+// ModerateMessage deletes a message with everything that belongs to it, like its sender deleting it would
+func (db *appdbimpl) ModerateMessage(messageID string, audit AuditEntry) error {
+	return db.inTransactionWithAudit(audit, func(tx *sql.Tx) error {
+		return deleteMessagesWhere(tx, "id = ?", messageID)
+	})
+}
+
+// DissolveGroup deletes a group with its messages. It returns the photos uploaded to the group, which are detached
+// from the messages they were forwarded to, so that the caller can remove the files.
+func (db *appdbimpl) DissolveGroup(conversationID string, audit AuditEntry) ([]string, error) {
+	var photoURLs []string
+	err := db.inTransactionWithAudit(audit, func(tx *sql.Tx) error {
+		var err error
+		photoURLs, err = queryStrings(tx, `
+            SELECT DISTINCT photo_url FROM messages
+            WHERE conversation_id = ? AND photo_url IS NOT NULL AND is_forwarded = 0
+        `, conversationID)
+		if err != nil {
+			return err
+		}
+		if err := detachPhotos(tx, photoURLs); err != nil {
+			return err
+		}
+		return deleteConversation(tx, conversationID)
+	})
+	return photoURLs, err
+}
+
+// GetAuditLog returns at most `limit` entries of the audit log, the most recent first, before the entry
+// `beforeCreatedAt`/`beforeID` if set
+func (db *appdbimpl) GetAuditLog(beforeCreatedAt, beforeID string, limit int) ([]AuditEntry, error) {
+	rows, err := db.c.Query(`
+        SELECT id, admin_id, action, target_type, target_id, details, created_at
+        FROM admin_audit_log
+        WHERE ? = '' OR created_at < ? OR (created_at = ? AND id < ?)
+        ORDER BY created_at DESC, id DESC
+        LIMIT ?
+    `, beforeCreatedAt, beforeCreatedAt, beforeCreatedAt, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.AdminID, &e.Action, &e.TargetType, &e.TargetID, &e.Details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// GetUsageStats counts users, conversations, messages and reports. RecentMessages counts the messages sent after
+// `recentSince`.
+func (db *appdbimpl) GetUsageStats(recentSince string) (UsageStats, error) {
+	var s UsageStats
+	err := db.c.QueryRow(`
+        SELECT
+            (SELECT COUNT(*) FROM users u
+                WHERE NOT EXISTS (SELECT 1 FROM placeholder_users p WHERE p.user_id = u.id)
+                    AND NOT EXISTS (SELECT 1 FROM deleted_users d WHERE d.user_id = u.id)),
+            (SELECT COUNT(*) FROM users WHERE is_admin = 1),
+            (SELECT COUNT(*) FROM users WHERE account_status = 'suspended'),
+            (SELECT COUNT(*) FROM users WHERE account_status = 'banned'),
+            (SELECT COUNT(*) FROM conversations WHERE type = 'direct'),
+            (SELECT COUNT(*) FROM conversations WHERE type = 'group'),
+            (SELECT COUNT(*) FROM messages),
+            (SELECT COUNT(*) FROM messages WHERE created_at > ?),
+            (SELECT COUNT(*) FROM reports WHERE status = 'open')
+    `, recentSince).Scan(&s.Users, &s.Admins, &s.SuspendedUsers, &s.BannedUsers, &s.DirectChats, &s.Groups,
+		&s.Messages, &s.RecentMessages, &s.OpenReports)
+	if err != nil {
+		return s, err
+	}
+
+	var pageCount, pageSize int64
+	if err := db.c.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return s, err
+	}
+	if err := db.c.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return s, err
+	}
+	s.DatabaseSizeBytes = pageCount * pageSize
+	return s, nil
+}
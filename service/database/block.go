@@ -0,0 +1,63 @@
+package database
+
+// BlockUser records that a user blocked another; blocking a blocked user keeps the original block
+func (db *appdbimpl) BlockUser(b Block) error {
+	_, err := db.c.Exec(`
+        INSERT OR IGNORE INTO user_blocks (blocker_id, blocked_id, created_at)
+        VALUES (?, ?, ?)
+    `, b.BlockerID, b.BlockedID, b.CreatedAt)
+	return err
+}
+
+func (db *appdbimpl) UnblockUser(blockerID, blockedID string) error {
+	_, err := db.c.Exec("DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?", blockerID, blockedID)
+	return err
+}
+
+// IsBlocked reports whether `blockerID` blocked `blockedID`
+func (db *appdbimpl) IsBlocked(blockerID, blockedID string) (bool, error) {
+	var blocked bool
+	err := db.c.QueryRow(`
+        SELECT EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?)
+    `, blockerID, blockedID).Scan(&blocked)
+	return blocked, err
+}
+
+// GetBlocks returns the users a user blocked, the most recently blocked first
+func (db *appdbimpl) GetBlocks(blockerID string) ([]Block, error) {
+	rows, err := db.c.Query(`
+        SELECT blocker_id, blocked_id, created_at
+        FROM user_blocks
+        WHERE blocker_id = ?
+        ORDER BY created_at DESC, rowid DESC
+    `, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []Block
+	for rows.Next() {
+		var b Block
+		if err := rows.Scan(&b.BlockerID, &b.BlockedID, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, rows.Err()
+}
+
+// GetBlockerIDs returns the users who blocked a user
+func (db *appdbimpl) GetBlockerIDs(blockedID string) ([]string, error) {
+	return queryStrings(db.c, "SELECT blocker_id FROM user_blocks WHERE blocked_id = ?", blockedID)
+}
+
+func (db *appdbimpl) CreateReport(r Report) error {
+	_, err := db.c.Exec(`
+        INSERT INTO reports (id, reporter_id, target_type, user_id, message_id, conversation_id, message_text,
+            message_photo_url, reason, details, status, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, r.ID, r.ReporterID, r.TargetType, r.UserID, r.MessageID, r.ConversationID, r.MessageText,
+		r.MessagePhotoURL, r.Reason, r.Details, r.Status, r.CreatedAt)
+	return err
+}
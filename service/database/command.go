@@ -0,0 +1,62 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// UpsertConversationCommand registers a bot command in a conversation, replacing its description and usage if the
+// same bot already registered it
+func (db *appdbimpl) UpsertConversationCommand(c ConversationCommand) error {
+	_, err := db.c.Exec(`
+        INSERT INTO conversation_commands (conversation_id, name, bot_user_id, description, usage, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+        ON CONFLICT (conversation_id, name) DO UPDATE SET description = excluded.description, usage = excluded.usage
+    `, c.ConversationID, c.Name, c.BotUserID, c.Description, c.Usage, c.CreatedAt)
+	return err
+}
+
+func (db *appdbimpl) GetConversationCommand(conversationID, name string) (*ConversationCommand, error) {
+	var c ConversationCommand
+	err := db.c.QueryRow(`
+        SELECT conversation_id, name, bot_user_id, description, usage, created_at
+        FROM conversation_commands
+        WHERE conversation_id = ? AND name = ?
+    `, conversationID, name).Scan(&c.ConversationID, &c.Name, &c.BotUserID, &c.Description, &c.Usage, &c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetConversationCommands returns the bot commands registered in a conversation, sorted by name
+func (db *appdbimpl) GetConversationCommands(conversationID string) ([]ConversationCommand, error) {
+	rows, err := db.c.Query(`
+        SELECT conversation_id, name, bot_user_id, description, usage, created_at
+        FROM conversation_commands
+        WHERE conversation_id = ?
+        ORDER BY name ASC
+    `, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var commands []ConversationCommand
+	for rows.Next() {
+		var c ConversationCommand
+		if err := rows.Scan(&c.ConversationID, &c.Name, &c.BotUserID, &c.Description, &c.Usage, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		commands = append(commands, c)
+	}
+	return commands, rows.Err()
+}
+
+func (db *appdbimpl) DeleteConversationCommand(conversationID, name string) error {
+	_, err := db.c.Exec("DELETE FROM conversation_commands WHERE conversation_id = ? AND name = ?", conversationID, name)
+	return err
+}
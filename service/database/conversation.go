@@ -22,6 +22,27 @@ func (db *appdbimpl) GetConversationByID(id string) (*Conversation, error) {
 	return &c, nil
 }
 
+func (db *appdbimpl) GetConversationSettings(conversationID string) (*ConversationSettings, error) {
+	s := ConversationSettings{ConversationID: conversationID}
+	err := db.c.QueryRow(`
+		SELECT single_reaction, disappearing_timer, disappearing_from FROM conversations WHERE id = ?
+	`, conversationID).Scan(&s.SingleReaction, &s.DisappearingTimer, &s.DisappearingFrom)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (db *appdbimpl) UpdateConversationSettings(settings ConversationSettings) error {
+	_, err := db.c.Exec(`
+		UPDATE conversations SET single_reaction = ?, disappearing_timer = ?, disappearing_from = ? WHERE id = ?
+	`, settings.SingleReaction, settings.DisappearingTimer, settings.DisappearingFrom, settings.ConversationID)
+	return err
+}
+
 func (db *appdbimpl) GetConversationsByUser(userID string) ([]Conversation, error) {
 	rows, err := db.c.Query(`
         SELECT c.id, c.type, c.name, c.photo_url, c.created_by, c.created_at
@@ -55,6 +76,18 @@ func (db *appdbimpl) AddParticipant(conversationID, userID string) error {
 
 func (db *appdbimpl) RemoveParticipant(conversationID, userID string) error {
 	_, err := db.c.Exec("DELETE FROM conversation_participants WHERE conversation_id = ? AND user_id = ?", conversationID, userID)
+	if err != nil {
+		return err
+	}
+
+	// Commands registered by a bot go away with it
+	_, err = db.c.Exec("DELETE FROM conversation_commands WHERE conversation_id = ? AND bot_user_id = ?", conversationID, userID)
+	if err != nil {
+		return err
+	}
+
+	// Messages of the conversation can't be seen any more
+	_, err = db.c.Exec("DELETE FROM starred_messages WHERE conversation_id = ? AND user_id = ?", conversationID, userID)
 	return err
 }
 
@@ -128,15 +161,26 @@ func (db *appdbimpl) GetConversationSummariesByUser(userID string) ([]Conversati
             c.photo_url,
             m.created_at,
             m.text,
-            m.content_type
+            m.content_type,
+            cp.archived,
+            cp.pin_position,
+            cp.muted_until,
+            cp.marked_unread,
+            COALESCE(unread.messages, 0),
+            COALESCE(unread.mentions, 0)
         FROM conversations c
         JOIN conversation_participants cp ON c.id = cp.conversation_id
         LEFT JOIN messages m ON m.id = (
             SELECT id FROM messages WHERE conversation_id = c.id ORDER BY created_at DESC LIMIT 1
         )
+        LEFT JOIN (
+            SELECT m.conversation_id, COUNT(*) AS messages, SUM(`+mentionsUser+`) AS mentions
+            `+unreadMessages+`
+            GROUP BY m.conversation_id
+        ) unread ON unread.conversation_id = c.id
         WHERE cp.user_id = ?
         ORDER BY m.created_at DESC NULLS LAST
-    `, userID)
+    `, userID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -146,9 +190,13 @@ func (db *appdbimpl) GetConversationSummariesByUser(userID string) ([]Conversati
 	for rows.Next() {
 		var s ConversationSummary
 		var contentType *string
-		if err := rows.Scan(&s.ID, &s.Type, &s.Title, &s.PhotoURL, &s.LastMessageAt, &s.LastMessageSnippet, &contentType); err != nil {
+		if err := rows.Scan(&s.ID, &s.Type, &s.Title, &s.PhotoURL, &s.LastMessageAt, &s.LastMessageSnippet, &contentType,
+			&s.State.Archived, &s.State.PinPosition, &s.State.MutedUntil, &s.State.MarkedUnread,
+			&s.Unread.Messages, &s.Unread.Mentions); err != nil {
 			return nil, err
 		}
+		s.State.ConversationID = s.ID
+		s.State.UserID = userID
 		// Set LastMessageIsPhoto based on content type
 		s.LastMessageIsPhoto = contentType != nil && *contentType == "photo"
 		// If it's a photo, set snippet to "[photo]"
@@ -156,6 +204,11 @@ func (db *appdbimpl) GetConversationSummariesByUser(userID string) ([]Conversati
 			snippet := "[photo]"
 			s.LastMessageSnippet = &snippet
 		}
+		// Polls store their question as text
+		if contentType != nil && *contentType == "poll" && s.LastMessageSnippet != nil {
+			snippet := "[poll] " + *s.LastMessageSnippet
+			s.LastMessageSnippet = &snippet
+		}
 		summaries = append(summaries, s)
 	}
 	return summaries, rows.Err()
@@ -165,12 +218,12 @@ func (db *appdbimpl) GetConversationSummariesByUser(userID string) ([]Conversati
 func (db *appdbimpl) GetLastMessage(conversationID string) (*Message, error) {
 	var m Message
 	err := db.c.QueryRow(`
-        SELECT id, conversation_id, sender_id, created_at, content_type, text, photo_url, replied_to_message_id, status
+        SELECT id, conversation_id, sender_id, created_at, content_type, text, photo_url, replied_to_message_id, reply_to_deleted, status
         FROM messages
         WHERE conversation_id = ?
         ORDER BY created_at DESC
         LIMIT 1
-    `, conversationID).Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.RepliedToMessageID, &m.Status)
+    `, conversationID).Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.RepliedToMessageID, &m.RepliedToDeleted, &m.Status)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
@@ -31,9 +31,12 @@ Then you can initialize the AppDatabase and pass it to the api package.
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // Message status constants
@@ -43,6 +46,39 @@ const (
 	StatusRead     = "read"
 )
 
+// Disappearing message timer starts
+const (
+	DisappearFromSent = "sent" // when the message is sent
+	DisappearFromRead = "read" // when all the recipients have read the message
+)
+
+// Account deletion policies: what happens to the messages of a user who deletes their account
+const (
+	// DeletionPolicyAnonymize keeps the messages, attributed to an anonymous "deleted user" account
+	DeletionPolicyAnonymize = "anonymize"
+	// DeletionPolicyRemove deletes the messages together with the account
+	DeletionPolicyRemove = "delete"
+)
+
+// Account export statuses
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// Scheduled message status
+const (
+	ScheduledPending = "pending"
+	ScheduledFailed  = "failed"
+)
+
+// Link preview statuses
+const (
+	LinkPreviewOK     = "ok"
+	LinkPreviewFailed = "failed"
+)
+
 // User represents a WASAText user
 type User struct {
 	ID          string
@@ -61,20 +97,83 @@ type Conversation struct {
 	CreatedAt string  // ISO 8601 timestamp of when the conversation was created
 }
 
+// ConversationSettings are the options shared by all the participants of a conversation
+type ConversationSettings struct {
+	ConversationID string
+	SingleReaction bool // each user may react to a message with one emoji only
+	// DisappearingTimer is the lifetime in seconds of new messages, 0 if they don't disappear
+	DisappearingTimer int
+	// DisappearingFrom is when the timer starts: DisappearFromSent or DisappearFromRead
+	DisappearingFrom string
+}
+
+// ConversationState is what a participant chose for a conversation, for themselves only
+type ConversationState struct {
+	ConversationID string
+	UserID         string
+	Archived       bool
+	PinPosition    *int    // set for conversations pinned to the top of the list; the highest comes first
+	MutedUntil     *string // MutedForever, or the end of a temporary mute; may be in the past
+	MarkedUnread   bool    // marked as unread by the user, until they open the conversation again
+}
+
+// MutedForever is the MutedUntil of conversations muted until they are unmuted
+const MutedForever = "9999-12-31T23:59:59Z"
+
+// UserPreferences are the settings of a user that apply to all their conversations
+type UserPreferences struct {
+	UserID string
+	// UnarchiveOnMessage moves archived conversations back to the list when a new message arrives
+	UnarchiveOnMessage bool
+	// PushNotifications sends Web Push notifications of new messages while the user is offline
+	PushNotifications bool
+	// PushPreviews shows the text of messages in push notifications, instead of a generic "New message"
+	PushPreviews bool
+	// DigestFrequency is how often unread messages are summarized by email: DigestHourly, DigestDaily or DigestNever
+	DigestFrequency string
+}
+
+// Email digest frequencies
+const (
+	DigestHourly = "hourly"
+	DigestDaily  = "daily"
+	DigestNever  = "never"
+)
+
+// DigestRecipient is a user whose email digest is due
+type DigestRecipient struct {
+	UserID    string
+	Email     string
+	Frequency string
+	Since     *string // end of the period of the previous digest; nil when digests were just turned on
+}
+
+// DigestMessage is an unread message to summarize in a digest
+type DigestMessage struct {
+	Message
+	Mentioned bool // the message mentions the recipient
+}
+
 // Message represents a single message
 type Message struct {
 	ID                 string
 	ConversationID     string
 	SenderID           string
 	CreatedAt          string
-	ContentType        string // "text", "photo"
+	ContentType        string // "text", "photo", "poll", "system"
 	Text               *string
 	PhotoURL           *string
 	FileURL            *string
 	FileName           *string
 	RepliedToMessageID *string
+	RepliedToDeleted   bool   // the message this one replied to was deleted
 	Status             string // "sent", "received", "read"
 	IsForwarded        bool
+	IsImported         bool    // copied from a chat export rather than sent
+	ImportKey          *string // identifies an imported message within its conversation, so imports can be re-run
+	ExpiresAfter       int     // disappearing message timer in seconds, 0 if the message doesn't disappear
+	ExpireOnRead       bool    // the timer starts once all recipients have read the message, not when it is sent
+	ExpiresAt          *string // when the message is deleted; unset until the timer starts
 }
 
 // Reaction represents an emoji reaction to a message
@@ -86,6 +185,212 @@ type Reaction struct {
 	CreatedAt string
 }
 
+// Poll is the question and options of a message with content type "poll"
+type Poll struct {
+	MessageID      string
+	Question       string
+	MultipleChoice bool
+	Anonymous      bool
+	ClosesAt       *string
+	Options        []PollOption
+}
+
+// PollOption is one of the answers of a poll, in display order
+type PollOption struct {
+	ID       string
+	Position int
+	Text     string
+}
+
+// PollVote is a user's vote for a poll option
+type PollVote struct {
+	MessageID string
+	OptionID  string
+	UserID    string
+	CreatedAt string
+}
+
+// PinnedMessage records who pinned a message of a conversation, and when
+type PinnedMessage struct {
+	MessageID      string
+	ConversationID string
+	PinnedBy       string
+	PinnedAt       string
+}
+
+// StarredMessage is a message a user saved for later
+type StarredMessage struct {
+	UserID         string
+	MessageID      string
+	ConversationID string
+	StarredAt      string
+}
+
+// LinkPreview is the cached preview of a web page, shared by every message linking to it
+type LinkPreview struct {
+	URL         string // as written in the messages
+	Status      string // "ok", or "failed" when the page could not be previewed
+	PageURL     *string
+	Title       *string
+	Description *string
+	SiteName    *string
+	ImageURL    *string // copy of the preview image in the uploads
+	FetchedAt   string
+}
+
+// PushSubscription is a Web Push subscription of a browser of a user. A browser has one endpoint, which belongs to
+// the last user who subscribed with it.
+type PushSubscription struct {
+	ID        string
+	UserID    string
+	Endpoint  string
+	P256dh    string
+	Auth      string
+	CreatedAt string
+}
+
+// Block is a user blocking another: the blocked user can't message the blocker or add them to groups
+type Block struct {
+	BlockerID string
+	BlockedID string
+	CreatedAt string
+}
+
+// Report flags a message or a user for the moderators
+type Report struct {
+	ID         string
+	ReporterID string
+	TargetType string // ReportTargetMessage or ReportTargetUser
+	UserID     string // the reported user, or the sender of the reported message
+	// Reported messages are copied, so that moderators can read them after they are deleted
+	MessageID       *string
+	ConversationID  *string
+	MessageText     *string
+	MessagePhotoURL *string
+	Reason          string
+	Details         *string
+	Status          string // ReportOpen until a moderator handles it
+	CreatedAt       string
+	ReviewedBy      *string // the admin who last changed the status
+	ReviewedAt      *string
+}
+
+// Report targets and statuses
+const (
+	ReportTargetMessage = "message"
+	ReportTargetUser    = "user"
+
+	ReportOpen      = "open"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+)
+
+// Account statuses. Suspended and banned users can't authenticate; suspensions may end by themselves.
+const (
+	AccountActive    = "active"
+	AccountSuspended = "suspended"
+	AccountBanned    = "banned"
+)
+
+// AccountStatus is whether a user may use their account
+type AccountStatus struct {
+	Status         string  // AccountActive, AccountSuspended or AccountBanned
+	SuspendedUntil *string // end of a suspension, nil if it has none
+	Reason         *string // shown to the user
+}
+
+// AdminUser is a user as seen in the admin console
+type AdminUser struct {
+	User    User
+	IsAdmin bool // granted in the database; admins from the configuration are not included
+	Account AccountStatus
+}
+
+// AuditEntry records an action of a server admin. The audit log is append-only.
+type AuditEntry struct {
+	ID         string
+	AdminID    *string // nil for actions run from the command line
+	Action     string
+	TargetType string // "user", "report", "message" or "conversation"
+	TargetID   string
+	Details    *string // JSON object with the parameters of the action
+	CreatedAt  string
+}
+
+// UsageStats counts what is stored on the server
+type UsageStats struct {
+	Users             int // excluding placeholders and deleted accounts
+	Admins            int // granted in the database
+	SuspendedUsers    int
+	BannedUsers       int
+	DirectChats       int
+	Groups            int
+	Messages          int
+	RecentMessages    int // sent after the time passed to GetUsageStats
+	OpenReports       int
+	DatabaseSizeBytes int64
+}
+
+// Mention is an @mention of a participant, or of everyone with @all, in the text of a message. Mentions point to the
+// user, not to the name, so they survive username changes.
+type Mention struct {
+	MessageID      string
+	ConversationID string
+	UserID         *string // nil for @all
+	Offset         int     // in UTF-16 code units, like JavaScript string indexes
+	Length         int
+}
+
+// ConversationCommand is a slash command registered by a bot in a conversation
+type ConversationCommand struct {
+	ConversationID string
+	Name           string
+	BotUserID      string
+	Description    string
+	Usage          string
+	CreatedAt      string
+}
+
+// AccountExport is an archive of the data of a user, built in the background
+type AccountExport struct {
+	ID          string
+	UserID      string
+	Status      string // "pending", "ready", "failed"
+	CreatedAt   string
+	CompletedAt *string
+	FilePath    *string // location of the archive on disk, once ready
+	Size        int64
+}
+
+// ScheduledMessage is a message written now to be sent by the scheduler at SendAt. It is deleted once sent.
+type ScheduledMessage struct {
+	ID                 string // also the ID of the message once sent
+	ConversationID     string
+	SenderID           string
+	CreatedAt          string
+	SendAt             string
+	ContentType        string
+	Text               *string
+	PhotoURL           *string
+	RepliedToMessageID *string
+	Poll               *string // JSON of the poll for poll messages
+	Status             string  // "pending", or "failed" when the message could not be sent
+	Error              *string // why the message could not be sent
+}
+
+// AccountDeletion describes what DeleteAccount removed from the database, so that the caller can remove the
+// corresponding files
+type AccountDeletion struct {
+	// DeletedConversationIDs are the conversations deleted with the account: direct conversations (all of them with
+	// DeletionPolicyRemove, otherwise those nobody else was in) and groups left without participants
+	DeletedConversationIDs []string
+	// PhotoURLs are the photos uploaded by the user or to the deleted conversations. Messages showing them,
+	// including forwarded copies, no longer reference them.
+	PhotoURLs []string
+	// ExportFiles are the archives of the user's account exports
+	ExportFiles []string
+}
+
 // ConversationSummary represents a conversation with last message info (for listing)
 type ConversationSummary struct {
 	ID                 string
@@ -95,6 +400,20 @@ type ConversationSummary struct {
 	LastMessageAt      *string
 	LastMessageSnippet *string
 	LastMessageIsPhoto bool
+	State              ConversationState // of the user the summaries were loaded for
+	Unread             UnreadCounts      // of the user the summaries were loaded for
+}
+
+// UnreadCounts counts the messages a user has not read yet. System and imported messages don't count.
+type UnreadCounts struct {
+	Messages int
+	Mentions int // unread messages mentioning the user
+}
+
+// ParticipantUnreadCounts are the unread counts of a participant in a conversation, and over all their conversations
+type ParticipantUnreadCounts struct {
+	Conversation UnreadCounts
+	Total        UnreadCounts // as GetTotalUnreadCounts counts them
 }
 
 // AppDatabase is the high level interface for the DB
@@ -109,6 +428,13 @@ type AppDatabase interface {
 	GetAllUsers() ([]User, error)
 	GetUsersPaginated(limit, offset int) ([]User, error)
 	GetUsersByIDs(ids []string) ([]User, error)
+	CreatePlaceholderUser(u User, sourceName, conversationID, createdAt string) error
+	IsPlaceholderUser(userID string) (bool, error)
+	IsInactiveUser(userID string) (bool, error)
+	GetUserPreferences(userID string) (*UserPreferences, error)
+	UpdateUserPreferences(p UserPreferences) error
+	GetUserEmail(userID string) (*string, error)
+	SetUserEmail(userID string, email *string) error
 
 	// Conversation methods
 	CreateConversation(id, convType, name string, createdBy *string, createdAt string) error
@@ -121,27 +447,148 @@ type AppDatabase interface {
 	GetParticipants(conversationID string) ([]User, error)
 	IsParticipant(conversationID, userID string) (bool, error)
 	GetDirectConversation(userID1, userID2 string) (*Conversation, error)
+	GetConversationSettings(conversationID string) (*ConversationSettings, error)
+	UpdateConversationSettings(settings ConversationSettings) error
+
+	// Per-user conversation state methods
+	GetConversationState(conversationID, userID string) (*ConversationState, error)
+	UpdateConversationState(state ConversationState) error
+	PinConversation(conversationID, userID string, limit int) (bool, error)
+	GetPinnedConversationIDs(userID string) ([]string, error)
+	ReorderPinnedConversations(userID string, conversationIDs []string) error
+	UnarchiveOnNewMessage(conversationID, senderID string) ([]string, error)
+	GetParticipantUnreadCounts(conversationID string, userIDs []string, now string) (map[string]ParticipantUnreadCounts, error)
+	GetTotalUnreadCounts(userID, now string) (UnreadCounts, error)
 
 	// Message methods
 	CreateMessage(msg Message) error
 	GetMessageByID(id string) (*Message, error)
+	GetMessagesByIDs(conversationID string, ids []string) ([]Message, error)
 	GetMessagesByConversation(conversationID string) ([]Message, error)
 	GetMessagesByConversationPaginated(conversationID string, limit, offset int) ([]Message, error)
+	GetMessagesByConversationAfter(conversationID, afterCreatedAt, afterID string, limit int) ([]Message, error)
+	GetMessageThread(messageID string) ([]Message, error)
+	GetReplyCountsByConversation(conversationID string) (map[string]int, error)
 	DeleteMessage(id string) error
 	UpdateMessageStatus(id, status string) error
 	MarkMessagesAsReceived(userID string) error
 	MarkMessagesAsRead(conversationID, userID string) error
 	MarkMessageReadByUser(messageID, userID string) error
 	GetMessageStatus(messageID string) (string, error)
+	StartReadExpiryTimers(now string) error
+	DeleteExpiredMessages(now string) ([]Message, []string, error)
+
+	// Account methods
+	GetMessagesBySender(userID string) ([]Message, error)
+	GetReactionsByUser(userID string) ([]Reaction, error)
+	CreateAccountExport(e AccountExport) error
+	UpdateAccountExport(e AccountExport) error
+	GetAccountExport(id string) (*AccountExport, error)
+	GetPendingAccountExport(userID string) (*AccountExport, error)
+	FailPendingAccountExports() error
+	DeleteAccount(userID, policy string, tombstone User, deletedAt string) (*AccountDeletion, error)
+
+	// Import methods
+	GetMessageIDsByImportKey(conversationID string, keys []string) (map[string]string, error)
+	ImportMessages(msgs []Message, reactions []Reaction) (int, error)
+
+	// Poll methods
+	CreatePollMessage(msg Message, poll Poll) error
+	GetPoll(messageID string) (*Poll, error)
+	GetPollsByConversation(conversationID string) ([]Poll, error)
+	GetPollVotes(messageID string) ([]PollVote, error)
+	GetPollVotesByConversation(conversationID string) ([]PollVote, error)
+	AddPollVote(vote PollVote, replaceOthers bool) error
+	RemovePollVote(messageID, optionID, userID string) error
 
 	// Reaction methods
-	CreateReaction(r Reaction) error
+	CreateReaction(r Reaction, replaceOthers bool) (stored Reaction, created bool, replaced []Reaction, err error)
 	GetReactionByID(id string) (*Reaction, error)
 	GetReactionsByMessage(messageID string) ([]Reaction, error)
 	GetReactionsByConversation(conversationID string) ([]Reaction, error)
-	GetUserReactionForMessage(messageID, userID string) (*Reaction, error)
+	GetReactionsByMessageIDs(messageIDs []string) ([]Reaction, error)
+	GetUserReactionsForMessage(messageID, userID string) ([]Reaction, error)
 	DeleteReaction(id string) error
 
+	// Pinned message methods
+	PinMessage(pin PinnedMessage, limit int) (bool, error)
+	UnpinMessage(messageID string) error
+	GetPinnedMessage(messageID string) (*PinnedMessage, error)
+	GetPinnedMessages(conversationID string) ([]PinnedMessage, error)
+
+	// Starred message methods
+	StarMessage(s StarredMessage) error
+	UnstarMessage(userID, messageID string) error
+	GetStarredMessages(userID, beforeStarredAt, beforeMessageID string, limit int) ([]StarredMessage, error)
+	GetStarredMessageIDs(userID, conversationID string) (map[string]bool, error)
+
+	// Mention methods
+	CreateMentions(mentions []Mention) error
+	GetMentionsByConversation(conversationID string) (map[string][]Mention, error)
+	GetMentionedMessages(userID, beforeCreatedAt, beforeMessageID string, limit int) ([]Message, error)
+
+	// Link preview methods
+	GetLinkPreview(url string) (*LinkPreview, error)
+	SaveLinkPreview(p LinkPreview) error
+	SetMessageLinkPreview(messageID, conversationID, url string) error
+	GetLinkPreviewsByConversation(conversationID string) (map[string]LinkPreview, error)
+
+	// Push subscription methods
+	SavePushSubscription(s PushSubscription) (*PushSubscription, error)
+	GetPushSubscription(id string) (*PushSubscription, error)
+	GetPushSubscriptions(userID string) ([]PushSubscription, error)
+	DeletePushSubscription(id string) error
+	DeletePushSubscriptionByEndpoint(endpoint string) error
+
+	// Block and report methods
+	BlockUser(b Block) error
+	UnblockUser(blockerID, blockedID string) error
+	IsBlocked(blockerID, blockedID string) (bool, error)
+	GetBlocks(blockerID string) ([]Block, error)
+	GetBlockerIDs(blockedID string) ([]string, error)
+	CreateReport(r Report) error
+
+	// Admin methods. Those changing data record `audit` in the same transaction.
+	IsAdmin(userID string) (bool, error)
+	SetAdmin(userID string, admin bool, audit AuditEntry) error
+	GetAdminIDs() ([]string, error)
+	GetAccountStatus(userID string) (AccountStatus, error)
+	SetAccountStatus(userID string, status AccountStatus, audit AuditEntry) error
+	GetAdminUser(userID string) (*AdminUser, error)
+	GetAdminUsers(query, status, afterName, afterID string, limit int) ([]AdminUser, error)
+	GetReport(id string) (*Report, error)
+	GetReports(status, userID, beforeCreatedAt, beforeID string, limit int) ([]Report, error)
+	ReviewReport(id, status string, audit AuditEntry) error
+	ModerateMessage(messageID string, audit AuditEntry) error
+	DissolveGroup(conversationID string, audit AuditEntry) ([]string, error)
+	GetAuditLog(beforeCreatedAt, beforeID string, limit int) ([]AuditEntry, error)
+	GetUsageStats(recentSince string) (UsageStats, error)
+
+	// Rate limit methods, sharing the buckets of ratelimit between the servers using the database
+	TakeRateLimitToken(key string, burst int, every time.Duration, now time.Time) (time.Duration, error)
+	PruneRateLimits(now time.Time) error
+
+	// Email digest methods
+	GetDueDigests(hourlyBefore, dailyBefore string, limit int) ([]DigestRecipient, error)
+	GetDigestMessages(userID, since, until string, limit int) ([]DigestMessage, error)
+	SetDigestProgress(userID, since, checkedAt string) error
+
+	// Bot command methods
+	UpsertConversationCommand(c ConversationCommand) error
+	GetConversationCommand(conversationID, name string) (*ConversationCommand, error)
+	GetConversationCommands(conversationID string) ([]ConversationCommand, error)
+	DeleteConversationCommand(conversationID, name string) error
+
+	// Scheduled message methods
+	CreateScheduledMessage(m ScheduledMessage) error
+	GetScheduledMessage(id string) (*ScheduledMessage, error)
+	GetScheduledMessagesBySender(conversationID, senderID string) ([]ScheduledMessage, error)
+	UpdateScheduledMessage(m ScheduledMessage) error
+	DeleteScheduledMessage(id string) error
+	GetDueScheduledMessages(now string, limit int) ([]ScheduledMessage, error)
+	GetNextScheduledSendAt() (*string, error)
+	FailScheduledMessage(id, reason string) error
+
 	// Group-specific methods
 	UpdateConversationName(conversationID, name string) error
 	UpdateConversationPhoto(conversationID string, photoURL *string) error
@@ -160,7 +607,18 @@ const (
 			id TEXT PRIMARY KEY,
 			name TEXT UNIQUE NOT NULL,
 			display_name TEXT,
-			photo_url TEXT
+			photo_url TEXT,
+			unarchive_on_message INTEGER NOT NULL DEFAULT 1,
+			push_notifications INTEGER NOT NULL DEFAULT 1,
+			push_previews INTEGER NOT NULL DEFAULT 1,
+			email TEXT,
+			digest_frequency TEXT NOT NULL DEFAULT 'never',
+			digest_since TEXT,
+			digest_checked_at TEXT,
+			is_admin INTEGER NOT NULL DEFAULT 0,
+			account_status TEXT NOT NULL DEFAULT 'active',
+			suspended_until TEXT,
+			status_reason TEXT
 		)`
 
 	createConversationsTable = `
@@ -171,6 +629,9 @@ const (
 			photo_url TEXT,
 			created_by TEXT,
 			created_at TEXT NOT NULL DEFAULT '',
+			single_reaction INTEGER NOT NULL DEFAULT 0,
+			disappearing_timer INTEGER NOT NULL DEFAULT 0,
+			disappearing_from TEXT NOT NULL DEFAULT 'sent',
 			FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
 		)`
 
@@ -178,6 +639,10 @@ const (
 		CREATE TABLE IF NOT EXISTS conversation_participants (
 			conversation_id TEXT NOT NULL,
 			user_id TEXT NOT NULL,
+			archived INTEGER NOT NULL DEFAULT 0,
+			pin_position INTEGER,
+			muted_until TEXT,
+			marked_unread INTEGER NOT NULL DEFAULT 0,
 			PRIMARY KEY (conversation_id, user_id),
 			FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
@@ -189,14 +654,20 @@ const (
 			conversation_id TEXT NOT NULL,
 			sender_id TEXT NOT NULL,
 			created_at TEXT NOT NULL,
-			content_type TEXT NOT NULL CHECK (content_type IN ('text', 'photo')),
+			content_type TEXT NOT NULL CHECK (content_type IN ('text', 'photo', 'poll', 'system')),
 			text TEXT,
 			photo_url TEXT,
 			file_url TEXT,
 			file_name TEXT,
 			replied_to_message_id TEXT,
+			reply_to_deleted INTEGER NOT NULL DEFAULT 0,
 			status TEXT NOT NULL DEFAULT 'sent' CHECK (status IN ('sent', 'received', 'read')),
 			is_forwarded INTEGER DEFAULT 0,
+			is_imported INTEGER NOT NULL DEFAULT 0,
+			import_key TEXT,
+			expires_after INTEGER NOT NULL DEFAULT 0,
+			expire_on_read INTEGER NOT NULL DEFAULT 0,
+			expires_at TEXT,
 			FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
 			FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE,
 			FOREIGN KEY (replied_to_message_id) REFERENCES messages(id) ON DELETE SET NULL
@@ -211,7 +682,7 @@ const (
 			created_at TEXT NOT NULL,
 			FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-			UNIQUE(message_id, user_id)
+			UNIQUE(message_id, user_id, emoji)
 		)`
 
 	createMessageReadsTable = `
@@ -223,6 +694,212 @@ const (
 			FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 		)`
+
+	createPollsTable = `
+		CREATE TABLE IF NOT EXISTS polls (
+			message_id TEXT PRIMARY KEY,
+			question TEXT NOT NULL,
+			multiple_choice INTEGER NOT NULL DEFAULT 0,
+			anonymous INTEGER NOT NULL DEFAULT 0,
+			closes_at TEXT,
+			FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+		)`
+
+	createPollOptionsTable = `
+		CREATE TABLE IF NOT EXISTS poll_options (
+			id TEXT PRIMARY KEY,
+			message_id TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			text TEXT NOT NULL,
+			FOREIGN KEY (message_id) REFERENCES polls(message_id) ON DELETE CASCADE
+		)`
+
+	createPollVotesTable = `
+		CREATE TABLE IF NOT EXISTS poll_votes (
+			message_id TEXT NOT NULL,
+			option_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			PRIMARY KEY (option_id, user_id),
+			FOREIGN KEY (message_id) REFERENCES polls(message_id) ON DELETE CASCADE,
+			FOREIGN KEY (option_id) REFERENCES poll_options(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`
+
+	createPlaceholderUsersTable = `
+		CREATE TABLE IF NOT EXISTS placeholder_users (
+			user_id TEXT PRIMARY KEY,
+			source_name TEXT NOT NULL,
+			conversation_id TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`
+
+	createDeletedUsersTable = `
+		CREATE TABLE IF NOT EXISTS deleted_users (
+			user_id TEXT PRIMARY KEY,
+			deleted_at TEXT NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`
+
+	createAccountExportsTable = `
+		CREATE TABLE IF NOT EXISTS account_exports (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			status TEXT NOT NULL CHECK (status IN ('pending', 'ready', 'failed')),
+			created_at TEXT NOT NULL,
+			completed_at TEXT,
+			file_path TEXT,
+			size INTEGER NOT NULL DEFAULT 0,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`
+
+	createScheduledMessagesTable = `
+		CREATE TABLE IF NOT EXISTS scheduled_messages (
+			id TEXT PRIMARY KEY,
+			conversation_id TEXT NOT NULL,
+			sender_id TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			send_at TEXT NOT NULL,
+			content_type TEXT NOT NULL CHECK (content_type IN ('text', 'photo', 'poll')),
+			text TEXT,
+			photo_url TEXT,
+			replied_to_message_id TEXT,
+			poll TEXT,
+			status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'failed')),
+			error TEXT,
+			FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+			FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE
+		)`
+
+	createPinnedMessagesTable = `
+		CREATE TABLE IF NOT EXISTS pinned_messages (
+			message_id TEXT PRIMARY KEY,
+			conversation_id TEXT NOT NULL,
+			pinned_by TEXT NOT NULL,
+			pinned_at TEXT NOT NULL,
+			FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+			FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+			FOREIGN KEY (pinned_by) REFERENCES users(id) ON DELETE CASCADE
+		)`
+
+	createStarredMessagesTable = `
+		CREATE TABLE IF NOT EXISTS starred_messages (
+			user_id TEXT NOT NULL,
+			message_id TEXT NOT NULL,
+			conversation_id TEXT NOT NULL,
+			starred_at TEXT NOT NULL,
+			PRIMARY KEY (user_id, message_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+			FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
+		)`
+
+	createMessageMentionsTable = `
+		CREATE TABLE IF NOT EXISTS message_mentions (
+			message_id TEXT NOT NULL,
+			conversation_id TEXT NOT NULL,
+			user_id TEXT,
+			text_offset INTEGER NOT NULL,
+			text_length INTEGER NOT NULL,
+			FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+			FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`
+
+	createLinkPreviewsTable = `
+		CREATE TABLE IF NOT EXISTS link_previews (
+			url TEXT PRIMARY KEY,
+			status TEXT NOT NULL CHECK (status IN ('ok', 'failed')),
+			page_url TEXT,
+			title TEXT,
+			description TEXT,
+			site_name TEXT,
+			image_url TEXT,
+			fetched_at TEXT NOT NULL
+		)`
+
+	createMessageLinkPreviewsTable = `
+		CREATE TABLE IF NOT EXISTS message_link_previews (
+			message_id TEXT PRIMARY KEY,
+			conversation_id TEXT NOT NULL,
+			url TEXT NOT NULL,
+			FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+			FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
+		)`
+
+	createPushSubscriptionsTable = `
+		CREATE TABLE IF NOT EXISTS push_subscriptions (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			endpoint TEXT UNIQUE NOT NULL,
+			p256dh TEXT NOT NULL,
+			auth TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`
+
+	createUserBlocksTable = `
+		CREATE TABLE IF NOT EXISTS user_blocks (
+			blocker_id TEXT NOT NULL,
+			blocked_id TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			PRIMARY KEY (blocker_id, blocked_id),
+			FOREIGN KEY (blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE
+		)`
+
+	// Reports outlive the messages and users they are about
+	createReportsTable = `
+		CREATE TABLE IF NOT EXISTS reports (
+			id TEXT PRIMARY KEY,
+			reporter_id TEXT NOT NULL,
+			target_type TEXT NOT NULL CHECK (target_type IN ('message', 'user')),
+			user_id TEXT NOT NULL,
+			message_id TEXT,
+			conversation_id TEXT,
+			message_text TEXT,
+			message_photo_url TEXT,
+			reason TEXT NOT NULL,
+			details TEXT,
+			status TEXT NOT NULL DEFAULT 'open',
+			created_at TEXT NOT NULL,
+			reviewed_by TEXT,
+			reviewed_at TEXT
+		)`
+
+	// The audit log outlives the admins and what they acted on; triggers make it append-only
+	createAdminAuditLogTable = `
+		CREATE TABLE IF NOT EXISTS admin_audit_log (
+			id TEXT PRIMARY KEY,
+			admin_id TEXT,
+			action TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			details TEXT,
+			created_at TEXT NOT NULL
+		)`
+
+	// rate_limits holds the buckets of ratelimit: full_at is when the bucket is full again, in Unix nanoseconds so
+	// that it can be updated in a single statement
+	createRateLimitsTable = `
+		CREATE TABLE IF NOT EXISTS rate_limits (
+			key TEXT PRIMARY KEY,
+			full_at INTEGER NOT NULL
+		) WITHOUT ROWID`
+
+	createConversationCommandsTable = `
+		CREATE TABLE IF NOT EXISTS conversation_commands (
+			conversation_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			bot_user_id TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			usage TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			PRIMARY KEY (conversation_id, name),
+			FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+			FOREIGN KEY (bot_user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`
 )
 
 // New returns a new instance of AppDatabase based on the SQLite connection `db`.
@@ -284,6 +961,24 @@ func createTables(db *sql.DB) error {
 		{"messages", createMessagesTable},
 		{"reactions", createReactionsTable},
 		{"message_reads", createMessageReadsTable},
+		{"pinned_messages", createPinnedMessagesTable},
+		{"starred_messages", createStarredMessagesTable},
+		{"message_mentions", createMessageMentionsTable},
+		{"link_previews", createLinkPreviewsTable},
+		{"message_link_previews", createMessageLinkPreviewsTable},
+		{"push_subscriptions", createPushSubscriptionsTable},
+		{"user_blocks", createUserBlocksTable},
+		{"reports", createReportsTable},
+		{"admin_audit_log", createAdminAuditLogTable},
+		{"rate_limits", createRateLimitsTable},
+		{"conversation_commands", createConversationCommandsTable},
+		{"polls", createPollsTable},
+		{"poll_options", createPollOptionsTable},
+		{"poll_votes", createPollVotesTable},
+		{"placeholder_users", createPlaceholderUsersTable},
+		{"deleted_users", createDeletedUsersTable},
+		{"account_exports", createAccountExportsTable},
+		{"scheduled_messages", createScheduledMessagesTable},
 	}
 
 	// Create tables
@@ -298,12 +993,53 @@ func createTables(db *sql.DB) error {
 		"ALTER TABLE conversations ADD COLUMN created_at TEXT NOT NULL DEFAULT ''",
 		"ALTER TABLE conversations ADD COLUMN created_by TEXT",
 		"ALTER TABLE conversations ADD COLUMN photo_url TEXT",
+		"ALTER TABLE conversations ADD COLUMN single_reaction INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE messages ADD COLUMN reply_to_deleted INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE messages ADD COLUMN is_imported INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE messages ADD COLUMN import_key TEXT",
+		"ALTER TABLE conversations ADD COLUMN disappearing_timer INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE conversations ADD COLUMN disappearing_from TEXT NOT NULL DEFAULT 'sent'",
+		"ALTER TABLE messages ADD COLUMN expires_after INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE messages ADD COLUMN expire_on_read INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE messages ADD COLUMN expires_at TEXT",
+		"ALTER TABLE users ADD COLUMN unarchive_on_message INTEGER NOT NULL DEFAULT 1",
+		"ALTER TABLE users ADD COLUMN push_notifications INTEGER NOT NULL DEFAULT 1",
+		"ALTER TABLE users ADD COLUMN push_previews INTEGER NOT NULL DEFAULT 1",
+		"ALTER TABLE users ADD COLUMN email TEXT",
+		"ALTER TABLE users ADD COLUMN digest_frequency TEXT NOT NULL DEFAULT 'never'",
+		"ALTER TABLE users ADD COLUMN digest_since TEXT",
+		"ALTER TABLE users ADD COLUMN digest_checked_at TEXT",
+		"ALTER TABLE users ADD COLUMN is_admin INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE users ADD COLUMN account_status TEXT NOT NULL DEFAULT 'active'",
+		"ALTER TABLE users ADD COLUMN suspended_until TEXT",
+		"ALTER TABLE users ADD COLUMN status_reason TEXT",
+		"ALTER TABLE reports ADD COLUMN reviewed_by TEXT",
+		"ALTER TABLE reports ADD COLUMN reviewed_at TEXT",
+		"ALTER TABLE conversation_participants ADD COLUMN archived INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE conversation_participants ADD COLUMN pin_position INTEGER",
+		"ALTER TABLE conversation_participants ADD COLUMN muted_until TEXT",
+		"ALTER TABLE conversation_participants ADD COLUMN marked_unread INTEGER NOT NULL DEFAULT 0",
 	}
 	for _, m := range migrations {
 		// Ignore errors — column may already exist
 		_, _ = db.Exec(m)
 	}
 
+	// Rebuilds: constraints that changed since older databases were created
+	rebuilds := []struct {
+		table  string
+		schema string
+		marker string // present in the current definition only
+	}{
+		{"messages", createMessagesTable, "'system'"},
+		{"reactions", createReactionsTable, "UNIQUE(message_id, user_id, emoji)"},
+	}
+	for _, rb := range rebuilds {
+		if err := rebuildTable(db, rb.table, rb.schema, rb.marker); err != nil {
+			return fmt.Errorf("error rebuilding %s table: %w", rb.table, err)
+		}
+	}
+
 	// Create indexes
 	indexes := []struct {
 		name  string
@@ -311,9 +1047,31 @@ func createTables(db *sql.DB) error {
 	}{
 		{"idx_messages_conversation", "CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id)"},
 		{"idx_messages_created_at", "CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at)"},
+		{"idx_messages_replied_to", "CREATE INDEX IF NOT EXISTS idx_messages_replied_to ON messages(replied_to_message_id)"},
+		{"idx_messages_import_key", "CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_import_key ON messages(conversation_id, import_key) WHERE import_key IS NOT NULL"},
 		{"idx_reactions_message", "CREATE INDEX IF NOT EXISTS idx_reactions_message ON reactions(message_id)"},
 		{"idx_participants_user", "CREATE INDEX IF NOT EXISTS idx_participants_user ON conversation_participants(user_id)"},
 		{"idx_users_name", "CREATE INDEX IF NOT EXISTS idx_users_name ON users(name)"},
+		{"idx_poll_options_message", "CREATE INDEX IF NOT EXISTS idx_poll_options_message ON poll_options(message_id)"},
+		{"idx_messages_expires_at", "CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages(expires_at) WHERE expires_at IS NOT NULL"},
+		{"idx_messages_sender", "CREATE INDEX IF NOT EXISTS idx_messages_sender ON messages(sender_id)"},
+		{"idx_pinned_messages_conversation", "CREATE INDEX IF NOT EXISTS idx_pinned_messages_conversation ON pinned_messages(conversation_id)"},
+		{"idx_starred_messages_user", "CREATE INDEX IF NOT EXISTS idx_starred_messages_user ON starred_messages(user_id, starred_at)"},
+		{"idx_starred_messages_message", "CREATE INDEX IF NOT EXISTS idx_starred_messages_message ON starred_messages(message_id)"},
+		{"idx_message_mentions_message", "CREATE INDEX IF NOT EXISTS idx_message_mentions_message ON message_mentions(message_id)"},
+		{"idx_message_mentions_conversation", "CREATE INDEX IF NOT EXISTS idx_message_mentions_conversation ON message_mentions(conversation_id)"},
+		{"idx_message_mentions_user", "CREATE INDEX IF NOT EXISTS idx_message_mentions_user ON message_mentions(user_id)"},
+		{"idx_message_link_previews_conversation", "CREATE INDEX IF NOT EXISTS idx_message_link_previews_conversation ON message_link_previews(conversation_id)"},
+		{"idx_users_digest", "CREATE INDEX IF NOT EXISTS idx_users_digest ON users(digest_frequency, digest_checked_at) WHERE email IS NOT NULL"},
+		{"idx_user_blocks_blocked", "CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked ON user_blocks(blocked_id)"},
+		{"idx_reports_status", "CREATE INDEX IF NOT EXISTS idx_reports_status ON reports(status, created_at)"},
+		{"idx_reports_user", "CREATE INDEX IF NOT EXISTS idx_reports_user ON reports(user_id, created_at)"},
+		{"idx_admin_audit_log_created_at", "CREATE INDEX IF NOT EXISTS idx_admin_audit_log_created_at ON admin_audit_log(created_at)"},
+		{"idx_push_subscriptions_user", "CREATE INDEX IF NOT EXISTS idx_push_subscriptions_user ON push_subscriptions(user_id)"},
+		{"idx_scheduled_messages_due", "CREATE INDEX IF NOT EXISTS idx_scheduled_messages_due ON scheduled_messages(status, send_at)"},
+		{"idx_scheduled_messages_sender", "CREATE INDEX IF NOT EXISTS idx_scheduled_messages_sender ON scheduled_messages(conversation_id, sender_id)"},
+		{"idx_account_exports_user", "CREATE INDEX IF NOT EXISTS idx_account_exports_user ON account_exports(user_id)"},
+		{"idx_poll_votes_message", "CREATE INDEX IF NOT EXISTS idx_poll_votes_message ON poll_votes(message_id)"},
 	}
 
 	for _, idx := range indexes {
@@ -322,9 +1080,126 @@ func createTables(db *sql.DB) error {
 		}
 	}
 
+	// Create triggers
+	triggers := []struct {
+		name  string
+		query string
+	}{
+		{"admin_audit_log_no_update", `
+		CREATE TRIGGER IF NOT EXISTS admin_audit_log_no_update BEFORE UPDATE ON admin_audit_log
+		BEGIN
+			SELECT RAISE(ABORT, 'admin_audit_log is append-only');
+		END`},
+		{"admin_audit_log_no_delete", `
+		CREATE TRIGGER IF NOT EXISTS admin_audit_log_no_delete BEFORE DELETE ON admin_audit_log
+		BEGIN
+			SELECT RAISE(ABORT, 'admin_audit_log is append-only');
+		END`},
+	}
+
+	for _, trigger := range triggers {
+		if _, err := db.Exec(trigger.query); err != nil {
+			return fmt.Errorf("error creating %s: %w", trigger.name, err)
+		}
+	}
+
 	return nil
 }
 
+// rebuildTable recreates `table` from `schema` if its stored definition doesn't contain `marker`. SQLite can't change
+// CHECK or UNIQUE constraints in place, so rows are copied to a new table (common columns only) which then replaces
+// the old one.
+func rebuildTable(db *sql.DB, table, schema, marker string) error {
+	var current string
+	err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&current)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(current, marker) {
+		return nil
+	}
+
+	// foreign_keys is a per-connection setting and can't be changed inside a transaction, so pin one connection
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	tmp := table + "_rebuild"
+	tmpSchema := strings.Replace(schema, "CREATE TABLE IF NOT EXISTS "+table+" (", "CREATE TABLE "+tmp+" (", 1)
+	if _, err := tx.Exec(tmpSchema); err != nil {
+		return err
+	}
+
+	oldColumns, err := tableColumns(tx, table)
+	if err != nil {
+		return err
+	}
+	newColumns, err := tableColumns(tx, tmp)
+	if err != nil {
+		return err
+	}
+	var common []string
+	for _, c := range newColumns {
+		for _, o := range oldColumns {
+			if c == o {
+				common = append(common, c)
+				break
+			}
+		}
+	}
+
+	columns := strings.Join(common, ", ")
+	statements := []string{
+		"INSERT INTO " + tmp + " (" + columns + ") SELECT " + columns + " FROM " + table,
+		"DROP TABLE " + table,
+		"ALTER TABLE " + tmp + " RENAME TO " + table,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// tableColumns returns the column names of a table
+func tableColumns(tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
 func (db *appdbimpl) Ping() error {
 	return db.c.Ping()
 }
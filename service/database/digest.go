@@ -0,0 +1,69 @@
+package database
+
+// GetDueDigests returns at most `limit` users with an email address whose digest is due: hourly digests last checked
+// before `hourlyBefore` and daily digests last checked before `dailyBefore`, the most overdue first
+func (db *appdbimpl) GetDueDigests(hourlyBefore, dailyBefore string, limit int) ([]DigestRecipient, error) {
+	rows, err := db.c.Query(`
+        SELECT id, email, digest_frequency, digest_since
+        FROM users
+        WHERE email IS NOT NULL AND (
+            (digest_frequency = 'hourly' AND (digest_checked_at IS NULL OR digest_checked_at <= ?))
+            OR (digest_frequency = 'daily' AND (digest_checked_at IS NULL OR digest_checked_at <= ?))
+        )
+        ORDER BY digest_checked_at ASC
+        LIMIT ?
+    `, hourlyBefore, dailyBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []DigestRecipient
+	for rows.Next() {
+		var r DigestRecipient
+		if err := rows.Scan(&r.UserID, &r.Email, &r.Frequency, &r.Since); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+// GetDigestMessages returns at most `limit` messages a user has not read yet that were sent in [since, until), the
+// oldest first. Like the unread counts, archived conversations are left out and muted ones only give their mentions.
+// Messages that expired by `until`, and those of users the recipient blocked, are left out too.
+func (db *appdbimpl) GetDigestMessages(userID, since, until string, limit int) ([]DigestMessage, error) {
+	rows, err := db.c.Query(`
+        SELECT m.id, m.conversation_id, m.sender_id, m.created_at, m.content_type, m.text, m.photo_url, m.file_url, m.file_name, m.replied_to_message_id, m.reply_to_deleted, m.status, m.is_forwarded, m.is_imported, m.expires_after, m.expire_on_read, m.expires_at,
+            `+mentionsUser+`
+        `+unreadMessages+`
+            AND cp.archived = 0
+            AND m.created_at >= ? AND m.created_at < ?
+            AND (m.expires_at IS NULL OR m.expires_at > ?)
+            AND (cp.muted_until IS NULL OR cp.muted_until <= ? OR `+mentionsUser+`)
+            AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = cp.user_id AND b.blocked_id = m.sender_id)
+        ORDER BY m.created_at ASC, m.rowid ASC
+        LIMIT ?
+    `, userID, since, until, until, until, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []DigestMessage
+	for rows.Next() {
+		var m DigestMessage
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.FileURL, &m.FileName, &m.RepliedToMessageID, &m.RepliedToDeleted, &m.Status, &m.IsForwarded, &m.IsImported, &m.ExpiresAfter, &m.ExpireOnRead, &m.ExpiresAt, &m.Mentioned); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// SetDigestProgress records that the messages of a user before `since` have been digested, and when the digest was
+// last checked: the next one is due one period after `checkedAt`
+func (db *appdbimpl) SetDigestProgress(userID, since, checkedAt string) error {
+	_, err := db.c.Exec("UPDATE users SET digest_since = ?, digest_checked_at = ? WHERE id = ?", since, checkedAt, userID)
+	return err
+}
@@ -0,0 +1,95 @@
+package database
+
+// StartReadExpiryTimers starts the timer of the disappearing messages that expire once read, for those that every
+// other participant has now read. Their deletion time is `now` (an RFC 3339 UTC timestamp) plus their timer.
+func (db *appdbimpl) StartReadExpiryTimers(now string) error {
+	_, err := db.c.Exec(`
+		UPDATE messages
+		SET expires_at = strftime('%Y-%m-%dT%H:%M:%SZ', ?, '+' || expires_after || ' seconds')
+		WHERE expire_on_read = 1 AND expires_after > 0 AND expires_at IS NULL
+		AND EXISTS (
+			SELECT 1 FROM conversation_participants cp
+			WHERE cp.conversation_id = messages.conversation_id AND cp.user_id != messages.sender_id
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM conversation_participants cp
+			WHERE cp.conversation_id = messages.conversation_id AND cp.user_id != messages.sender_id
+			AND NOT EXISTS (
+				SELECT 1 FROM message_reads mr WHERE mr.message_id = messages.id AND mr.user_id = cp.user_id
+			)
+		)
+	`, now)
+	return err
+}
+
+// DeleteExpiredMessages deletes the disappearing messages whose deletion time is not after `now`, in a single
+// transaction. It returns the deleted messages and the URLs of their photos that no other message shows any more, so
+// that the caller can remove the files.
+func (db *appdbimpl) DeleteExpiredMessages(now string) ([]Message, []string, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	const expired = "expires_at IS NOT NULL AND expires_at <= ?"
+
+	rows, err := tx.Query(`
+        SELECT id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, reply_to_deleted, status, is_forwarded, is_imported, expires_after, expire_on_read, expires_at
+        FROM messages
+        WHERE `+expired+`
+        ORDER BY created_at ASC, id ASC
+    `, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.FileURL, &m.FileName, &m.RepliedToMessageID, &m.RepliedToDeleted, &m.Status, &m.IsForwarded, &m.IsImported, &m.ExpiresAfter, &m.ExpireOnRead, &m.ExpiresAt); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil, nil
+	}
+
+	if err := deleteMessagesWhere(tx, expired, now); err != nil {
+		return nil, nil, err
+	}
+
+	// Forwarded copies and user profiles may still show the same file
+	seen := make(map[string]bool)
+	var unused []string
+	for _, m := range messages {
+		if m.PhotoURL == nil || seen[*m.PhotoURL] {
+			continue
+		}
+		seen[*m.PhotoURL] = true
+		var inUse bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM messages WHERE photo_url = ?)
+			OR EXISTS (SELECT 1 FROM users WHERE photo_url = ?)
+			OR EXISTS (SELECT 1 FROM conversations WHERE photo_url = ?)
+		`, *m.PhotoURL, *m.PhotoURL, *m.PhotoURL).Scan(&inUse)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !inUse {
+			unused = append(unused, *m.PhotoURL)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return messages, unused, nil
+}
@@ -0,0 +1,85 @@
+package database
+
+// importKeyBatchSize bounds the number of parameters of a single lookup by import key
+const importKeyBatchSize = 500
+
+// GetMessageIDsByImportKey returns the IDs of the messages of a conversation that were imported with one of `keys`,
+// indexed by key
+func (db *appdbimpl) GetMessageIDsByImportKey(conversationID string, keys []string) (map[string]string, error) {
+	ids := make(map[string]string)
+	for start := 0; start < len(keys); start += importKeyBatchSize {
+		batch := keys[start:min(start+importKeyBatchSize, len(keys))]
+
+		// Build placeholders for SQL IN clause
+		placeholders := ""
+		args := make([]interface{}, 0, len(batch)+1)
+		args = append(args, conversationID)
+		for i, key := range batch {
+			if i > 0 {
+				placeholders += ","
+			}
+			placeholders += "?"
+			args = append(args, key)
+		}
+
+		rows, err := db.c.Query("SELECT import_key, id FROM messages WHERE conversation_id = ? AND import_key IN ("+placeholders+")", args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var key, id string
+			if err := rows.Scan(&key, &id); err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			ids[key] = id
+		}
+		err = rows.Err()
+		_ = rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// ImportMessages saves imported messages and their reactions in a single transaction. Messages whose import key is
+// already taken in their conversation, and reactions that already exist, are skipped. It returns the number of
+// messages actually inserted.
+func (db *appdbimpl) ImportMessages(msgs []Message, reactions []Reaction) (int, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	inserted := 0
+	for _, msg := range msgs {
+		res, err := tx.Exec(`
+            INSERT OR IGNORE INTO messages (id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, status, is_forwarded, is_imported, import_key)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?)
+        `, msg.ID, msg.ConversationID, msg.SenderID, msg.CreatedAt, msg.ContentType, msg.Text, msg.PhotoURL, msg.FileURL, msg.FileName, msg.RepliedToMessageID, msg.Status, msg.IsForwarded, msg.ImportKey)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		inserted += int(n)
+	}
+
+	for _, r := range reactions {
+		_, err := tx.Exec(`
+            INSERT OR IGNORE INTO reactions (id, message_id, user_id, emoji, created_at)
+            VALUES (?, ?, ?, ?, ?)
+        `, r.ID, r.MessageID, r.UserID, r.Emoji, r.CreatedAt)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return inserted, tx.Commit()
+}
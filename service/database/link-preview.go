@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+func (db *appdbimpl) GetLinkPreview(url string) (*LinkPreview, error) {
+	var p LinkPreview
+	err := db.c.QueryRow(`
+        SELECT url, status, page_url, title, description, site_name, image_url, fetched_at
+        FROM link_previews
+        WHERE url = ?
+    `, url).Scan(&p.URL, &p.Status, &p.PageURL, &p.Title, &p.Description, &p.SiteName, &p.ImageURL, &p.FetchedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SaveLinkPreview adds a preview to the cache, replacing the previous preview of the same URL
+func (db *appdbimpl) SaveLinkPreview(p LinkPreview) error {
+	_, err := db.c.Exec(`
+        INSERT OR REPLACE INTO link_previews (url, status, page_url, title, description, site_name, image_url, fetched_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `, p.URL, p.Status, p.PageURL, p.Title, p.Description, p.SiteName, p.ImageURL, p.FetchedAt)
+	return err
+}
+
+// SetMessageLinkPreview links a message to the preview of `url`, which may not be in the cache yet
+func (db *appdbimpl) SetMessageLinkPreview(messageID, conversationID, url string) error {
+	_, err := db.c.Exec(`
+        INSERT OR REPLACE INTO message_link_previews (message_id, conversation_id, url)
+        VALUES (?, ?, ?)
+    `, messageID, conversationID, url)
+	return err
+}
+
+// GetLinkPreviewsByConversation returns the preview of every message of a conversation whose link was previewed
+func (db *appdbimpl) GetLinkPreviewsByConversation(conversationID string) (map[string]LinkPreview, error) {
+	rows, err := db.c.Query(`
+        SELECT mlp.message_id, lp.url, lp.status, lp.page_url, lp.title, lp.description, lp.site_name, lp.image_url, lp.fetched_at
+        FROM message_link_previews mlp
+        JOIN link_previews lp ON lp.url = mlp.url
+        WHERE mlp.conversation_id = ? AND lp.status = 'ok'
+    `, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	previews := make(map[string]LinkPreview)
+	for rows.Next() {
+		var messageID string
+		var p LinkPreview
+		if err := rows.Scan(&messageID, &p.URL, &p.Status, &p.PageURL, &p.Title, &p.Description, &p.SiteName, &p.ImageURL, &p.FetchedAt); err != nil {
+			return nil, err
+		}
+		previews[messageID] = p
+	}
+	return previews, rows.Err()
+}
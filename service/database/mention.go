@@ -0,0 +1,81 @@
+package database
+
+// CreateMentions stores the mentions of a message
+func (db *appdbimpl) CreateMentions(mentions []Mention) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, m := range mentions {
+		_, err := tx.Exec(`
+            INSERT INTO message_mentions (message_id, conversation_id, user_id, text_offset, text_length)
+            VALUES (?, ?, ?, ?, ?)
+        `, m.MessageID, m.ConversationID, m.UserID, m.Offset, m.Length)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetMentionsByConversation returns the mentions of every message of a conversation that has any, in the order they
+// appear in the text
+func (db *appdbimpl) GetMentionsByConversation(conversationID string) (map[string][]Mention, error) {
+	rows, err := db.c.Query(`
+        SELECT message_id, conversation_id, user_id, text_offset, text_length
+        FROM message_mentions
+        WHERE conversation_id = ?
+        ORDER BY message_id, text_offset
+    `, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := make(map[string][]Mention)
+	for rows.Next() {
+		var m Mention
+		if err := rows.Scan(&m.MessageID, &m.ConversationID, &m.UserID, &m.Offset, &m.Length); err != nil {
+			return nil, err
+		}
+		mentions[m.MessageID] = append(mentions[m.MessageID], m)
+	}
+	return mentions, rows.Err()
+}
+
+// GetMentionedMessages returns at most `limit` messages of other users mentioning a user, by name or with @all, in
+// the conversations the user is in, the most recent first. When `beforeCreatedAt` is set, only the messages after
+// (beforeCreatedAt, beforeMessageID) in that order are returned, so that pages can be loaded one after the other.
+func (db *appdbimpl) GetMentionedMessages(userID, beforeCreatedAt, beforeMessageID string, limit int) ([]Message, error) {
+	rows, err := db.c.Query(`
+        SELECT m.id, m.conversation_id, m.sender_id, m.created_at, m.content_type, m.text, m.photo_url, m.file_url, m.file_name, m.replied_to_message_id, m.reply_to_deleted, m.status, m.is_forwarded, m.is_imported, m.expires_after, m.expire_on_read, m.expires_at
+        FROM messages m
+        JOIN conversation_participants cp ON cp.conversation_id = m.conversation_id AND cp.user_id = ?
+        WHERE m.sender_id != ?
+        AND EXISTS (
+            SELECT 1 FROM message_mentions mm
+            WHERE mm.message_id = m.id AND (mm.user_id = ? OR mm.user_id IS NULL)
+        )
+        AND (? = '' OR m.created_at < ? OR (m.created_at = ? AND m.id < ?))
+        ORDER BY m.created_at DESC, m.id DESC
+        LIMIT ?
+    `, userID, userID, userID, beforeCreatedAt, beforeCreatedAt, beforeCreatedAt, beforeMessageID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.FileURL, &m.FileName, &m.RepliedToMessageID, &m.RepliedToDeleted, &m.Status, &m.IsForwarded, &m.IsImported, &m.ExpiresAfter, &m.ExpireOnRead, &m.ExpiresAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
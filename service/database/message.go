@@ -7,18 +7,18 @@ import (
 
 func (db *appdbimpl) CreateMessage(msg Message) error {
 	_, err := db.c.Exec(`
-        INSERT INTO messages (id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, status, is_forwarded)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-    `, msg.ID, msg.ConversationID, msg.SenderID, msg.CreatedAt, msg.ContentType, msg.Text, msg.PhotoURL, msg.FileURL, msg.FileName, msg.RepliedToMessageID, msg.Status, msg.IsForwarded)
+        INSERT INTO messages (id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, status, is_forwarded, expires_after, expire_on_read, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, msg.ID, msg.ConversationID, msg.SenderID, msg.CreatedAt, msg.ContentType, msg.Text, msg.PhotoURL, msg.FileURL, msg.FileName, msg.RepliedToMessageID, msg.Status, msg.IsForwarded, msg.ExpiresAfter, msg.ExpireOnRead, msg.ExpiresAt)
 	return err
 }
 
 func (db *appdbimpl) GetMessageByID(id string) (*Message, error) {
 	var m Message
 	err := db.c.QueryRow(`
-        SELECT id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, status, is_forwarded
+        SELECT id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, reply_to_deleted, status, is_forwarded, is_imported, expires_after, expire_on_read, expires_at
         FROM messages WHERE id = ?
-    `, id).Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.FileURL, &m.FileName, &m.RepliedToMessageID, &m.Status, &m.IsForwarded)
+    `, id).Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.FileURL, &m.FileName, &m.RepliedToMessageID, &m.RepliedToDeleted, &m.Status, &m.IsForwarded, &m.IsImported, &m.ExpiresAfter, &m.ExpireOnRead, &m.ExpiresAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
@@ -28,9 +28,56 @@ func (db *appdbimpl) GetMessageByID(id string) (*Message, error) {
 	return &m, nil
 }
 
+// messageIDBatchSize bounds the number of parameters of a single lookup by message ID
+const messageIDBatchSize = 500
+
+// GetMessagesByIDs returns the messages of a conversation among `ids`. IDs of messages that don't exist or belong to
+// another conversation are left out.
+func (db *appdbimpl) GetMessagesByIDs(conversationID string, ids []string) ([]Message, error) {
+	var messages []Message
+	for start := 0; start < len(ids); start += messageIDBatchSize {
+		batch := ids[start:min(start+messageIDBatchSize, len(ids))]
+
+		// Build placeholders for SQL IN clause
+		placeholders := ""
+		args := make([]interface{}, 0, len(batch)+1)
+		args = append(args, conversationID)
+		for i, id := range batch {
+			if i > 0 {
+				placeholders += ","
+			}
+			placeholders += "?"
+			args = append(args, id)
+		}
+
+		rows, err := db.c.Query(`
+            SELECT id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, reply_to_deleted, status, is_forwarded, is_imported, expires_after, expire_on_read, expires_at
+            FROM messages
+            WHERE conversation_id = ? AND id IN (`+placeholders+`)
+        `, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var m Message
+			if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.FileURL, &m.FileName, &m.RepliedToMessageID, &m.RepliedToDeleted, &m.Status, &m.IsForwarded, &m.IsImported, &m.ExpiresAfter, &m.ExpireOnRead, &m.ExpiresAt); err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			messages = append(messages, m)
+		}
+		err = rows.Err()
+		_ = rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
 func (db *appdbimpl) GetMessagesByConversation(conversationID string) ([]Message, error) {
 	rows, err := db.c.Query(`
-        SELECT id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, status, is_forwarded
+        SELECT id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, reply_to_deleted, status, is_forwarded, is_imported, expires_after, expire_on_read, expires_at
         FROM messages
         WHERE conversation_id = ?
         ORDER BY created_at ASC
@@ -43,7 +90,7 @@ func (db *appdbimpl) GetMessagesByConversation(conversationID string) ([]Message
 	var messages []Message
 	for rows.Next() {
 		var m Message
-		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.FileURL, &m.FileName, &m.RepliedToMessageID, &m.Status, &m.IsForwarded); err != nil {
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.FileURL, &m.FileName, &m.RepliedToMessageID, &m.RepliedToDeleted, &m.Status, &m.IsForwarded, &m.IsImported, &m.ExpiresAfter, &m.ExpireOnRead, &m.ExpiresAt); err != nil {
 			return nil, err
 		}
 		messages = append(messages, m)
@@ -53,7 +100,7 @@ func (db *appdbimpl) GetMessagesByConversation(conversationID string) ([]Message
 
 func (db *appdbimpl) GetMessagesByConversationPaginated(conversationID string, limit, offset int) ([]Message, error) {
 	rows, err := db.c.Query(`
-        SELECT id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, status, is_forwarded
+        SELECT id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, reply_to_deleted, status, is_forwarded, is_imported, expires_after, expire_on_read, expires_at
         FROM messages
         WHERE conversation_id = ?
         ORDER BY created_at ASC
@@ -67,7 +114,63 @@ func (db *appdbimpl) GetMessagesByConversationPaginated(conversationID string, l
 	var messages []Message
 	for rows.Next() {
 		var m Message
-		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.FileURL, &m.FileName, &m.RepliedToMessageID, &m.Status, &m.IsForwarded); err != nil {
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.FileURL, &m.FileName, &m.RepliedToMessageID, &m.RepliedToDeleted, &m.Status, &m.IsForwarded, &m.IsImported, &m.ExpiresAfter, &m.ExpireOnRead, &m.ExpiresAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// GetMessagesByConversationAfter returns up to `limit` messages of a conversation that come after the message
+// (afterCreatedAt, afterID) in chronological order. Pass an empty afterCreatedAt to start from the first message.
+// Unlike offset pagination, pages stay consistent while new messages are added.
+func (db *appdbimpl) GetMessagesByConversationAfter(conversationID, afterCreatedAt, afterID string, limit int) ([]Message, error) {
+	rows, err := db.c.Query(`
+        SELECT id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, reply_to_deleted, status, is_forwarded, is_imported, expires_after, expire_on_read, expires_at
+        FROM messages
+        WHERE conversation_id = ? AND (created_at > ? OR (created_at = ? AND id > ?))
+        ORDER BY created_at ASC, id ASC
+        LIMIT ?
+    `, conversationID, afterCreatedAt, afterCreatedAt, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.FileURL, &m.FileName, &m.RepliedToMessageID, &m.RepliedToDeleted, &m.Status, &m.IsForwarded, &m.IsImported, &m.ExpiresAfter, &m.ExpireOnRead, &m.ExpiresAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// GetMessageThread returns a message followed by all its direct and indirect replies, oldest first
+func (db *appdbimpl) GetMessageThread(messageID string) ([]Message, error) {
+	rows, err := db.c.Query(`
+        WITH RECURSIVE thread(id) AS (
+            SELECT id FROM messages WHERE id = ?
+            UNION
+            SELECT m.id FROM messages m JOIN thread t ON m.replied_to_message_id = t.id
+        )
+        SELECT id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, reply_to_deleted, status, is_forwarded, is_imported, expires_after, expire_on_read, expires_at
+        FROM messages
+        WHERE id IN (SELECT id FROM thread)
+        ORDER BY (id = ?) DESC, created_at ASC
+    `, messageID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.ContentType, &m.Text, &m.PhotoURL, &m.FileURL, &m.FileName, &m.RepliedToMessageID, &m.RepliedToDeleted, &m.Status, &m.IsForwarded, &m.IsImported, &m.ExpiresAfter, &m.ExpireOnRead, &m.ExpiresAt); err != nil {
 			return nil, err
 		}
 		messages = append(messages, m)
@@ -75,9 +178,72 @@ func (db *appdbimpl) GetMessagesByConversationPaginated(conversationID string, l
 	return messages, rows.Err()
 }
 
+// GetReplyCountsByConversation returns the number of direct replies of every message of a conversation that has any
+func (db *appdbimpl) GetReplyCountsByConversation(conversationID string) (map[string]int, error) {
+	rows, err := db.c.Query(`
+        SELECT replied_to_message_id, COUNT(*)
+        FROM messages
+        WHERE conversation_id = ? AND replied_to_message_id IS NOT NULL
+        GROUP BY replied_to_message_id
+    `, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+		counts[id] = count
+	}
+	return counts, rows.Err()
+}
+
+// DeleteMessage deletes a message. Replies to it keep a flag so that their quote can show the original was deleted.
 func (db *appdbimpl) DeleteMessage(id string) error {
-	_, err := db.c.Exec("DELETE FROM messages WHERE id = ?", id)
-	return err
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec("UPDATE messages SET replied_to_message_id = NULL, reply_to_deleted = 1 WHERE replied_to_message_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM pinned_messages WHERE message_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM starred_messages WHERE message_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM message_mentions WHERE message_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM message_link_previews WHERE message_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM messages WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (db *appdbimpl) UpdateMessageStatus(id, status string) error {
@@ -101,7 +267,7 @@ func (db *appdbimpl) MarkMessagesAsReceived(userID string) error {
 }
 
 // MarkMessagesAsRead updates all messages NOT sent by userID in a conversation to "read" status
-// This is called when a user opens a specific conversation (two checkmarks)
+// This is called when a user opens a specific conversation (two checkmarks), or sends a message in it
 func (db *appdbimpl) MarkMessagesAsRead(conversationID, userID string) error {
 	// Get all messages in the conversation not sent by this user
 	rows, err := db.c.Query(`
@@ -125,7 +291,15 @@ func (db *appdbimpl) MarkMessagesAsRead(conversationID, userID string) error {
 			return err
 		}
 	}
-	return rows.Err()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Opening the conversation also clears a manual "unread" mark
+	_, err = db.c.Exec(`
+		UPDATE conversation_participants SET marked_unread = 0 WHERE conversation_id = ? AND user_id = ?
+	`, conversationID, userID)
+	return err
 }
 
 // MarkMessageReadByUser records that a specific user has read a specific message
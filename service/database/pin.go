@@ -0,0 +1,90 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// PinMessage pins a message in its conversation, unless `limit` messages are pinned there already. It returns false
+// when the limit was reached. Pinning a message again keeps the original pin.
+func (db *appdbimpl) PinMessage(pin PinnedMessage, limit int) (bool, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var pinned bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM pinned_messages WHERE message_id = ?)", pin.MessageID).Scan(&pinned)
+	if err != nil {
+		return false, err
+	}
+	if pinned {
+		return true, nil
+	}
+
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM pinned_messages WHERE conversation_id = ?", pin.ConversationID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	if count >= limit {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO pinned_messages (message_id, conversation_id, pinned_by, pinned_at)
+        VALUES (?, ?, ?, ?)
+    `, pin.MessageID, pin.ConversationID, pin.PinnedBy, pin.PinnedAt)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (db *appdbimpl) UnpinMessage(messageID string) error {
+	_, err := db.c.Exec("DELETE FROM pinned_messages WHERE message_id = ?", messageID)
+	return err
+}
+
+func (db *appdbimpl) GetPinnedMessage(messageID string) (*PinnedMessage, error) {
+	var p PinnedMessage
+	err := db.c.QueryRow(`
+        SELECT message_id, conversation_id, pinned_by, pinned_at
+        FROM pinned_messages
+        WHERE message_id = ?
+    `, messageID).Scan(&p.MessageID, &p.ConversationID, &p.PinnedBy, &p.PinnedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPinnedMessages returns the pinned messages of a conversation, the most recently pinned first
+func (db *appdbimpl) GetPinnedMessages(conversationID string) ([]PinnedMessage, error) {
+	rows, err := db.c.Query(`
+        SELECT message_id, conversation_id, pinned_by, pinned_at
+        FROM pinned_messages
+        WHERE conversation_id = ?
+        ORDER BY pinned_at DESC, rowid DESC
+    `, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pins []PinnedMessage
+	for rows.Next() {
+		var p PinnedMessage
+		if err := rows.Scan(&p.MessageID, &p.ConversationID, &p.PinnedBy, &p.PinnedAt); err != nil {
+			return nil, err
+		}
+		pins = append(pins, p)
+	}
+	return pins, rows.Err()
+}
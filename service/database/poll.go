@@ -0,0 +1,180 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// CreatePollMessage stores a message with content type "poll" together with its question and options
+func (db *appdbimpl) CreatePollMessage(msg Message, poll Poll) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(`
+        INSERT INTO messages (id, conversation_id, sender_id, created_at, content_type, text, photo_url, file_url, file_name, replied_to_message_id, status, is_forwarded, expires_after, expire_on_read, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, msg.ID, msg.ConversationID, msg.SenderID, msg.CreatedAt, msg.ContentType, msg.Text, msg.PhotoURL, msg.FileURL, msg.FileName, msg.RepliedToMessageID, msg.Status, msg.IsForwarded, msg.ExpiresAfter, msg.ExpireOnRead, msg.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO polls (message_id, question, multiple_choice, anonymous, closes_at)
+        VALUES (?, ?, ?, ?, ?)
+    `, msg.ID, poll.Question, poll.MultipleChoice, poll.Anonymous, poll.ClosesAt)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range poll.Options {
+		_, err = tx.Exec("INSERT INTO poll_options (id, message_id, position, text) VALUES (?, ?, ?, ?)", o.ID, msg.ID, o.Position, o.Text)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *appdbimpl) GetPoll(messageID string) (*Poll, error) {
+	var p Poll
+	err := db.c.QueryRow(`
+        SELECT message_id, question, multiple_choice, anonymous, closes_at
+        FROM polls WHERE message_id = ?
+    `, messageID).Scan(&p.MessageID, &p.Question, &p.MultipleChoice, &p.Anonymous, &p.ClosesAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.c.Query("SELECT id, position, text FROM poll_options WHERE message_id = ? ORDER BY position ASC", messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o PollOption
+		if err := rows.Scan(&o.ID, &o.Position, &o.Text); err != nil {
+			return nil, err
+		}
+		p.Options = append(p.Options, o)
+	}
+	return &p, rows.Err()
+}
+
+// GetPollsByConversation fetches all polls of a conversation, with their options, at once
+func (db *appdbimpl) GetPollsByConversation(conversationID string) ([]Poll, error) {
+	rows, err := db.c.Query(`
+        SELECT p.message_id, p.question, p.multiple_choice, p.anonymous, p.closes_at, o.id, o.position, o.text
+        FROM polls p
+        JOIN messages m ON m.id = p.message_id
+        JOIN poll_options o ON o.message_id = p.message_id
+        WHERE m.conversation_id = ?
+        ORDER BY p.message_id, o.position ASC
+    `, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var polls []Poll
+	for rows.Next() {
+		var p Poll
+		var o PollOption
+		if err := rows.Scan(&p.MessageID, &p.Question, &p.MultipleChoice, &p.Anonymous, &p.ClosesAt, &o.ID, &o.Position, &o.Text); err != nil {
+			return nil, err
+		}
+		if n := len(polls); n > 0 && polls[n-1].MessageID == p.MessageID {
+			polls[n-1].Options = append(polls[n-1].Options, o)
+			continue
+		}
+		p.Options = []PollOption{o}
+		polls = append(polls, p)
+	}
+	return polls, rows.Err()
+}
+
+func (db *appdbimpl) GetPollVotes(messageID string) ([]PollVote, error) {
+	rows, err := db.c.Query("SELECT message_id, option_id, user_id, created_at FROM poll_votes WHERE message_id = ? ORDER BY created_at ASC", messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var votes []PollVote
+	for rows.Next() {
+		var v PollVote
+		if err := rows.Scan(&v.MessageID, &v.OptionID, &v.UserID, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		votes = append(votes, v)
+	}
+	return votes, rows.Err()
+}
+
+// GetPollVotesByConversation fetches the votes of all polls in a conversation at once
+func (db *appdbimpl) GetPollVotesByConversation(conversationID string) ([]PollVote, error) {
+	rows, err := db.c.Query(`
+        SELECT v.message_id, v.option_id, v.user_id, v.created_at
+        FROM poll_votes v
+        JOIN messages m ON m.id = v.message_id
+        WHERE m.conversation_id = ?
+        ORDER BY v.created_at ASC
+    `, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var votes []PollVote
+	for rows.Next() {
+		var v PollVote
+		if err := rows.Scan(&v.MessageID, &v.OptionID, &v.UserID, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		votes = append(votes, v)
+	}
+	return votes, rows.Err()
+}
+
+// AddPollVote records a vote. With replaceOthers (single-choice polls) the user's votes for other options of the
+// same poll are removed first. Voting twice for the same option is a no-op.
+func (db *appdbimpl) AddPollVote(vote PollVote, replaceOthers bool) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if replaceOthers {
+		_, err = tx.Exec("DELETE FROM poll_votes WHERE message_id = ? AND user_id = ? AND option_id != ?", vote.MessageID, vote.UserID, vote.OptionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+        INSERT OR IGNORE INTO poll_votes (message_id, option_id, user_id, created_at)
+        VALUES (?, ?, ?, ?)
+    `, vote.MessageID, vote.OptionID, vote.UserID, vote.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *appdbimpl) RemovePollVote(messageID, optionID, userID string) error {
+	_, err := db.c.Exec("DELETE FROM poll_votes WHERE message_id = ? AND option_id = ? AND user_id = ?", messageID, optionID, userID)
+	return err
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const pushSubscriptionColumns = "id, user_id, endpoint, p256dh, auth, created_at"
+
+func scanPushSubscription(row interface{ Scan(...interface{}) error }) (PushSubscription, error) {
+	var s PushSubscription
+	err := row.Scan(&s.ID, &s.UserID, &s.Endpoint, &s.P256dh, &s.Auth, &s.CreatedAt)
+	return s, err
+}
+
+// SavePushSubscription adds a subscription, or updates the subscription with the same endpoint: browsers subscribe
+// again with the same endpoint, possibly for another user. It returns the stored subscription, which keeps the ID
+// and creation time of an existing one.
+func (db *appdbimpl) SavePushSubscription(s PushSubscription) (*PushSubscription, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(`
+        INSERT INTO push_subscriptions (`+pushSubscriptionColumns+`)
+        VALUES (?, ?, ?, ?, ?, ?)
+        ON CONFLICT (endpoint) DO UPDATE SET user_id = excluded.user_id, p256dh = excluded.p256dh, auth = excluded.auth
+    `, s.ID, s.UserID, s.Endpoint, s.P256dh, s.Auth, s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := scanPushSubscription(tx.QueryRow("SELECT "+pushSubscriptionColumns+" FROM push_subscriptions WHERE endpoint = ?", s.Endpoint))
+	if err != nil {
+		return nil, err
+	}
+	return &stored, tx.Commit()
+}
+
+func (db *appdbimpl) GetPushSubscription(id string) (*PushSubscription, error) {
+	s, err := scanPushSubscription(db.c.QueryRow("SELECT "+pushSubscriptionColumns+" FROM push_subscriptions WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetPushSubscriptions returns the subscriptions of a user, the oldest first
+func (db *appdbimpl) GetPushSubscriptions(userID string) ([]PushSubscription, error) {
+	rows, err := db.c.Query(`
+        SELECT `+pushSubscriptionColumns+`
+        FROM push_subscriptions
+        WHERE user_id = ?
+        ORDER BY created_at ASC, rowid ASC
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []PushSubscription
+	for rows.Next() {
+		s, err := scanPushSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	return subscriptions, rows.Err()
+}
+
+func (db *appdbimpl) DeletePushSubscription(id string) error {
+	_, err := db.c.Exec("DELETE FROM push_subscriptions WHERE id = ?", id)
+	return err
+}
+
+// DeletePushSubscriptionByEndpoint deletes the subscription of an endpoint the push service no longer knows
+func (db *appdbimpl) DeletePushSubscriptionByEndpoint(endpoint string) error {
+	_, err := db.c.Exec("DELETE FROM push_subscriptions WHERE endpoint = ?", endpoint)
+	return err
+}
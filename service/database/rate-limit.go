@@ -0,0 +1,37 @@
+package database
+
+import (
+	"time"
+)
+
+// TakeRateLimitToken takes a token from the bucket `key`, which allows `burst` requests at once and then one every
+// `every`, and returns 0; when the bucket is empty, it returns how long until it has a token. The bucket is checked
+// and updated in a single statement, so servers sharing the database can't both take the last token.
+func (db *appdbimpl) TakeRateLimitToken(key string, burst int, every time.Duration, now time.Time) (time.Duration, error) {
+	nowNanos, everyNanos := now.UnixNano(), every.Nanoseconds()
+	res, err := db.c.Exec(`
+        INSERT INTO rate_limits (key, full_at) VALUES (?, ? + ?)
+        ON CONFLICT (key) DO UPDATE SET full_at = MAX(full_at, ?) + ?
+        WHERE MAX(full_at, ?) + ? - ? <= ? * ?
+    `, key, nowNanos, everyNanos, nowNanos, everyNanos, nowNanos, everyNanos, nowNanos, burst, everyNanos)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return 0, err
+	}
+
+	var fullAt int64
+	if err := db.c.QueryRow("SELECT full_at FROM rate_limits WHERE key = ?", key).Scan(&fullAt); err != nil {
+		return 0, err
+	}
+	// The bucket may have refilled since the update: the request is still refused, for the shortest wait
+	wait := max(fullAt, nowNanos) + everyNanos - nowNanos - int64(burst)*everyNanos
+	return time.Duration(max(wait, 1)), nil
+}
+
+// PruneRateLimits removes the buckets full at `now`, which are the same as missing ones
+func (db *appdbimpl) PruneRateLimits(now time.Time) error {
+	_, err := db.c.Exec("DELETE FROM rate_limits WHERE full_at <= ?", now.UnixNano())
+	return err
+}
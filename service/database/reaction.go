@@ -5,21 +5,69 @@ import (
 	"errors"
 )
 
-func (db *appdbimpl) CreateReaction(r Reaction) error {
-	// First, delete any existing reaction from this user on this message
-	_, err := db.c.Exec(`
-        DELETE FROM reactions WHERE message_id = ? AND user_id = ?
-    `, r.MessageID, r.UserID)
+// CreateReaction stores a reaction. With replaceOthers (conversations in single-reaction mode) the user's other
+// reactions to the same message are removed first, and returned as replaced. Reacting twice with the same emoji
+// stores nothing: the reaction already stored is returned instead, with created false.
+func (db *appdbimpl) CreateReaction(r Reaction, replaceOthers bool) (stored Reaction, created bool, replaced []Reaction, err error) {
+	tx, err := db.c.Begin()
 	if err != nil {
-		return err
+		return Reaction{}, false, nil, err
 	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
 
-	// Then insert the new reaction
-	_, err = db.c.Exec(`
-        INSERT INTO reactions (id, message_id, user_id, emoji, created_at)
+	if replaceOthers {
+		// Deleting and reading in one statement, so that concurrent requests each report the reactions they removed
+		rows, err := tx.Query(`
+            DELETE FROM reactions WHERE message_id = ? AND user_id = ? AND emoji != ?
+            RETURNING id, message_id, user_id, emoji, created_at
+        `, r.MessageID, r.UserID, r.Emoji)
+		if err != nil {
+			return Reaction{}, false, nil, err
+		}
+		for rows.Next() {
+			var e Reaction
+			if err := rows.Scan(&e.ID, &e.MessageID, &e.UserID, &e.Emoji, &e.CreatedAt); err != nil {
+				_ = rows.Close()
+				return Reaction{}, false, nil, err
+			}
+			replaced = append(replaced, e)
+		}
+		if err := rows.Close(); err != nil {
+			return Reaction{}, false, nil, err
+		}
+		if err := rows.Err(); err != nil {
+			return Reaction{}, false, nil, err
+		}
+	}
+
+	res, err := tx.Exec(`
+        INSERT OR IGNORE INTO reactions (id, message_id, user_id, emoji, created_at)
         VALUES (?, ?, ?, ?, ?)
     `, r.ID, r.MessageID, r.UserID, r.Emoji, r.CreatedAt)
-	return err
+	if err != nil {
+		return Reaction{}, false, nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return Reaction{}, false, nil, err
+	}
+
+	stored = r
+	if n == 0 {
+		// A concurrent request stored the same reaction first
+		err = tx.QueryRow(`
+            SELECT id, message_id, user_id, emoji, created_at
+            FROM reactions
+            WHERE message_id = ? AND user_id = ? AND emoji = ?
+        `, r.MessageID, r.UserID, r.Emoji).Scan(&stored.ID, &stored.MessageID, &stored.UserID, &stored.Emoji, &stored.CreatedAt)
+		if err != nil {
+			return Reaction{}, false, nil, err
+		}
+	}
+
+	return stored, n > 0, replaced, tx.Commit()
 }
 
 func (db *appdbimpl) GetReactionByID(id string) (*Reaction, error) {
@@ -35,7 +83,7 @@ func (db *appdbimpl) GetReactionByID(id string) (*Reaction, error) {
 }
 
 func (db *appdbimpl) GetReactionsByMessage(messageID string) ([]Reaction, error) {
-	rows, err := db.c.Query("SELECT id, message_id, user_id, emoji, created_at FROM reactions WHERE message_id = ?", messageID)
+	rows, err := db.c.Query("SELECT id, message_id, user_id, emoji, created_at FROM reactions WHERE message_id = ? ORDER BY created_at ASC", messageID)
 	if err != nil {
 		return nil, err
 	}
@@ -52,20 +100,27 @@ func (db *appdbimpl) GetReactionsByMessage(messageID string) ([]Reaction, error)
 	return reactions, rows.Err()
 }
 
-func (db *appdbimpl) GetUserReactionForMessage(messageID, userID string) (*Reaction, error) {
-	var r Reaction
-	err := db.c.QueryRow(`
-		SELECT id, message_id, user_id, emoji, created_at 
-		FROM reactions 
+func (db *appdbimpl) GetUserReactionsForMessage(messageID, userID string) ([]Reaction, error) {
+	rows, err := db.c.Query(`
+		SELECT id, message_id, user_id, emoji, created_at
+		FROM reactions
 		WHERE message_id = ? AND user_id = ?
-	`, messageID, userID).Scan(&r.ID, &r.MessageID, &r.UserID, &r.Emoji, &r.CreatedAt)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, nil
-	}
+		ORDER BY created_at ASC
+	`, messageID, userID)
 	if err != nil {
 		return nil, err
 	}
-	return &r, nil
+	defer rows.Close()
+
+	var reactions []Reaction
+	for rows.Next() {
+		var r Reaction
+		if err := rows.Scan(&r.ID, &r.MessageID, &r.UserID, &r.Emoji, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, r)
+	}
+	return reactions, rows.Err()
 }
 
 func (db *appdbimpl) DeleteReaction(id string) error {
@@ -80,6 +135,7 @@ func (db *appdbimpl) GetReactionsByConversation(conversationID string) ([]Reacti
 		FROM reactions r
 		JOIN messages m ON r.message_id = m.id
 		WHERE m.conversation_id = ?
+		ORDER BY r.created_at ASC
 	`, conversationID)
 	if err != nil {
 		return nil, err
@@ -96,3 +152,38 @@ func (db *appdbimpl) GetReactionsByConversation(conversationID string) ([]Reacti
 	}
 	return reactions, rows.Err()
 }
+
+// GetReactionsByMessageIDs fetches the reactions of several messages at once, oldest first
+func (db *appdbimpl) GetReactionsByMessageIDs(messageIDs []string) ([]Reaction, error) {
+	if len(messageIDs) == 0 {
+		return []Reaction{}, nil
+	}
+
+	// Build placeholders for SQL IN clause
+	placeholders := ""
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		if i > 0 {
+			placeholders += ","
+		}
+		placeholders += "?"
+		args[i] = id
+	}
+
+	query := "SELECT id, message_id, user_id, emoji, created_at FROM reactions WHERE message_id IN (" + placeholders + ") ORDER BY created_at ASC"
+	rows, err := db.c.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactions []Reaction
+	for rows.Next() {
+		var r Reaction
+		if err := rows.Scan(&r.ID, &r.MessageID, &r.UserID, &r.Emoji, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, r)
+	}
+	return reactions, rows.Err()
+}
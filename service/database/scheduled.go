@@ -0,0 +1,111 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const scheduledMessageColumns = `id, conversation_id, sender_id, created_at, send_at, content_type, text, photo_url,
+        replied_to_message_id, poll, status, error`
+
+func scanScheduledMessage(row interface{ Scan(...interface{}) error }) (ScheduledMessage, error) {
+	var m ScheduledMessage
+	err := row.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.CreatedAt, &m.SendAt, &m.ContentType, &m.Text, &m.PhotoURL,
+		&m.RepliedToMessageID, &m.Poll, &m.Status, &m.Error)
+	return m, err
+}
+
+func (db *appdbimpl) queryScheduledMessages(query string, args ...interface{}) ([]ScheduledMessage, error) {
+	rows, err := db.c.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []ScheduledMessage
+	for rows.Next() {
+		m, err := scanScheduledMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+func (db *appdbimpl) CreateScheduledMessage(m ScheduledMessage) error {
+	_, err := db.c.Exec(`
+        INSERT INTO scheduled_messages (`+scheduledMessageColumns+`)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, m.ID, m.ConversationID, m.SenderID, m.CreatedAt, m.SendAt, m.ContentType, m.Text, m.PhotoURL,
+		m.RepliedToMessageID, m.Poll, m.Status, m.Error)
+	return err
+}
+
+func (db *appdbimpl) GetScheduledMessage(id string) (*ScheduledMessage, error) {
+	m, err := scanScheduledMessage(db.c.QueryRow(`
+        SELECT `+scheduledMessageColumns+`
+        FROM scheduled_messages
+        WHERE id = ?
+    `, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// GetScheduledMessagesBySender returns the messages a user scheduled in a conversation, the next to be sent first
+func (db *appdbimpl) GetScheduledMessagesBySender(conversationID, senderID string) ([]ScheduledMessage, error) {
+	return db.queryScheduledMessages(`
+        SELECT `+scheduledMessageColumns+`
+        FROM scheduled_messages
+        WHERE conversation_id = ? AND sender_id = ?
+        ORDER BY send_at ASC, created_at ASC
+    `, conversationID, senderID)
+}
+
+// UpdateScheduledMessage replaces the content, time and status of a scheduled message
+func (db *appdbimpl) UpdateScheduledMessage(m ScheduledMessage) error {
+	_, err := db.c.Exec(`
+        UPDATE scheduled_messages
+        SET send_at = ?, content_type = ?, text = ?, photo_url = ?, replied_to_message_id = ?, poll = ?, status = ?, error = ?
+        WHERE id = ?
+    `, m.SendAt, m.ContentType, m.Text, m.PhotoURL, m.RepliedToMessageID, m.Poll, m.Status, m.Error, m.ID)
+	return err
+}
+
+func (db *appdbimpl) DeleteScheduledMessage(id string) error {
+	_, err := db.c.Exec("DELETE FROM scheduled_messages WHERE id = ?", id)
+	return err
+}
+
+// GetDueScheduledMessages returns at most `limit` pending messages whose time is not after `now`, the most overdue
+// first
+func (db *appdbimpl) GetDueScheduledMessages(now string, limit int) ([]ScheduledMessage, error) {
+	return db.queryScheduledMessages(`
+        SELECT `+scheduledMessageColumns+`
+        FROM scheduled_messages
+        WHERE status = 'pending' AND send_at <= ?
+        ORDER BY send_at ASC, created_at ASC
+        LIMIT ?
+    `, now, limit)
+}
+
+// GetNextScheduledSendAt returns the time of the next pending message, or nil if there is none
+func (db *appdbimpl) GetNextScheduledSendAt() (*string, error) {
+	var sendAt sql.NullString
+	err := db.c.QueryRow("SELECT MIN(send_at) FROM scheduled_messages WHERE status = 'pending'").Scan(&sendAt)
+	if err != nil || !sendAt.Valid {
+		return nil, err
+	}
+	return &sendAt.String, nil
+}
+
+// FailScheduledMessage marks a scheduled message as failed, so that the scheduler does not try to send it again
+func (db *appdbimpl) FailScheduledMessage(id, reason string) error {
+	_, err := db.c.Exec("UPDATE scheduled_messages SET status = 'failed', error = ? WHERE id = ?", reason, id)
+	return err
+}
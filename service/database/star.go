@@ -0,0 +1,64 @@
+package database
+
+// StarMessage saves a message for a user. Starring a message again keeps the original time.
+func (db *appdbimpl) StarMessage(s StarredMessage) error {
+	_, err := db.c.Exec(`
+        INSERT OR IGNORE INTO starred_messages (user_id, message_id, conversation_id, starred_at)
+        VALUES (?, ?, ?, ?)
+    `, s.UserID, s.MessageID, s.ConversationID, s.StarredAt)
+	return err
+}
+
+func (db *appdbimpl) UnstarMessage(userID, messageID string) error {
+	_, err := db.c.Exec("DELETE FROM starred_messages WHERE user_id = ? AND message_id = ?", userID, messageID)
+	return err
+}
+
+// GetStarredMessages returns at most `limit` messages starred by a user, the most recently starred first. When
+// `beforeStarredAt` is set, only the stars after (beforeStarredAt, beforeMessageID) in that order are returned, so
+// that pages can be loaded one after the other.
+func (db *appdbimpl) GetStarredMessages(userID, beforeStarredAt, beforeMessageID string, limit int) ([]StarredMessage, error) {
+	rows, err := db.c.Query(`
+        SELECT user_id, message_id, conversation_id, starred_at
+        FROM starred_messages
+        WHERE user_id = ?
+        AND (? = '' OR starred_at < ? OR (starred_at = ? AND message_id < ?))
+        ORDER BY starred_at DESC, message_id DESC
+        LIMIT ?
+    `, userID, beforeStarredAt, beforeStarredAt, beforeStarredAt, beforeMessageID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stars []StarredMessage
+	for rows.Next() {
+		var s StarredMessage
+		if err := rows.Scan(&s.UserID, &s.MessageID, &s.ConversationID, &s.StarredAt); err != nil {
+			return nil, err
+		}
+		stars = append(stars, s)
+	}
+	return stars, rows.Err()
+}
+
+// GetStarredMessageIDs returns the set of the messages of a conversation starred by a user
+func (db *appdbimpl) GetStarredMessageIDs(userID, conversationID string) (map[string]bool, error) {
+	rows, err := db.c.Query(`
+        SELECT message_id FROM starred_messages WHERE user_id = ? AND conversation_id = ?
+    `, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
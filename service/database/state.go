@@ -0,0 +1,227 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// GetConversationState returns the state of a conversation for one of its participants, or nil if the user is not
+// a participant
+func (db *appdbimpl) GetConversationState(conversationID, userID string) (*ConversationState, error) {
+	s := ConversationState{ConversationID: conversationID, UserID: userID}
+	err := db.c.QueryRow(`
+        SELECT archived, pin_position, muted_until, marked_unread
+        FROM conversation_participants
+        WHERE conversation_id = ? AND user_id = ?
+    `, conversationID, userID).Scan(&s.Archived, &s.PinPosition, &s.MutedUntil, &s.MarkedUnread)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (db *appdbimpl) UpdateConversationState(s ConversationState) error {
+	_, err := db.c.Exec(`
+        UPDATE conversation_participants
+        SET archived = ?, pin_position = ?, muted_until = ?, marked_unread = ?
+        WHERE conversation_id = ? AND user_id = ?
+    `, s.Archived, s.PinPosition, s.MutedUntil, s.MarkedUnread, s.ConversationID, s.UserID)
+	return err
+}
+
+// PinConversation pins a conversation to the top of the list of a user, above the conversations already pinned,
+// unless `limit` conversations are pinned already. It returns false when the limit was reached. Pinned conversations
+// are not archived. Pinning a pinned conversation keeps its position.
+func (db *appdbimpl) PinConversation(conversationID, userID string, limit int) (bool, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var count, top int
+	var position sql.NullInt64
+	err = tx.QueryRow(`
+        SELECT COUNT(pin_position), COALESCE(MAX(pin_position), 0),
+            (SELECT pin_position FROM conversation_participants WHERE conversation_id = ? AND user_id = ?)
+        FROM conversation_participants
+        WHERE user_id = ?
+    `, conversationID, userID, userID).Scan(&count, &top, &position)
+	if err != nil {
+		return false, err
+	}
+	if position.Valid {
+		return true, nil
+	}
+	if count >= limit {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`
+        UPDATE conversation_participants SET pin_position = ?, archived = 0
+        WHERE conversation_id = ? AND user_id = ?
+    `, top+1, conversationID, userID)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// GetPinnedConversationIDs returns the conversations pinned by a user, from the top of the list
+func (db *appdbimpl) GetPinnedConversationIDs(userID string) ([]string, error) {
+	rows, err := db.c.Query(`
+        SELECT conversation_id FROM conversation_participants
+        WHERE user_id = ? AND pin_position IS NOT NULL
+        ORDER BY pin_position DESC
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ReorderPinnedConversations sets the order of the conversations pinned by a user, from the top of the list.
+// `conversationIDs` should be the conversations returned by GetPinnedConversationIDs.
+func (db *appdbimpl) ReorderPinnedConversations(userID string, conversationIDs []string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for i, id := range conversationIDs {
+		_, err := tx.Exec(`
+            UPDATE conversation_participants SET pin_position = ?
+            WHERE conversation_id = ? AND user_id = ? AND pin_position IS NOT NULL
+        `, len(conversationIDs)-i, id, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UnarchiveOnNewMessage moves a conversation back out of the archive of the participants who receive a new message
+// from `senderID`, if their preferences say so. It returns the users whose conversation was unarchived.
+func (db *appdbimpl) UnarchiveOnNewMessage(conversationID, senderID string) ([]string, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	const where = `conversation_id = ? AND user_id != ? AND archived = 1
+        AND user_id IN (SELECT id FROM users WHERE unarchive_on_message = 1)`
+	userIDs, err := queryStrings(tx, "SELECT user_id FROM conversation_participants WHERE "+where, conversationID, senderID)
+	if err != nil || len(userIDs) == 0 {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE conversation_participants SET archived = 0 WHERE "+where, conversationID, senderID); err != nil {
+		return nil, err
+	}
+	return userIDs, tx.Commit()
+}
+
+// unreadOfParticipants selects, as `m`, the messages the participants `cp` have not read yet, for any participant
+const unreadOfParticipants = `
+        FROM messages m
+        JOIN conversation_participants cp ON cp.conversation_id = m.conversation_id
+        WHERE m.sender_id != cp.user_id AND m.content_type != 'system' AND m.is_imported = 0
+            AND NOT EXISTS (SELECT 1 FROM message_reads mr WHERE mr.message_id = m.id AND mr.user_id = cp.user_id)`
+
+// unreadMessages selects, as `m`, the messages the participant `cp` has not read yet. It takes the user ID as
+// argument.
+const unreadMessages = unreadOfParticipants + ` AND cp.user_id = ?`
+
+// mentionsUser is true for the messages of unreadMessages mentioning their participant, by name or with @all
+const mentionsUser = `EXISTS (
+            SELECT 1 FROM message_mentions mm
+            WHERE mm.message_id = m.id AND (mm.user_id = cp.user_id OR mm.user_id IS NULL)
+        )`
+
+// unreadCountsBatchSize bounds the number of users whose unread counts are computed by a single query
+const unreadCountsBatchSize = 500
+
+// GetParticipantUnreadCounts counts, for each of `userIDs`, the messages of a conversation they have not read yet,
+// and their totals as GetTotalUnreadCounts computes them. The counts of all the users are computed at once, grouped
+// by user; users with nothing to read get zero counts.
+func (db *appdbimpl) GetParticipantUnreadCounts(conversationID string, userIDs []string, now string) (map[string]ParticipantUnreadCounts, error) {
+	counts := make(map[string]ParticipantUnreadCounts, len(userIDs))
+	for _, userID := range userIDs {
+		counts[userID] = ParticipantUnreadCounts{}
+	}
+	for start := 0; start < len(userIDs); start += unreadCountsBatchSize {
+		batch := userIDs[start:min(start+unreadCountsBatchSize, len(userIDs))]
+
+		placeholders := ""
+		args := []interface{}{conversationID, conversationID, now}
+		for i, userID := range batch {
+			if i > 0 {
+				placeholders += ","
+			}
+			placeholders += "?"
+			args = append(args, userID)
+		}
+
+		rows, err := db.c.Query(`
+            SELECT
+                cp.user_id,
+                COALESCE(SUM(m.conversation_id = ?), 0),
+                COALESCE(SUM(m.conversation_id = ? AND `+mentionsUser+`), 0),
+                COALESCE(SUM(cp.archived = 0 AND (cp.muted_until IS NULL OR cp.muted_until <= ?)), 0),
+                COALESCE(SUM(cp.archived = 0 AND `+mentionsUser+`), 0)
+            `+unreadOfParticipants+` AND cp.user_id IN (`+placeholders+`)
+            GROUP BY cp.user_id
+        `, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var userID string
+			var c ParticipantUnreadCounts
+			if err := rows.Scan(&userID, &c.Conversation.Messages, &c.Conversation.Mentions, &c.Total.Messages, &c.Total.Mentions); err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			counts[userID] = c
+		}
+		err = rows.Err()
+		_ = rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// GetTotalUnreadCounts counts the messages a user has not read yet in the conversations they did not archive.
+// Messages of the conversations muted at `now` only count as mentions.
+func (db *appdbimpl) GetTotalUnreadCounts(userID, now string) (UnreadCounts, error) {
+	var c UnreadCounts
+	err := db.c.QueryRow(`
+        SELECT
+            COALESCE(SUM(cp.muted_until IS NULL OR cp.muted_until <= ?), 0),
+            COALESCE(SUM(`+mentionsUser+`), 0)
+        `+unreadMessages+` AND cp.archived = 0
+    `, now, userID).Scan(&c.Messages, &c.Mentions)
+	return c, err
+}
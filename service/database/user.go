@@ -132,3 +132,93 @@ func (db *appdbimpl) GetUsersByIDs(ids []string) ([]User, error) {
 	}
 	return users, rows.Err()
 }
+
+// CreatePlaceholderUser creates the account standing for a sender of an imported conversation that doesn't match any
+// user. `sourceName` is the name found in the chat export.
+func (db *appdbimpl) CreatePlaceholderUser(u User, sourceName, conversationID, createdAt string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec("INSERT INTO users (id, name, display_name, photo_url) VALUES (?, ?, ?, ?)", u.ID, u.Name, u.DisplayName, u.PhotoURL)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO placeholder_users (user_id, source_name, conversation_id, created_at)
+		VALUES (?, ?, ?, ?)
+	`, u.ID, sourceName, conversationID, createdAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// IsPlaceholderUser reports whether a user is a placeholder created by an import
+func (db *appdbimpl) IsPlaceholderUser(userID string) (bool, error) {
+	var exists bool
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM placeholder_users WHERE user_id = ?)", userID).Scan(&exists)
+	return exists, err
+}
+
+// IsInactiveUser reports whether a user is a placeholder or a deleted account. Nobody can log in or authenticate as
+// an inactive user.
+func (db *appdbimpl) IsInactiveUser(userID string) (bool, error) {
+	var inactive bool
+	err := db.c.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM placeholder_users WHERE user_id = ?)
+			OR EXISTS(SELECT 1 FROM deleted_users WHERE user_id = ?)
+	`, userID, userID).Scan(&inactive)
+	return inactive, err
+}
+
+// GetUserPreferences returns the preferences of a user, or nil if the user doesn't exist
+func (db *appdbimpl) GetUserPreferences(userID string) (*UserPreferences, error) {
+	p := UserPreferences{UserID: userID}
+	err := db.c.QueryRow("SELECT unarchive_on_message, push_notifications, push_previews, digest_frequency FROM users WHERE id = ?", userID).
+		Scan(&p.UnarchiveOnMessage, &p.PushNotifications, &p.PushPreviews, &p.DigestFrequency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// UpdateUserPreferences saves the preferences of a user. Turning digests off forgets where the last digest ended,
+// so that turning them on again doesn't summarize the messages in between.
+func (db *appdbimpl) UpdateUserPreferences(p UserPreferences) error {
+	_, err := db.c.Exec(`
+        UPDATE users
+        SET unarchive_on_message = ?, push_notifications = ?, push_previews = ?, digest_frequency = ?,
+            digest_since = CASE WHEN ? = 'never' THEN NULL ELSE digest_since END
+        WHERE id = ?
+    `, p.UnarchiveOnMessage, p.PushNotifications, p.PushPreviews, p.DigestFrequency, p.DigestFrequency, p.UserID)
+	return err
+}
+
+// GetUserEmail returns the email address of a user, or nil if they have none
+func (db *appdbimpl) GetUserEmail(userID string) (*string, error) {
+	var email sql.NullString
+	err := db.c.QueryRow("SELECT email FROM users WHERE id = ?", userID).Scan(&email)
+	if errors.Is(err, sql.ErrNoRows) || !email.Valid {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &email.String, nil
+}
+
+// SetUserEmail changes the email address of a user; nil removes it
+func (db *appdbimpl) SetUserEmail(userID string, email *string) error {
+	_, err := db.c.Exec("UPDATE users SET email = ? WHERE id = ?", email, userID)
+	return err
+}
@@ -0,0 +1,155 @@
+/*
+Package digest writes the email digests of unread messages, in plain text and HTML, and signs the unsubscribe links
+they carry.
+
+The digest lists the conversations with new unread messages, with the latest few of each, followed by the messages
+mentioning the recipient. Choosing who gets a digest and what goes in it is up to the caller.
+*/
+package digest
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// Digest is the content of a digest email
+type Digest struct {
+	// Recipient is the name the email is addressed to
+	Recipient string
+
+	// Frequency is "hourly" or "daily"
+	Frequency string
+
+	Conversations []Conversation
+
+	// Mentions are the new messages mentioning the recipient, in every conversation
+	Mentions []Line
+
+	// AppURL opens the web UI; UnsubscribeURL turns digests off
+	AppURL         string
+	UnsubscribeURL string
+}
+
+// Conversation is a conversation with new unread messages
+type Conversation struct {
+	Title    string
+	URL      string
+	Unread   int
+	Mentions int
+
+	// Latest are the most recent of the unread messages, the oldest first
+	Latest []Line
+}
+
+// Line is a message as shown in a digest
+type Line struct {
+	Sender       string
+	Conversation string
+	Text         string
+	At           string
+}
+
+// Subject returns the subject of the digest email
+func Subject(d Digest) string {
+	unread, mentions := 0, len(d.Mentions)
+	for _, c := range d.Conversations {
+		unread += c.Unread
+	}
+	subject := fmt.Sprintf("%d unread %s", unread, plural(unread, "message", "messages"))
+	if mentions > 0 {
+		subject += fmt.Sprintf(", %d %s", mentions, plural(mentions, "mention", "mentions"))
+	}
+	return subject + " on WASAText"
+}
+
+// Render returns the plain-text and HTML bodies of the digest email
+func Render(d Digest) (text, html string, err error) {
+	var tb, hb bytes.Buffer
+	if err := textDigest.Execute(&tb, d); err != nil {
+		return "", "", fmt.Errorf("rendering text digest: %w", err)
+	}
+	if err := htmlDigest.Execute(&hb, d); err != nil {
+		return "", "", fmt.Errorf("rendering HTML digest: %w", err)
+	}
+	return tb.String(), hb.String(), nil
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+var templateFuncs = map[string]interface{}{
+	"plural": plural,
+}
+
+var textDigest = texttemplate.Must(texttemplate.New("text").Funcs(templateFuncs).Parse(`Hi {{.Recipient}},
+
+Here is your {{.Frequency}} summary of what you missed on WASAText.
+{{range .Conversations}}
+{{.Title}}: {{.Unread}} unread {{plural .Unread "message" "messages"}}{{if .Mentions}}, {{.Mentions}} {{plural .Mentions "mention" "mentions"}}{{end}}
+{{- range .Latest}}
+  {{.Sender}}: {{.Text}}
+{{- end}}
+  {{.URL}}
+{{end}}
+{{- if .Mentions}}
+Mentions
+{{- range .Mentions}}
+  {{.Sender}} in {{.Conversation}}: {{.Text}}
+{{- end}}
+{{end}}
+Open WASAText: {{.AppURL}}
+
+You receive this email because you turned on {{.Frequency}} digests.
+Unsubscribe: {{.UnsubscribeURL}}
+`))
+
+var htmlDigest = htmltemplate.Must(htmltemplate.New("html").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>WASAText digest</title>
+</head>
+<body style="font-family: sans-serif; max-width: 40em; margin: 1em auto; color: #222;">
+<p>Hi {{.Recipient}},</p>
+<p>Here is your {{.Frequency}} summary of what you missed on WASAText.</p>
+{{- range .Conversations}}
+<div style="margin: 1em 0; padding: 0.5em 1em; border-left: 3px solid #4a7;">
+<p style="margin: 0.25em 0;"><a href="{{.URL}}" style="font-weight: bold;">{{.Title}}</a>
+<span style="color: #777;">· {{.Unread}} unread {{plural .Unread "message" "messages"}}{{if .Mentions}} · {{.Mentions}} {{plural .Mentions "mention" "mentions"}}{{end}}</span></p>
+{{- range .Latest}}
+<p style="margin: 0.25em 0;"><b>{{.Sender}}</b>: {{.Text}}</p>
+{{- end}}
+</div>
+{{- end}}
+{{- if .Mentions}}
+<h3>Mentions</h3>
+{{- range .Mentions}}
+<p style="margin: 0.25em 0;"><b>{{.Sender}}</b> in {{.Conversation}}: {{.Text}}</p>
+{{- end}}
+{{- end}}
+<p><a href="{{.AppURL}}">Open WASAText</a></p>
+<p style="color: #777; font-size: 0.85em;">You receive this email because you turned on {{.Frequency}} digests.
+<a href="{{.UnsubscribeURL}}">Unsubscribe</a></p>
+</body>
+</html>
+`))
+
+// UnsubscribedPage is the page shown by the unsubscribe link
+const UnsubscribedPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Unsubscribed</title>
+</head>
+<body style="font-family: sans-serif; max-width: 40em; margin: 2em auto; color: #222;">
+<h1>Unsubscribed</h1>
+<p>You will no longer receive email digests from WASAText. You can turn them on again in your preferences.</p>
+</body>
+</html>
+`
@@ -0,0 +1,77 @@
+package digest
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// secretSize is the size of the key signing unsubscribe tokens
+const secretSize = 32
+
+// UnsubscribeToken returns the token of the unsubscribe link of a user. Tokens don't expire: the link of an old
+// email must keep working.
+func UnsubscribeToken(secret []byte, userID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(userID)) + "." + base64.RawURLEncoding.EncodeToString(sign(secret, userID))
+}
+
+// VerifyUnsubscribeToken returns the user of an unsubscribe token, or false if the token was not signed with
+// `secret`
+func VerifyUnsubscribeToken(secret []byte, token string) (string, bool) {
+	encodedID, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", false
+	}
+	userID, err := base64.RawURLEncoding.DecodeString(encodedID)
+	if err != nil {
+		return "", false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, sign(secret, string(userID))) {
+		return "", false
+	}
+	return string(userID), true
+}
+
+func sign(secret []byte, userID string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte("unsubscribe\x00" + userID))
+	return h.Sum(nil)
+}
+
+// LoadOrCreateSecret reads the key signing unsubscribe tokens from the file at `path`, or creates the key and the
+// file if it doesn't exist. Changing the key breaks the links of the emails already sent.
+func LoadOrCreateSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		secret, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(secret) < secretSize {
+			return nil, fmt.Errorf("%s must hold at least %d bytes in hex", path, secretSize)
+		}
+		return secret, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if dir := filepath.Dir(path); dir != "" && dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(secret)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
@@ -1,16 +1,44 @@
 package globaltime
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
-// FixedTime represent a fixed moment in time. Set this variable to anything different from the default value for
-// time.Time and the value will be returned in Now() function in place of the current time
-var FixedTime time.Time
+var (
+	mu        sync.RWMutex
+	fixedTime time.Time
+)
 
-// Now returns the current time (time.Now()) if no FixedTime has been set. Otherwise, it returns FixedTime.
-// Use this in place of time.Now() to allow testing w/ custom time.
+// SetFixedTime fixes the time returned by Now to `t`. Set it to the zero time.Time to go back to the current time. It
+// is safe to call while other goroutines call Now.
+func SetFixedTime(t time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+	fixedTime = t
+}
+
+// Advance moves the fixed time forward by `d`. It does nothing if no fixed time is set.
+func Advance(d time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	if !fixedTime.IsZero() {
+		fixedTime = fixedTime.Add(d)
+	}
+}
+
+// FixedTime returns the time set with SetFixedTime, or the zero time.Time if none is set
+func FixedTime() time.Time {
+	mu.RLock()
+	defer mu.RUnlock()
+	return fixedTime
+}
+
+// Now returns the current time (time.Now()) if no time has been set with SetFixedTime. Otherwise, it returns the
+// fixed time. Use this in place of time.Now() to allow testing w/ custom time.
 func Now() time.Time {
-	if FixedTime.After(time.Time{}) {
-		return FixedTime
+	if t := FixedTime(); t.After(time.Time{}) {
+		return t
 	}
 	return time.Now()
 }
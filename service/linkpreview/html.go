@@ -0,0 +1,112 @@
+package linkpreview
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 500
+)
+
+// parseHTML reads the preview tags of a page fetched from `pageURL`. It stops at the end of <head>.
+func parseHTML(r io.Reader, pageURL *url.URL) (*Preview, error) {
+	meta := make(map[string]string)
+	var title strings.Builder
+	inTitle := false
+
+	z := html.NewTokenizer(r)
+loop:
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				break loop
+			}
+			return nil, z.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tag := z.Token()
+			switch tag.DataAtom {
+			case atom.Title:
+				inTitle = true
+			case atom.Meta:
+				var key, content string
+				for _, a := range tag.Attr {
+					switch a.Key {
+					case "property", "name":
+						key = strings.ToLower(strings.TrimSpace(a.Val))
+					case "content":
+						content = strings.TrimSpace(a.Val)
+					}
+				}
+				// The first occurrence of a tag wins
+				if _, ok := meta[key]; key != "" && content != "" && !ok {
+					meta[key] = content
+				}
+			case atom.Body:
+				break loop
+			}
+		case html.TextToken:
+			if inTitle {
+				title.Write(z.Text())
+			}
+		case html.EndTagToken:
+			switch z.Token().DataAtom {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				break loop
+			}
+		}
+	}
+
+	first := func(keys ...string) string {
+		for _, k := range keys {
+			if v := meta[k]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	p := &Preview{
+		URL:         pageURL.String(),
+		Title:       truncate(first("og:title", "twitter:title"), maxTitleLength),
+		Description: truncate(first("og:description", "twitter:description", "description"), maxDescriptionLength),
+		SiteName:    truncate(first("og:site_name"), maxTitleLength),
+	}
+	if p.Title == "" {
+		p.Title = truncate(strings.Join(strings.Fields(title.String()), " "), maxTitleLength)
+	}
+	if canonical := resolve(pageURL, first("og:url")); canonical != "" {
+		p.URL = canonical
+	}
+	p.ImageURL = resolve(pageURL, first("og:image:secure_url", "og:image", "og:image:url", "twitter:image", "twitter:image:src"))
+	return p, nil
+}
+
+// resolve returns `ref` as an absolute http(s) URL relative to `base`, or "" if it isn't one
+func resolve(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || checkURL(u) != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// truncate shortens `s` to at most `n` characters
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
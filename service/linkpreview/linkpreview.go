@@ -0,0 +1,196 @@
+/*
+Package linkpreview fetches the preview of a web page: its title, description and image, from Open Graph and Twitter
+card tags, falling back to the HTML title and description.
+
+Pages are fetched by a Fetcher with strict timeouts and size limits. The Fetcher refuses to connect to loopback,
+private, link-local and other non-public addresses, unless they are explicitly allowed, so that users can't make the
+server request internal services (see netguard). The check is done on every redirect too.
+*/
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ozberk-sevinc/wasa-project/service/netguard"
+)
+
+const (
+	DefaultTimeout      = 5 * time.Second
+	DefaultMaxPageSize  = 512 << 10
+	DefaultMaxImageSize = 2 << 20
+
+	maxRedirects = 3
+)
+
+// ErrNotHTML is returned by Fetch for URLs that are not web pages
+var ErrNotHTML = errors.New("not an HTML page")
+
+// Config configures a Fetcher. Zero values are replaced by the defaults.
+type Config struct {
+	// Timeout bounds each request, from dialing to reading the whole body
+	Timeout time.Duration
+
+	// MaxPageSize is the number of bytes of a page read to find its tags; the rest is ignored
+	MaxPageSize int64
+
+	// MaxImageSize is the size of the largest preview image. Larger images are left out.
+	MaxImageSize int64
+
+	// AllowedNetworks are networks the Fetcher may connect to even though they are not public, for instance
+	// 127.0.0.0/8 to preview pages of a local test server
+	AllowedNetworks []netip.Prefix
+}
+
+// Preview is the preview of a web page. Fields the page does not provide are empty.
+type Preview struct {
+	// URL is the canonical URL of the page, or the URL it was fetched from after redirects
+	URL         string
+	Title       string
+	Description string
+	SiteName    string
+
+	// ImageURL is the absolute URL of the preview image
+	ImageURL string
+}
+
+// Image is a downloaded preview image
+type Image struct {
+	ContentType string
+	Data        []byte
+}
+
+// Fetcher fetches link previews. It is safe for concurrent use.
+type Fetcher struct {
+	cfg    Config
+	client *http.Client
+}
+
+// NewFetcher returns a Fetcher using `cfg`
+func NewFetcher(cfg Config) *Fetcher {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxPageSize <= 0 {
+		cfg.MaxPageSize = DefaultMaxPageSize
+	}
+	if cfg.MaxImageSize <= 0 {
+		cfg.MaxImageSize = DefaultMaxImageSize
+	}
+
+	f := &Fetcher{cfg: cfg}
+	dialer := &net.Dialer{
+		Timeout: cfg.Timeout,
+		Control: netguard.Control(cfg.AllowedNetworks),
+	}
+	f.client = &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			// Never go through a proxy from the environment: the proxy would make the connection for us
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   cfg.Timeout,
+			ResponseHeaderTimeout: cfg.Timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			return checkURL(req.URL)
+		},
+	}
+	return f
+}
+
+// checkURL accepts the http and https URLs
+func checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return errors.New("missing host")
+	}
+	return nil
+}
+
+// Fetch downloads the page at `rawURL` and returns its preview
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Preview, error) {
+	resp, err := f.get(ctx, rawURL, "text/html,application/xhtml+xml")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotHTML
+	}
+
+	preview, err := parseHTML(io.LimitReader(resp.Body, f.cfg.MaxPageSize), resp.Request.URL)
+	if err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+// FetchImage downloads the image at `rawURL`, if it is not larger than the configured limit
+func (f *Fetcher) FetchImage(ctx context.Context, rawURL string) (*Image, error) {
+	resp, err := f.get(ctx, rawURL, "image/*")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.cfg.MaxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > f.cfg.MaxImageSize {
+		return nil, errors.New("image too large")
+	}
+
+	// The declared type is not trusted: the image is served again by us
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, errors.New("not an image")
+	}
+	return &Image{ContentType: contentType, Data: data}, nil
+}
+
+func (f *Fetcher) get(ctx context.Context, rawURL, accept string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", "WASAText-LinkPreview/1.0")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,67 @@
+/*
+Package netguard keeps the server from connecting to internal services on behalf of users (server-side request
+forgery). It checks the address actually dialed, after DNS resolution, so that host names resolving to private
+addresses are refused too.
+*/
+package netguard
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"syscall"
+)
+
+// ErrBlockedAddress is returned when dialing an address that is not allowed
+var ErrBlockedAddress = errors.New("address not allowed")
+
+// nonPublicNetworks are the special-purpose ranges that IsPublic rejects besides the ones of the netip.Addr methods
+var nonPublicNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, which can reach any IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// IsPublic reports whether `addr` is a public unicast address. Loopback, private, link-local, multicast and other
+// special-purpose addresses are not public.
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicNetworks {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Control returns a net.Dialer Control function refusing to connect to addresses that are not public, except those
+// in `allowed`
+func Control(allowed []netip.Prefix) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, _ syscall.RawConn) error {
+		ap, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+		}
+		addr := ap.Addr().Unmap()
+		for _, prefix := range allowed {
+			if prefix.Contains(addr) {
+				return nil
+			}
+		}
+		if !IsPublic(addr) {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Package ratelimit throttles clients with token buckets. A Limit allows a burst of requests, and then one request every
+interval; a Rule has a Limit per user and one per client address. Limiter checks the requests against a Store, which
+keeps the state of the buckets: MemoryStore for a single server, or a store shared by the replicas of the server.
+
+Buckets are implemented with the generic cell rate algorithm (GCRA): the state of a bucket is a single time, when the
+bucket will be full again, which is easy to keep in a database and to update atomically.
+*/
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often the buckets that filled up are removed from the store
+const pruneInterval = 5 * time.Minute
+
+// Limit allows Burst requests at once, then one every Every. The zero Limit allows everything.
+type Limit struct {
+	Burst int
+	Every time.Duration
+}
+
+// Enabled reports whether the limit throttles requests
+func (l Limit) Enabled() bool {
+	return l.Burst > 0 && l.Every > 0
+}
+
+// String formats the limit like ParseLimit expects it
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Burst, time.Duration(l.Burst)*l.Every)
+}
+
+// ParseLimit parses a limit like 60/1m, for 60 requests a minute (and up to 60 at once). "off" and the empty string
+// are no limit.
+func ParseLimit(s string) (Limit, error) {
+	if s == "" || s == "off" {
+		return Limit{}, nil
+	}
+	count, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q: expected COUNT/DURATION", s)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("limit %q: count must be a positive number", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("limit %q: duration must be positive, like 1m or 30s", s)
+	}
+	if d/time.Duration(n) <= 0 {
+		return Limit{}, fmt.Errorf("limit %q: too many requests for the duration", s)
+	}
+	return Limit{Burst: n, Every: d / time.Duration(n)}, nil
+}
+
+// Rule limits the requests of each user and of each client address. Anonymous requests are only limited per address.
+type Rule struct {
+	PerUser Limit
+	PerIP   Limit
+}
+
+// ParseRule parses space-separated limits like `user=60/1m ip=300/1m`; limits left out, "off" and the empty string
+// are no limit
+func ParseRule(s string) (Rule, error) {
+	var rule Rule
+	if s == "off" {
+		return rule, nil
+	}
+	for _, part := range strings.Fields(s) {
+		scope, limit, ok := strings.Cut(part, "=")
+		if !ok {
+			return Rule{}, fmt.Errorf("rule %q: expected user=LIMIT or ip=LIMIT", s)
+		}
+		l, err := ParseLimit(limit)
+		if err != nil {
+			return Rule{}, err
+		}
+		switch scope {
+		case "user":
+			rule.PerUser = l
+		case "ip":
+			rule.PerIP = l
+		default:
+			return Rule{}, fmt.Errorf("rule %q: unknown scope %q, expected user or ip", s, scope)
+		}
+	}
+	return rule, nil
+}
+
+// Store keeps the state of the buckets. It must be safe for concurrent use.
+type Store interface {
+	// Take takes a token from the bucket `key` if it has one, and returns 0. Otherwise it returns how long until the
+	// bucket has a token.
+	Take(key string, limit Limit, now time.Time) (time.Duration, error)
+
+	// Prune removes the buckets full at `now`, which are the same as missing ones
+	Prune(now time.Time) error
+}
+
+// Limiter checks requests against the buckets of a Store, pruning it from time to time
+type Limiter struct {
+	store Store
+
+	mu        sync.Mutex
+	nextPrune time.Time
+}
+
+// NewLimiter returns a Limiter keeping its buckets in `store`
+func NewLimiter(store Store) (*Limiter, error) {
+	if store == nil {
+		return nil, errors.New("store is required")
+	}
+	return &Limiter{store: store}, nil
+}
+
+// Allow takes a token from the bucket `key`. It returns 0 if the request is allowed, otherwise how long the client
+// should wait. Requests are always allowed by a disabled limit.
+func (l *Limiter) Allow(key string, limit Limit, now time.Time) (time.Duration, error) {
+	if !limit.Enabled() {
+		return 0, nil
+	}
+
+	l.mu.Lock()
+	prune := !now.Before(l.nextPrune)
+	if prune {
+		l.nextPrune = now.Add(pruneInterval)
+	}
+	l.mu.Unlock()
+	if prune {
+		if err := l.store.Prune(now); err != nil {
+			return 0, fmt.Errorf("pruning rate limits: %w", err)
+		}
+	}
+
+	return l.store.Take(key, limit, now)
+}
+
+// MemoryStore keeps the buckets in memory, for a single server
+type MemoryStore struct {
+	mu sync.Mutex
+
+	// full holds when each bucket will be full again
+	full map[string]time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{full: make(map[string]time.Time)}
+}
+
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	full, wait := next(s.full[key], limit, now)
+	if wait > 0 {
+		return wait, nil
+	}
+	s.full[key] = full
+	return 0, nil
+}
+
+func (s *MemoryStore) Prune(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, full := range s.full {
+		if !full.After(now) {
+			delete(s.full, key)
+		}
+	}
+	return nil
+}
+
+// next computes a request at `now` on a bucket that is full at `full` (the zero time for a new bucket). If the request
+// is allowed, it returns when the bucket will be full after it and 0; otherwise it returns how long until the bucket
+// has a token.
+func next(full time.Time, limit Limit, now time.Time) (time.Time, time.Duration) {
+	if full.Before(now) {
+		full = now
+	}
+	full = full.Add(limit.Every)
+	if wait := full.Sub(now) - time.Duration(limit.Burst)*limit.Every; wait > 0 {
+		return time.Time{}, wait
+	}
+	return full, 0
+}
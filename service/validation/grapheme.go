@@ -0,0 +1,135 @@
+package validation
+
+import (
+	"unicode"
+)
+
+// countGraphemes counts the user-perceived characters of a string, following the rules of Unicode extended grapheme
+// clusters (UAX #29) that matter for text without control characters: combining marks and other extending
+// characters, emoji modifier and ZWJ sequences, pairs of regional indicators (flags) and Hangul syllables.
+// Prepended concatenation marks, which only appear in a few scripts, start a new character.
+func countGraphemes(s string) int {
+	count := 0
+	var prev rune
+	pictographic := false // the current character has an emoji, which ZWJ can join to another
+	regional := 0         // regional indicators at the end of the current character
+	for i, r := range s {
+		if i == 0 || !joins(prev, r, pictographic, regional) {
+			count++
+			pictographic = false
+			regional = 0
+		}
+		if isExtendedPictographic(r) {
+			pictographic = true
+		}
+		if isRegionalIndicator(r) {
+			regional++
+		}
+		prev = r
+	}
+	return count
+}
+
+// joins reports whether `r` belongs to the same character as `prev`
+func joins(prev, r rune, pictographic bool, regional int) bool {
+	switch {
+	case isExtend(r) || r == zeroWidthJoiner || unicode.Is(unicode.Mc, r):
+		return true
+	case prev == zeroWidthJoiner:
+		return pictographic && isExtendedPictographic(r)
+	case isRegionalIndicator(prev) && isRegionalIndicator(r):
+		return regional%2 == 1
+	}
+	return joinsHangul(hangulType(prev), hangulType(r))
+}
+
+const zeroWidthJoiner = '\u200D'
+
+// isExtend reports whether a rune extends the character before it: combining marks, variation selectors, the zero
+// width non-joiner, emoji modifiers (skin tones) and tags (subdivision flags)
+func isExtend(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me) || r == '\u200C' ||
+		(r >= 0x1F3FB && r <= 0x1F3FF) ||
+		(r >= 0xE0020 && r <= 0xE007F)
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+func isExtendedPictographic(r rune) bool {
+	return unicode.Is(extendedPictographic, r)
+}
+
+// extendedPictographic is the Extended_Pictographic property of emoji-data.txt (Unicode 15.1), reserved code points
+// included as there. Emoji modifiers and regional indicators are not in it.
+var extendedPictographic = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x00A9, 0x00A9, 1}, {0x00AE, 0x00AE, 1},
+		{0x203C, 0x203C, 1}, {0x2049, 0x2049, 1}, {0x2122, 0x2122, 1}, {0x2139, 0x2139, 1},
+		{0x2194, 0x2199, 1}, {0x21A9, 0x21AA, 1},
+		{0x231A, 0x231B, 1}, {0x2328, 0x2328, 1}, {0x2388, 0x2388, 1}, {0x23CF, 0x23CF, 1},
+		{0x23E9, 0x23F3, 1}, {0x23F8, 0x23FA, 1},
+		{0x24C2, 0x24C2, 1},
+		{0x25AA, 0x25AB, 1}, {0x25B6, 0x25B6, 1}, {0x25C0, 0x25C0, 1}, {0x25FB, 0x25FE, 1},
+		{0x2600, 0x2605, 1}, {0x2607, 0x2612, 1}, {0x2614, 0x2685, 1}, {0x2690, 0x2705, 1},
+		{0x2708, 0x2712, 1}, {0x2714, 0x2714, 1}, {0x2716, 0x2716, 1}, {0x271D, 0x271D, 1},
+		{0x2721, 0x2721, 1}, {0x2728, 0x2728, 1}, {0x2733, 0x2734, 1}, {0x2744, 0x2744, 1},
+		{0x2747, 0x2747, 1}, {0x274C, 0x274C, 1}, {0x274E, 0x274E, 1}, {0x2753, 0x2755, 1},
+		{0x2757, 0x2757, 1}, {0x2763, 0x2767, 1}, {0x2795, 0x2797, 1}, {0x27A1, 0x27A1, 1},
+		{0x27B0, 0x27B0, 1}, {0x27BF, 0x27BF, 1},
+		{0x2934, 0x2935, 1},
+		{0x2B05, 0x2B07, 1}, {0x2B1B, 0x2B1C, 1}, {0x2B50, 0x2B50, 1}, {0x2B55, 0x2B55, 1},
+		{0x3030, 0x3030, 1}, {0x303D, 0x303D, 1}, {0x3297, 0x3297, 1}, {0x3299, 0x3299, 1},
+	},
+	R32: []unicode.Range32{
+		{0x1F000, 0x1F0FF, 1}, {0x1F10D, 0x1F10F, 1}, {0x1F12F, 0x1F12F, 1}, {0x1F16C, 0x1F171, 1},
+		{0x1F17E, 0x1F17F, 1}, {0x1F18E, 0x1F18E, 1}, {0x1F191, 0x1F19A, 1}, {0x1F1AD, 0x1F1E5, 1},
+		{0x1F201, 0x1F20F, 1}, {0x1F21A, 0x1F21A, 1}, {0x1F22F, 0x1F22F, 1}, {0x1F232, 0x1F23A, 1},
+		{0x1F23C, 0x1F23F, 1}, {0x1F249, 0x1F3FA, 1}, {0x1F400, 0x1F53D, 1}, {0x1F546, 0x1F64F, 1},
+		{0x1F680, 0x1F6FF, 1}, {0x1F774, 0x1F77F, 1}, {0x1F7D5, 0x1F7FF, 1}, {0x1F80C, 0x1F80F, 1},
+		{0x1F848, 0x1F84F, 1}, {0x1F85A, 0x1F85F, 1}, {0x1F888, 0x1F88F, 1}, {0x1F8AE, 0x1F8FF, 1},
+		{0x1F90C, 0x1F93A, 1}, {0x1F93C, 0x1F945, 1}, {0x1F947, 0x1FAFF, 1}, {0x1FC00, 0x1FFFD, 1},
+	},
+	LatinOffset: 2,
+}
+
+// Hangul syllable types: leading consonant, vowel, trailing consonant, and precomposed syllables without and with a
+// trailing consonant
+const (
+	hangulNone = iota
+	hangulL
+	hangulV
+	hangulT
+	hangulLV
+	hangulLVT
+)
+
+func hangulType(r rune) int {
+	switch {
+	case r >= 0x1100 && r <= 0x115F, r >= 0xA960 && r <= 0xA97C:
+		return hangulL
+	case r >= 0x1160 && r <= 0x11A7, r >= 0xD7B0 && r <= 0xD7C6:
+		return hangulV
+	case r >= 0x11A8 && r <= 0x11FF, r >= 0xD7CB && r <= 0xD7FB:
+		return hangulT
+	case r >= 0xAC00 && r <= 0xD7A3:
+		if (r-0xAC00)%28 == 0 {
+			return hangulLV
+		}
+		return hangulLVT
+	}
+	return hangulNone
+}
+
+func joinsHangul(prev, next int) bool {
+	switch prev {
+	case hangulL:
+		return next == hangulL || next == hangulV || next == hangulLV || next == hangulLVT
+	case hangulLV, hangulV:
+		return next == hangulV || next == hangulT
+	case hangulLVT, hangulT:
+		return next == hangulT
+	}
+	return false
+}
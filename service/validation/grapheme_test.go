@@ -0,0 +1,82 @@
+package validation
+
+import "testing"
+
+// TestCountGraphemes checks the characters counted in emoji sequences, flags, combining marks and Hangul, and that
+// symbols which are not emoji don't join with a ZWJ
+func TestCountGraphemes(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want int
+	}{
+		{"empty", "", 0},
+		{"letters", "ab", 2},
+		{"combining mark", "e\u0301", 1},
+		{"combining marks on each letter", "a\u0308o\u0308", 2},
+		{"zero width non-joiner", "a\u200C", 1},
+		{"emoji", "👍", 1},
+		{"two emoji", "👍👍", 2},
+		{"variation selector", "❤\uFE0F", 1},
+		{"skin tone", "👍🏽", 1},
+		{"skin tone then emoji", "👍🏽👍", 2},
+		{"ZWJ family", "👨\u200D👩\u200D👧\u200D👦", 1},
+		{"ZWJ with skin tone", "👩🏽\u200D💻", 1},
+		{"ZWJ with variation selector", "🏳\uFE0F\u200D🌈", 1},
+		{"ZWJ heart on fire", "❤\uFE0F\u200D🔥", 1},
+		{"ZWJ after a letter", "a\u200D👍", 2},
+		{"ZWJ between geometric shapes", "■\u200D■", 2},
+		{"ZWJ between arrows", "⬀\u200D⬀", 2},
+		{"ZWJ between emoji squares", "⬛\u200D⬛", 1},
+		{"keycap", "1\uFE0F\u20E3", 1},
+		{"keycap without variation selector", "#\u20E3", 1},
+		{"two keycaps", "1\uFE0F\u20E32\uFE0F\u20E3", 2},
+		{"flag", "🇮🇹", 1},
+		{"two flags", "🇮🇹🇫🇷", 2},
+		{"flag and a regional indicator", "🇮🇹🇫", 2},
+		{"tag sequence", "🏴\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007F", 1},
+		{"tag sequence then flag", "🏴\U000E0067\U000E0062\U000E0073\U000E0063\U000E0074\U000E007F🇮🇹", 2},
+		{"Hangul syllables", "한국", 2},
+		{"Hangul jamo L V T", "\u1112\u1161\u11AB", 1},
+		{"Hangul jamo L L V", "\u1100\u1100\u1161", 1},
+		{"Hangul LV then T", "\uAC00\u11A8", 1},
+		{"Hangul LVT then V", "\uAC01\u1161", 2},
+		{"Hangul T then L", "\u11A8\u1100", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countGraphemes(tt.s); got != tt.want {
+				t.Errorf("countGraphemes(%+q) = %d, expected %d", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestIsExtendedPictographic checks the edges of the ranges of the property
+func TestIsExtendedPictographic(t *testing.T) {
+	tests := []struct {
+		r    rune
+		want bool
+	}{
+		{'©', true},
+		{'a', false},
+		{'↔', true},
+		{'↚', false},
+		{'■', false},
+		{'▶', true},
+		{'☀', true},
+		{'⬀', false},
+		{'⬛', true},
+		{'⭐', true},
+		{'🇦', false},
+		{'🏻', false},
+		{'🏺', true},
+		{'🐀', true},
+		{'🫠', true},
+	}
+	for _, tt := range tests {
+		if got := isExtendedPictographic(tt.r); got != tt.want {
+			t.Errorf("isExtendedPictographic(%U) = %t, expected %t", tt.r, got, tt.want)
+		}
+	}
+}
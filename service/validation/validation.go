@@ -0,0 +1,196 @@
+/*
+Package validation checks and normalises the content users send: message text, names, reactions and references to
+uploaded files. Text is normalised to Unicode NFC and trimmed, lengths are counted in characters (code points) after
+normalisation, and control characters are rejected, with the bidirectional overrides that can make text display
+differently from what it contains.
+
+Checks return the normalised value, or an *Error naming the field that failed and why, with one of the Code constants.
+*/
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Codes of the Error of a field, stable for clients to match. CodeInvalidFormat is for values that don't have the
+// expected syntax, like dates, and CodeInvalidValue for values that are well-formed but not allowed.
+const (
+	CodeRequired          = "required"
+	CodeTooLong           = "too-long"
+	CodeInvalidEncoding   = "invalid-encoding"
+	CodeControlCharacter  = "control-character"
+	CodeNotSingleGrapheme = "not-single-grapheme"
+	CodeInvalidUpload     = "invalid-upload"
+	CodeInvalidFormat     = "invalid-format"
+	CodeInvalidValue      = "invalid-value"
+)
+
+// Codes returns the codes of the Error of a field, for checking them against the API specification
+func Codes() []string {
+	return []string{
+		CodeRequired,
+		CodeTooLong,
+		CodeInvalidEncoding,
+		CodeControlCharacter,
+		CodeNotSingleGrapheme,
+		CodeInvalidUpload,
+		CodeInvalidFormat,
+		CodeInvalidValue,
+	}
+}
+
+// Error is a field that failed validation
+type Error struct {
+	// Field is the name of the field in the request, like text or poll.options[2]
+	Field   string
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// As returns the *Error wrapped in err, if any
+func As(err error) (*Error, bool) {
+	var vErr *Error
+	if errors.As(err, &vErr) {
+		return vErr, true
+	}
+	return nil, false
+}
+
+func newError(field, code, format string, args ...interface{}) *Error {
+	return &Error{Field: field, Code: code, Message: field + " " + fmt.Sprintf(format, args...)}
+}
+
+// Limits are the maximum lengths of the texts users send, in characters
+type Limits struct {
+	MessageText  int
+	GroupName    int
+	PollQuestion int
+	PollOption   int
+}
+
+// DefaultLimits are the lengths documented in the API specification
+var DefaultLimits = Limits{
+	MessageText:  4096,
+	GroupName:    100,
+	PollQuestion: 300,
+	PollOption:   100,
+}
+
+// WithDefaults returns the limits with the ones not set (zero or negative) taken from DefaultLimits
+func (l Limits) WithDefaults() Limits {
+	if l.MessageText <= 0 {
+		l.MessageText = DefaultLimits.MessageText
+	}
+	if l.GroupName <= 0 {
+		l.GroupName = DefaultLimits.GroupName
+	}
+	if l.PollQuestion <= 0 {
+		l.PollQuestion = DefaultLimits.PollQuestion
+	}
+	if l.PollOption <= 0 {
+		l.PollOption = DefaultLimits.PollOption
+	}
+	return l
+}
+
+// Line validates a required single-line text of at most `max` characters, like a name, and returns it normalised
+func Line(field, s string, max int) (string, error) {
+	return text(field, s, max, false)
+}
+
+// Paragraph validates a required text of at most `max` characters that may span several lines, like a message, and
+// returns it normalised. Line breaks are normalised to \n; tabs are allowed.
+func Paragraph(field, s string, max int) (string, error) {
+	return text(field, s, max, true)
+}
+
+func text(field, s string, max int, multiline bool) (string, error) {
+	if !utf8.ValidString(s) {
+		return "", newError(field, CodeInvalidEncoding, "must be valid UTF-8")
+	}
+	if multiline {
+		s = strings.ReplaceAll(s, "\r\n", "\n")
+	}
+	s = strings.TrimSpace(norm.NFC.String(s))
+	if s == "" {
+		return "", newError(field, CodeRequired, "is required")
+	}
+	for _, r := range s {
+		if isControl(r, multiline) {
+			return "", newError(field, CodeControlCharacter, "must not contain control characters (found U+%04X)", r)
+		}
+	}
+	if n := utf8.RuneCountInString(s); n > max {
+		return "", newError(field, CodeTooLong, "must be at most %d characters, not %d", max, n)
+	}
+	return s, nil
+}
+
+// isControl reports whether a rune is not allowed in text: control characters other than line breaks and tabs in
+// multiline text, bidirectional embeddings, overrides and isolates, the byte order mark, and noncharacters
+func isControl(r rune, multiline bool) bool {
+	switch {
+	case r == '\n' || r == '\t':
+		return !multiline
+	case r == '\u2028' || r == '\u2029':
+		return !multiline
+	case unicode.Is(unicode.Cc, r):
+		return true
+	case r >= '\u202A' && r <= '\u202E', r >= '\u2066' && r <= '\u2069', r == '\uFEFF':
+		return true
+	case r >= '\uFDD0' && r <= '\uFDEF', r&0xFFFE == 0xFFFE:
+		return true
+	}
+	return false
+}
+
+// Grapheme validates a required single user-perceived character, like the emoji of a reaction, and returns it
+// normalised. Emoji sequences with skin tones, joiners, keycaps, flags and tags are a single character.
+func Grapheme(field, s string) (string, error) {
+	if !utf8.ValidString(s) {
+		return "", newError(field, CodeInvalidEncoding, "must be valid UTF-8")
+	}
+	s = norm.NFC.String(s)
+	if s == "" {
+		return "", newError(field, CodeRequired, "is required")
+	}
+	for _, r := range s {
+		if isControl(r, false) || unicode.IsSpace(r) {
+			return "", newError(field, CodeControlCharacter, "must not contain control characters or spaces")
+		}
+	}
+	if n := countGraphemes(s); n != 1 {
+		return "", newError(field, CodeNotSingleGrapheme, "must be a single character or emoji, not %d", n)
+	}
+	return s, nil
+}
+
+// UploadPath validates a reference to a file the server stored under the URL path `dir`, like
+// /uploads/messages/ID, and returns the name of the file. The file itself is not checked.
+func UploadPath(field, url, dir string) (string, error) {
+	dir = strings.TrimSuffix(dir, "/") + "/"
+	name, ok := strings.CutPrefix(url, dir)
+	if !ok || name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\?#") || path.Clean(url) != url {
+		return "", newError(field, CodeInvalidUpload, "must be a file uploaded to %s", dir)
+	}
+	if !utf8.ValidString(name) {
+		return "", newError(field, CodeInvalidEncoding, "must be valid UTF-8")
+	}
+	for _, r := range name {
+		if isControl(r, false) {
+			return "", newError(field, CodeInvalidUpload, "must be a file uploaded to %s", dir)
+		}
+	}
+	return name, nil
+}
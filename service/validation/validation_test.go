@@ -0,0 +1,107 @@
+package validation
+
+import "testing"
+
+// check is a call to a check of the package, with the value expected back or the code of the Error
+type check struct {
+	name string
+	call func() (string, error)
+	want string
+	code string
+}
+
+func runChecks(t *testing.T, checks []check) {
+	t.Helper()
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := c.call()
+			if c.code == "" {
+				if err != nil || got != c.want {
+					t.Errorf("got %+q, %v, expected %+q", got, err, c.want)
+				}
+				return
+			}
+			if vErr, ok := As(err); !ok || vErr.Code != c.code {
+				t.Errorf("got %+q, %v, expected a %s error", got, err, c.code)
+			}
+		})
+	}
+}
+
+// TestText checks the normalisation of texts, their length counted after it, and the characters they may not contain
+func TestText(t *testing.T) {
+	line := func(s string, max int) func() (string, error) {
+		return func() (string, error) { return Line("name", s, max) }
+	}
+	paragraph := func(s string, max int) func() (string, error) {
+		return func() (string, error) { return Paragraph("text", s, max) }
+	}
+	runChecks(t, []check{
+		{"trimmed", line("  Alice \t", 10), "Alice", ""},
+		{"NFC", line("Cafe\u0301", 10), "Caf\u00E9", ""},
+		{"length after NFC", line("e\u0301", 1), "\u00E9", ""},
+		{"length in characters", line("日本語", 3), "日本語", ""},
+		{"too long", line("abcd", 3), "", CodeTooLong},
+		{"empty", line("", 10), "", CodeRequired},
+		{"only spaces", line(" \n ", 10), "", CodeRequired},
+		{"invalid UTF-8", line("a\xffb", 10), "", CodeInvalidEncoding},
+		{"line break in a line", line("a\nb", 10), "", CodeControlCharacter},
+		{"tab in a line", line("a\tb", 10), "", CodeControlCharacter},
+		{"line separator in a line", line("a\u2028b", 10), "", CodeControlCharacter},
+		{"bell", line("a\u0007b", 10), "", CodeControlCharacter},
+		{"right-to-left override", line("a\u202Eb", 10), "", CodeControlCharacter},
+		{"isolate", line("a\u2066b", 10), "", CodeControlCharacter},
+		{"byte order mark", line("a\uFEFFb", 10), "", CodeControlCharacter},
+		{"noncharacter", line("a\uFDD0b", 10), "", CodeControlCharacter},
+		{"noncharacter at the end of a plane", line("a\U0001FFFEb", 10), "", CodeControlCharacter},
+		{"zero width joiner", line("👩\u200D💻", 10), "👩\u200D💻", ""},
+		{"line breaks", paragraph("a\r\nb\nc", 10), "a\nb\nc", ""},
+		{"tab", paragraph("a\tb", 10), "a\tb", ""},
+		{"line separator", paragraph("a\u2028b", 10), "a\u2028b", ""},
+		{"carriage return alone", paragraph("a\rb", 10), "", CodeControlCharacter},
+		{"line break counted", paragraph("ab\r\ncd", 5), "ab\ncd", ""},
+		{"paragraph too long", paragraph("ab\ncd", 4), "", CodeTooLong},
+	})
+}
+
+// TestGrapheme checks that a single character or emoji sequence is accepted, normalised, and nothing else
+func TestGrapheme(t *testing.T) {
+	grapheme := func(s string) func() (string, error) {
+		return func() (string, error) { return Grapheme("emoji", s) }
+	}
+	runChecks(t, []check{
+		{"emoji", grapheme("👍"), "👍", ""},
+		{"letter", grapheme("a"), "a", ""},
+		{"NFC", grapheme("e\u0301"), "\u00E9", ""},
+		{"ZWJ family", grapheme("👨\u200D👩\u200D👧"), "👨\u200D👩\u200D👧", ""},
+		{"keycap", grapheme("1\uFE0F\u20E3"), "1\uFE0F\u20E3", ""},
+		{"flag", grapheme("🇮🇹"), "🇮🇹", ""},
+		{"empty", grapheme(""), "", CodeRequired},
+		{"invalid UTF-8", grapheme("\xff"), "", CodeInvalidEncoding},
+		{"space", grapheme("👍 "), "", CodeControlCharacter},
+		{"control character", grapheme("👍\u202E"), "", CodeControlCharacter},
+		{"two emoji", grapheme("👍👍"), "", CodeNotSingleGrapheme},
+		{"two flags", grapheme("🇮🇹🇫🇷"), "", CodeNotSingleGrapheme},
+		{"symbols joined", grapheme("■\u200D■"), "", CodeNotSingleGrapheme},
+	})
+}
+
+// TestUploadPath checks that only the names of files directly under the directory are accepted
+func TestUploadPath(t *testing.T) {
+	upload := func(url string) func() (string, error) {
+		return func() (string, error) { return UploadPath("photoUrl", url, "/uploads/messages") }
+	}
+	runChecks(t, []check{
+		{"file", upload("/uploads/messages/abc.png"), "abc.png", ""},
+		{"other directory", upload("/uploads/users/abc.png"), "", CodeInvalidUpload},
+		{"directory itself", upload("/uploads/messages/"), "", CodeInvalidUpload},
+		{"subdirectory", upload("/uploads/messages/a/b.png"), "", CodeInvalidUpload},
+		{"parent", upload("/uploads/messages/.."), "", CodeInvalidUpload},
+		{"traversal", upload("/uploads/messages/../users/abc.png"), "", CodeInvalidUpload},
+		{"backslash", upload("/uploads/messages/a\\b.png"), "", CodeInvalidUpload},
+		{"query", upload("/uploads/messages/abc.png?x=1"), "", CodeInvalidUpload},
+		{"absolute URL", upload("https://example.com/uploads/messages/abc.png"), "", CodeInvalidUpload},
+		{"control character", upload("/uploads/messages/a\u0000.png"), "", CodeInvalidUpload},
+		{"invalid UTF-8", upload("/uploads/messages/a\xff.png"), "", CodeInvalidEncoding},
+	})
+}
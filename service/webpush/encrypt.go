@@ -0,0 +1,108 @@
+package webpush
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+const (
+	saltSize     = 16
+	authSize     = 16
+	publicSize   = 65 // uncompressed P-256 point
+	recordSize   = 4096
+	headerSize   = saltSize + 4 + 1 + publicSize
+	paddingDelim = 0x02 // marks the last (and only) record
+
+	// recordOverhead is the size of the header, the delimiter and the AES-GCM tag
+	recordOverhead = headerSize + 1 + 16
+)
+
+// subscriptionKeys are the decoded keys of a Subscription
+type subscriptionKeys struct {
+	public *ecdh.PublicKey
+	auth   []byte
+}
+
+// decodeBase64URL accepts base64url with or without padding, as browsers are not consistent
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func parseSubscriptionKeys(sub Subscription) (subscriptionKeys, error) {
+	p256dh, err := decodeBase64URL(sub.P256dh)
+	if err != nil {
+		return subscriptionKeys{}, errors.New("p256dh must be base64url")
+	}
+	public, err := ecdh.P256().NewPublicKey(p256dh)
+	if err != nil {
+		return subscriptionKeys{}, errors.New("p256dh must be a P-256 public key")
+	}
+	auth, err := decodeBase64URL(sub.Auth)
+	if err != nil || len(auth) != authSize {
+		return subscriptionKeys{}, errors.New("auth must be 16 bytes in base64url")
+	}
+	return subscriptionKeys{public: public, auth: auth}, nil
+}
+
+// encrypt encrypts `payload` for a subscription with the aes128gcm content encoding, as a single record, following
+// RFC 8291: a key shared with the browser is derived from a new ECDH key pair and the authentication secret.
+func encrypt(payload []byte, keys subscriptionKeys) ([]byte, error) {
+	serverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := serverKey.ECDH(keys.public)
+	if err != nil {
+		return nil, err
+	}
+	serverPublic := serverKey.PublicKey().Bytes()
+
+	keyInfo := "WebPush: info\x00" + string(keys.public.Bytes()) + string(serverPublic)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, keys.auth, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, headerSize, headerSize+len(payload)+1+gcm.Overhead())
+	copy(body, salt)
+	binary.BigEndian.PutUint32(body[saltSize:], recordSize)
+	body[saltSize+4] = publicSize
+	copy(body[saltSize+5:], serverPublic)
+
+	plaintext := append(append([]byte{}, payload...), paddingDelim)
+	return gcm.Seal(body, nonce, plaintext, nil), nil
+}
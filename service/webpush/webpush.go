@@ -0,0 +1,159 @@
+/*
+Package webpush sends Web Push notifications: messages encrypted for a browser push subscription (RFC 8291), posted
+to the push service of the browser with a VAPID signature identifying this server (RFC 8292).
+
+Push service endpoints come from the clients, so a Sender only connects to public addresses, unless others are
+explicitly allowed (see netguard).
+*/
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ozberk-sevinc/wasa-project/service/netguard"
+)
+
+const (
+	// DefaultTTL is how long push services keep a notification for an offline browser
+	DefaultTTL = 24 * time.Hour
+
+	// MaxPayloadSize is the largest payload that fits in a push message once encrypted
+	MaxPayloadSize = 4096 - recordOverhead
+
+	requestTimeout = 10 * time.Second
+)
+
+// ErrGone is returned by Send when the push service says the subscription no longer exists. It should be deleted.
+var ErrGone = errors.New("push subscription gone")
+
+// Subscription is a browser push subscription, as given by PushSubscription.toJSON()
+type Subscription struct {
+	Endpoint string
+	P256dh   string // public key of the browser, base64url
+	Auth     string // authentication secret, base64url
+}
+
+// Config configures a Sender
+type Config struct {
+	// Key is the VAPID key of this server (see LoadOrCreateKey)
+	Key *ecdsa.PrivateKey
+
+	// Subject is a mailto: or https: URL push services can use to contact the operator of this server
+	Subject string
+
+	// AllowedNetworks are networks the Sender may connect to even though they are not public, for instance
+	// 127.0.0.0/8 for a local push service
+	AllowedNetworks []netip.Prefix
+}
+
+// Sender sends push notifications. It is safe for concurrent use.
+type Sender struct {
+	cfg    Config
+	client *http.Client
+}
+
+// NewSender returns a Sender using `cfg`
+func NewSender(cfg Config) (*Sender, error) {
+	if cfg.Key == nil {
+		return nil, errors.New("VAPID key is required")
+	}
+	if cfg.Subject == "" {
+		return nil, errors.New("VAPID subject is required")
+	}
+	dialer := &net.Dialer{
+		Timeout: requestTimeout,
+		Control: netguard.Control(cfg.AllowedNetworks),
+	}
+	return &Sender{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: requestTimeout,
+			Transport: &http.Transport{
+				Proxy:       nil,
+				DialContext: dialer.DialContext,
+			},
+			// Push services answer directly; a redirect could lead anywhere
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}, nil
+}
+
+// PublicKey returns the VAPID public key of the Sender, which browsers need to subscribe (applicationServerKey)
+func (s *Sender) PublicKey() string {
+	return PublicKey(s.cfg.Key)
+}
+
+// ValidateSubscription checks that a subscription can be used by Send
+func ValidateSubscription(sub Subscription) error {
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("endpoint must be an http or https URL")
+	}
+	if _, err := parseSubscriptionKeys(sub); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Send encrypts `payload` for `sub` and posts it to its push service. Payloads larger than MaxPayloadSize are
+// refused. ErrGone is returned for subscriptions that no longer exist.
+func (s *Sender) Send(ctx context.Context, sub Subscription, payload []byte, ttl time.Duration) error {
+	if len(payload) > MaxPayloadSize {
+		return fmt.Errorf("payload too large: %d bytes", len(payload))
+	}
+	keys, err := parseSubscriptionKeys(sub)
+	if err != nil {
+		return err
+	}
+	body, err := encrypt(payload, keys)
+	if err != nil {
+		return fmt.Errorf("encrypting payload: %w", err)
+	}
+
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+	authorization, err := vapidAuthorization(s.cfg.Key, s.cfg.Subject, endpoint, time.Now())
+	if err != nil {
+		return fmt.Errorf("signing VAPID token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	req.Header.Set("Urgency", "normal")
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("push service answered %s", resp.Status)
+	}
+	return nil
+}
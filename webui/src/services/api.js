@@ -29,6 +29,17 @@ api.interceptors.response.use(
 			localStorage.removeItem("wasatext_user");
 			window.location.href = "/login";
 		}
+		// Error codes are stable (see the Error schema), messages are not: match on error.code
+		const body = error.response?.data;
+		if (body && typeof body === "object") {
+			error.code = body.code;
+			error.details = body.details || [];
+			error.requestId = body.requestId;
+		}
+		// Rate limited: tell the caller how many seconds to wait
+		if (error.response?.status === 429) {
+			error.retryAfter = Number(error.response.headers["retry-after"]) || undefined;
+		}
 		return Promise.reject(error);
 	}
 );
@@ -55,6 +66,25 @@ export const userAPI = {
 			headers: { "Content-Type": "multipart/form-data" },
 		});
 	},
+	// email is where digests are sent; null removes it
+	setEmail: (email) => api.put("/me/email", { email }),
+	deleteMe: () => api.delete("/me"),
+	requestExport: () => api.post("/me/export"),
+	getExport: (exportId) => api.get(`/me/export/${exportId}`),
+	downloadExport: (exportId) => api.get(`/me/export/${exportId}/download`, { responseType: "blob" }),
+	getStarred: ({ limit, cursor } = {}) => api.get("/me/starred", { params: { limit, cursor } }),
+	getMentions: ({ limit, cursor } = {}) => api.get("/me/mentions", { params: { limit, cursor } }),
+	reorderPinnedConversations: (conversationIds) => api.put("/me/pinned-conversations", { conversationIds }),
+	getPreferences: () => api.get("/me/preferences"),
+	updatePreferences: (preferences) => api.put("/me/preferences", preferences),
+	getVapidPublicKey: () => api.get("/push/vapid-public-key"),
+	getPushSubscriptions: () => api.get("/me/push-subscriptions"),
+	// subscription is a browser PushSubscription; toJSON() gives the endpoint and keys
+	subscribePush: (subscription) => api.post("/me/push-subscriptions", subscription.toJSON ? subscription.toJSON() : subscription),
+	unsubscribePush: (subscriptionId) => api.delete(`/me/push-subscriptions/${subscriptionId}`),
+	getBlocks: () => api.get("/me/blocks"),
+	block: (userId) => api.post(`/me/blocks/${userId}`),
+	unblock: (userId) => api.delete(`/me/blocks/${userId}`),
 	searchUsers: (query = "") => api.get(`/users${query ? `?q=${encodeURIComponent(query)}` : ""}`),
 };
 
@@ -63,9 +93,37 @@ export const userAPI = {
 // ============================================================================
 
 export const conversationAPI = {
-	getAll: () => api.get("/conversations"),
+	// sort is "pinned" (pinned conversations first) or "recent"
+	getAll: ({ archived, sort } = {}) => api.get("/conversations", { params: { archived, sort } }),
 	getById: (id) => api.get(`/conversations/${id}`),
 	create: (userId) => api.post("/conversations", { userId }),
+	getSettings: (id) => api.get(`/conversations/${id}/settings`),
+	updateSettings: (id, settings) => api.put(`/conversations/${id}/settings`, settings),
+	// timer in seconds (0 turns disappearing messages off); from is "sent" or "read"
+	setDisappearing: (id, timer, from = "sent") =>
+		api.put(`/conversations/${id}/settings`, { disappearingTimer: timer, disappearingFrom: from }),
+	archive: (id) => api.put(`/conversations/${id}/archive`),
+	unarchive: (id) => api.delete(`/conversations/${id}/archive`),
+	pin: (id) => api.put(`/conversations/${id}/pin`),
+	unpin: (id) => api.delete(`/conversations/${id}/pin`),
+	// until is a date-time; without it the conversation stays muted until unmuted
+	mute: (id, until) => api.put(`/conversations/${id}/mute`, until ? { until } : {}),
+	unmute: (id) => api.delete(`/conversations/${id}/mute`),
+	markUnread: (id) => api.put(`/conversations/${id}/unread`),
+	clearUnread: (id) => api.delete(`/conversations/${id}/unread`),
+	export: (id, { format = "json", media = "link" } = {}) =>
+		api.get(`/conversations/${id}/export`, { params: { format, media }, responseType: "blob" }),
+	import: (id, file, { format, dateOrder, timezone, senders } = {}) => {
+		const formData = new FormData();
+		formData.append("file", file);
+		if (format) formData.append("format", format);
+		if (dateOrder) formData.append("dateOrder", dateOrder);
+		if (timezone) formData.append("timezone", timezone);
+		if (senders) formData.append("senders", JSON.stringify(senders));
+		return api.post(`/conversations/${id}/import`, formData, {
+			headers: { "Content-Type": "multipart/form-data" },
+		});
+	},
 };
 
 // ============================================================================
@@ -80,12 +138,13 @@ export const messageAPI = {
 			headers: { "Content-Type": "multipart/form-data" },
 		});
 	},
-	send: (conversationId, { contentType, text, photoUrl, replyToMessageId }) =>
+	send: (conversationId, { contentType, text, photoUrl, replyToMessageId, poll }) =>
 		api.post(`/conversations/${conversationId}/messages`, {
 			contentType,
 			text,
 			photoUrl,
 			replyToMessageId,
+			poll,
 		}),
 	delete: (conversationId, messageId) =>
 		api.delete(`/conversations/${conversationId}/messages/${messageId}`),
@@ -97,6 +156,49 @@ export const messageAPI = {
 		api.post(`/conversations/${conversationId}/messages/${messageId}/comments`, { emoji }),
 	removeReaction: (conversationId, messageId, reactionId) =>
 		api.delete(`/conversations/${conversationId}/messages/${messageId}/comments/${reactionId}`),
+	star: (conversationId, messageId) => api.put(`/conversations/${conversationId}/messages/${messageId}/star`),
+	unstar: (conversationId, messageId) => api.delete(`/conversations/${conversationId}/messages/${messageId}/star`),
+	pin: (conversationId, messageId) => api.put(`/conversations/${conversationId}/messages/${messageId}/pin`),
+	unpin: (conversationId, messageId) => api.delete(`/conversations/${conversationId}/messages/${messageId}/pin`),
+	getThread: (conversationId, messageId) =>
+		api.get(`/conversations/${conversationId}/messages/${messageId}/thread`),
+	listReactions: (conversationId, messageId, emoji = "") =>
+		api.get(
+			`/conversations/${conversationId}/messages/${messageId}/reactions${emoji ? `?emoji=${encodeURIComponent(emoji)}` : ""}`,
+		),
+	vote: (conversationId, messageId, optionId) =>
+		api.put(`/conversations/${conversationId}/messages/${messageId}/poll/votes/${optionId}`),
+	unvote: (conversationId, messageId, optionId) =>
+		api.delete(`/conversations/${conversationId}/messages/${messageId}/poll/votes/${optionId}`),
+};
+
+// ============================================================================
+// SCHEDULED MESSAGE API
+// ============================================================================
+
+export const scheduledMessageAPI = {
+	list: (conversationId) => api.get(`/conversations/${conversationId}/scheduled-messages`),
+	// message is the body of messageAPI.send; sendAt an ISO 8601 date-time in the future
+	create: (conversationId, message, sendAt) =>
+		api.post(`/conversations/${conversationId}/scheduled-messages`, { ...message, sendAt }),
+	update: (conversationId, scheduledMessageId, message, sendAt) =>
+		api.put(`/conversations/${conversationId}/scheduled-messages/${scheduledMessageId}`, { ...message, sendAt }),
+	cancel: (conversationId, scheduledMessageId) =>
+		api.delete(`/conversations/${conversationId}/scheduled-messages/${scheduledMessageId}`),
+};
+
+// ============================================================================
+// COMMAND API
+// ============================================================================
+
+export const commandAPI = {
+	list: (conversationId, prefix = "") =>
+		api.get(`/conversations/${conversationId}/commands${prefix ? `?prefix=${encodeURIComponent(prefix)}` : ""}`),
+	register: (conversationId, name, { description, usage }) =>
+		api.put(`/conversations/${conversationId}/commands/${name}`, { description, usage }),
+	unregister: (conversationId, name) => api.delete(`/conversations/${conversationId}/commands/${name}`),
+	reply: (conversationId, invocationId, { text, ephemeral = false }) =>
+		api.post(`/conversations/${conversationId}/command-invocations/${invocationId}/reply`, { text, ephemeral }),
 };
 
 // ============================================================================
@@ -118,4 +220,36 @@ export const groupAPI = {
 	},
 };
 
+// ============================================================================
+// REPORT API
+// ============================================================================
+
+export const reportAPI = {
+	// reason is one of spam, harassment, inappropriate, impersonation or other
+	reportMessage: (conversationId, messageId, reason, details) =>
+		api.post("/reports", { type: "message", conversationId, messageId, reason, details }),
+	reportUser: (userId, reason, details) => api.post("/reports", { type: "user", userId, reason, details }),
+};
+
+// ============================================================================
+// ADMIN API (server admins only, see /me isAdmin)
+// ============================================================================
+
+export const adminAPI = {
+	getUsers: ({ q, status, limit, cursor } = {}) => api.get("/admin/users", { params: { q, status, limit, cursor } }),
+	getUser: (userId) => api.get(`/admin/users/${userId}`),
+	// status is active, suspended or banned; suspendedUntil (ISO date-time) only with suspended
+	setUserStatus: (userId, status, { suspendedUntil, reason } = {}) =>
+		api.put(`/admin/users/${userId}/status`, { status, suspendedUntil, reason }),
+	getReports: ({ status, userId, limit, cursor } = {}) =>
+		api.get("/admin/reports", { params: { status, userId, limit, cursor } }),
+	getReport: (reportId) => api.get(`/admin/reports/${reportId}`),
+	// status is open, resolved or dismissed
+	reviewReport: (reportId, status) => api.put(`/admin/reports/${reportId}/status`, { status }),
+	deleteMessage: (conversationId, messageId) => api.delete(`/admin/conversations/${conversationId}/messages/${messageId}`),
+	dissolveGroup: (groupId) => api.delete(`/admin/groups/${groupId}`),
+	getStats: () => api.get("/admin/stats"),
+	getAuditLog: ({ limit, cursor } = {}) => api.get("/admin/audit-log", { params: { limit, cursor } }),
+};
+
 export default api;